@@ -2,6 +2,7 @@
 package merkledag
 
 import (
+	"encoding/binary"
 	"fmt"
 	"os"
 	"sync"
@@ -20,15 +21,9 @@ var NumThread = 64 * 8
 func init() {
 	PinBuffer = make(map[cid.Cid]*TierCid)
 	PinBufferMutex = &sync.Mutex{}
+	UnPinBuffer = make(map[cid.Cid]*TierCid)
+	UnPinBufferMutex = &sync.Mutex{}
 }
-// var IPFS_Path = "/home/mssong/.ipfs"
-// var IPFS_Path = "/mnt/nvme0n1/.ipfs"
-
-// var IPFS_Path = "/root/.ipfs"
-// var IPFS_DownloadPath = "/root/ipfs_client"
-
-var IPFS_Path = "/root/ipfs_server/.ipfs"
-var IPFS_DownloadPath = "/root/ipfs_server" //md0
 
 type TierCid struct {
 	NonLeaf []cid.Cid
@@ -51,6 +46,32 @@ func NewTierCid() *TierCid {
 	return tc
 }
 
+// tierCidVersion is the first byte of every encoded TierCid.
+const tierCidVersion = 1
+
+// Marshal encodes the TierCid as a version byte followed by the NonLeaf and
+// Leaf lists, each one prefixed by its length. This is the encoding IPFS
+// daemons decode when a TierCid is installed.
+func (tc *TierCid) Marshal() []byte {
+	buf := make([]byte, 0, 1+(len(tc.NonLeaf)+len(tc.Leaf))*40)
+	buf = append(buf, tierCidVersion)
+	for _, list := range [][]cid.Cid{tc.NonLeaf, tc.Leaf} {
+		buf = appendUvarint(buf, uint64(len(list)))
+		for _, c := range list {
+			b := c.Bytes()
+			buf = appendUvarint(buf, uint64(len(b)))
+			buf = append(buf, b...)
+		}
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
 func PrintPinBuffer(cid cid.Cid) {
 	tc := PinBuffer[cid]
 	fmt.Println("----------Print PinBuffer(CID: %s)\n----------", cid.String())
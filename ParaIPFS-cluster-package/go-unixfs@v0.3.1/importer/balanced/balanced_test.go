@@ -3,10 +3,13 @@ package balanced
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	mrand "math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	h "github.com/ipfs/go-unixfs/importer/helpers"
@@ -32,7 +35,7 @@ func buildTestDag(ds ipld.DAGService, spl chunker.Splitter) (*dag.ProtoNode, err
 		return nil, err
 	}
 
-	nd, err := Layout(db)
+	nd, err := Layout(db, "")
 	if err != nil {
 		return nil, err
 	}
@@ -337,3 +340,126 @@ func TestSeekingConsistency(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestParallelLayout checks that the parallel layout, reading a file of
+// several leaves from its path, and the streamed layout build the same DAG
+// as the sequential one, and record its leaves in the PinBuffer.
+func TestParallelLayout(t *testing.T) {
+	defer func(links, n int) {
+		ChildLinkCount, dag.NumThread = links, n
+	}(ChildLinkCount, dag.NumThread)
+	ChildLinkCount = 3
+	dag.NumThread = 4
+
+	// Eleven leaves, the last one partial, on three levels.
+	data := make([]byte, 10*ChunkSize+1000)
+	u.NewTimeSeededRand().Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ds := mdtest.Mock()
+	build := func(path string, concurrency int) ipld.Node {
+		dbp := h.DagBuilderParams{
+			Dagserv:     ds,
+			Maxlinks:    ChildLinkCount,
+			Concurrency: concurrency,
+		}
+		db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), ChunkSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nd, err := Layout(db, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	tierCid := func(nd ipld.Node, layout string) *dag.TierCid {
+		dag.PinBufferMutex.Lock()
+		tc, ok := dag.PinBuffer[nd.Cid()]
+		delete(dag.PinBuffer, nd.Cid())
+		dag.PinBufferMutex.Unlock()
+		if !ok {
+			t.Fatalf("%s layout recorded no TierCid for %s", layout, nd.Cid())
+		}
+		if len(tc.Leaf) != 11 {
+			t.Fatalf("%s layout recorded %d leaves, expected 11", layout, len(tc.Leaf))
+		}
+		// Four parents of the leaves and two nodes above them.
+		if len(tc.NonLeaf) != 6 {
+			t.Fatalf("%s layout recorded %d internal nodes, expected 6", layout, len(tc.NonLeaf))
+		}
+		return tc
+	}
+
+	seq := build("", 1)
+	par := build(path, 0)
+	parTc := tierCid(par, "parallel")
+	stream := build("", 4)
+	streamTc := tierCid(stream, "streamed")
+	if !seq.Cid().Equals(par.Cid()) {
+		t.Fatalf("sequential root %s, parallel root %s", seq.Cid(), par.Cid())
+	}
+	if !seq.Cid().Equals(stream.Cid()) {
+		t.Fatalf("sequential root %s, streamed root %s", seq.Cid(), stream.Cid())
+	}
+
+	for i := range parTc.NonLeaf {
+		if !parTc.NonLeaf[i].Equals(streamTc.NonLeaf[i]) {
+			t.Fatalf("internal node %d: parallel %s, streamed %s", i, parTc.NonLeaf[i], streamTc.NonLeaf[i])
+		}
+	}
+	// The internal nodes are listed depth first.
+	first, err := dag.DecodeProtobuf(par.RawData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Links()[0].Cid.Equals(parTc.NonLeaf[0]) {
+		t.Fatalf("first internal node %s, expected %s", parTc.NonLeaf[0], first.Links()[0].Cid)
+	}
+
+	r, err := uio.NewDagReader(context.Background(), par, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagrArrComp(t, r, data)
+
+	// A file missing from its path fails the add.
+	if _, err := Layout(nil, filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Fatalf("expected the missing file to fail the add, got %v", err)
+	}
+}
+
+// failingDAGService fails to add every node of the parallel layout.
+type failingDAGService struct {
+	ipld.DAGService
+}
+
+var errFailedAdd = errors.New("failed add")
+
+func (failingDAGService) Add_mansub(context.Context, ipld.Node) error {
+	return errFailedAdd
+}
+
+func TestParallelLayoutAddError(t *testing.T) {
+	data := make([]byte, 4*ChunkSize)
+	u.NewTimeSeededRand().Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbp := h.DagBuilderParams{
+		Dagserv:  failingDAGService{mdtest.Mock()},
+		Maxlinks: ChildLinkCount,
+	}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), ChunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Layout(db, path); err != errFailedAdd {
+		t.Fatalf("expected the failed add to fail the layout, got %v", err)
+	}
+}
@@ -53,19 +53,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"path/filepath"
-	"sync"
-	"time"
 
 	ft "github.com/ipfs/go-unixfs"
 	h "github.com/ipfs/go-unixfs/importer/helpers"
+	"golang.org/x/sync/errgroup"
 
-	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
-	"github.com/ipfs/go-datastore"
-	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	ipld "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
 	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
@@ -77,76 +71,73 @@ var ChildLinkCount = 174
 
 // var NumThread = 32
 
-// var IPFS_Path = "/home/mssong/.ipfs"
-
-// var IPFS_Path = "/mnt/nvme0n1/.ipfs"
-
-func encode(key datastore.Key) (dirPath, fileName string) {
-	// dir: /home/mssong/.ipfs/blocks/7P path: /home/mssong/.ipfs/blocks/7P/CIQKGXY65BAIM2G5C64GRJOK2SGPDAXNG5VGHVHW7KFQ3PFFF5YH7PI.data
-	extension := ".data"
-	noslash := key.String()[1:]
-	// datastorePath := "/home/mssong/.ipfs/blocks"
-	datastorePath := merkledag.IPFS_Path + "/blocks"
-
-	dirPath = filepath.Join(datastorePath, noslash[len(noslash)-3:len(noslash)-1])
-	fileName = noslash + extension
-	return dirPath, fileName
-}
-
-func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, childNode []ipld.Node, childFileSize []uint64, lastChildIdx int, newFileNonLeaf *[]cid.Cid) (ipld.Node, uint64, error) {
-	// fmt.Println("@@@makeDAG")
-	wg := sync.WaitGroup{}
-
+// makeDAG builds the nodes of `level` out of the nodes of the level below,
+// `childNode`, `ChildLinkCount` children per node, and then the levels above
+// it up to the root, which it returns. The nodes of a level are built at
+// once, and the first error stops the build. The CIDs of every level are
+// appended to `levels`, in order, once all of its nodes are built.
+func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, childNode []ipld.Node, childFileSize []uint64, lastChildIdx int, levels *[][]cid.Cid) (ipld.Node, uint64, error) {
 	filledNode := make([]ipld.Node, depthNodeCount[level])
 	nodeFileSize := make([]uint64, depthNodeCount[level])
+
+	eg, ctx := errgroup.WithContext(db.Context())
 	for i := 0; i < depthNodeCount[level]; i++ {
-		// fmt.Println("depthNodeCount[level]:", depthNodeCount[level])
-		// fmt.Println("len(childNode):",len(childNode))
-		// fmt.Println("len(childFileSize):",len(childFileSize))
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			node := db.NewFSNodeOverDag(ft.TFile)
-			for idx := i * ChildLinkCount; idx < (i+1)*ChildLinkCount; idx++ {
-				if i == depthNodeCount[level]-1 && idx > lastChildIdx {
-					break
-				}
-				st1 := time.Now()
-				// fmt.Println("i=", i, "idx =", idx)
-				err := node.AddChild_mansub(childNode[idx], childFileSize[idx], db, level)
-				elap1 := time.Since(st1)
-				elap1 = elap1
-				// fmt.Println("elap1:", elap1)
+		i := i
+		eg.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-				if err != nil {
-					panic("mssong - err := node.AddChild(childNode[idx], childFileSize[idx], db)")
-				}
-				nodeFileSize[i] = node.FileSize()
-				filledNode[i], err = node.Commit()
-				// fmt.Printf("newFileNonLeaf_0:%#v\n", newFileNonLeaf)
-				if err != nil {
-					panic("mssong - filledNode[i], err = node.Commit()")
+			node := db.NewFSNodeOverDag(ft.TFile)
+			for idx := i * ChildLinkCount; idx < (i+1)*ChildLinkCount && idx <= lastChildIdx; idx++ {
+				if err := node.AddChild_mansub(childNode[idx], childFileSize[idx], db, level); err != nil {
+					return err
 				}
 			}
-			// mssong_Todo: 에러나니깐 일단 주석
-			// mutex := sync.Mutex{}
-			// mutex.Lock()
-			// filledNode[i] 만들어지는 순서가 i순서에 맞지 않음
-			// *newFileNonLeaf = append(*newFileNonLeaf, filledNode[i].Cid())
-			// fmt.Println("newFileNonLeaf:", filledNode[i])
-			// mutex.Unlock()
-			// 일단 주석
-
-		}(i)
+			nodeFileSize[i] = node.FileSize()
+			var err error
+			filledNode[i], err = node.Commit()
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, 0, err
 	}
-	wg.Wait()
+
+	levelCids := make([]cid.Cid, len(filledNode))
+	for i, nd := range filledNode {
+		levelCids[i] = nd.Cid()
+	}
+	*levels = append(*levels, levelCids)
 
 	if level+1 == len(depthNodeCount) {
 		return filledNode[0], nodeFileSize[0], nil
 	}
-	fn, nfs, err := makeDAG(db, level+1, depthNodeCount, filledNode, nodeFileSize, depthNodeCount[level]-1, newFileNonLeaf)
-	return fn, nfs, err
+	return makeDAG(db, level+1, depthNodeCount, filledNode, nodeFileSize, depthNodeCount[level]-1, levels)
+}
+
+// nonLeafOrder lists the internal nodes of a balanced DAG with `maxlinks`
+// children per node, given the CIDs of each of its levels from the parents
+// of the leaves up to the root. They are listed depth first, in the order a
+// reader visits them, without the root.
+func nonLeafOrder(levels [][]cid.Cid, maxlinks int) []cid.Cid {
+	if len(levels) == 0 {
+		return nil
+	}
 
+	var nonLeaf []cid.Cid
+	var visit func(level, idx int)
+	visit = func(level, idx int) {
+		nonLeaf = append(nonLeaf, levels[level][idx])
+		if level == 0 {
+			return
+		}
+		for child := idx * maxlinks; child < (idx+1)*maxlinks && child < len(levels[level-1]); child++ {
+			visit(level-1, child)
+		}
+	}
+	visit(len(levels)-1, 0)
+	return nonLeaf[1:]
 }
 
 // Layout builds a balanced DAG layout. In a balanced DAG of depth 1, leaf nodes
@@ -163,6 +154,14 @@ func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, chil
 // depth of the DAG. The process is repeated until there is no more data to add
 // (i.e. the DagBuilderHelper’s Done() function returns true).
 //
+// When `fileAbsPath` names the file being added the DAG is built from it
+// directly by `parallelLayout`; otherwise, unless `db.Concurrency()` is 1,
+// the Splitter is consumed by the pipelined `streamLayout`. Both produce
+// the same DAG as the sequential process described below. Callers only pass
+// the path of a local file they opened themselves (see
+// `files.ReaderFile.LocalFile`), never one a client claims to have read its
+// data from.
+//
 // The nodes are filled recursively, so the DAG is built from the bottom up. Leaf
 // nodes are created first using the chunked file data and its size. The size is
 // then bubbled up to the parent (internal) node, which aggregates all the sizes of
@@ -221,246 +220,152 @@ func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, chil
 //        +=========+   +=========+   + - - - - +
 //
 func Layout(db *h.DagBuilderHelper, fileAbsPath string) (ipld.Node, error) {
-	// fmt.Println("fileAbsPath:", fileAbsPath)
-	var newFileLeaf []cid.Cid
-	optFlag := true
+	if fileAbsPath != "" {
+		root, ok, err := parallelLayout(db, fileAbsPath)
+		if err != nil || ok {
+			return root, err
+		}
+	}
 
-	if fileAbsPath != "" && optFlag {
-		st := time.Now()
-		depthNodeCount := make([]int, 1)
+	if !db.Done() && db.Concurrency() > 1 {
+		return streamLayout(db)
+	}
 
-		fileInfo, err := os.Stat(fileAbsPath)
+	if db.Done() {
+		// No data, return just an empty node.
+		root, err := db.NewLeafNode(nil, ft.TFile)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		// fmt.Println("exist:", fileAbsPath)
+		// This works without Filestore support (`ProcessFileStore`).
+		// TODO: Why? Is there a test case missing?
 
-		fileSize := fileInfo.Size()
-		// fmt.Println("fileSize:", fileSize)
-		var levelNodeCount int
-		if fileSize%ChunkSize != 0 {
-			levelNodeCount = int(fileSize/ChunkSize) + 1
-		} else {
-			levelNodeCount = int(fileSize / ChunkSize)
-		}
-		depthNodeCount[0] = levelNodeCount //leaf node
+		return root, db.Add(root)
+	}
 
-		var root ipld.Node
-		if levelNodeCount == 1 { // only one leaf node == root node
-			root, _, err := db.NewLeafDataNode(ft.TFile)
-			if err != nil {
-				return nil, err
-			}
-			return root, db.Add(root)
-		}
+	// The first `root` will be a single leaf node with data
+	// (corner case), after that subsequent `root` nodes will
+	// always be internal nodes (with a depth > 0) that can
+	// be handled by the loop.
+	root, fileSize, err := db.NewLeafDataNode(ft.TFile)
+	if err != nil {
+		return nil, err
+	}
 
-		// fmt.Println("levelNodeCount:", len(depthNodeCount), levelNodeCount)
-
-		// depthNodeCount = NPD node
-		for {
-			childLinks := int64(ChildLinkCount)
-			if int(fileSize%childLinks) != 0 {
-				levelNodeCount = levelNodeCount/int(childLinks) + 1
-				// fmt.Println("levelNodeCount:", len(depthNodeCount), levelNodeCount)
-				if levelNodeCount == 1 {
-					depthNodeCount = append(depthNodeCount, 1) //root node
-					break
-				}
-			} else {
-				levelNodeCount = levelNodeCount / int(childLinks)
-				// fmt.Println("levelNodeCount:", len(depthNodeCount), levelNodeCount)
-			}
-			depthNodeCount = append(depthNodeCount, levelNodeCount)
-		}
+	// Each time a DAG of a certain `depth` is filled (because it
+	// has reached its maximum capacity of `db.Maxlinks()` per node)
+	// extend it by making it a sub-DAG of a bigger DAG with `depth+1`.
+	for depth := 1; !db.Done(); depth++ {
 
-		leafNode := make([]ipld.Node, depthNodeCount[0])
-		leafFileSize := make([]uint64, depthNodeCount[0])
+		// Add the old `root` as a child of the `newRoot`.
+		newRoot := db.NewFSNodeOverDag(ft.TFile)
+		newRoot.AddChild(root, fileSize, db)
 
-		newFileLeaf = make([]cid.Cid, depthNodeCount[0])
+		// Fill the `newRoot` (that has the old `root` already as child)
+		// and make it the current `root` for the next iteration (when
+		// it will become "old").
+		root, fileSize, err = fillNodeRec(db, newRoot, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Println("root CID:", root.Cid())
+	return root, db.Add(root)
+}
 
-		var numTh int
-		var size int
-		if merkledag.NumThread == 1 {
-			size = depthNodeCount[0]
-		} else {
+// parallelLayout builds the DAG of the file at `fileAbsPath` straight from
+// the file, reading and storing its leaves in up to `merkledag.NumThread`
+// groups at once, and records its TierCid in `merkledag.PinBuffer`. The
+// first error stops the build. `ok` is false, and nothing has been read
+// from the Splitter, when the file fits in a single leaf and has to be built
+// sequentially instead.
+func parallelLayout(db *h.DagBuilderHelper, fileAbsPath string) (root ipld.Node, ok bool, err error) {
+	f, err := os.Open(fileAbsPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
 
-			size = depthNodeCount[0] / (merkledag.NumThread - 1)
-		}
-		if size == 0 || size == 1 {
-			if size == 0 {
-				size = 1
-			}
-			numTh = depthNodeCount[0]
-		} else {
-			numTh = depthNodeCount[0] / size
-			if depthNodeCount[0]%size != 0 {
-				numTh = numTh + 1
-			}
-		}
-		// fmt.Println("numTh:", numTh, "depthNodeCount[0]:", depthNodeCount[0], "size:", size)
-		var wg sync.WaitGroup
+	leaves := int((fileInfo.Size() + ChunkSize - 1) / ChunkSize)
+	if leaves < 2 {
+		return nil, false, nil
+	}
 
-		tempPath := merkledag.IPFS_Path + "/blocks/temp"
-		os.Mkdir(tempPath, 0755)
+	// Number of nodes on each level of the DAG, from the leaves up to
+	// the root.
+	depthNodeCount := []int{leaves}
+	for n := leaves; n > 1; {
+		n = (n + ChildLinkCount - 1) / ChildLinkCount
+		depthNodeCount = append(depthNodeCount, n)
+	}
 
-		for i := 0; i < numTh; i++ {
-			wg.Add(1)
+	// The leaves are built in groups of `size` consecutive leaves.
+	size := leaves
+	if merkledag.NumThread > 1 {
+		size = leaves / (merkledag.NumThread - 1)
+	}
+	if size < 1 {
+		size = 1
+	}
+	groups := (leaves + size - 1) / size
+
+	leafNode := make([]ipld.Node, leaves)
+	leafFileSize := make([]uint64, leaves)
+	eg, ctx := errgroup.WithContext(db.Context())
+	for g := 0; g < groups; g++ {
+		g := g
+		eg.Go(func() error {
+			buf := make([]byte, ChunkSize)
+			for idx := g * size; idx < (g+1)*size && idx < leaves; idx++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 
-			go func(i int) {
-				defer wg.Done()
-				f, err := os.Open(fileAbsPath)
-				if err != nil {
-					panic(err)
+				offset := int64(idx) * ChunkSize
+				n, err := f.ReadAt(buf, offset)
+				if err != nil && !(err == io.EOF && n > 0) {
+					return err
 				}
-				offset := int64(i) * int64(size) * ChunkSize
-				f.Seek(offset, 0)
-				full := make([]byte, int64(size)*ChunkSize)
-				n, err := io.ReadFull(f, full)
-				if err == io.ErrUnexpectedEOF {
-					small := make([]byte, n)
-					copy(small, full)
-					full = small
+				// The leaf keeps its data, so it must not share buf.
+				data := make([]byte, n)
+				copy(data, buf[:n])
+
+				leafNode[idx], leafFileSize[idx], err = db.NewLeafDataNode_mansub(data, uint64(offset), ft.TFile)
+				if err != nil {
+					return err
 				}
-				idx := i * size
-				fileDataSize := len(full)
-				count := fileDataSize / int(ChunkSize)
-				if count == 0 {
-					var err error
-					leafNode[idx], leafFileSize[idx], err = db.NewLeafDataNode_mansub(full, ft.TFile)
-					if err != nil {
-						log.Fatal("mssong: leafNode[i], leafFileSize[i], err = db.NewLeafDataNode_mansub(ft.TFile, fileCidIdx)")
-					}
-
-					newFileLeaf[idx] = leafNode[idx].Cid()
-					db.Add_mansub(leafNode[idx])
-
-					// err = db.Add(leafNode[idx])
-					// if err != nil {
-					// 	panic(err)
-					// }
-				} else {
-					if fileDataSize%int(ChunkSize) != 0 {
-						count = count + 1
-					}
-
-					for j := 0; j < count; j++ {
-						start := j * int(ChunkSize)
-						end := (j + 1) * int(ChunkSize)
-						if end >= fileDataSize {
-							end = fileDataSize
-						}
-						var err error
-						leafNode[idx+j], leafFileSize[idx+j], err = db.NewLeafDataNode_mansub(full[start:end], ft.TFile)
-						if err != nil {
-							log.Fatal("mssong: leafNode[i], leafFileSize[i], err = db.NewLeafDataNode_mansub(ft.TFile, fileCidIdx)")
-						}
-
-						newFileLeaf[idx+j] = leafNode[idx+j].Cid()
-
-						db.Add_mansub(leafNode[idx+j])
-						// err = db.Add(leafNode[idx+j])
-						/////////////////////////////
-						dsKey := dshelp.MultihashToDsKey(newFileLeaf[idx+j].Hash())
-						dirPath, fileName := encode(dsKey)
-						os.Mkdir(dirPath, 0755)
-						filePath := dirPath + "/" + fileName
-						f, err := os.Create(filePath)
-						if err != nil {
-							panic(err)
-						}
-						// tempFile := tempPath + fileName
-						// // tmpFileName := "temp-" + fileName
-						// f, err := os.Create(tempFile)
-						// if err != nil {
-						// 	panic(err)
-						// }
-						var blk blocks.Block
-						blk = leafNode[idx+j]
-						f.Write(blk.RawData())
-						f.Sync()
-						/////////////////////////////
-						if err != nil {
-							panic(err)
-						}
-					}
+				if err := db.AddLeaf_mansub(leafNode[idx], g); err != nil {
+					return err
 				}
-
-			}(i)
-		}
-		wg.Wait()
-
-		newFileNonLeaf := make([]cid.Cid, 0)
-		st_1 := time.Now()
-		st_1 = st_1
-		root, _, err = makeDAG(db, 1, depthNodeCount, leafNode, leafFileSize, depthNodeCount[0]-1, &newFileNonLeaf)
-		// fmt.Println("makeDag elap:", time.Since(st_1))
-		// dagCid := merkledag.NewTierCid()
-		// dagCid.NonLeaf = append(dagCid.NonLeaf, newFileNonLeaf...)
-		// dagCid.Leaf = append(dagCid.Leaf, newFileLeaf...)
-		// merkledag.PinBuffer[root.Cid()] = dagCid
-		// fmt.Println("newFileNonLeaf:", len(newFileNonLeaf), "leaf:", len(newFileLeaf))
-
-		dagCid := merkledag.NewTierCid()
-		dagCid.NonLeaf = append(dagCid.NonLeaf, newFileNonLeaf...)
-		dagCid.Leaf = append(dagCid.Leaf, newFileLeaf...)
-		//mssong_Todo: 일단 주석
-		// fmt.Printf("PinBuffer:%#v\n", merkledag.PinBuffer)
-		// fmt.Printf("dagCid:%#v\n", dagCid)
-		merkledag.PinBufferMutex.Lock()
-		merkledag.PinBuffer[root.Cid()] = dagCid
-		merkledag.PinBufferMutex.Unlock()
-		//mssong_Todo: 일단 주석
-
-		// merkledag.PrintPinBuffer(root.Cid())
-		// fmt.Println("root CID:", root.Cid())
-		elap := time.Since(st)
-		elap = elap
-		// fmt.Println("layout elap:", elap)
-		return root, db.Add(root)
-		// panic("good game")
-	} else {
-		if db.Done() {
-			// No data, return just an empty node.
-			root, err := db.NewLeafNode(nil, ft.TFile)
-			if err != nil {
-				return nil, err
+				db.Chunked(n)
 			}
-			// This works without Filestore support (`ProcessFileStore`).
-			// TODO: Why? Is there a test case missing?
-
-			return root, db.Add(root)
-		}
-
-		// The first `root` will be a single leaf node with data
-		// (corner case), after that subsequent `root` nodes will
-		// always be internal nodes (with a depth > 0) that can
-		// be handled by the loop.
-		root, fileSize, err := db.NewLeafDataNode(ft.TFile)
-		if err != nil {
-			return nil, err
-		}
-
-		// Each time a DAG of a certain `depth` is filled (because it
-		// has reached its maximum capacity of `db.Maxlinks()` per node)
-		// extend it by making it a sub-DAG of a bigger DAG with `depth+1`.
-		for depth := 1; !db.Done(); depth++ {
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, false, err
+	}
 
-			// Add the old `root` as a child of the `newRoot`.
-			newRoot := db.NewFSNodeOverDag(ft.TFile)
-			newRoot.AddChild(root, fileSize, db)
+	var levels [][]cid.Cid
+	root, _, err = makeDAG(db, 1, depthNodeCount, leafNode, leafFileSize, leaves-1, &levels)
+	if err != nil {
+		return nil, false, err
+	}
 
-			// Fill the `newRoot` (that has the old `root` already as child)
-			// and make it the current `root` for the next iteration (when
-			// it will become "old").
-			root, fileSize, err = fillNodeRec(db, newRoot, depth)
-			if err != nil {
-				return nil, err
-			}
-		}
-		fmt.Println("root CID:", root.Cid())
-		return root, db.Add(root)
+	dagCid := merkledag.NewTierCid()
+	dagCid.NonLeaf = append(dagCid.NonLeaf, nonLeafOrder(levels, ChildLinkCount)...)
+	for _, nd := range leafNode {
+		dagCid.Leaf = append(dagCid.Leaf, nd.Cid())
 	}
+	merkledag.PinBufferMutex.Lock()
+	merkledag.PinBuffer[root.Cid()] = dagCid
+	merkledag.PinBufferMutex.Unlock()
 
+	return root, true, db.Add(root)
 }
 
 // fillNodeRec will "fill" the given internal (non-leaf) `node` with data by
@@ -44,6 +44,11 @@ type DagBuilderHelper struct {
 	// is not reused to construct another DAG, but a new one (with a
 	// zero `offset`) is created.
 	offset uint64
+
+	chunked func(int)
+
+	ctx     context.Context
+	workers int
 }
 
 // DagBuilderParams wraps configuration options to create a DagBuilderHelper
@@ -65,6 +70,20 @@ type DagBuilderParams struct {
 	// NoCopy signals to the chunker that it should track fileinfo for
 	// filestore adds
 	NoCopy bool
+
+	// Chunked is called with the size of the data of every leaf the
+	// parallel balanced layout reads from the file itself, bypassing the
+	// chunker. It may be called concurrently.
+	Chunked func(int)
+
+	// Concurrency is the number of workers the parallel layouts build and
+	// store leaves with. Defaults to merkledag.NumThread.
+	Concurrency int
+
+	// Ctx is the context the blocks are written under. Cancelling it makes
+	// the layout stop and return its error. Defaults to
+	// context.Background().
+	Ctx context.Context
 }
 
 // New generates a new DagBuilderHelper from the given params and a given
@@ -76,6 +95,15 @@ func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error
 		rawLeaves:  dbp.RawLeaves,
 		cidBuilder: dbp.CidBuilder,
 		maxlinks:   dbp.Maxlinks,
+		chunked:    dbp.Chunked,
+		ctx:        dbp.Ctx,
+		workers:    dbp.Concurrency,
+	}
+	if db.ctx == nil {
+		db.ctx = context.Background()
+	}
+	if db.workers < 1 {
+		db.workers = dag.NumThread
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
@@ -133,6 +161,16 @@ func (db *DagBuilderHelper) GetDagServ() ipld.DAGService {
 	return db.dserv
 }
 
+// Context returns the context the blocks are written under.
+func (db *DagBuilderHelper) Context() context.Context {
+	return db.ctx
+}
+
+// Concurrency returns the number of workers the parallel layouts use.
+func (db *DagBuilderHelper) Concurrency() int {
+	return db.workers
+}
+
 // GetCidBuilder returns the internal `cid.CidBuilder` set in the builder.
 func (db *DagBuilderHelper) GetCidBuilder() cid.Builder {
 	return db.cidBuilder
@@ -222,20 +260,20 @@ func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node i
 	return node, dataSize, nil
 }
 
-func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
-	// debug.PrintStack()
-
+// NewLeafDataNode_mansub builds a leaf node out of fileData, a chunk read
+// directly from the file at offset instead of from the Splitter, so that
+// leaves can be built out of order by the parallel layouts.
+func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, offset uint64, fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
 	dataSize = uint64(len(fileData))
 
 	// Create a new leaf node containing the file chunk data.
 	node, err = db.NewLeafNode(fileData, fsNodeType)
-
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Convert this leaf to a `FilestoreNode` if needed.
-	node = db.ProcessFileStore(node, dataSize)
+	node = db.processFileStoreAt(node, offset)
 
 	return node, dataSize, nil
 }
@@ -249,24 +287,30 @@ func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, fsNodeType p
 // `NewLeafDataNode` is called, both work in tandem but the
 // offset is more related to this function).
 func (db *DagBuilderHelper) ProcessFileStore(node ipld.Node, dataSize uint64) ipld.Node {
+	fn := db.processFileStoreAt(node, db.offset)
+	if fn != node {
+		// Update `offset` with the size of the data generated by `db.Next`.
+		db.offset += dataSize
+	}
+	return fn
+}
+
+// processFileStoreAt is ProcessFileStore for a chunk found at `offset` in
+// the file. It does not touch `db.offset`.
+func (db *DagBuilderHelper) processFileStoreAt(node ipld.Node, offset uint64) ipld.Node {
 	// Check if Filestore is being used.
 	if db.fullPath != "" {
 		// Check if the node is actually a raw node (needed for
 		// Filestore support).
 		if _, ok := node.(*dag.RawNode); ok {
-			fn := &pi.FilestoreNode{
+			return &pi.FilestoreNode{
 				Node: node,
 				PosInfo: &pi.PosInfo{
-					Offset:   db.offset,
+					Offset:   offset,
 					FullPath: db.fullPath,
 					Stat:     db.stat,
 				},
 			}
-
-			// Update `offset` with the size of the data generated by `db.Next`.
-			db.offset += dataSize
-
-			return fn
 		}
 	}
 
@@ -276,12 +320,12 @@ func (db *DagBuilderHelper) ProcessFileStore(node ipld.Node, dataSize uint64) ip
 
 // Add inserts the given node in the DAGService.
 func (db *DagBuilderHelper) Add(node ipld.Node) error {
-	return db.dserv.Add(context.TODO(), node)
+	return db.dserv.Add(db.ctx, node)
 }
 
 // Add inserts the given node in the DAGService.
 func (db *DagBuilderHelper) Add_mansub(node ipld.Node) error {
-	return db.dserv.Add_mansub(context.TODO(), node)
+	return db.dserv.Add_mansub(db.ctx, node)
 }
 
 // Maxlinks returns the configured maximum number for links
@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"context"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+type leafGroupKey struct{}
+
+// WithLeafGroup returns a context carrying the leaf group of the nodes added
+// with it. The parallel balanced layout builds the leaves of a file in
+// groups of consecutive leaves, each in its own goroutine, and tells the
+// DAGService which group a leaf belongs to this way.
+func WithLeafGroup(ctx context.Context, group int) context.Context {
+	return context.WithValue(ctx, leafGroupKey{}, group)
+}
+
+// LeafGroup returns the leaf group set by WithLeafGroup, if any.
+func LeafGroup(ctx context.Context) (int, bool) {
+	group, ok := ctx.Value(leafGroupKey{}).(int)
+	return group, ok
+}
+
+// AddLeaf_mansub inserts the given leaf of the given leaf group in the
+// DAGService.
+func (db *DagBuilderHelper) AddLeaf_mansub(node ipld.Node, group int) error {
+	return db.dserv.Add_mansub(WithLeafGroup(db.ctx, group), node)
+}
+
+// AddLeaf inserts the given leaf, which belongs to no leaf group, in the
+// DAGService. The streamed balanced layout adds its leaves this way.
+func (db *DagBuilderHelper) AddLeaf(node ipld.Node) error {
+	return db.dserv.Add_mansub(db.ctx, node)
+}
+
+// Chunked reports n bytes of the file read into a leaf by the parallel
+// layout to the Chunked function of the DagBuilderParams, if any.
+func (db *DagBuilderHelper) Chunked(n int) {
+	if db.chunked != nil {
+		db.chunked(n)
+	}
+}
@@ -4,17 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"sync"
 	"time"
 
 	proto "github.com/gogo/protobuf/proto"
-	"github.com/ipfs/go-datastore"
-	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
 	unixfs "github.com/ipfs/go-unixfs"
@@ -287,15 +281,6 @@ func (dr *dagReader) writeNodeDataBuffer(w io.Writer) (int64, error) {
 }
 
 ///////////////////////////////////// wrriten by mssong
-func encode(key datastore.Key) (file string) {
-	extension := ".data"
-	noslash := key.String()[1:]
-	datastorePath := merkledag.IPFS_Path + "/blocks"
-
-	dir := filepath.Join(datastorePath, noslash[len(noslash)-3:len(noslash)-1])
-	file = filepath.Join(dir, noslash+extension)
-	return file
-}
 
 // UnwrapData unmarshals a protobuf messages and returns the contents.
 func UnwrapData(data []byte) ([]byte, error) {
@@ -307,134 +292,60 @@ func UnwrapData(data []byte) ([]byte, error) {
 	return pbdata.GetData(), nil
 }
 
-func createFile(f *os.File, tc *merkledag.TierCid) (size int64, err error) {
-	wg := sync.WaitGroup{}
-	rawData := make([][]byte, len(tc.Leaf))
-	// ff, err := os.Create("/home/mssong/zzzzzzz")
-	for i := 0; i < len(tc.Leaf); i++ {
-		wg.Add(1)
-		go func(i int) {
-
-			defer wg.Done()
-			leafCid := tc.Leaf[i]
-			dsKey := dshelp.MultihashToDsKey(leafCid.Hash())
-			// fmt.Println("dsKey:", dsKey.String())
-			filePath := encode(dsKey)
-			// fmt.Println("filePath:", filePath)
-			dat, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				panic(err)
-			}
-
-			// fmt.Println("filePath:", filePath, "data len:", len(dat))
-
-			node, err := merkledag.DecodeProtobuf(dat)
-			if err != nil {
-				panic(err)
-			}
-
-			rawData[i], err = UnwrapData(node.Data())
-
-			if err != nil {
-				panic(err)
-			}
-
-		}(i)
-
-	}
-	wg.Wait()
-
-	st_1 := time.Now()
-	for i := 0; i < len(rawData); i++ {
-
-		f.Write(rawData[i])
-	}
-	elap_1 := time.Since(st_1)
-	elap_1 = elap_1
-	// fmt.Println("elap_1:", elap_1)
-
-	fileInfo, err := f.Stat()
-	if err != nil {
-		panic(err)
+// leafData returns the file data held by a leaf node.
+func leafData(nd ipld.Node) ([]byte, error) {
+	switch nd := nd.(type) {
+	case *merkledag.RawNode:
+		return nd.RawData(), nil
+	case *merkledag.ProtoNode:
+		return UnwrapData(nd.Data())
+	default:
+		return nil, ErrUnkownNodeType
 	}
-	return fileInfo.Size(), nil
 }
 
-func createFile_2(f *os.File, tc *merkledag.TierCid) (size int64, err error) {
-	wg := sync.WaitGroup{}
-	len_leaf := len(tc.Leaf)
-	rawData := make([][]byte, len_leaf)
-	// fmt.Println("len_leaf:", len_leaf)
-	count := len_leaf / merkledag.NumThread
-	if len_leaf%merkledag.NumThread != 0 {
-		count = count + 1
-	}
-	// fmt.Println("count: ", count)
-	var cc = 0
-	// var mutex sync.RWMutex
-	for i := 0; i < merkledag.NumThread; i++ {
-		if len_leaf <= i {
-			// fmt.Println("i: ", i)
-			break
+// writeLeaves writes the data of `leaves` to `w`, in order. The leaves are
+// fetched from the reader's NodeGetter, `merkledag.NumThread` at a time.
+func (dr *dagReader) writeLeaves(w io.Writer, leaves []cid.Cid) (n int64, err error) {
+	for start := 0; start < len(leaves); start += merkledag.NumThread {
+		end := start + merkledag.NumThread
+		if end > len(leaves) {
+			end = len(leaves)
 		}
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < count; j++ {
-				interval := (i * count) + j
-				if interval >= len_leaf {
-					break
-				}
-				cc++
-				// fmt.Println("interval, i, j", interval, i, j, cc, count)
-				leafCid := tc.Leaf[interval]
-				dsKey := dshelp.MultihashToDsKey(leafCid.Hash())
-				// fmt.Println("dsKey:", dsKey.String())
-				filePath := encode(dsKey)
-				// fmt.Println("filePath:", filePath)
-				dat, err := ioutil.ReadFile(filePath)
-				// fmt.Println("filePath:", filePath, "data len:", len(dat))
-				if err != nil {
-					panic(err)
-				}
-				if dat == nil {
-					fmt.Println("data is nil")
-					continue
-				}
-				node, err := merkledag.DecodeProtobuf(dat)
-				if err != nil {
-					panic(err)
-				}
+		batch := leaves[start:end]
 
-				rawData[interval], err = UnwrapData(node.Data())
-				if err != nil {
-					panic(err)
-				}
-				// mutex.Lock()
-				// f.WriteAt(rawData[interval], int64(interval*256*1024))
-				// mutex.Unlock()
+		// The same leaf can appear several times in a file.
+		pos := make(map[cid.Cid][]int, len(batch))
+		for i, c := range batch {
+			pos[c] = append(pos[c], i)
+		}
+		nodes := make([]ipld.Node, len(batch))
+		for opt := range dr.serv.GetMany(dr.ctx, batch) {
+			if opt.Err != nil {
+				return n, opt.Err
 			}
+			for _, i := range pos[opt.Node.Cid()] {
+				nodes[i] = opt.Node
+			}
+		}
 
-		}(i)
-
-	}
-	wg.Wait()
-
-	// fmt.Println("len_leaf:", len_leaf)
-	st_1 := time.Now()
-	for i := 0; i < len(rawData); i++ {
-
-		f.Write(rawData[i])
-	}
-	elap_1 := time.Since(st_1)
-	elap_1 = elap_1
-	// fmt.Println("elap_1:", elap_1)
-
-	fileInfo, err := f.Stat()
-	if err != nil {
-		panic(err)
+		for i, nd := range nodes {
+			if nd == nil {
+				return n, ipld.ErrNotFound{Cid: batch[i]}
+			}
+			data, err := leafData(nd)
+			if err != nil {
+				return n, err
+			}
+			written, err := w.Write(data)
+			n += int64(written)
+			dr.offset += int64(written)
+			if err != nil {
+				return n, err
+			}
+		}
 	}
-	return fileInfo.Size(), nil
+	return n, nil
 }
 
 ///////////////////////////////////// wrriten by mssong
@@ -453,6 +364,9 @@ func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 
 	dr.dagWalker.SetContext(dr.ctx)
 
+	// Only a traversal of the whole DAG gives its TierCid.
+	fromStart := dr.offset == 0 && dr.currentNodeData == nil
+
 	// If there was a partially read buffer from the last visited
 	// node read it before visiting a new one.
 	if dr.currentNodeData != nil {
@@ -463,93 +377,77 @@ func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 	}
 
 	st := time.Now()
-	tc_Pin, exist_Pin := merkledag.PinBuffer[dr.rootNode.Cid()]
-	tc_UnPin, exist_Unpin := merkledag.UnPinBuffer[dr.rootNode.Cid()]
-
-	tc_Pin = tc_Pin
-	tc_UnPin = tc_UnPin
-
-	// f, err := os.Create("/home/mssong/ipfsGetData")
-
-	fileName := merkledag.IPFS_DownloadPath + "/" + dr.rootNode.Cid().String()
-	_, err = os.Stat(fileName)
-	if err == nil {
-		fmt.Println("exist file! cluster", fileName)
-
-		return 0, nil
-	}
 
-	f, err := os.Create(fileName)
-	if err != nil {
-		panic(err)
+	// The recorded TierCid lists the leaves of the whole file.
+	if fromStart {
+		merkledag.PinBufferMutex.Lock()
+		tc, ok := merkledag.PinBuffer[dr.rootNode.Cid()]
+		merkledag.PinBufferMutex.Unlock()
+		if !ok {
+			merkledag.UnPinBufferMutex.Lock()
+			tc, ok = merkledag.UnPinBuffer[dr.rootNode.Cid()]
+			merkledag.UnPinBufferMutex.Unlock()
+		}
+		if ok && len(tc.Leaf) > 0 {
+			return dr.writeLeaves(w, tc.Leaf)
+		}
 	}
-	defer f.Close()
-
-	if exist_Pin {
-		fmt.Println("exist pin!")
-
-		n, err = createFile_2(f, tc_Pin)
-	} else if exist_Unpin {
-		fmt.Println("exist unpin!")
 
-		n, err = createFile_2(f, tc_UnPin)
-	} else {
-		dagCid := merkledag.NewTierCid()
-		//////////////////////////////////////////////////////////////////////////////////////////////////
+	dagCid := merkledag.NewTierCid()
+	//////////////////////////////////////////////////////////////////////////////////////////////////
 
-		// Iterate the DAG calling the passed `Visitor` function on every node
-		// to read its data into the `out` buffer, stop if there is an error or
-		// if the entire DAG is traversed (`EndOfDag`).
-		err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
-			// debug.PrintStack()
-			node := ipld.ExtractIPLDNode(visitedNode)
-			// fmt.Printf("%v: Iterate node cid:%s\n", time.Now(), node.Cid())
-			// time.Sleep(3 * time.Second)
-			// fmt.Println("nodes:%#v", node)
-			// Skip internal nodes, they shouldn't have any file data
-			// (see the `balanced` package for more details).
-			if len(node.Links()) > 0 {
-				// fmt.Println("rootNode.Cid():", dr.rootNode.Cid())
-				dagCid.NonLeaf = append(dagCid.NonLeaf, node.Cid())
-				return nil
-			}
+	// Iterate the DAG calling the passed `Visitor` function on every node
+	// to read its data into the `out` buffer, stop if there is an error or
+	// if the entire DAG is traversed (`EndOfDag`).
+	err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
+		// debug.PrintStack()
+		node := ipld.ExtractIPLDNode(visitedNode)
+		// fmt.Printf("%v: Iterate node cid:%s\n", time.Now(), node.Cid())
+		// time.Sleep(3 * time.Second)
+		// fmt.Println("nodes:%#v", node)
+		// Skip internal nodes, they shouldn't have any file data
+		// (see the `balanced` package for more details).
+		if len(node.Links()) > 0 {
+			// fmt.Println("rootNode.Cid():", dr.rootNode.Cid())
+			dagCid.NonLeaf = append(dagCid.NonLeaf, node.Cid())
+			return nil
+		}
 
-			dagCid.Leaf = append(dagCid.Leaf, node.Cid())
+		dagCid.Leaf = append(dagCid.Leaf, node.Cid())
 
-			// fmt.Println("Iterate node Cid:", node.Cid())
-			// fmt.Printf("node:%T\n", node)
-			// time.Sleep(5 * time.Second)
-			err = dr.saveNodeData(node)
-			if err != nil {
-				return err
-			}
+		// fmt.Println("Iterate node Cid:", node.Cid())
+		// fmt.Printf("node:%T\n", node)
+		// time.Sleep(5 * time.Second)
+		err = dr.saveNodeData(node)
+		if err != nil {
+			return err
+		}
 
-			////////////////////////////////////////////////////////////////////////////////////////////////////////////
-			// Save the leaf node file data in a buffer in case it is only
-			// partially read now and future `CtxReadFull` calls reclaim the
-			// rest (as each node is visited only once during `Iterate`).
-			written, err := dr.writeNodeDataBuffer(w)
-			n += written
-			if err != nil {
-				return err
-			}
-			////////////////////////////////////////////////////////////////////////////////////////////////////////////
+		////////////////////////////////////////////////////////////////////////////////////////////////////////////
+		// Save the leaf node file data in a buffer in case it is only
+		// partially read now and future `CtxReadFull` calls reclaim the
+		// rest (as each node is visited only once during `Iterate`).
+		written, err := dr.writeNodeDataBuffer(w)
+		n += written
+		if err != nil {
+			return err
+		}
+		////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-			return nil
-		})
-		merkledag.UnPinBuffer[dr.rootNode.Cid()] = dagCid
-		// merkledag.PrintUnPinBuffer(dr.rootNode.Cid())
-		elap := time.Since(st)
-		elap = elap
-		// fmt.Println("writeTo elap:", elap)
-		//////////////////////////////////////////////////////////////////////////////////////////////////
+		return nil
+	})
+	// merkledag.PrintUnPinBuffer(dr.rootNode.Cid())
+	//////////////////////////////////////////////////////////////////////////////////////////////////
 
-		// fmt.Printf("merkledag.UnpinnedCidMap:%+v\n", merkledag.UnpinnedCidMap)
+	// fmt.Printf("merkledag.UnpinnedCidMap:%+v\n", merkledag.UnpinnedCidMap)
 
-		if err == ipld.EndOfDag {
-			return n, nil
+	if err == ipld.EndOfDag {
+		if fromStart {
+			merkledag.UnPinBufferMutex.Lock()
+			merkledag.UnPinBuffer[dr.rootNode.Cid()] = dagCid
+			merkledag.UnPinBufferMutex.Unlock()
 		}
-
+		return n, nil
 	}
 	elap := time.Since(st)
 	elap = elap
@@ -9,6 +9,8 @@ import (
 	"io"
 	"mime/multipart"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/ipfs/go-unixfs"
 	"github.com/ipfs/ipfs-cluster/adder/ipfsadd"
@@ -48,12 +50,70 @@ type ClusterDAGService interface {
 	Allocations() []peer.ID
 }
 
+// A ClusterDAGService streaming its blocks to their destinations may
+// report how far each of them is. The progress is included in the
+// AddedOutput.
+type progressReporter interface {
+	Progress() []api.AddDestination
+}
+
+func destinations(dgs ClusterDAGService) []api.AddDestination {
+	if pr, ok := dgs.(progressReporter); ok {
+		return pr.Progress()
+	}
+	return nil
+}
+
+// countingDAGService counts the blocks written to a ClusterDAGService.
+type countingDAGService struct {
+	ClusterDAGService
+	blocks uint64
+}
+
+func (dgs *countingDAGService) Add(ctx context.Context, node ipld.Node) error {
+	err := dgs.ClusterDAGService.Add(ctx, node)
+	if err == nil {
+		atomic.AddUint64(&dgs.blocks, 1)
+	}
+	return err
+}
+
+func (dgs *countingDAGService) Add_mansub(ctx context.Context, node ipld.Node) error {
+	err := dgs.ClusterDAGService.Add_mansub(ctx, node)
+	if err == nil {
+		atomic.AddUint64(&dgs.blocks, 1)
+	}
+	return err
+}
+
+func (dgs *countingDAGService) AddMany(ctx context.Context, nodes []ipld.Node) error {
+	err := dgs.ClusterDAGService.AddMany(ctx, nodes)
+	if err == nil {
+		atomic.AddUint64(&dgs.blocks, uint64(len(nodes)))
+	}
+	return err
+}
+
+// progress fills in the blocks written so far and how they are being
+// streamed to their destinations.
+func (dgs *countingDAGService) progress(out *api.AddedOutput) {
+	out.Blocks = atomic.LoadUint64(&dgs.blocks)
+	out.Destinations = destinations(dgs.ClusterDAGService)
+}
+
 // A dagFormatter can create dags from files.Node. It can keep state
 // to add several files to the same dag.
 type dagFormatter interface {
 	Add(name string, f files.Node) (api.Cid, error)
+	// Chunked returns the number of bytes of the added files read so
+	// far.
+	Chunked() uint64
 }
 
+// ProgressInterval is how often an Adder sends progress outputs while
+// adding with the Progress option.
+var ProgressInterval = time.Second
+
 // Adder is used to add content to IPFS Cluster using an implementation of
 // ClusterDAGService.
 type Adder struct {
@@ -128,14 +188,16 @@ func (a *Adder) FromFiles(ctx context.Context, f files.Directory) (api.Cid, erro
 	defer a.cancel()
 	defer close(a.output)
 
+	dgs := &countingDAGService{ClusterDAGService: a.dgs}
+
 	var dagFmtr dagFormatter
 	var err error
 	switch a.params.Format {
 	case "", "unixfs":
-		dagFmtr, err = newIpfsAdder(ctx, a.dgs, a.params, a.output)
+		dagFmtr, err = newIpfsAdder(ctx, dgs, a.params, a.output)
 
 	case "car":
-		dagFmtr, err = newCarAdder(ctx, a.dgs, a.params, a.output)
+		dagFmtr, err = newCarAdder(ctx, dgs, a.params, a.output)
 	default:
 		err = errors.New("bad dag formatter option")
 	}
@@ -143,6 +205,11 @@ func (a *Adder) FromFiles(ctx context.Context, f files.Directory) (api.Cid, erro
 		return api.CidUndef, err
 	}
 
+	if a.params.Progress {
+		stop := a.sendProgress(dagFmtr, dgs)
+		defer stop()
+	}
+
 	// setup wrapping
 	if a.params.Wrap {
 		f = files.NewSliceDirectory(
@@ -185,12 +252,46 @@ func (a *Adder) FromFiles(ctx context.Context, f files.Directory) (api.Cid, erro
 	return clusterRoot, nil
 }
 
+// sendProgress sends a progress output every ProgressInterval until the
+// returned function is called, which sends a last one.
+func (a *Adder) sendProgress(dagFmtr dagFormatter, dgs *countingDAGService) func() {
+	send := func() {
+		out := api.AddedOutput{
+			Chunked: dagFmtr.Chunked(),
+		}
+		dgs.progress(&out)
+		a.output <- out
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		send()
+	}
+}
+
 // A wrapper around the ipfsadd.Adder to satisfy the dagFormatter interface.
 type ipfsAdder struct {
 	*ipfsadd.Adder
 }
 
-func newIpfsAdder(ctx context.Context, dgs ClusterDAGService, params api.AddParams, out chan api.AddedOutput) (*ipfsAdder, error) {
+func newIpfsAdder(ctx context.Context, dgs *countingDAGService, params api.AddParams, out chan api.AddedOutput) (*ipfsAdder, error) {
 	iadder, err := ipfsadd.NewAdder(ctx, dgs, dgs.Allocations)
 	if err != nil {
 		logger.Error(err)
@@ -203,6 +304,7 @@ func newIpfsAdder(ctx context.Context, dgs ClusterDAGService, params api.AddPara
 	iadder.Out = out
 	iadder.Progress = params.Progress
 	iadder.NoCopy = params.NoCopy
+	iadder.ProgressFun = dgs.progress
 
 	// Set up prefi
 	prefix, err := merkledag.PrefixForCidVersion(params.CidVersion)
@@ -252,13 +354,14 @@ func (ia *ipfsAdder) Add(name string, f files.Node) (api.Cid, error) {
 // But for that we would need to keep state and track an MFS root similarly to
 // what the ipfsadder does.
 type carAdder struct {
-	ctx    context.Context
-	dgs    ClusterDAGService
-	params api.AddParams
-	output chan api.AddedOutput
+	ctx     context.Context
+	dgs     *countingDAGService
+	params  api.AddParams
+	output  chan api.AddedOutput
+	chunked uint64
 }
 
-func newCarAdder(ctx context.Context, dgs ClusterDAGService, params api.AddParams, out chan api.AddedOutput) (*carAdder, error) {
+func newCarAdder(ctx context.Context, dgs *countingDAGService, params api.AddParams, out chan api.AddedOutput) (*carAdder, error) {
 	return &carAdder{
 		ctx:    ctx,
 		dgs:    dgs,
@@ -300,6 +403,7 @@ func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 		}
 
 		bytes += uint64(len(block.RawData()))
+		atomic.StoreUint64(&ca.chunked, bytes)
 
 		nd, err := ipld.Decode(block)
 		if err != nil {
@@ -321,13 +425,20 @@ func (ca *carAdder) Add(name string, fn files.Node) (api.Cid, error) {
 		}
 	}
 
-	ca.output <- api.AddedOutput{
+	out := api.AddedOutput{
 		Name:        name,
 		Cid:         api.NewCid(root),
 		Bytes:       bytes,
 		Size:        size,
 		Allocations: ca.dgs.Allocations(),
 	}
+	ca.dgs.progress(&out)
+	ca.output <- out
 
 	return api.NewCid(root), nil
 }
+
+// Chunked returns the number of bytes of blocks read from the CAR file.
+func (ca *carAdder) Chunked() uint64 {
+	return atomic.LoadUint64(&ca.chunked)
+}
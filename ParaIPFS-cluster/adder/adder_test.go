@@ -15,6 +15,7 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
 )
 
 type mockCDAGServ struct {
@@ -36,6 +37,10 @@ func (dag *mockCDAGServ) Allocations() []peer.ID {
 	return nil
 }
 
+func (dag *mockCDAGServ) Add_mansub(ctx context.Context, node ipld.Node) error {
+	return dag.Add(ctx, node)
+}
+
 func TestAdder(t *testing.T) {
 	sth := test.NewShardingTestHelper()
 	defer sth.Clean(t)
@@ -72,6 +77,58 @@ func TestAdder(t *testing.T) {
 	}
 }
 
+func TestAdder_Progress(t *testing.T) {
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+
+	mr, closer := sth.GetTreeMultiReader(t)
+	defer closer.Close()
+	r := multipart.NewReader(mr, mr.Boundary())
+	p := api.DefaultAddParams()
+	p.Progress = true
+
+	dags := newMockCDAGServ()
+	out := make(chan api.AddedOutput, 10)
+	adder := New(dags, p, out)
+
+	var outputs []api.AddedOutput
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for o := range out {
+			outputs = append(outputs, o)
+		}
+	}()
+
+	_, err := adder.FromMultipart(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	fileBytes := make(map[string]uint64)
+	for _, o := range outputs {
+		if !o.Cid.Defined() && o.Name != "" {
+			fileBytes[o.Name] = o.Bytes
+		}
+	}
+	var total uint64
+	for _, b := range fileBytes {
+		total += b
+	}
+
+	last := outputs[len(outputs)-1]
+	if last.Cid.Defined() {
+		t.Fatal("the last output should report the progress")
+	}
+	if total == 0 || last.Chunked != total {
+		t.Errorf("expected %d bytes chunked, got %d", total, last.Chunked)
+	}
+	if last.Blocks < uint64(len(dags.Nodes)) {
+		t.Errorf("expected at least %d blocks written, got %d", len(dags.Nodes), last.Blocks)
+	}
+}
+
 func TestAdder_DoubleStart(t *testing.T) {
 	sth := test.NewShardingTestHelper()
 	defer sth.Clean(t)
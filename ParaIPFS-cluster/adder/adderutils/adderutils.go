@@ -13,6 +13,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/adder/single"
 	"github.com/ipfs/ipfs-cluster/api"
 
+	files "github.com/ipfs/go-ipfs-files"
 	logging "github.com/ipfs/go-log/v2"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
@@ -22,7 +23,8 @@ var logger = logging.Logger("adder")
 // AddMultipartHTTPHandler is a helper function to add content
 // uploaded using a multipart request. The outputTransform parameter
 // allows to customize the http response output format to something
-// else than api.AddedOutput objects.
+// else than api.AddedOutput objects, and to leave outputs out by
+// returning nil.
 func AddMultipartHTTPHandler(
 	ctx context.Context,
 	rpc *rpc.Client,
@@ -30,6 +32,35 @@ func AddMultipartHTTPHandler(
 	reader *multipart.Reader,
 	w http.ResponseWriter,
 	outputTransform func(api.AddedOutput) interface{},
+) (api.Cid, error) {
+	return addHTTPHandler(ctx, rpc, params, w, outputTransform, func(add *adder.Adder) (api.Cid, error) {
+		return add.FromMultipart(ctx, reader)
+	})
+}
+
+// AddFilesHTTPHandler is like AddMultipartHTTPHandler, but adds the entries
+// of a files.Directory, like files opened on the disk of the peer. Files
+// read from disk are built with the parallel balanced layout.
+func AddFilesHTTPHandler(
+	ctx context.Context,
+	rpc *rpc.Client,
+	params api.AddParams,
+	f files.Directory,
+	w http.ResponseWriter,
+	outputTransform func(api.AddedOutput) interface{},
+) (api.Cid, error) {
+	return addHTTPHandler(ctx, rpc, params, w, outputTransform, func(add *adder.Adder) (api.Cid, error) {
+		return add.FromFiles(ctx, f)
+	})
+}
+
+func addHTTPHandler(
+	ctx context.Context,
+	rpc *rpc.Client,
+	params api.AddParams,
+	w http.ResponseWriter,
+	outputTransform func(api.AddedOutput) interface{},
+	addFunc func(*adder.Adder) (api.Cid, error),
 ) (api.Cid, error) {
 	var dags adder.ClusterDAGService
 	output := make(chan api.AddedOutput, 200)
@@ -67,7 +98,7 @@ func AddMultipartHTTPHandler(
 
 		enc := json.NewEncoder(w)
 		add := adder.New(dags, params, output)
-		root, err := add.FromMultipart(ctx, reader)
+		root, err := addFunc(add)
 		if err != nil { // Send an error
 			logger.Error(err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -101,7 +132,7 @@ func AddMultipartHTTPHandler(
 		streamOutput(w, output, outputTransform)
 	}()
 	add := adder.New(dags, params, output)
-	root, err := add.FromMultipart(ctx, reader)
+	root, err := addFunc(add)
 	if err != nil {
 		logger.Error(err)
 		// Set trailer with error
@@ -115,7 +146,11 @@ func streamOutput(w http.ResponseWriter, output chan api.AddedOutput, transform
 	flusher, flush := w.(http.Flusher)
 	enc := json.NewEncoder(w)
 	for v := range output {
-		err := enc.Encode(transform(v))
+		tv := transform(v)
+		if tv == nil {
+			continue
+		}
+		err := enc.Encode(tv)
 		if err != nil {
 			logger.Error(err)
 			break
@@ -129,7 +164,9 @@ func streamOutput(w http.ResponseWriter, output chan api.AddedOutput, transform
 func buildOutput(output chan api.AddedOutput, transform func(api.AddedOutput) interface{}) []interface{} {
 	var finalOutput []interface{}
 	for v := range output {
-		finalOutput = append(finalOutput, transform(v))
+		if tv := transform(v); tv != nil {
+			finalOutput = append(finalOutput, tv)
+		}
 	}
 	return finalOutput
 }
@@ -8,6 +8,8 @@ import (
 	"io"
 	gopath "path"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ipfs/ipfs-cluster/api"
 
@@ -68,6 +70,18 @@ type Adder struct {
 	// filename in the case of single files here and emit those events
 	// correctly from the beginning).
 	OutputPrefix string
+	// Cluster: when set, fills in the progress of the add, like how the
+	// blocks are being streamed to each of their destinations, in the
+	// emitted events.
+	ProgressFun func(*api.AddedOutput)
+	// Cluster: bytes chunked so far when adding with Progress.
+	chunked uint64
+}
+
+// Chunked returns the number of bytes chunked so far over all the added
+// files. It is only counted when adding with Progress.
+func (adder *Adder) Chunked() uint64 {
+	return atomic.LoadUint64(&adder.chunked)
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -93,8 +107,9 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 	// debug.PrintStack()
 
-	fi, _ := reader.(files.FileInfo)
-	fileAbsPath := fi.AbsPath()
+	// Only files the daemon reads from a local path can be built by the
+	// parallel layout; anything else is streamed.
+	fileAbsPath := localPath(reader)
 
 	chnk, err := chunker.FromString(reader, adder.Chunker)
 	if err != nil {
@@ -109,6 +124,12 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 		Maxlinks:   ihelper.DefaultLinksPerBlock,
 		NoCopy:     adder.NoCopy,
 		CidBuilder: adder.CidBuilder,
+		Ctx:        adder.ctx,
+	}
+	// Cluster: the parallel layout reads the file by itself, so the
+	// progress of the file is reported as its leaves are built.
+	if pr, ok := reader.(*progressReader2); ok {
+		params.Chunked = pr.chunked
 	}
 
 	db, err := params.New(chnk)
@@ -129,6 +150,24 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 	return nd, nil
 }
 
+// localPath returns the path of the local file the daemon opened and reads r
+// from, or "" if r reads from anything else. The files of a multipart request
+// carry the path the client read them from, which is not to be trusted.
+func localPath(r io.Reader) string {
+	var f interface{} = r
+	if pr, ok := r.(*progressReader2); ok {
+		f = pr.FileInfo
+	}
+	rf, ok := f.(*files.ReaderFile)
+	if !ok {
+		return ""
+	}
+	if _, ok := rf.LocalFile(); !ok {
+		return ""
+	}
+	return rf.AbsPath()
+}
+
 // Cluster: commented as it is unused
 // // RootNode returns the mfs root node
 // func (adder *Adder) curRootNode() (ipld.Node, error) {
@@ -381,8 +420,9 @@ func (adder *Adder) addFile(path string, file files.File) error {
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
 	var reader io.Reader = file
+	var rdr *progressReader
 	if adder.Progress {
-		rdr := &progressReader{file: reader, path: path, out: adder.Out}
+		rdr = &progressReader{file: reader, path: path, adder: adder}
 		if fi, ok := file.(files.FileInfo); ok {
 			reader = &progressReader2{rdr, fi}
 		} else {
@@ -394,6 +434,9 @@ func (adder *Adder) addFile(path string, file files.File) error {
 	if err != nil {
 		return err
 	}
+	if rdr != nil {
+		rdr.flush()
+	}
 
 	// patch it into the root
 	return adder.addNode(dagnode, path)
@@ -450,37 +493,98 @@ func (adder *Adder) outputDagnode(out chan api.AddedOutput, name string, dn ipld
 	// account for this here.
 	name = filepath.Join(adder.OutputPrefix, name)
 
-	out <- api.AddedOutput{
+	output := api.AddedOutput{
 		Cid:         api.NewCid(dn.Cid()),
 		Name:        name,
 		Size:        s,
 		Allocations: adder.allocsFun(),
 	}
+	adder.progress(&output)
+	out <- output
 
 	return nil
 }
 
+func (adder *Adder) progress(out *api.AddedOutput) {
+	if adder.ProgressFun != nil {
+		adder.ProgressFun(out)
+	}
+}
+
 type progressReader struct {
-	file         io.Reader
-	path         string
-	out          chan api.AddedOutput
+	file  io.Reader
+	path  string
+	adder *Adder
+
+	// Cluster: the parallel layout reports the chunked leaves
+	// concurrently.
+	mu           sync.Mutex
 	bytes        int64
 	lastProgress int64
 }
 
 func (i *progressReader) Read(p []byte) (int, error) {
 	n, err := i.file.Read(p)
+	i.advance(n, err == io.EOF)
+	return n, err
+}
 
+// chunked reports n bytes of the file chunked by the parallel layout.
+func (i *progressReader) chunked(n int) {
+	i.advance(n, false)
+}
+
+// advance counts n more bytes of the file and sends a progress update every
+// progressReaderIncrement bytes, or when forced.
+func (i *progressReader) advance(n int, force bool) {
+	atomic.AddUint64(&i.adder.chunked, uint64(n))
+
+	i.mu.Lock()
 	i.bytes += int64(n)
-	if i.bytes-i.lastProgress >= progressReaderIncrement || err == io.EOF {
-		i.lastProgress = i.bytes
-		i.out <- api.AddedOutput{
-			Name:  i.path,
-			Bytes: uint64(i.bytes),
-		}
+	due := i.bytes-i.lastProgress >= progressReaderIncrement || force
+	var output api.AddedOutput
+	if due {
+		output = i.update()
 	}
+	i.mu.Unlock()
 
-	return n, err
+	if due {
+		i.send(output)
+	}
+}
+
+// flush sends a last progress update when the last bytes counted were not
+// reported, which happens when the file was not read until io.EOF.
+func (i *progressReader) flush() {
+	i.mu.Lock()
+	due := i.bytes != i.lastProgress
+	var output api.AddedOutput
+	if due {
+		output = i.update()
+	}
+	i.mu.Unlock()
+
+	if due {
+		i.send(output)
+	}
+}
+
+// update marks the bytes counted as reported and returns the progress update
+// reporting them. It must be called with mu held.
+func (i *progressReader) update() api.AddedOutput {
+	i.lastProgress = i.bytes
+	return api.AddedOutput{
+		Name:    i.path,
+		Bytes:   uint64(i.bytes),
+		Chunked: i.adder.Chunked(),
+	}
+}
+
+// send sends a progress update. It blocks until the update is read, so it
+// must not be called with mu held.
+func (i *progressReader) send(output api.AddedOutput) {
+	i.adder.progress(&output)
+	i.adder.Out <- output
 }
 
 type progressReader2 struct {
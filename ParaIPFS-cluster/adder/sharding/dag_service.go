@@ -7,7 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-
+	"sync"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/adder"
@@ -17,6 +17,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
+	helpers "github.com/ipfs/go-unixfs/importer/helpers"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
@@ -36,10 +37,16 @@ type DAGService struct {
 	addParams api.AddParams
 	output    chan<- api.AddedOutput
 
-	addedSet *cid.Set
+	// The parallel layout adds the leaves of each of its leaf groups
+	// from a different goroutine. Every leaf group fills its own
+	// shards, which are built and streamed at the same time as the
+	// others. The rest of the blocks go to the main shards.
+	main *shardGroup
 
-	// Current shard being built
-	currentShard *shard
+	// mu guards everything below.
+	mu       sync.Mutex
+	addedSet *cid.Set
+	groups   map[int]*shardGroup
 	// Last flushed shard CID
 	previousShard cid.Cid
 
@@ -50,6 +57,14 @@ type DAGService struct {
 	totalSize uint64
 }
 
+// shardGroup holds the shard being filled with the blocks of a leaf group,
+// or with the blocks out of any.
+type shardGroup struct {
+	mu sync.Mutex
+	// Current shard being built
+	current *shard
+}
+
 // New returns a new ClusterDAGService, which uses the given rpc client to perform
 // Allocate, IPFSStream and Pin requests to other cluster components.
 func New(ctx context.Context, rpc *rpc.Client, opts api.AddParams, out chan<- api.AddedOutput) *DAGService {
@@ -60,7 +75,9 @@ func New(ctx context.Context, rpc *rpc.Client, opts api.AddParams, out chan<- ap
 		rpcClient: rpc,
 		addParams: opts,
 		output:    out,
+		main:      &shardGroup{},
 		addedSet:  cid.NewSet(),
+		groups:    make(map[int]*shardGroup),
 		shards:    make(map[string]cid.Cid),
 		startTime: time.Now(),
 	}
@@ -69,27 +86,51 @@ func New(ctx context.Context, rpc *rpc.Client, opts api.AddParams, out chan<- ap
 // Add puts the given node in its corresponding shard and sends it to the
 // destination peers.
 func (dgs *DAGService) Add(ctx context.Context, node ipld.Node) error {
+	dgs.mu.Lock()
 	// FIXME: This will grow in memory
-	if !dgs.addedSet.Visit(node.Cid()) {
+	visit := dgs.addedSet.Visit(node.Cid())
+	dgs.mu.Unlock()
+	if !visit {
 		return nil
 	}
 
-	return dgs.ingestBlock(ctx, node)
+	return dgs.ingestBlock(ctx, dgs.groupFor(ctx), node)
 }
 
+// Add_mansub puts the given node, built by the parallel layout, in its
+// corresponding shard. The leaves carry their leaf group in ctx, and go to
+// the shards of that group.
 func (dgs *DAGService) Add_mansub(ctx context.Context, node ipld.Node) error {
-	// FIXME: This will grow in memory
-	if !dgs.addedSet.Visit(node.Cid()) {
-		return nil
+	return dgs.Add(ctx, node)
+}
+
+// groupFor returns the shardGroup for the leaf group in ctx, or the main
+// one.
+func (dgs *DAGService) groupFor(ctx context.Context) *shardGroup {
+	group, ok := helpers.LeafGroup(ctx)
+	if !ok {
+		return dgs.main
 	}
 
-	return dgs.ingestBlock(ctx, node)
+	dgs.mu.Lock()
+	defer dgs.mu.Unlock()
+	g, ok := dgs.groups[group]
+	if !ok {
+		g = &shardGroup{}
+		dgs.groups[group] = g
+	}
+	return g
 }
 
 // Finalize finishes sharding, creates the cluster DAG and pins it along
 // with the meta pin for the root node of the content.
 func (dgs *DAGService) Finalize(ctx context.Context, dataRoot api.Cid) (api.Cid, error) {
-	lastCid, err := dgs.flushCurrentShard(ctx)
+	if err := dgs.flushGroups(ctx); err != nil {
+		return dataRoot, err
+	}
+
+	// The main shards get the root, which is added last.
+	lastCid, err := dgs.flushCurrentShard(ctx, dgs.main)
 	if err != nil {
 		return api.NewCid(lastCid), err
 	}
@@ -118,7 +159,7 @@ func (dgs *DAGService) Finalize(ctx context.Context, dataRoot api.Cid) (api.Cid,
 	}()
 
 	// Stream these blocks and wait until we are done.
-	bs := adder.NewBlockStreamer(ctx, dgs.rpcClient, []peer.ID{""}, blocks)
+	bs := adder.NewBlockStreamer(ctx, dgs.rpcClient, []peer.ID{""}, blocks, nil)
 	select {
 	case <-ctx.Done():
 		return dataRoot, ctx.Err()
@@ -187,65 +228,68 @@ func (dgs *DAGService) Finalize(ctx context.Context, dataRoot api.Cid) (api.Cid,
 	return dataRoot, nil
 }
 
-// Allocations returns the current allocations for the current shard.
+// Allocations returns the current allocations for the current main shard.
 func (dgs *DAGService) Allocations() []peer.ID {
-	// FIXME: this is probably not safe in concurrency?  However, there is
-	// no concurrent execution of any code in the DAGService I think.
-	if dgs.currentShard != nil {
-		return dgs.currentShard.Allocations()
+	dgs.main.mu.Lock()
+	defer dgs.main.mu.Unlock()
+	if dgs.main.current != nil {
+		return dgs.main.current.Allocations()
 	}
 	return nil
 }
 
-// ingests a block to the current shard. If it get's full, it
+// ingests a block to the current shard of g. If it get's full, it
 // Flushes the shard and retries with a new one.
-func (dgs *DAGService) ingestBlock(ctx context.Context, n ipld.Node) error {
-	shard := dgs.currentShard
-
-	// if we have no currentShard, create one
-	if shard == nil {
-		logger.Infof("new shard for '%s': #%d", dgs.addParams.Name, len(dgs.shards))
-		var err error
-		// important: shards use the DAGService context.
-		shard, err = newShard(dgs.ctx, ctx, dgs.rpcClient, dgs.addParams.PinOptions)
-		if err != nil {
-			return err
+func (dgs *DAGService) ingestBlock(ctx context.Context, g *shardGroup, n ipld.Node) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		shard := g.current
+
+		// if we have no current shard, create one
+		if shard == nil {
+			logger.Infof("new shard for '%s'", dgs.addParams.Name)
+			var err error
+			// important: shards use the DAGService context.
+			shard, err = newShard(dgs.ctx, ctx, dgs.rpcClient, dgs.addParams.PinOptions)
+			if err != nil {
+				return err
+			}
+			g.current = shard
 		}
-		dgs.currentShard = shard
-	}
 
-	logger.Debugf("ingesting block %s in shard %d (%s)", n.Cid(), len(dgs.shards), dgs.addParams.Name)
+		logger.Debugf("ingesting block %s (%s)", n.Cid(), dgs.addParams.Name)
 
-	// this is not same as n.Size()
-	size := uint64(len(n.RawData()))
+		// this is not same as n.Size()
+		size := uint64(len(n.RawData()))
 
-	// add the block to it if it fits and return
-	if shard.Size()+size < shard.Limit() {
-		shard.AddLink(ctx, n.Cid(), size)
-		return dgs.currentShard.sendBlock(ctx, n)
-	}
+		// add the block to it if it fits and return
+		if shard.Size()+size < shard.Limit() {
+			shard.AddLink(ctx, n.Cid(), size)
+			return shard.sendBlock(ctx, n)
+		}
 
-	logger.Debugf("shard %d full: block: %d. shard: %d. limit: %d",
-		len(dgs.shards),
-		size,
-		shard.Size(),
-		shard.Limit(),
-	)
+		logger.Debugf("shard full: block: %d. shard: %d. limit: %d",
+			size,
+			shard.Size(),
+			shard.Limit(),
+		)
 
-	// -------
-	// Below: block DOES NOT fit in shard
-	// Flush and retry
+		// -------
+		// Below: block DOES NOT fit in shard
+		// Flush and retry
 
-	// if shard is empty, error
-	if shard.Size() == 0 {
-		return errors.New("block doesn't fit in empty shard: shard size too small?")
-	}
+		// if shard is empty, error
+		if shard.Size() == 0 {
+			return errors.New("block doesn't fit in empty shard: shard size too small?")
+		}
 
-	_, err := dgs.flushCurrentShard(ctx)
-	if err != nil {
-		return err
+		if _, err := dgs.flushShard(ctx, shard); err != nil {
+			return err
+		}
+		g.current = nil
 	}
-	return dgs.ingestBlock(ctx, n) // <-- retry ingest
 }
 
 func (dgs *DAGService) logStats(metaPin, clusterDAGPin api.Cid) {
@@ -285,25 +329,83 @@ func (dgs *DAGService) sendOutput(ao api.AddedOutput) {
 	}
 }
 
-// flushes the dgs.currentShard and returns the LastLink()
-func (dgs *DAGService) flushCurrentShard(ctx context.Context) (cid.Cid, error) {
-	shard := dgs.currentShard
+// flushes the current shard of g and returns the LastLink()
+func (dgs *DAGService) flushCurrentShard(ctx context.Context, g *shardGroup) (cid.Cid, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	shard := g.current
 	if shard == nil {
 		return cid.Undef, errors.New("cannot flush a nil shard")
 	}
 
-	lens := len(dgs.shards)
+	lastLink, err := dgs.flushShard(ctx, shard)
+	if err != nil {
+		return lastLink, err
+	}
+	g.current = nil
+	return lastLink, nil
+}
+
+// flushGroups flushes the current shards of all leaf groups at the same
+// time.
+func (dgs *DAGService) flushGroups(ctx context.Context) error {
+	dgs.mu.Lock()
+	groups := make([]*shardGroup, 0, len(dgs.groups))
+	for _, g := range dgs.groups {
+		groups = append(groups, g)
+	}
+	dgs.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(groups))
+	for i, g := range groups {
+		wg.Add(1)
+		go func(i int, g *shardGroup) {
+			defer wg.Done()
+			g.mu.Lock()
+			empty := g.current == nil
+			g.mu.Unlock()
+			if !empty {
+				_, errs[i] = dgs.flushCurrentShard(ctx, g)
+			}
+		}(i, g)
+	}
+	wg.Wait()
 
-	shardCid, err := shard.Flush(ctx, lens, dgs.previousShard)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushShard flushes the given shard and returns the LastLink(). The shard
+// takes the next number in the cluster DAG and is chained to the previous
+// one before being streamed, so that shards flushed at the same time are
+// numbered and chained in the same order.
+func (dgs *DAGService) flushShard(ctx context.Context, shard *shard) (cid.Cid, error) {
+	nodes, err := shard.Build(ctx)
 	if err != nil {
-		return shardCid, err
+		return cid.Undef, err
 	}
+	rootCid := nodes[0].Cid()
+
+	dgs.mu.Lock()
+	shardN := len(dgs.shards)
+	prev := dgs.previousShard
+	dgs.shards[fmt.Sprintf("%d", shardN)] = rootCid
+	dgs.previousShard = rootCid
 	dgs.totalSize += shard.Size()
-	dgs.shards[fmt.Sprintf("%d", lens)] = shardCid
-	dgs.previousShard = shardCid
-	dgs.currentShard = nil
+	dgs.mu.Unlock()
+
+	shardCid, err := shard.Flush(ctx, shardN, prev, nodes)
+	if err != nil {
+		return shardCid, err
+	}
 	dgs.sendOutput(api.AddedOutput{
-		Name:        fmt.Sprintf("shard-%d", lens),
+		Name:        fmt.Sprintf("shard-%d", shardN),
 		Cid:         api.NewCid(shardCid),
 		Size:        shard.Size(),
 		Allocations: shard.Allocations(),
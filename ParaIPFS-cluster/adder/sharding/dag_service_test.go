@@ -3,6 +3,7 @@ package sharding
 import (
 	"context"
 	"errors"
+	"math/rand"
 	"mime/multipart"
 	"sync"
 	"testing"
@@ -11,7 +12,10 @@ import (
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/test"
 
+	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
+	merkledag "github.com/ipfs/go-merkledag"
+	helpers "github.com/ipfs/go-unixfs/importer/helpers"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
@@ -66,7 +70,7 @@ func (rpcs *testRPC) BlockGet(ctx context.Context, c api.Cid) ([]byte, error) {
 	return bI.([]byte), nil
 }
 
-func makeAdder(t *testing.T, params api.AddParams) (*adder.Adder, *testRPC) {
+func makeRPCClient(t *testing.T) (*rpc.Client, *testRPC) {
 	rpcObj := &testRPC{}
 	server := rpc.NewServer(nil, "mock")
 	err := server.RegisterName("Cluster", rpcObj)
@@ -77,8 +81,11 @@ func makeAdder(t *testing.T, params api.AddParams) (*adder.Adder, *testRPC) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	client := rpc.NewClientWithServer(nil, "mock", server)
+	return rpc.NewClientWithServer(nil, "mock", server), rpcObj
+}
 
+func makeAdder(t *testing.T, params api.AddParams) (*adder.Adder, *testRPC) {
+	client, rpcObj := makeRPCClient(t)
 	out := make(chan api.AddedOutput, 1)
 
 	dags := New(context.Background(), client, params, out)
@@ -189,6 +196,81 @@ func TestFromMultipart(t *testing.T) {
 
 }
 
+func TestLeafGroups(t *testing.T) {
+	p := api.DefaultAddParams()
+	// 6 leaves per shard
+	p.ShardSize = 1024 * 100
+	p.Name = "testingLeafGroups"
+	p.Shard = true
+	p.ReplicationFactorMin = 1
+	p.ReplicationFactorMax = 2
+
+	ctx := context.Background()
+	client, rpcObj := makeRPCClient(t)
+	dgs := New(ctx, client, p, nil)
+
+	// 4 leaf groups of 10 leaves, added at the same time like the
+	// parallel layout does.
+	groups := 4
+	leaves := make([][]ipld.Node, groups)
+	for i := range leaves {
+		for j := 0; j < 10; j++ {
+			data := make([]byte, 16*1024)
+			rand.Read(data)
+			leaves[i] = append(leaves[i], merkledag.NewRawNode(data))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := range leaves {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gctx := helpers.WithLeafGroup(ctx, i)
+			for _, n := range leaves[i] {
+				if err := dgs.Add_mansub(gctx, n); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	root := &merkledag.ProtoNode{}
+	for i := range leaves {
+		for _, n := range leaves[i] {
+			if err := root.AddNodeLink("", n); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := dgs.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCid, err := dgs.Finalize(ctx, api.NewCid(root.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 shards per leaf group and one with the root. Without leaf
+	// groups, the leaves and the root would fit in 7 shards.
+	shardBlocks, err := VerifyShards(t, rootCid, rpcObj, rpcObj, 2*groups+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shardBlocks) != groups*10+1 {
+		t.Fatal("shards have missing or extra blocks")
+	}
+	for i := range leaves {
+		for _, n := range leaves[i] {
+			if _, ok := shardBlocks[n.Cid().String()]; !ok {
+				t.Fatal("shards are missing a block:", n.Cid())
+			}
+		}
+	}
+}
+
 func TestFromMultipart_Errors(t *testing.T) {
 	type testcase struct {
 		name   string
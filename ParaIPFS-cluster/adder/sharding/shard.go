@@ -57,7 +57,7 @@ func newShard(globalCtx context.Context, ctx context.Context, rpc *rpc.Client, o
 		rpc:         rpc,
 		allocations: allocs,
 		pinOptions:  opts,
-		bs:          adder.NewBlockStreamer(globalCtx, rpc, allocs, blocks),
+		bs:          adder.NewBlockStreamer(globalCtx, rpc, allocs, blocks, nil),
 		blocks:      blocks,
 		dagNode:     make(map[string]cid.Cid),
 		currentSize: 0,
@@ -93,18 +93,24 @@ func (sh *shard) sendBlock(ctx context.Context, n ipld.Node) error {
 	}
 }
 
-// Flush completes the allocation of this shard by building a CBOR node
-// and adding it to IPFS, then pinning it in cluster. It returns the Cid of the
-// shard.
-func (sh *shard) Flush(ctx context.Context, shardN int, prev cid.Cid) (cid.Cid, error) {
-	logger.Debugf("shard %d: flush", shardN)
+// Build builds the CBOR nodes of this shard. The first one is the root of
+// the shard.
+func (sh *shard) Build(ctx context.Context) ([]ipld.Node, error) {
 	nodes, err := makeDAG(ctx, sh.dagNode)
 	if err != nil {
-		return cid.Undef, err
+		close(sh.blocks)
+		return nil, err
 	}
+	return nodes, nil
+}
 
+// Flush completes the allocation of this shard by adding the nodes returned
+// by Build to IPFS, then pinning it in cluster. The shard pin references
+// the previous shard. It returns the Cid of the shard.
+func (sh *shard) Flush(ctx context.Context, shardN int, prev cid.Cid, nodes []ipld.Node) (cid.Cid, error) {
+	logger.Debugf("shard %d: flush", shardN)
 	for _, n := range nodes {
-		err = sh.sendBlock(ctx, n)
+		err := sh.sendBlock(ctx, n)
 		if err != nil {
 			close(sh.blocks)
 			return cid.Undef, err
@@ -4,7 +4,7 @@ package single
 
 import (
 	"context"
-	"fmt"
+	"sync"
 
 	adder "github.com/ipfs/ipfs-cluster/adder"
 	"github.com/ipfs/ipfs-cluster/api"
@@ -28,15 +28,17 @@ type DAGService struct {
 	ctx       context.Context
 	rpcClient *rpc.Client
 
-	dests     []peer.ID
 	addParams api.AddParams
 	local     bool
 
+	// The parallel layout adds blocks concurrently. mu guards
+	// dests, bs and recentBlocks.
+	mu           sync.Mutex
+	dests        []peer.ID
 	bs           *adder.BlockStreamer
-	blocks       chan api.NodeWithMeta
 	recentBlocks *recentBlocks
 
-	networkCount uint
+	blocks chan api.NodeWithMeta
 }
 
 // New returns a new Adder with the given rpc Client. The client is used
@@ -52,7 +54,6 @@ func New(ctx context.Context, rpc *rpc.Client, opts api.AddParams, local bool) *
 		local:        local,
 		blocks:       make(chan api.NodeWithMeta, 256),
 		recentBlocks: &recentBlocks{},
-		networkCount: 0,
 	}
 }
 
@@ -61,7 +62,9 @@ func (dgs *DAGService) Add(ctx context.Context, node ipld.Node) error {
 	// Avoid adding the same node multiple times in a row.
 	// This is done by the ipfsadd-er, because some nodes are added
 	// via dagbuilder, then via MFS, and root nodes once more.
+	dgs.mu.Lock()
 	if dgs.recentBlocks.Has(node) {
+		dgs.mu.Unlock()
 		return nil
 	}
 
@@ -69,39 +72,12 @@ func (dgs *DAGService) Add(ctx context.Context, node ipld.Node) error {
 	// is the adder only allocates and starts streaming when the first
 	// block arrives and not on creation.
 	if dgs.dests == nil {
-		dests, err := adder.BlockAllocate(ctx, dgs.rpcClient, dgs.addParams.PinOptions)
-		if err != nil {
+		if err := dgs.allocate(ctx); err != nil {
+			dgs.mu.Unlock()
 			return err
 		}
-
-		hasLocal := false
-		localPid := dgs.rpcClient.ID()
-		for i, d := range dests {
-			if d == localPid || d == "" {
-				hasLocal = true
-				// ensure our allocs do not carry an empty peer
-				// mostly an issue with testing mocks
-				dests[i] = localPid
-			}
-		}
-
-		dgs.dests = dests
-		fmt.Printf("dgs.dests:%+v, localPid: %+v, dgs.local:%v\n, hasLocal:%v\n", dgs.dests, localPid, dgs.local, hasLocal)
-
-		if dgs.local {
-			// If this is a local pin, make sure that the local
-			// peer is among the allocations..
-			// UNLESS user-allocations are defined!
-			if !hasLocal && localPid != "" && len(dgs.addParams.UserAllocations) == 0 {
-				// replace last allocation with local peer
-				dgs.dests[len(dgs.dests)-1] = localPid
-			}
-
-			dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, []peer.ID{localPid}, dgs.blocks)
-		} else {
-			dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, dgs.dests, dgs.blocks)
-		}
 	}
+	dgs.mu.Unlock()
 
 	select {
 	case <-ctx.Done():
@@ -109,91 +85,94 @@ func (dgs *DAGService) Add(ctx context.Context, node ipld.Node) error {
 	case <-dgs.ctx.Done():
 		return ctx.Err()
 	case dgs.blocks <- adder.IpldNodeToNodeWithMeta(node):
+		dgs.mu.Lock()
 		dgs.recentBlocks.Add(node)
+		dgs.mu.Unlock()
 		return nil
 	}
 }
 
-// Add puts the given node in the destination peers.
+// Add_mansub puts the given node, built by the parallel layout, in the
+// destination peers. The layout writes some of the leaves straight into the
+// datastore of the local peer, but not all of them, so the local peer is
+// streamed every block like the other destinations.
 func (dgs *DAGService) Add_mansub(ctx context.Context, node ipld.Node) error {
-	// fmt.Println("hello")
-	// Avoid adding the same node multiple times in a row.
-	// This is done by the ipfsadd-er, because some nodes are added
-	// via dagbuilder, then via MFS, and root nodes once more.
-	if dgs.recentBlocks.Has(node) {
-		return nil
-	}
+	return dgs.Add(ctx, node)
+}
 
-	// FIXME: can't this happen on initialization?  Perhaps the point here
-	// is the adder only allocates and starts streaming when the first
-	// block arrives and not on creation.
-	if dgs.dests == nil {
-		// debug.PrintStack()
-		// fmt.Println("dests == nil")
-		dests, err := adder.BlockAllocate(ctx, dgs.rpcClient, dgs.addParams.PinOptions)
-		if err != nil {
-			return err
-		}
+// allocate decides the destinations of the blocks and starts streaming to
+// them. It must be called with mu held.
+func (dgs *DAGService) allocate(ctx context.Context) error {
+	dests, err := adder.BlockAllocate(ctx, dgs.rpcClient, dgs.addParams.PinOptions)
+	if err != nil {
+		return err
+	}
 
-		new_dests := make([]peer.ID, 0)
-		hasLocal := false
-		localPid := dgs.rpcClient.ID()
-		for _, d := range dests {
-			if d == localPid || d == "" {
-				hasLocal = true
-				// ensure our allocs do not carry an empty peer
-				// mostly an issue with testing mocks
-				// dests[i] = localPid
-				continue
-			}
-			new_dests = append(new_dests, d)
+	hasLocal := false
+	localPid := dgs.rpcClient.ID()
+	for i, d := range dests {
+		if d == localPid || d == "" {
+			hasLocal = true
+			// ensure our allocs do not carry an empty peer
+			// mostly an issue with testing mocks
+			dests[i] = localPid
 		}
+	}
 
-		dgs.dests = new_dests
-		// fmt.Printf("Add_mansub dgs.dests:%+v, localPid: %+v, dgs.local:%v\n, hasLocal:%v\n", dgs.dests, localPid, dgs.local, hasLocal)
-
-		if dgs.local {
-			// If this is a local pin, make sure that the local
-			// peer is among the allocations..
-			// UNLESS user-allocations are defined!
-			if !hasLocal && localPid != "" && len(dgs.addParams.UserAllocations) == 0 {
-				// replace last allocation with local peer
-				dgs.dests[len(dgs.dests)-1] = localPid
-			}
+	dgs.dests = dests
 
-			dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, []peer.ID{localPid}, dgs.blocks)
-		} else {
-			dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, dgs.dests, dgs.blocks)
+	if dgs.local {
+		// If this is a local pin, make sure that the local
+		// peer is among the allocations..
+		// UNLESS user-allocations are defined!
+		if !hasLocal && localPid != "" && len(dgs.addParams.UserAllocations) == 0 {
+			// replace last allocation with local peer
+			dgs.dests[len(dgs.dests)-1] = localPid
 		}
-	}
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-dgs.ctx.Done():
-		return ctx.Err()
-	case dgs.blocks <- adder.IpldNodeToNodeWithMeta(node):
-		// fmt.Println("dgs.networkCount:", dgs.networkCount)
-		// dgs.networkCount++
-		dgs.recentBlocks.Add(node)
-		return nil
+		// The other allocations fetch the blocks from the local
+		// peer when pinning.
+		dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, []peer.ID{localPid}, dgs.blocks, nil)
+	} else {
+		dgs.bs = adder.NewBlockStreamer(dgs.ctx, dgs.rpcClient, dgs.dests, dgs.blocks, &dgs.addParams.PinOptions)
 	}
+	return nil
 }
 
-// Finalize pins the last Cid added to this DAGService.
+// Finalize pins the last Cid added to this DAGService. When the parallel
+// layout recorded the TierCid of root, it is streamed and pinned along with
+// it.
 func (dgs *DAGService) Finalize(ctx context.Context, root api.Cid) (api.Cid, error) {
+	var tierCid api.Cid
+	if !dgs.addParams.NoPin {
+		if tcNode, ok := adder.TierCidNode(root.Cid); ok {
+			if err := dgs.Add(ctx, tcNode); err != nil {
+				close(dgs.blocks)
+				return root, err
+			}
+			tierCid = api.NewCid(tcNode.Cid())
+		}
+	}
 	close(dgs.blocks)
 
+	dgs.mu.Lock()
+	bs := dgs.bs
+	dgs.mu.Unlock()
+	if bs == nil {
+		// Nothing was added.
+		return root, adder.ErrBlockAdder
+	}
+
 	select {
 	case <-dgs.ctx.Done():
 		return root, ctx.Err()
 	case <-ctx.Done():
 		return root, ctx.Err()
-	case <-dgs.bs.Done():
+	case <-bs.Done():
 	}
 
 	// If the streamer failed to put blocks.
-	if err := dgs.bs.Err(); err != nil {
+	if err := bs.Err(); err != nil {
 		return root, err
 	}
 
@@ -207,19 +186,45 @@ func (dgs *DAGService) Finalize(ctx context.Context, root api.Cid) (api.Cid, err
 
 	// Cluster pin the result
 	rootPin := api.PinWithOpts(root, dgs.addParams.PinOptions)
-	rootPin.Allocations = dgs.dests
+	rootPin.Allocations = dgs.Allocations()
+	if tierCid.Defined() {
+		err := adder.PinTierCid(ctx, dgs.rpcClient, &rootPin, tierCid)
+		if err != nil {
+			return root, err
+		}
+	}
 
 	return root, adder.Pin(ctx, dgs.rpcClient, rootPin)
 }
 
-// Allocations returns the add destinations decided by the DAGService.
+// Allocations returns the add destinations decided by the DAGService. They
+// do not include the destinations given up while streaming, but those
+// allocated in their place.
 func (dgs *DAGService) Allocations() []peer.ID {
+	dgs.mu.Lock()
+	defer dgs.mu.Unlock()
+
+	dests := dgs.dests
+	if dgs.bs != nil && !dgs.local {
+		dests = dgs.bs.Allocations()
+	}
 	// using rpc clients without a host results in an empty peer
 	// which cannot be parsed to peer.ID on deserialization.
-	if len(dgs.dests) == 1 && dgs.dests[0] == "" {
+	if len(dests) == 1 && dests[0] == "" {
+		return nil
+	}
+	return dests
+}
+
+// Progress returns how the blocks are being streamed to each destination.
+func (dgs *DAGService) Progress() []api.AddDestination {
+	dgs.mu.Lock()
+	defer dgs.mu.Unlock()
+
+	if dgs.bs == nil {
 		return nil
 	}
-	return dgs.dests
+	return dgs.bs.Progress()
 }
 
 // AddMany calls Add for every given node.
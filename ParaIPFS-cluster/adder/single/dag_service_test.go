@@ -5,7 +5,9 @@ import (
 	"errors"
 	"mime/multipart"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	adder "github.com/ipfs/ipfs-cluster/adder"
 	"github.com/ipfs/ipfs-cluster/api"
@@ -27,10 +29,26 @@ func (rpcs *testIPFSRPC) BlockStream(ctx context.Context, in <-chan api.NodeWith
 	defer close(out)
 	for n := range in {
 		rpcs.blocks.Store(n.Cid.String(), n)
+		out <- struct{}{}
 	}
 	return nil
 }
 
+// flakyIPFSRPC fails the given number of streams after a first block.
+type flakyIPFSRPC struct {
+	testIPFSRPC
+	failures int32
+}
+
+func (rpcs *flakyIPFSRPC) BlockStream(ctx context.Context, in <-chan api.NodeWithMeta, out chan<- struct{}) error {
+	if atomic.AddInt32(&rpcs.failures, -1) < 0 {
+		return rpcs.testIPFSRPC.BlockStream(ctx, in, out)
+	}
+	defer close(out)
+	<-in
+	return errors.New("stream failed")
+}
+
 func (rpcs *testClusterRPC) Pin(ctx context.Context, in api.Pin, out *api.Pin) error {
 	rpcs.pins.Store(in.Cid.String(), in)
 	*out = in
@@ -94,6 +112,11 @@ func TestAdd(t *testing.T) {
 		if !ok {
 			t.Error("the tree wasn't pinned")
 		}
+
+		progress := dags.Progress()
+		if len(progress) != 1 || progress[0].Blocks == 0 || progress[0].Confirmed != progress[0].Blocks {
+			t.Errorf("all blocks should have been confirmed: %+v", progress)
+		}
 	})
 
 	t.Run("trickle", func(t *testing.T) {
@@ -136,3 +159,158 @@ func TestAdd(t *testing.T) {
 		}
 	})
 }
+
+func TestAddRetry(t *testing.T) {
+	delay := adder.BlockStreamRetryDelay
+	adder.BlockStreamRetryDelay = time.Millisecond
+	defer func() {
+		adder.BlockStreamRetryDelay = delay
+	}()
+
+	add := func(t *testing.T, failures int32) (*DAGService, *flakyIPFSRPC, api.Cid, error) {
+		clusterRPC := &testClusterRPC{}
+		ipfsRPC := &flakyIPFSRPC{failures: failures}
+		server := rpc.NewServer(nil, "mock")
+		err := server.RegisterName("Cluster", clusterRPC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = server.RegisterName("IPFSConnector", ipfsRPC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := rpc.NewClientWithServer(nil, "mock", server)
+		params := api.DefaultAddParams()
+		params.Wrap = true
+
+		dags := New(context.Background(), client, params, false)
+		add := adder.New(dags, params, nil)
+
+		sth := test.NewShardingTestHelper()
+		defer sth.Clean(t)
+		mr, closer := sth.GetTreeMultiReader(t)
+		defer closer.Close()
+		r := multipart.NewReader(mr, mr.Boundary())
+
+		rootCid, err := add.FromMultipart(context.Background(), r)
+		return dags, ipfsRPC, rootCid, err
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		clean, _, _, err := add(t, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dags, ipfsRPC, rootCid, err := add(t, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rootCid.String() != test.ShardingDirBalancedRootCIDWrapped {
+			t.Fatal("bad root cid: ", rootCid)
+		}
+
+		for _, c := range test.ShardingDirCids {
+			_, ok := ipfsRPC.blocks.Load(c)
+			if !ok {
+				t.Error("block was not added to IPFS", c)
+			}
+		}
+
+		progress := dags.Progress()
+		if len(progress) != 1 {
+			t.Fatal("expected a single destination")
+		}
+		if progress[0].Retries != 2 || progress[0].Missed != 0 || progress[0].Error != "" {
+			t.Errorf("unexpected progress: %+v", progress[0])
+		}
+		// The blocks sent again are only counted once.
+		if blocks := clean.Progress()[0].Blocks; progress[0].Blocks != blocks || progress[0].Confirmed != blocks {
+			t.Errorf("expected %d blocks sent and confirmed: %+v", blocks, progress[0])
+		}
+	})
+
+	t.Run("given up", func(t *testing.T) {
+		dags, _, _, err := add(t, int32(adder.BlockStreamRetries)+1)
+		if err != adder.ErrBlockAdder {
+			t.Fatal("expected the add to fail: ", err)
+		}
+		progress := dags.Progress()
+		if len(progress) != 1 || progress[0].Error == "" {
+			t.Errorf("expected the destination to be given up: %+v", progress)
+		}
+		if len(dags.Allocations()) != 0 {
+			t.Error("the destination given up should not be allocated")
+		}
+	})
+}
+
+// slowIPFSRPC takes its time writing every block of its first stream.
+type slowIPFSRPC struct {
+	testIPFSRPC
+	streams int32
+}
+
+func (rpcs *slowIPFSRPC) BlockStream(ctx context.Context, in <-chan api.NodeWithMeta, out chan<- struct{}) error {
+	if atomic.AddInt32(&rpcs.streams, 1) > 1 {
+		return rpcs.testIPFSRPC.BlockStream(ctx, in, out)
+	}
+	defer close(out)
+	for range in {
+		time.Sleep(time.Millisecond)
+		out <- struct{}{}
+	}
+	return nil
+}
+
+// twoPeersClusterRPC allocates the blocks to two peers.
+type twoPeersClusterRPC struct {
+	testClusterRPC
+}
+
+func (rpcs *twoPeersClusterRPC) BlockAllocate(ctx context.Context, in api.Pin, out *[]peer.ID) error {
+	*out = []peer.ID{test.PeerID1, test.PeerID2}
+	return nil
+}
+
+// TestAddSlowDestination checks that a destination far behind the others is
+// not skipped any blocks.
+func TestAddSlowDestination(t *testing.T) {
+	buffer := adder.BlockStreamBuffer
+	adder.BlockStreamBuffer = 2
+	defer func() {
+		adder.BlockStreamBuffer = buffer
+	}()
+
+	server := rpc.NewServer(nil, "mock")
+	if err := server.RegisterName("Cluster", &twoPeersClusterRPC{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("IPFSConnector", &slowIPFSRPC{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.NewClientWithServer(nil, "mock", server)
+	params := api.DefaultAddParams()
+
+	dags := New(context.Background(), client, params, false)
+	add := adder.New(dags, params, nil)
+
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+	mr, closer := sth.GetTreeMultiReader(t)
+	defer closer.Close()
+	r := multipart.NewReader(mr, mr.Boundary())
+
+	if _, err := add.FromMultipart(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := dags.Progress()
+	if len(progress) != 2 {
+		t.Fatalf("expected two destinations: %+v", progress)
+	}
+	for _, p := range progress {
+		if p.Missed != 0 || p.Error != "" || p.Blocks != progress[0].Blocks || p.Confirmed != p.Blocks {
+			t.Errorf("expected every block sent to both destinations: %+v", progress)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package adder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+// ErrBlockAdder is returned when adding a to multiple destinations
+// block fails on all of them.
+var ErrBlockAdder = errors.New("failed to put block on all destinations")
+
+// BlockStreamBuffer is the number of the latest blocks a BlockStreamer keeps
+// for its destinations. Blocks are received as long as every destination is
+// less than this many blocks behind, so that none of them misses any, and
+// the blocks a failed stream may not have delivered can be sent again.
+var BlockStreamBuffer = 256
+
+// BlockStreamRetries is the number of times the stream to a destination is
+// restarted after failing before the destination is given up.
+var BlockStreamRetries = 3
+
+// BlockStreamRetryDelay is the delay before the first restart of a failed
+// stream. It doubles with every retry.
+var BlockStreamRetryDelay = time.Second
+
+// BlockStreamer helps streaming nodes to multiple destinations, as long as
+// one of them is still working.
+//
+// Every destination is streamed the blocks by its own IPFSConnector.BlockStream
+// call, at its own pace, up to BlockStreamBuffer blocks apart. A failed
+// stream is restarted with the blocks it was sent but did not confirm, and a
+// destination whose retries are exhausted, or which may have lost blocks that
+// are no longer kept, is given up, and replaced by a new allocation when the
+// BlockStreamer was given pin options.
+type BlockStreamer struct {
+	rpcClient *rpc.Client
+	blocks    <-chan api.NodeWithMeta
+	allocOpts *api.PinOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu guards everything below, and the state of the destinations.
+	// cond is signaled whenever blocks are received or consumed, and
+	// whenever a destination finishes.
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ring   []api.NodeWithMeta
+	head   uint64 // number of blocks received
+	closed bool   // all blocks were received
+	dests  []*destination
+	err    error
+}
+
+type destination struct {
+	peer     peer.ID
+	replaces peer.ID
+
+	cursor    uint64 // next block to send
+	high      uint64 // next block never sent
+	sent      uint64
+	confirmed uint64
+	missed    uint64
+	retries   int
+	done      bool
+	err       error
+}
+
+// NewBlockStreamer creates a BlockStreamer given an rpc client, allocated
+// peers and a channel on which the blocks to stream are received. When
+// allocOpts is not nil, the destinations given up are replaced by
+// allocating again with these options.
+func NewBlockStreamer(ctx context.Context, rpcClient *rpc.Client, dests []peer.ID, blocks <-chan api.NodeWithMeta, allocOpts *api.PinOptions) *BlockStreamer {
+	bsCtx, cancel := context.WithCancel(ctx)
+
+	bs := BlockStreamer{
+		ctx:       bsCtx,
+		cancel:    cancel,
+		rpcClient: rpcClient,
+		blocks:    blocks,
+		allocOpts: allocOpts,
+		ring:      make([]api.NodeWithMeta, BlockStreamBuffer),
+		err:       nil,
+	}
+	bs.cond = sync.NewCond(&bs.mu)
+	for _, d := range dests {
+		bs.dests = append(bs.dests, &destination{peer: d})
+	}
+
+	go bs.streamBlocks()
+	return &bs
+}
+
+// Done returns a channel which gets closed when the BlockStreamer has
+// finished.
+func (bs *BlockStreamer) Done() <-chan struct{} {
+	return bs.ctx.Done()
+}
+
+// Err returns any errors that happened after the operation of the
+// BlockStreamer, for example when blocks could not be put to all nodes.
+func (bs *BlockStreamer) Err() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.err
+}
+
+// Allocations returns the destinations which have not been given up,
+// including those allocated to replace the others.
+func (bs *BlockStreamer) Allocations() []peer.ID {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	var allocs []peer.ID
+	for _, d := range bs.dests {
+		if d.err == nil {
+			allocs = append(allocs, d.peer)
+		}
+	}
+	return allocs
+}
+
+// Progress returns how far each destination is.
+func (bs *BlockStreamer) Progress() []api.AddDestination {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	progress := make([]api.AddDestination, len(bs.dests))
+	for i, d := range bs.dests {
+		progress[i] = api.AddDestination{
+			Peer:      d.peer,
+			Blocks:    d.sent,
+			Confirmed: d.confirmed,
+			Missed:    d.missed,
+			Retries:   d.retries,
+			Replaces:  d.replaces,
+		}
+		if d.err != nil {
+			progress[i].Error = d.err.Error()
+		}
+	}
+	return progress
+}
+
+func (bs *BlockStreamer) streamBlocks() {
+	defer bs.cancel()
+
+	// Wake up whoever waits for blocks when we are cancelled.
+	go func() {
+		<-bs.ctx.Done()
+		bs.broadcast()
+	}()
+
+	bs.mu.Lock()
+	for _, d := range bs.dests {
+		bs.startDestination(d)
+	}
+	bs.mu.Unlock()
+
+	for b := range bs.blocks {
+		if !bs.push(b) {
+			// Nobody is left to stream to. Drain the blocks
+			// until the channel is closed.
+			go func() {
+				for range bs.blocks {
+				}
+			}()
+			break
+		}
+	}
+
+	bs.mu.Lock()
+	bs.closed = true
+	bs.cond.Broadcast()
+	bs.mu.Unlock()
+
+	bs.wg.Wait()
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	failed := 0
+	for _, d := range bs.dests {
+		if d.err != nil {
+			logger.Warnf("error streaming blocks to %s: %s", d.peer, d.err)
+			failed++
+		}
+	}
+	// FIXME: replicate everywhere.
+	if failed == len(bs.dests) {
+		logger.Error(ErrBlockAdder)
+		bs.err = ErrBlockAdder
+	} else if failed > 0 {
+		logger.Warning("there were errors streaming blocks, but at least one destination succeeded")
+	}
+}
+
+func (bs *BlockStreamer) broadcast() {
+	bs.mu.Lock()
+	bs.cond.Broadcast()
+	bs.mu.Unlock()
+}
+
+// startDestination starts streaming to d. It must be called with mu held.
+func (bs *BlockStreamer) startDestination(d *destination) {
+	bs.wg.Add(1)
+	go func() {
+		defer bs.wg.Done()
+		bs.streamDestination(d)
+	}()
+}
+
+// tail returns the oldest block still kept. It must be called with mu held.
+func (bs *BlockStreamer) tail() uint64 {
+	if bs.head < uint64(len(bs.ring)) {
+		return 0
+	}
+	return bs.head - uint64(len(bs.ring))
+}
+
+// push waits until the slowest destination has room for b and keeps it. It
+// returns false when no destination is left.
+func (bs *BlockStreamer) push(b api.NodeWithMeta) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	for {
+		if bs.ctx.Err() != nil {
+			return false
+		}
+		slowest, ok := uint64(0), false
+		for _, d := range bs.dests {
+			if d.done || d.err != nil {
+				continue
+			}
+			if !ok || d.cursor < slowest {
+				slowest, ok = d.cursor, true
+			}
+		}
+		if !ok {
+			return false
+		}
+		if bs.head-slowest < uint64(len(bs.ring)) {
+			break
+		}
+		bs.cond.Wait()
+	}
+
+	bs.ring[bs.head%uint64(len(bs.ring))] = b
+	bs.head++
+	bs.cond.Broadcast()
+	return true
+}
+
+// next waits for the next block to send to d. It returns false once all
+// blocks are sent, or when ctx is done.
+func (bs *BlockStreamer) next(ctx context.Context, d *destination) (api.NodeWithMeta, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	for d.cursor == bs.head && !bs.closed && ctx.Err() == nil {
+		bs.cond.Wait()
+	}
+	if ctx.Err() != nil || d.cursor == bs.head {
+		return api.NodeWithMeta{}, false
+	}
+
+	b := bs.ring[d.cursor%uint64(len(bs.ring))]
+	d.cursor++
+	// Blocks sent again after a failed stream are only counted once.
+	if d.cursor > d.high {
+		d.high = d.cursor
+		d.sent++
+	}
+	bs.cond.Broadcast()
+	return b, true
+}
+
+// streamDestination streams the blocks to d, restarting the stream when it
+// fails until it succeeds or d is given up.
+func (bs *BlockStreamer) streamDestination(d *destination) {
+	delay := BlockStreamRetryDelay
+	for {
+		bs.mu.Lock()
+		start := d.cursor
+		confirmed := d.confirmed
+		bs.mu.Unlock()
+
+		err := bs.streamOnce(d)
+		if err == nil {
+			bs.mu.Lock()
+			d.done = true
+			bs.cond.Broadcast()
+			bs.mu.Unlock()
+			return
+		}
+
+		bs.mu.Lock()
+		giveUp := bs.ctx.Err() != nil || d.retries >= BlockStreamRetries
+		if !giveUp {
+			// Send again what the failed stream did not confirm.
+			// The blocks are confirmed in order.
+			resume := start + (d.confirmed - confirmed)
+			if resume > d.cursor {
+				resume = d.cursor
+			}
+			if tail := bs.tail(); resume < tail {
+				err = fmt.Errorf("%d blocks may have been lost and are no longer kept: %w", tail-resume, err)
+				giveUp = true
+			} else {
+				d.retries++
+				d.cursor = resume
+			}
+		}
+		bs.mu.Unlock()
+
+		if giveUp {
+			bs.replace(d)
+			bs.mu.Lock()
+			d.err = err
+			bs.cond.Broadcast()
+			bs.mu.Unlock()
+			return
+		}
+
+		logger.Warnf("streaming blocks to %s failed, retrying in %s: %s", d.peer, delay, err)
+		select {
+		case <-bs.ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// streamOnce streams to d the blocks from its cursor with a single
+// BlockStream call.
+func (bs *BlockStreamer) streamOnce(d *destination) error {
+	// BlockStream fails without blocks, so we wait for a first one
+	// before calling it.
+	first, ok := bs.next(bs.ctx, d)
+	if !ok {
+		return bs.ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(bs.ctx)
+	defer cancel()
+
+	in := make(chan api.NodeWithMeta)
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(in)
+		for b, ok := first, true; ok; b, ok = bs.next(ctx, d) {
+			select {
+			case <-ctx.Done():
+				return
+			case in <- b:
+			}
+		}
+	}()
+
+	// A value is sent on out for every block the destination confirms
+	// having written.
+	out := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for range out {
+			bs.mu.Lock()
+			d.confirmed++
+			bs.mu.Unlock()
+		}
+	}()
+
+	err := bs.rpcClient.Stream(
+		ctx,
+		d.peer,
+		"IPFSConnector",
+		"BlockStream",
+		in,
+		out,
+	)
+
+	// Stop feeding the stream before anyone touches the cursor again.
+	cancel()
+	bs.broadcast()
+	<-fed
+	<-drained
+	if err == nil {
+		// The stream may have been closed early.
+		err = bs.ctx.Err()
+	}
+	if err == nil {
+		// Peers running older versions confirm nothing, and
+		// duplicated blocks are confirmed once. A successful
+		// stream confirms everything it was sent.
+		bs.mu.Lock()
+		d.confirmed = d.sent
+		bs.mu.Unlock()
+	}
+	return err
+}
+
+// replace allocates a destination in place of d, which is being given up,
+// and starts streaming to it from the oldest block still kept.
+func (bs *BlockStreamer) replace(d *destination) {
+	if bs.allocOpts == nil || bs.ctx.Err() != nil {
+		return
+	}
+
+	opts := *bs.allocOpts
+	known := make(map[peer.ID]struct{})
+	opts.UserAllocations = nil
+	bs.mu.Lock()
+	for _, other := range bs.dests {
+		known[other.peer] = struct{}{}
+		if other != d && other.err == nil {
+			opts.UserAllocations = append(opts.UserAllocations, other.peer)
+		}
+	}
+	bs.mu.Unlock()
+
+	allocs, err := BlockAllocate(bs.ctx, bs.rpcClient, opts)
+	if err != nil {
+		logger.Warnf("cannot allocate a replacement for %s: %s", d.peer, err)
+		return
+	}
+	for _, p := range allocs {
+		if p == "" {
+			p = bs.rpcClient.ID()
+		}
+		if _, ok := known[p]; ok {
+			continue
+		}
+
+		bs.mu.Lock()
+		defer bs.mu.Unlock()
+		tail := bs.tail()
+		r := &destination{
+			peer:     p,
+			replaces: d.peer,
+			cursor:   tail,
+			high:     tail,
+			missed:   tail,
+		}
+		bs.dests = append(bs.dests, r)
+		logger.Infof("streaming blocks to %s in place of %s", p, d.peer)
+		bs.startDestination(r)
+		return
+	}
+	logger.Warnf("no peer left to replace %s", d.peer)
+}
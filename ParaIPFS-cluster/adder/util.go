@@ -4,104 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 
 	"github.com/ipfs/ipfs-cluster/api"
-	"go.uber.org/multierr"
 
 	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
 
-// ErrBlockAdder is returned when adding a to multiple destinations
-// block fails on all of them.
-var ErrBlockAdder = errors.New("failed to put block on all destinations")
-
-// BlockStreamer helps streaming nodes to multiple destinations, as long as
-// one of them is still working.
-type BlockStreamer struct {
-	dests     []peer.ID
-	rpcClient *rpc.Client
-	blocks    <-chan api.NodeWithMeta
-
-	ctx    context.Context
-	cancel context.CancelFunc
-	errMu  sync.Mutex
-	err    error
-}
-
-// NewBlockStreamer creates a BlockStreamer given an rpc client, allocated
-// peers and a channel on which the blocks to stream are received.
-func NewBlockStreamer(ctx context.Context, rpcClient *rpc.Client, dests []peer.ID, blocks <-chan api.NodeWithMeta) *BlockStreamer {
-	bsCtx, cancel := context.WithCancel(ctx)
-
-	bs := BlockStreamer{
-		ctx:       bsCtx,
-		cancel:    cancel,
-		dests:     dests,
-		rpcClient: rpcClient,
-		blocks:    blocks,
-		err:       nil,
-	}
-
-	go bs.streamBlocks()
-	return &bs
-}
-
-// Done returns a channel which gets closed when the BlockStreamer has
-// finished.
-func (bs *BlockStreamer) Done() <-chan struct{} {
-	return bs.ctx.Done()
-}
-
-func (bs *BlockStreamer) setErr(err error) {
-	bs.errMu.Lock()
-	bs.err = err
-	bs.errMu.Unlock()
-}
-
-// Err returns any errors that happened after the operation of the
-// BlockStreamer, for example when blocks could not be put to all nodes.
-func (bs *BlockStreamer) Err() error {
-	bs.errMu.Lock()
-	defer bs.errMu.Unlock()
-	return bs.err
-}
-
-func (bs *BlockStreamer) streamBlocks() {
-	defer bs.cancel()
-
-	// Nothing should be sent on out.
-	// We drain though
-	out := make(chan struct{})
-	go func() {
-		for range out {
-		}
-	}()
-
-	errs := bs.rpcClient.MultiStream(
-		bs.ctx,
-		bs.dests,
-		"IPFSConnector",
-		"BlockStream",
-		bs.blocks,
-		out,
-	)
-
-	combinedErrors := multierr.Combine(errs...)
-
-	// FIXME: replicate everywhere.
-	if len(multierr.Errors(combinedErrors)) == len(bs.dests) {
-		logger.Error(combinedErrors)
-		bs.setErr(ErrBlockAdder)
-	} else if combinedErrors != nil {
-		logger.Warning("there were errors streaming blocks, but at least one destination succeeded")
-		logger.Warning(combinedErrors)
-	}
-}
-
 // IpldNodeToNodeWithMeta converts an ipld.Node to api.NodeWithMeta.
 func IpldNodeToNodeWithMeta(n ipld.Node) api.NodeWithMeta {
 	size, err := n.Size()
@@ -151,6 +63,48 @@ func Pin(ctx context.Context, rpc *rpc.Client, pin api.Pin) error {
 	)
 }
 
+// MaxTierCidBlockSize is the size over which the TierCid of an added DAG is
+// not sent along with it. IPFS daemons cannot move such blocks between them,
+// and build the TierCid themselves instead.
+var MaxTierCidBlockSize = 1024 * 1024
+
+// TierCidNode takes the TierCid recorded for root by the parallel layout out
+// of merkledag.PinBuffer, and returns it serialized in a raw block.
+func TierCidNode(root cid.Cid) (ipld.Node, bool) {
+	merkledag.PinBufferMutex.Lock()
+	tc, ok := merkledag.PinBuffer[root]
+	delete(merkledag.PinBuffer, root)
+	merkledag.PinBufferMutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data := tc.Marshal()
+	if len(data) > MaxTierCidBlockSize {
+		logger.Warnf("not sending the TierCid of %s: %d bytes is too large", root, len(data))
+		return nil, false
+	}
+	return merkledag.NewRawNode(data), true
+}
+
+// PinTierCid pins the block holding the TierCid of the given pin directly,
+// with the same options and allocations, and sets it as the TierCid of the
+// pin. Cluster unpins it along with the pin.
+func PinTierCid(ctx context.Context, rpc *rpc.Client, pin *api.Pin, tierCid api.Cid) error {
+	opts := pin.PinOptions
+	opts.Mode = api.PinModeDirect
+	if opts.Name != "" {
+		opts.Name = fmt.Sprintf("%s-tiercid", opts.Name)
+	}
+	tcPin := api.PinWithOpts(tierCid, opts)
+	tcPin.Allocations = pin.Allocations
+	if err := Pin(ctx, rpc, tcPin); err != nil {
+		return err
+	}
+	pin.TierCid = &tierCid
+	return nil
+}
+
 // ErrDAGNotFound is returned whenever we try to get a block from the DAGService.
 var ErrDAGNotFound = errors.New("dagservice: block not found")
 
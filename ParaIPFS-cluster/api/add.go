@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -15,12 +16,46 @@ var DefaultShardSize = uint64(100 * 1024 * 1024) // 100 MB
 
 // AddedOutput carries information for displaying the standard ipfs output
 // indicating a node of a file has been added.
+//
+// When adding with Progress, outputs without a Cid report the progress of
+// the add instead.
 type AddedOutput struct {
 	Name        string    `json:"name" codec:"n,omitempty"`
 	Cid         Cid       `json:"cid" codec:"c"`
 	Bytes       uint64    `json:"bytes,omitempty" codec:"b,omitempty"`
 	Size        uint64    `json:"size,omitempty" codec:"s,omitempty"`
 	Allocations []peer.ID `json:"allocations,omitempty" codec:"a,omitempty"`
+	// Chunked is the number of bytes chunked so far, over all the
+	// added files.
+	Chunked uint64 `json:"chunked,omitempty" codec:"ch,omitempty"`
+	// Blocks is the number of blocks written so far to the DAG service.
+	Blocks uint64 `json:"blocks,omitempty" codec:"bl,omitempty"`
+	// Destinations reports how the blocks are being streamed to each of
+	// the peers they are put on.
+	Destinations []AddDestination `json:"destinations,omitempty" codec:"d,omitempty"`
+}
+
+// AddDestination carries the progress of streaming the blocks of an add to
+// one of the peers they are put on.
+type AddDestination struct {
+	// Peer is empty when the blocks are put on the local peer.
+	Peer peer.ID `json:"peer,omitempty" codec:"p"`
+	// Blocks is the number of blocks sent to the peer so far. Blocks
+	// sent again after a failed stream are only counted once.
+	Blocks uint64 `json:"blocks" codec:"b"`
+	// Confirmed is the number of blocks the peer confirmed having
+	// written, counted like Blocks.
+	Confirmed uint64 `json:"confirmed" codec:"c"`
+	// Missed is the number of blocks streamed before the peer was
+	// allocated in place of one that was given up. The peer fetches
+	// them from the other destinations when pinning.
+	Missed  uint64 `json:"missed,omitempty" codec:"m,omitempty"`
+	Retries int    `json:"retries,omitempty" codec:"r,omitempty"`
+	// Error is set when the peer was given up.
+	Error string `json:"error,omitempty" codec:"e,omitempty"`
+	// Replaces is set when the peer was allocated in place of one that
+	// was given up.
+	Replaces peer.ID `json:"replaces,omitempty" codec:"rp,omitempty"`
 }
 
 // IPFSAddParams groups options specific to the ipfs-adder, which builds
@@ -49,6 +84,11 @@ type AddParams struct {
 	Format         string // selects with adder
 	NoPin          bool
 
+	// ServerPaths lists files or directories on the disk of the peer
+	// receiving the request, added instead of the request body. The
+	// REST API only accepts paths under its add_server_path_roots.
+	ServerPaths []string
+
 	IPFSAddParams
 }
 
@@ -210,6 +250,8 @@ func AddParamsFromQuery(query url.Values) (AddParams, error) {
 		return params, err
 	}
 
+	params.ServerPaths = query["server-path"]
+
 	return params, nil
 }
 
@@ -238,6 +280,9 @@ func (p AddParams) ToQueryString() (string, error) {
 	query.Set("nocopy", fmt.Sprintf("%t", p.NoCopy))
 	query.Set("format", p.Format)
 	query.Set("no-pin", fmt.Sprintf("%t", p.NoPin))
+	for _, sp := range p.ServerPaths {
+		query.Add("server-path", sp)
+	}
 	return query.Encode(), nil
 }
 
@@ -257,5 +302,6 @@ func (p AddParams) Equals(p2 AddParams) bool {
 		p.StreamChannels == p2.StreamChannels &&
 		p.NoCopy == p2.NoCopy &&
 		p.Format == p2.Format &&
-		p.NoPin == p2.NoPin
+		p.NoPin == p2.NoPin &&
+		strings.Join(p.ServerPaths, "\x00") == strings.Join(p2.ServerPaths, "\x00")
 }
@@ -82,6 +82,7 @@ func TestAddParams_ToQueryString(t *testing.T) {
 	p.Name = "something"
 	p.RawLeaves = true
 	p.ShardSize = 1020
+	p.ServerPaths = []string{"/mnt/staging/a", "/mnt/staging/b c"}
 	qstr, err := p.ToQueryString()
 	if err != nil {
 		t.Fatal(err)
@@ -99,4 +100,9 @@ func TestAddParams_ToQueryString(t *testing.T) {
 	if !p.Equals(p2) {
 		t.Error("generated and parsed params should be equal")
 	}
+
+	p2.ServerPaths = p2.ServerPaths[:1]
+	if p.Equals(p2) {
+		t.Error("params with different server paths should not be equal")
+	}
 }
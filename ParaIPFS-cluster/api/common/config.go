@@ -105,6 +105,12 @@ type Config struct {
 	CORSAllowCredentials bool
 	CORSMaxAge           time.Duration
 
+	// AddServerPathRoots lists the directories under which the files
+	// to add can be given as paths on the disk of the peer. Adding from
+	// server-side paths is disabled when it is empty. Only the REST API
+	// supports it.
+	AddServerPathRoots []string
+
 	// Tracing flag used to skip tracing specific paths when not enabled.
 	Tracing bool
 }
@@ -133,6 +139,8 @@ type jsonConfig struct {
 	CORSExposedHeaders   []string `json:"cors_exposed_headers"`
 	CORSAllowCredentials bool     `json:"cors_allow_credentials"`
 	CORSMaxAge           string   `json:"cors_max_age"`
+
+	AddServerPathRoots []string `json:"add_server_path_roots,omitempty"`
 }
 
 // GetHTTPLogPath gets full path of the file where http logs should be
@@ -189,6 +197,12 @@ func (cfg *Config) Validate() error {
 		return errors.New(cfg.ConfigKey + ".cors_max_age is invalid")
 	}
 
+	for _, root := range cfg.AddServerPathRoots {
+		if !filepath.IsAbs(root) {
+			return fmt.Errorf("%s.add_server_path_roots: %q is not an absolute path", cfg.ConfigKey, root)
+		}
+	}
+
 	return cfg.validateLibp2p()
 }
 
@@ -239,6 +253,7 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	cfg.BasicAuthCredentials = jcfg.BasicAuthCredentials
 	cfg.HTTPLogFile = jcfg.HTTPLogFile
 	cfg.Headers = jcfg.Headers
+	cfg.AddServerPathRoots = jcfg.AddServerPathRoots
 
 	return cfg.Validate()
 }
@@ -400,6 +415,7 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 		CORSExposedHeaders:     cfg.CORSExposedHeaders,
 		CORSAllowCredentials:   cfg.CORSAllowCredentials,
 		CORSMaxAge:             cfg.CORSMaxAge.String(),
+		AddServerPathRoots:     cfg.AddServerPathRoots,
 	}
 
 	if cfg.ID != "" {
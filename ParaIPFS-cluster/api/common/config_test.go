@@ -217,6 +217,15 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error with MaxHeaderBytes")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.AddServerPathRoots = []string{"relative/root"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with a relative add_server_path_roots entry")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
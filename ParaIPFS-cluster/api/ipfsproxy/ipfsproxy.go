@@ -618,10 +618,18 @@ func (proxy *Server) addHandler(w http.ResponseWriter, r *http.Request) {
 	if nopin {
 		params.NoPin = true
 	}
+	// Paths on the disk of the peer are only added through the REST
+	// API, which checks them against its allowlist.
+	params.ServerPaths = nil
 
 	logger.Warnf("Proxy/add does not support all IPFS params. Current options: %+v", params)
 
 	outputTransform := func(in api.AddedOutput) interface{} {
+		// The progress outputs of cluster have no
+		// equivalent in ipfs.
+		if !in.Cid.Defined() && in.Bytes == 0 {
+			return nil
+		}
 		cidStr := ""
 		if in.Cid.Defined() {
 			cidStr = in.Cid.String()
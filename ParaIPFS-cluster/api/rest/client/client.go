@@ -56,10 +56,17 @@ type Client interface {
 	// PeerRm removes a current peer from the cluster
 	PeerRm(ctx context.Context, pid peer.ID) error
 
-	// Add imports files to the cluster from the given paths.
+	// Add imports files to the cluster from the given paths. The
+	// outputs of the add are streamed on out, which is closed when
+	// done. With params.Progress, outputs without a Cid report the
+	// bytes chunked, the blocks written and the blocks confirmed by
+	// each destination as the add goes.
 	Add(ctx context.Context, paths []string, params api.AddParams, out chan<- api.AddedOutput) error
 	// AddMultiFile imports new files from a MultiFileReader.
 	AddMultiFile(ctx context.Context, multiFileR *files.MultiFileReader, params api.AddParams, out chan<- api.AddedOutput) error
+	// AddServerPaths imports files found at the given paths on the disk
+	// of the cluster peer.
+	AddServerPaths(ctx context.Context, paths []string, params api.AddParams, out chan<- api.AddedOutput) error
 
 	// Pin tracks a Cid with the given replication factor and a name for
 	// human-friendliness.
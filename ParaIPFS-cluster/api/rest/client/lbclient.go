@@ -538,6 +538,39 @@ func (lc *loadBalancingClient) AddMultiFile(
 	return err
 }
 
+// AddServerPaths imports files found on the disk of the cluster peer. See
+// Add().
+func (lc *loadBalancingClient) AddServerPaths(
+	ctx context.Context,
+	paths []string,
+	params api.AddParams,
+	out chan<- api.AddedOutput,
+) error {
+	call := func(c Client) error {
+		done := make(chan struct{})
+		cout := make(chan api.AddedOutput, cap(out))
+		go func() {
+			for o := range cout {
+				out <- o
+			}
+			done <- struct{}{}
+		}()
+
+		// this blocks until done
+		err := c.AddServerPaths(ctx, paths, params, cout)
+		// wait for cout to be closed
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		return err
+	}
+
+	err := lc.retry(0, call)
+	close(out)
+	return err
+}
+
 // IPFS returns an instance of go-ipfs-api's Shell, pointing to the
 // configured ProxyAddr (or to the default Cluster's IPFS proxy port).
 // It re-uses this Client's HTTP client, thus will be constrained by
@@ -674,9 +674,57 @@ func (c *defaultClient) AddMultiFile(
 		return err
 	}
 
-	// our handler decodes an AddedOutput and puts it
-	// in the out channel.
-	handler := func(dec *json.Decoder) error {
+	err = c.doStream(ctx,
+		"POST",
+		"/add?"+queryStr,
+		headers,
+		multiFileR,
+		addedOutputHandler(out),
+	)
+	return err
+}
+
+// AddServerPaths imports the files or directories found at the given paths
+// on the disk of the cluster peer, which must lie under the
+// add_server_path_roots of its REST API. Nothing is uploaded, and the peer
+// builds the DAGs of the files with the parallel layout.
+func (c *defaultClient) AddServerPaths(
+	ctx context.Context,
+	paths []string,
+	params api.AddParams,
+	out chan<- api.AddedOutput,
+) error {
+	ctx, span := trace.StartSpan(ctx, "client/AddServerPaths")
+	defer span.End()
+
+	defer close(out)
+
+	if len(paths) == 0 {
+		return errors.New("need at least one server path")
+	}
+
+	// This method must run with StreamChannels set.
+	params.StreamChannels = true
+	params.ServerPaths = paths
+	queryStr, err := params.ToQueryString()
+	if err != nil {
+		return err
+	}
+
+	err = c.doStream(ctx,
+		"POST",
+		"/add?"+queryStr,
+		nil,
+		nil,
+		addedOutputHandler(out),
+	)
+	return err
+}
+
+// addedOutputHandler returns a handler that decodes an AddedOutput and puts
+// it in the out channel.
+func addedOutputHandler(out chan<- api.AddedOutput) responseDecoder {
+	return func(dec *json.Decoder) error {
 		if out == nil {
 			return nil
 		}
@@ -688,13 +736,4 @@ func (c *defaultClient) AddMultiFile(
 		out <- obj
 		return nil
 	}
-
-	err = c.doStream(ctx,
-		"POST",
-		"/add?"+queryStr,
-		headers,
-		multiFileR,
-		handler,
-	)
-	return err
 }
@@ -869,6 +869,52 @@ func TestAddMultiFile(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestAddProgress(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer api.Shutdown(ctx)
+
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+
+	testF := func(t *testing.T, c Client) {
+		mfr, closer := sth.GetTreeMultiReader(t)
+		defer closer.Close()
+
+		p := types.DefaultAddParams()
+		p.Progress = true
+
+		out := make(chan types.AddedOutput, 1)
+		var progress []types.AddedOutput
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range out {
+				if !v.Cid.Defined() {
+					progress = append(progress, v)
+				}
+			}
+		}()
+
+		err := c.AddMultiFile(ctx, mfr, p, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+
+		if len(progress) == 0 {
+			t.Fatal("expected progress outputs")
+		}
+		last := progress[len(progress)-1]
+		if last.Chunked == 0 || last.Blocks == 0 {
+			t.Errorf("unexpected progress: %+v", last)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRepoGC(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
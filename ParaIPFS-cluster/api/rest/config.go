@@ -126,5 +126,8 @@ func defaultFunc(cfg *common.Config) error {
 	cfg.CORSAllowCredentials = DefaultCORSAllowCredentials
 	cfg.CORSMaxAge = DefaultCORSMaxAge
 
+	// Adding from server-side paths is disabled
+	cfg.AddServerPathRoots = nil
+
 	return nil
 }
@@ -13,6 +13,8 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +23,7 @@ import (
 	types "github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/api/common"
 
+	files "github.com/ipfs/go-ipfs-files"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -285,13 +288,18 @@ func (api *API) alertsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
-	reader, err := r.MultipartReader()
+	params, err := types.AddParamsFromQuery(r.URL.Query())
 	if err != nil {
 		api.SendResponse(w, http.StatusBadRequest, err, nil)
 		return
 	}
 
-	params, err := types.AddParamsFromQuery(r.URL.Query())
+	if len(params.ServerPaths) > 0 {
+		api.addServerPathsHandler(w, r, params)
+		return
+	}
+
+	reader, err := r.MultipartReader()
 	if err != nil {
 		api.SendResponse(w, http.StatusBadRequest, err, nil)
 		return
@@ -310,6 +318,98 @@ func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// addServerPathsHandler adds the files at params.ServerPaths, read from the
+// disk of this peer, so that the parallel layout can build them. The paths
+// must lie under one of the AddServerPathRoots.
+func (api *API) addServerPathsHandler(w http.ResponseWriter, r *http.Request, params types.AddParams) {
+	entries := make([]files.DirEntry, 0, len(params.ServerPaths))
+	for _, p := range params.ServerPaths {
+		status, node, err := api.openServerPath(p, params)
+		if err != nil {
+			for _, e := range entries {
+				e.Node().Close()
+			}
+			api.SendResponse(w, status, err, nil)
+			return
+		}
+		entries = append(entries, files.FileEntry(filepath.Base(p), node))
+	}
+	dir := files.NewSliceDirectory(entries)
+	defer dir.Close()
+
+	api.SetHeaders(w)
+
+	// any errors sent as trailer
+	adderutils.AddFilesHTTPHandler(
+		r.Context(),
+		api.rpcClient,
+		params,
+		dir,
+		w,
+		nil,
+	)
+}
+
+// openServerPath checks that p is allowed and opens it. The returned status
+// is meant for the response when it fails. Any path out of the roots gets the
+// same error, whether it exists or not.
+func (api *API) openServerPath(p string, params types.AddParams) (int, files.Node, error) {
+	if !filepath.IsAbs(p) {
+		return http.StatusBadRequest, nil, fmt.Errorf("server path %s is not absolute", p)
+	}
+	forbidden := fmt.Errorf("server path %s is not under any of the allowed roots", p)
+	// Nothing out of the roots is touched, then links are resolved so
+	// that they cannot point out of them.
+	cleaned := filepath.Clean(p)
+	if !api.serverPathAllowed(cleaned) {
+		return http.StatusForbidden, nil, forbidden
+	}
+	resolved, err := filepath.EvalSymlinks(cleaned)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if !api.serverPathAllowed(resolved) {
+		return http.StatusForbidden, nil, forbidden
+	}
+
+	stat, err := os.Lstat(resolved)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if stat.IsDir() && !params.Recursive {
+		return http.StatusBadRequest, nil, fmt.Errorf("%s is a directory, use recursive", p)
+	}
+	node, err := files.NewSerialFile(resolved, params.Hidden, stat)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	return http.StatusOK, node, nil
+}
+
+// serverPathAllowed returns whether the clean path p is one of the
+// AddServerPathRoots or lies under one of them. Each root is compared both as
+// configured and with its links resolved.
+func (api *API) serverPathAllowed(p string) bool {
+	for _, root := range api.config.AddServerPathRoots {
+		roots := []string{filepath.Clean(root)}
+		if resolved, err := filepath.EvalSymlinks(root); err != nil {
+			logger.Warnf("cannot resolve add_server_path_roots entry: %s", err)
+		} else {
+			roots = append(roots, resolved)
+		}
+		for _, root := range roots {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				continue
+			}
+			if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (api *API) peerListHandler(w http.ResponseWriter, r *http.Request) {
 	in := make(chan struct{})
 	close(in)
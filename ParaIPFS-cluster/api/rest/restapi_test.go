@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -266,6 +268,101 @@ func TestAPIAddFileEndpoint_StreamChannelsFalse(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIAddFileEndpointServerPath(t *testing.T) {
+	ctx := context.Background()
+
+	sth := clustertest.NewShardingTestHelper()
+	defer sth.Clean(t)
+
+	// This generates the testing files and
+	// writes them to disk.
+	_, closer := sth.GetTreeMultiReader(t)
+	closer.Close()
+
+	root, err := filepath.Abs("shardTesting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := filepath.Join(root, "testTree")
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(filepath.Dir(root), link); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.Default()
+	cfg.CORSAllowedOrigins = []string{clientOrigin}
+	cfg.CORSAllowedMethods = []string{"GET", "POST", "DELETE"}
+	cfg.CORSMaxAge = 10 * time.Minute
+	cfg.AddServerPathRoots = []string{root}
+	rest := testAPIwithConfig(t, cfg, "server path")
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		// The files over a chunk, like B/big_file, are read from
+		// their path by the parallel layout.
+		resp := api.AddedOutput{}
+		addURL := url(rest) + "/add?recursive=true&stream-channels=true&server-path=" + tree
+		test.MakeStreamingPost(t, rest, addURL, nil, "", &resp)
+		if resp.Cid.String() != clustertest.ShardingDirBalancedRootCID {
+			t.Error("Bad Cid after adding: ", resp.Cid)
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?server-path="+tree, []byte{}, &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected error adding a directory without recursive")
+		}
+
+		errResp = api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?recursive=true&server-path="+filepath.Dir(root), []byte{}, &errResp)
+		if errResp.Code != http.StatusForbidden {
+			t.Error("expected error adding a path out of the roots")
+		}
+
+		errResp = api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?recursive=true&server-path="+filepath.Join(tree, "..", ".."), []byte{}, &errResp)
+		if errResp.Code != http.StatusForbidden {
+			t.Error("expected error adding a path escaping the roots")
+		}
+
+		errResp = api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?recursive=true&server-path="+filepath.Join(filepath.Dir(root), "missing"), []byte{}, &errResp)
+		if errResp.Code != http.StatusForbidden {
+			t.Error("expected the same error for a missing path out of the roots")
+		}
+
+		errResp = api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?recursive=true&server-path="+link, []byte{}, &errResp)
+		if errResp.Code != http.StatusForbidden {
+			t.Error("expected error adding a link pointing out of the roots")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIAddFileEndpointServerPathDisabled(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/add?recursive=true&server-path="+root, []byte{}, &errResp)
+		if errResp.Code != http.StatusForbidden {
+			t.Error("expected error adding a server path without roots")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIPeerRemoveEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -1009,6 +1009,12 @@ type Pin struct {
 	// When not needed the pointer is nil
 	Reference *Cid `json:"reference" codec:"r,omitempty"`
 
+	// TierCid is the CID of a block, stored next to the content, holding
+	// the serialized TierCid of the pinned DAG. The IPFS daemons install
+	// it when pinning, so that they do not have to walk the DAG to read
+	// or garbage collect it. When not known the pointer is nil.
+	TierCid *Cid `json:"tiercid,omitempty" codec:"tc,omitempty"`
+
 	// The time that the pin was submitted to the consensus layer.
 	Timestamp time.Time `json:"timestamp" codec:"i,omitempty"`
 }
@@ -1023,6 +1029,9 @@ func (pin Pin) String() string {
 	if pin.Reference != nil {
 		fmt.Fprintf(&b, "reference: %s\n", pin.Reference)
 	}
+	if pin.TierCid != nil {
+		fmt.Fprintf(&b, "tiercid: %s\n", pin.TierCid)
+	}
 	return b.String()
 }
 
@@ -1149,6 +1158,9 @@ func (pin Pin) ProtoMarshal() ([]byte, error) {
 	if ref := pin.Reference; ref != nil {
 		pbPin.Reference = ref.Bytes()
 	}
+	if tc := pin.TierCid; tc != nil {
+		pbPin.TierCid = tc.Bytes()
+	}
 	return proto.Marshal(pbPin)
 }
 
@@ -1189,6 +1201,13 @@ func (pin *Pin) ProtoUnmarshal(data []byte) error {
 		pin.Reference = &ref
 	}
 
+	tc, err := CastCid(pbPin.GetTierCid())
+	if err != nil {
+		pin.TierCid = nil
+	} else {
+		pin.TierCid = &tc
+	}
+
 	ts := pbPin.GetTimestamp()
 	if ts > 0 {
 		pin.Timestamp = time.Unix(int64(ts), 0)
@@ -1266,6 +1285,16 @@ func (pin Pin) Equals(pin2 Pin) bool {
 		return false
 	}
 
+	if pin.TierCid != nil && pin2.TierCid == nil ||
+		pin.TierCid == nil && pin2.TierCid != nil {
+		return false
+	}
+
+	if pin.TierCid != nil && pin2.TierCid != nil &&
+		!pin.TierCid.Equals(*pin2.TierCid) {
+		return false
+	}
+
 	allocs1 := PeersToStrings(pin.Allocations)
 	sort.Strings(allocs1)
 	allocs2 := PeersToStrings(pin2.Allocations)
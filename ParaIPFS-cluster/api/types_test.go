@@ -155,6 +155,9 @@ func TestDupTags(t *testing.T) {
 
 	typ = reflect.TypeOf(AddedOutput{})
 	checkDupTags(t, "codec", typ, nil)
+
+	typ = reflect.TypeOf(AddDestination{})
+	checkDupTags(t, "codec", typ, nil)
 }
 
 func TestPinOptionsQuery(t *testing.T) {
@@ -281,3 +284,31 @@ func TestPinCodec(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPinProto(t *testing.T) {
+	ci, _ := DecodeCid("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	tc, _ := DecodeCid("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	pin := PinCid(ci)
+	pin.TierCid = &tc
+
+	data, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pin2 Pin
+	err = pin2.ProtoUnmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin2.TierCid == nil || !pin2.TierCid.Equals(tc) {
+		t.Error("TierCid should survive protobuf serialization")
+	}
+	if !pin.Equals(pin2) {
+		t.Error("pins should be equal")
+	}
+
+	pin2.TierCid = nil
+	if pin.Equals(pin2) {
+		t.Error("pins with different TierCids should not be equal")
+	}
+}
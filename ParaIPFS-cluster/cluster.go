@@ -1433,10 +1433,11 @@ func checkPinType(pin api.Pin) error {
 			return errors.New("data pins should not reference other pins")
 		}
 	case api.ShardType:
-		if pin.MaxDepth != 1 {
-			return errors.New("must pin shards go depth 1")
+		// Shards with more links than fit in a block use an
+		// indirect graph and are pinned with max-depth 2.
+		if pin.MaxDepth != 1 && pin.MaxDepth != 2 {
+			return errors.New("must pin shards go depth 1 or 2")
 		}
-		// FIXME: indirect shard pins could have max-depth 2
 		// FIXME: repinning a shard type will overwrite replication
 		//        factor from previous:
 		// if existing.ReplicationFactorMin != rplMin ||
@@ -1556,7 +1557,12 @@ func (c *Cluster) pin(
 	if existing.Defined() &&
 		pin.PinOptions.Equals(existing.PinOptions) &&
 		len(blacklist) == 0 {
+		// Keep a TierCid sent by the adder if there was none.
+		tierCid := pin.TierCid
 		pin = existing
+		if pin.TierCid == nil {
+			pin.TierCid = tierCid
+		}
 	}
 
 	// Usually allocations are unset when pinning normally, however, the
@@ -1617,7 +1623,11 @@ func (c *Cluster) Unpin(ctx context.Context, h api.Cid) (api.Pin, error) {
 
 	switch pin.Type {
 	case api.DataType:
-		return pin, c.consensus.LogUnpin(ctx, pin)
+		err := c.consensus.LogUnpin(ctx, pin)
+		if err != nil {
+			return pin, err
+		}
+		return pin, c.unpinTierCid(ctx, pin)
 	case api.ShardType:
 		err := "cannot unpin a shard directly. Unpin content root CID instead"
 		return pin, errors.New(err)
@@ -1660,6 +1670,23 @@ func (c *Cluster) unpinClusterDag(metaPin api.Pin) error {
 	return nil
 }
 
+// unpinTierCid unpins the block holding the TierCid of pin, which the adder
+// pinned along with it.
+func (c *Cluster) unpinTierCid(ctx context.Context, pin api.Pin) error {
+	if pin.TierCid == nil {
+		return nil
+	}
+
+	_, err := c.PinGet(ctx, *pin.TierCid)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.consensus.LogUnpin(ctx, api.PinCid(*pin.TierCid))
+}
+
 // PinUpdate pins a new CID based on an existing cluster Pin. The allocations
 // and most pin options (replication factors) are copied from the existing
 // Pin.  The options object can be used to set the Name for the new pin and
@@ -1684,6 +1711,8 @@ func (c *Cluster) PinUpdate(ctx context.Context, from api.Cid, to api.Cid, opts
 
 	existing.Cid = to
 	existing.PinUpdate = from
+	// The TierCid of from does not describe to.
+	existing.TierCid = nil
 	existing.Timestamp = time.Now()
 	if opts.Name != "" {
 		existing.Name = opts.Name
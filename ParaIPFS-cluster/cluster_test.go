@@ -133,7 +133,7 @@ func (ipfs *mockConnector) Resolve(ctx context.Context, path string) (api.Cid, e
 func (ipfs *mockConnector) ConnectSwarms(ctx context.Context) error       { return nil }
 func (ipfs *mockConnector) ConfigKey(keypath string) (interface{}, error) { return nil, nil }
 
-func (ipfs *mockConnector) BlockStream(ctx context.Context, in <-chan api.NodeWithMeta) error {
+func (ipfs *mockConnector) BlockStream(ctx context.Context, in <-chan api.NodeWithMeta, confirmed chan<- struct{}) error {
 	for n := range in {
 		ipfs.blocks.Store(n.Cid.String(), n.Data)
 	}
@@ -871,6 +871,37 @@ func TestClusterUnpin(t *testing.T) {
 	}
 }
 
+func TestClusterUnpinTierCid(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid2, api.PinOptions{Mode: api.PinModeDirect})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	pin := api.PinCid(test.Cid1)
+	pin.TierCid = &test.Cid2
+	_, _, err = cl.pin(ctx, pin, nil)
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	pinDelay()
+
+	_, err = cl.Unpin(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal("unpin should have worked:", err)
+	}
+	pinDelay()
+
+	_, err = cl.PinGet(ctx, test.Cid2)
+	if err != state.ErrNotFound {
+		t.Error("the TierCid should have been unpinned along with the pin:", err)
+	}
+}
+
 func TestClusterUnpinPath(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -312,16 +312,23 @@ Optional replication-min and replication-max factors can be provided: -1 means
 "pin everywhere" and 0 means use cluster's default setting (i.e., replication
 factor set in config). Positive values indicate how many peers should pin this
 content.
+
+With --server-path, the paths are absolute paths on the disk of the cluster
+peer, such as a shared or staging mount, and nothing is uploaded. The peer
+reads the files itself and can build them with the parallel layout. The paths
+must lie under one of the "add_server_path_roots" of the peer's "restapi"
+configuration.
+
+Cluster Add supports handling huge files and sharding the resulting DAG among
+several ipfs daemons (--shard). In this case, a single ipfs daemon will not
+contain the full dag, but only parts of it (shards). Desired shard size can
+be provided with the --shard-size flag. Files built with the parallel layout
+are sharded along its groups of leaves, whose shards are built and sent to
+their allocations at the same time.
+
+We recommend setting a --name for sharded pins. Otherwise, it will be
+automatically generated.
 `,
-			/*
-				Cluster Add supports handling huge files and sharding the resulting DAG among
-				several ipfs daemons (--shard). In this case, a single ipfs daemon will not
-				contain the full dag, but only parts of it (shards). Desired shard size can
-				be provided with the --shard-size flag.
-
-				We recommend setting a --name for sharded pins. Otherwise, it will be
-				automatically generated.
-			*/
 			Flags: []cli.Flag{
 				cli.BoolFlag{
 					Name:  "recursive, r",
@@ -423,23 +430,24 @@ content.
 					Name:  "nocopy",
 					Usage: "Add the URL using filestore. Implies raw-leaves. (experimental)",
 				},
+				cli.BoolFlag{
+					Name:  "server-path",
+					Usage: "Add paths found on the disk of the cluster peer instead of uploading them",
+				},
 
-				// TODO: Uncomment when sharding is supported.
-				// cli.BoolFlag{
-				//	Name:  "shard",
-				//	Usage: "Break the file into pieces (shards) and distributed among peers",
-				// },
-				// cli.Uint64Flag{
-				//	Name:  "shard-size",
-				//	Value: defaultAddParams.ShardSize,
-				//	Usage: "Sets the maximum replication factor for pinning this file",
-				// },
-				// TODO: Figure progress over total bar.
-				// cli.BoolFlag{
-				//	Name:  "progress, p",
-				//	Usage: "Stream progress data",
-				// },
-
+				cli.BoolFlag{
+					Name:  "shard",
+					Usage: "Break the file into pieces (shards) and distributed among peers",
+				},
+				cli.Uint64Flag{
+					Name:  "shard-size",
+					Value: defaultAddParams.ShardSize,
+					Usage: "Sets the maximum size of a shard, in bytes",
+				},
+				cli.BoolFlag{
+					Name:  "progress, p",
+					Usage: "Show the progress of the add on stderr",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				shard := c.Bool("shard")
@@ -479,9 +487,8 @@ content.
 					p.UserAllocations = api.StringsToPeers(strings.Split(c.String("allocations"), ","))
 				}
 				p.Format = c.String("format")
-				//p.Shard = shard
-				//p.ShardSize = c.Uint64("shard-size")
-				p.Shard = false
+				p.Shard = shard
+				p.ShardSize = c.Uint64("shard-size")
 				p.Recursive = c.Bool("recursive")
 				p.Local = c.Bool("local")
 				p.Layout = c.String("layout")
@@ -501,6 +508,18 @@ content.
 				if p.NoCopy {
 					p.RawLeaves = true
 				}
+				p.Progress = c.Bool("progress")
+
+				var bar *addProgressBar
+				if p.Progress {
+					// The size of server paths is not known
+					// here.
+					var total uint64
+					if !c.Bool("server-path") {
+						total = addTotalSize(paths, p.Hidden)
+					}
+					bar = newAddProgressBar(os.Stderr, total)
+				}
 
 				// Prevent footgun
 				if p.Wrap && p.Format == "car" {
@@ -519,6 +538,13 @@ content.
 					var q = c.Bool("quiet") || qq
 					var bufferResults = c.Bool("no-stream")
 					for v := range out {
+						if !v.Cid.Defined() {
+							// a progress output
+							if bar != nil {
+								bar.update(v)
+							}
+							continue
+						}
 						added := addedOutputQuiet{
 							AddedOutput: v,
 							quiet:       q,
@@ -529,9 +555,15 @@ content.
 							continue
 						}
 						if !qq { // print things
+							if bar != nil {
+								bar.clear()
+							}
 							formatResponse(c, added, nil)
 						}
 					}
+					if bar != nil {
+						bar.finish()
+					}
 					if !lastBuf.AddedOutput.Cid.Defined() {
 						return // no elements at all
 					}
@@ -559,7 +591,12 @@ content.
 					}
 				}()
 
-				cerr := globalClient.Add(ctx, paths, p, out)
+				var cerr error
+				if c.Bool("server-path") {
+					cerr = globalClient.AddServerPaths(ctx, paths, p, out)
+				} else {
+					cerr = globalClient.Add(ctx, paths, p, out)
+				}
 				wg.Wait()
 				formatResponse(c, nil, cerr)
 				return cerr
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+const progressBarWidth = 30
+
+// addProgressBar draws the progress outputs of an add on a single line.
+type addProgressBar struct {
+	w     io.Writer
+	total uint64 // 0 when unknown
+	drawn bool
+}
+
+func newAddProgressBar(w io.Writer, total uint64) *addProgressBar {
+	return &addProgressBar{
+		w:     w,
+		total: total,
+	}
+}
+
+// update draws the given progress output.
+func (bar *addProgressBar) update(out api.AddedOutput) {
+	var b strings.Builder
+	if bar.total > 0 {
+		done := out.Chunked
+		if done > bar.total {
+			done = bar.total
+		}
+		filled := int(done * progressBarWidth / bar.total)
+		fmt.Fprintf(&b, "[%s%s] %3d%% %s / %s",
+			strings.Repeat("#", filled),
+			strings.Repeat("-", progressBarWidth-filled),
+			done*100/bar.total,
+			humanize.IBytes(out.Chunked),
+			humanize.IBytes(bar.total),
+		)
+	} else {
+		fmt.Fprintf(&b, "%s chunked", humanize.IBytes(out.Chunked))
+	}
+
+	fmt.Fprintf(&b, " | %d blocks", out.Blocks)
+
+	// The blocks are confirmed as far as the slowest destination.
+	var confirmed uint64
+	peers := 0
+	for _, d := range out.Destinations {
+		if d.Error != "" {
+			continue
+		}
+		if peers == 0 || d.Confirmed < confirmed {
+			confirmed = d.Confirmed
+		}
+		peers++
+	}
+	if peers > 0 {
+		fmt.Fprintf(&b, " | %d confirmed on %d peers", confirmed, peers)
+	}
+
+	// Clear what is left of the previous line.
+	fmt.Fprintf(bar.w, "\r%s\033[K", b.String())
+	bar.drawn = true
+}
+
+// clear erases the progress bar, so that something else can be printed on
+// its line. The next update draws it again.
+func (bar *addProgressBar) clear() {
+	if bar.drawn {
+		fmt.Fprint(bar.w, "\r\033[K")
+		bar.drawn = false
+	}
+}
+
+// finish ends the line of the progress bar.
+func (bar *addProgressBar) finish() {
+	if bar.drawn {
+		fmt.Fprintln(bar.w)
+	}
+}
+
+// addTotalSize returns the size of the local files that adding the given
+// paths reads, or 0 when it cannot be known.
+func addTotalSize(paths []string, hidden bool) uint64 {
+	var total uint64
+	for _, p := range paths {
+		if strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://") {
+			return 0
+		}
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != p && !hidden && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				total += uint64(info.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			return 0
+		}
+	}
+	return total
+}
@@ -94,8 +94,9 @@ type IPFSConnector interface {
 	RepoGC(context.Context) (api.RepoGC, error)
 	// Resolve returns a cid given a path.
 	Resolve(context.Context, string) (api.Cid, error)
-	// BlockStream adds a stream of blocks to IPFS.
-	BlockStream(context.Context, <-chan api.NodeWithMeta) error
+	// BlockStream adds a stream of blocks to IPFS. When confirmed is
+	// not nil, a value is sent on it for every block IPFS confirms.
+	BlockStream(ctx context.Context, blocks <-chan api.NodeWithMeta, confirmed chan<- struct{}) error
 	// BlockGet retrieves the raw data of an IPFS block.
 	BlockGet(context.Context, api.Cid) ([]byte, error)
 }
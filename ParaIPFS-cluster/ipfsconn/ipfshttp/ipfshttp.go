@@ -378,6 +378,18 @@ func (ipfs *Connector) Pin(ctx context.Context, pin api.Pin) error {
 		}
 	}
 
+	if pin.TierCid != nil {
+		// Pinning does without the TierCid, only slower. Installing it
+		// only fetches its block, which gets the time a pin gets to
+		// make progress.
+		installCtx, cancel := context.WithTimeout(ctx, ipfs.config.PinTimeout)
+		err := ipfs.installTierCid(installCtx, hash, *pin.TierCid)
+		cancel()
+		if err != nil {
+			logger.Warnf("cannot install the TierCid of %s: %s", hash, err)
+		}
+	}
+
 	// Pin request and timeout if there is no progress
 	outPins := make(chan int)
 	go func() {
@@ -483,6 +495,22 @@ func (ipfs *Connector) pinUpdate(ctx context.Context, from, to api.Cid) error {
 	return nil
 }
 
+// installTierCid asks the daemon to install the TierCid serialized in the
+// tierCid block for root. The daemon keeps it, unverified, until it checks
+// it while pinning root, and serves it meanwhile.
+func (ipfs *Connector) installTierCid(ctx context.Context, root, tierCid api.Cid) error {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/installTierCid")
+	defer span.End()
+
+	path := fmt.Sprintf("dag/tiercid/install?arg=%s&arg=%s", root, tierCid)
+	_, err := ipfs.postCtx(ctx, path, "", nil)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("installed TierCid %s of %s", tierCid, root)
+	return nil
+}
+
 // Unpin performs an unpin request against the configured IPFS
 // daemon.
 func (ipfs *Connector) Unpin(ctx context.Context, hash api.Cid) error {
@@ -1076,8 +1104,9 @@ func blockPutQuery(prefix cid.Prefix) (url.Values, error) {
 }
 
 // BlockStream performs a multipart request to block/put with the blocks
-// received on the channel.
-func (ipfs *Connector) BlockStream(ctx context.Context, blocks <-chan api.NodeWithMeta) error {
+// received on the channel. Every block in the response of IPFS is
+// confirmed on the confirmed channel, when given.
+func (ipfs *Connector) BlockStream(ctx context.Context, blocks <-chan api.NodeWithMeta, confirmed chan<- struct{}) error {
 	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/BlockStream")
 	defer span.End()
 
@@ -1135,6 +1164,17 @@ func (ipfs *Connector) BlockStream(ctx context.Context, blocks <-chan api.NodeWi
 		// logger.Info("response block: %s", res.Key)
 		if !it.Seen(res.Key) {
 			logger.Warningf("blockPut response CID (%s) does not match the multihash of any blocks sent", res.Key)
+			continue
+		}
+		if confirmed != nil {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case confirmed <- struct{}{}:
+			}
+		}
+		if err != nil {
+			break
 		}
 	}
 
@@ -107,6 +107,58 @@ func TestPin(t *testing.T) {
 	}
 }
 
+func TestPinTierCid(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	tc := test.Cid4
+	mock.BlockStore[tc.String()] = []byte("tiercid")
+
+	pin := api.PinCid(test.Cid1)
+	pin.TierCid = &tc
+	err := ipfs.Pin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mock.GetCount("dag/tiercid/install") != 1 {
+		t.Error("dag/tiercid/install should have been called once")
+	}
+
+	// Pinning works even when the TierCid cannot be installed.
+	missing := test.Cid3
+	pin2 := api.PinCid(test.Cid2)
+	pin2.TierCid = &missing
+	err = ipfs.Pin(ctx, pin2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mock.GetCount("dag/tiercid/install") != 2 {
+		t.Error("dag/tiercid/install should have been called twice")
+	}
+	if mock.GetCount("pin/add") != 2 {
+		t.Error("pin/add should have been called twice")
+	}
+
+	// Nor does it wait longer than the pin timeout for it.
+	ipfs.config.PinTimeout = time.Second
+	slow := test.SlowCid1
+	pin3 := api.PinCid(test.Cid3)
+	pin3.TierCid = &slow
+	start := time.Now()
+	err = ipfs.Pin(ctx, pin3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("installing the TierCid took %s", elapsed)
+	}
+	if mock.GetCount("pin/add") != 3 {
+		t.Error("pin/add should have been called three times")
+	}
+}
+
 func TestPinUpdate(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -335,7 +387,7 @@ func TestBlockStream(t *testing.T) {
 	}
 	close(blocks)
 
-	err := ipfs.BlockStream(ctx, blocks)
+	err := ipfs.BlockStream(ctx, blocks, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -348,10 +400,14 @@ func TestBlockStream(t *testing.T) {
 	}
 	close(blocks2)
 
-	err = ipfs.BlockStream(ctx, blocks2)
+	confirmed := make(chan struct{}, 1)
+	err = ipfs.BlockStream(ctx, blocks2, confirmed)
 	if err != nil {
 		t.Error(err)
 	}
+	if len(confirmed) != 1 {
+		t.Error("the block should have been confirmed")
+	}
 }
 
 func TestBlockGet(t *testing.T) {
@@ -373,7 +429,7 @@ func TestBlockGet(t *testing.T) {
 		Cid:  test.ShardCid,
 	}
 	close(blocks)
-	err = ipfs.BlockStream(ctx, blocks)
+	err = ipfs.BlockStream(ctx, blocks, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -579,7 +579,7 @@ func (rpcapi *IPFSConnectorRPCAPI) SwarmPeers(ctx context.Context, in struct{},
 // BlockStream runs IPFSConnector.BlockStream().
 func (rpcapi *IPFSConnectorRPCAPI) BlockStream(ctx context.Context, in <-chan api.NodeWithMeta, out chan<- struct{}) error {
 	defer close(out) // very important to do at the end
-	return rpcapi.ipfs.BlockStream(ctx, in)
+	return rpcapi.ipfs.BlockStream(ctx, in, out)
 }
 
 // BlockGet runs IPFSConnector.BlockGet().
@@ -102,6 +102,13 @@ type mockBlockPutResp struct {
 	Key string
 }
 
+type mockTierCidInstallResp struct {
+	Root    api.Cid
+	Source  string
+	NonLeaf int
+	Leaf    int
+}
+
 type mockRepoGCResp struct {
 	Key   cid.Cid `json:",omitempty"`
 	Error string  `json:",omitempty"`
@@ -424,6 +431,31 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			j, _ := json.Marshal(resp)
 			w.Write(j)
 		}
+	case "dag/tiercid/install":
+		args := r.URL.Query()["arg"]
+		if len(args) != 2 {
+			goto ERROR
+		}
+		root, err := api.DecodeCid(args[0])
+		if err != nil {
+			goto ERROR
+		}
+		// The block of SlowCid1 is searched for until the request is
+		// cancelled.
+		if args[1] == SlowCid1.String() {
+			<-r.Context().Done()
+			goto ERROR
+		}
+		// The TierCid is installed from a block we have.
+		if _, ok := m.BlockStore[args[1]]; !ok {
+			goto ERROR
+		}
+		resp := mockTierCidInstallResp{
+			Root:   root,
+			Source: "unpinned",
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "block/get":
 		query := r.URL.Query()
 		arg, ok := query["arg"]
@@ -158,6 +158,26 @@ func WithTaskComparator(comparator TaskComparator) Option {
 	}
 }
 
+// WithTierCidSource answers the TierCid requests of peers with src, so that
+// they can fetch the DAGs this node has the TierCid of without walking them.
+func WithTierCidSource(src bsnet.TierCidHandler) Option {
+	return func(bs *Bitswap) {
+		bs.tierCidSource = src
+	}
+}
+
+// TierCidBatches sets how FetchTierCid requests the blocks of a TierCid:
+// size blocks at once, with up to parallel such batches in flight.
+func TierCidBatches(size, parallel int) Option {
+	if size <= 0 || parallel <= 0 {
+		panic(fmt.Sprintf("TierCid batches of %d blocks, %d at once, but both must be > 0", size, parallel))
+	}
+	return func(bs *Bitswap) {
+		bs.tierCidBatchSize = size
+		bs.tierCidParallel = parallel
+	}
+}
+
 // New initializes a BitSwap instance that communicates over the provided
 // BitSwapNetwork. This function registers the returned instance as the network
 // delegate. Runs until context is cancelled or bitswap.Close is called.
@@ -261,6 +281,8 @@ func New(parent context.Context, network bsnet.BitSwapNetwork,
 		engineMaxOutstandingBytesPerPeer: defaults.BitswapMaxOutstandingBytesPerPeer,
 		engineSetSendDontHaves:           true,
 		simulateDontHavesOnTimeout:       true,
+		tierCidBatchSize:                 defaults.TierCidBatchSize,
+		tierCidParallel:                  defaults.TierCidParallelBatches,
 	}
 
 	// apply functional options before starting and running bitswap
@@ -288,6 +310,9 @@ func New(parent context.Context, network bsnet.BitSwapNetwork,
 
 	bs.pqm.Startup()
 	network.SetDelegate(bs)
+	if tn, ok := network.(bsnet.TierCidNetwork); ok && bs.tierCidSource != nil {
+		tn.SetTierCidHandler(bs.tierCidSource)
+	}
 
 	// Start up bitswaps async worker routines
 	bs.startWorkers(ctx, px)
@@ -388,6 +413,13 @@ type Bitswap struct {
 	simulateDontHavesOnTimeout bool
 
 	taskComparator TaskComparator
+
+	// answers the TierCid requests of peers, if set
+	tierCidSource bsnet.TierCidHandler
+
+	// how FetchTierCid requests the blocks of a TierCid
+	tierCidBatchSize int
+	tierCidParallel  int
 }
 
 type counters struct {
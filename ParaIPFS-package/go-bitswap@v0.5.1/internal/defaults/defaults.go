@@ -17,4 +17,9 @@ const (
 	BitswapEngineTaskWorkerCount = 8
 	// the total amount of bytes that a peer should have outstanding, it is utilized by the decision engine
 	BitswapMaxOutstandingBytesPerPeer = 1 << 20
+
+	// number of blocks of a TierCid requested at once from its providers
+	TierCidBatchSize = 512
+	// number of batches of a TierCid in flight at once
+	TierCidParallelBatches = 8
 )
@@ -94,6 +94,8 @@ const (
 type op struct {
 	op   opType
 	keys []cid.Cid
+	// from lists the peers known to have the keys of an opWant
+	from []peer.ID
 }
 
 // Session holds state for an individual bitswap transfer operation.
@@ -255,6 +257,29 @@ func (s *Session) GetBlocks(ctx context.Context, keys []cid.Cid) (<-chan blocks.
 	)
 }
 
+// GetBlocksFrom is like GetBlocks, for keys the given peers are known to
+// have: the session sends them want-blocks for the keys straight away,
+// spread between them, instead of first looking for peers with want-haves.
+func (s *Session) GetBlocksFrom(ctx context.Context, keys []cid.Cid, from []peer.ID) (<-chan blocks.Block, error) {
+	ctx = logging.ContextWithLoggable(ctx, s.uuid)
+
+	return bsgetter.AsyncGetBlocks(ctx, s.ctx, keys, s.notif,
+		func(ctx context.Context, keys []cid.Cid) {
+			select {
+			case s.incoming <- op{op: opWant, keys: keys, from: from}:
+			case <-ctx.Done():
+			case <-s.ctx.Done():
+			}
+		},
+		func(keys []cid.Cid) {
+			select {
+			case s.incoming <- op{op: opCancel, keys: keys}:
+			case <-s.ctx.Done():
+			}
+		},
+	)
+}
+
 // SetBaseTickDelay changes the rate at which ticks happen.
 func (s *Session) SetBaseTickDelay(baseTickDelay time.Duration) {
 	select {
@@ -307,7 +332,7 @@ func (s *Session) run(ctx context.Context) {
 				s.handleReceive(oper.keys)
 			case opWant:
 				// Client wants blocks
-				s.wantBlocks(ctx, oper.keys)
+				s.wantBlocks(ctx, oper.keys, oper.from)
 			case opCancel:
 				// Wants were cancelled
 				s.sw.CancelPending(oper.keys)
@@ -436,8 +461,9 @@ func (s *Session) handleReceive(ks []cid.Cid) {
 	s.resetIdleTick()
 }
 
-// wantBlocks is called when blocks are requested by the client
-func (s *Session) wantBlocks(ctx context.Context, newks []cid.Cid) {
+// wantBlocks is called when blocks are requested by the client, from the
+// given peers if any
+func (s *Session) wantBlocks(ctx context.Context, newks []cid.Cid, from []peer.ID) {
 	if len(newks) > 0 {
 		// Inform the SessionInterestManager that this session is interested in the keys
 		s.sim.RecordSessionInterest(s.id, newks)
@@ -445,11 +471,15 @@ func (s *Session) wantBlocks(ctx context.Context, newks []cid.Cid) {
 		s.sw.BlocksRequested(newks)
 		// Tell the sessionWantSender that the blocks have been requested
 		s.sws.Add(newks)
+		// and who has them
+		for _, p := range from {
+			s.sws.Have(p, newks)
+		}
 	}
 
-	// If we have discovered peers already, the sessionWantSender will
-	// send wants to them
-	if s.sprm.PeersDiscovered() {
+	// If we have discovered peers already, or been told some, the
+	// sessionWantSender will send wants to them
+	if len(from) > 0 || s.sprm.PeersDiscovered() {
 		return
 	}
 
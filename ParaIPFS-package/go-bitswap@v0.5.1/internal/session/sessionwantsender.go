@@ -171,6 +171,13 @@ func (sws *sessionWantSender) Update(from peer.ID, ks []cid.Cid, haves []cid.Cid
 	})
 }
 
+// Have is called when p is known to have the blocks of ks without having
+// said so itself, as if it had sent HAVEs for them
+func (sws *sessionWantSender) Have(p peer.ID, ks []cid.Cid) {
+	sws.bpm.ReceiveFrom(p, ks, nil)
+	sws.Update(p, nil, ks, nil)
+}
+
 // SignalAvailability is called by the PeerManager to signal that a peer has
 // connected / disconnected
 func (sws *sessionWantSender) SignalAvailability(p peer.ID, isAvailable bool) {
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// MaxTierCidSize is the largest encoded TierCid a peer accepts, enough for
+// the leaves of a file of about 400 GiB in chunks of 256 KiB.
+const MaxTierCidSize = 64 << 20
+
+const tierCidVersion = 1
+
+// ErrInvalidTierCid is returned when decoding a malformed TierCid.
+var ErrInvalidTierCid = errors.New("invalid encoded TierCid")
+
+// TierCid lists the nodes of a DAG, as recorded by the peer that imported
+// or pinned it: its internal nodes and its leaves, each in the order a
+// reader visits them. It is what a peer answers when asked for the tiers
+// of a root, so that the leaves can be fetched without walking the DAG.
+type TierCid struct {
+	NonLeaf []cid.Cid
+	Leaf    []cid.Cid
+}
+
+// Marshal encodes the TierCid as a version byte followed by its two lists,
+// each a varint count of varint-prefixed CIDs.
+func (tc *TierCid) Marshal() []byte {
+	buf := make([]byte, 0, 1+(len(tc.NonLeaf)+len(tc.Leaf))*40)
+	buf = append(buf, tierCidVersion)
+	var tmp [binary.MaxVarintLen64]byte
+	for _, list := range [][]cid.Cid{tc.NonLeaf, tc.Leaf} {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(list)))]...)
+		for _, c := range list {
+			b := c.Bytes()
+			buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(b)))]...)
+			buf = append(buf, b...)
+		}
+	}
+	return buf
+}
+
+// UnmarshalTierCid decodes a TierCid encoded with Marshal.
+func UnmarshalTierCid(data []byte) (*TierCid, error) {
+	if len(data) == 0 || data[0] != tierCidVersion {
+		return nil, ErrInvalidTierCid
+	}
+	data = data[1:]
+
+	tc := &TierCid{}
+	for _, list := range []*[]cid.Cid{&tc.NonLeaf, &tc.Leaf} {
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > uint64(len(data)) {
+			return nil, ErrInvalidTierCid
+		}
+		data = data[n:]
+		*list = make([]cid.Cid, 0, count)
+		for i := uint64(0); i < count; i++ {
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, ErrInvalidTierCid
+			}
+			c, err := cid.Cast(data[n : n+int(size)])
+			if err != nil {
+				return nil, ErrInvalidTierCid
+			}
+			*list = append(*list, c)
+			data = data[n+int(size):]
+		}
+	}
+	if len(data) != 0 {
+		return nil, ErrInvalidTierCid
+	}
+	return tc, nil
+}
@@ -0,0 +1,39 @@
+package message
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestTierCidRoundTrip(t *testing.T) {
+	tc := &TierCid{
+		NonLeaf: []cid.Cid{mkFakeCid("a"), mkFakeCid("b")},
+		Leaf:    []cid.Cid{mkFakeCid("c"), mkFakeCid("d"), mkFakeCid("e")},
+	}
+	data := tc.Marshal()
+
+	out, err := UnmarshalTierCid(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.NonLeaf) != len(tc.NonLeaf) || len(out.Leaf) != len(tc.Leaf) {
+		t.Fatalf("got %d non-leaves and %d leaves", len(out.NonLeaf), len(out.Leaf))
+	}
+	for i, c := range tc.NonLeaf {
+		if !out.NonLeaf[i].Equals(c) {
+			t.Fatalf("non-leaf %d: got %s, expected %s", i, out.NonLeaf[i], c)
+		}
+	}
+	for i, c := range tc.Leaf {
+		if !out.Leaf[i].Equals(c) {
+			t.Fatalf("leaf %d: got %s, expected %s", i, out.Leaf[i], c)
+		}
+	}
+
+	for _, bad := range [][]byte{nil, {0}, data[:len(data)-1], append(data, 0)} {
+		if _, err := UnmarshalTierCid(bad); err != ErrInvalidTierCid {
+			t.Fatalf("expected ErrInvalidTierCid, got %v", err)
+		}
+	}
+}
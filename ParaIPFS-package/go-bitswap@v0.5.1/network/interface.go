@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	bsmsg "github.com/ipfs/go-bitswap/message"
@@ -23,8 +24,14 @@ var (
 	ProtocolBitswapOneOne protocol.ID = "/ipfs/bitswap/1.1.0"
 	// ProtocolBitswap is the current version of the bitswap protocol: 1.2.0
 	ProtocolBitswap protocol.ID = "/ipfs/bitswap/1.2.0"
+	// ProtocolTierCid is the protocol peers are asked for the TierCid of a
+	// root with
+	ProtocolTierCid protocol.ID = "/paraipfs/bitswap/tiercid/1.0.0"
 )
 
+// ErrNoTierCid is returned when a peer has no TierCid for a root.
+var ErrNoTierCid = errors.New("peer has no TierCid for the root")
+
 // BitSwapNetwork provides network connectivity for BitSwap sessions.
 type BitSwapNetwork interface {
 	Self() peer.ID
@@ -53,6 +60,21 @@ type BitSwapNetwork interface {
 	Pinger
 }
 
+// TierCidHandler returns the TierCid of root, if the node has one, to
+// answer the request of a peer.
+type TierCidHandler func(ctx context.Context, root cid.Cid) (*bsmsg.TierCid, bool)
+
+// TierCidNetwork is implemented by the networks over which peers can ask
+// each other for the TierCids of roots.
+type TierCidNetwork interface {
+	// SetTierCidHandler answers the TierCid requests of peers with h.
+	SetTierCidHandler(h TierCidHandler)
+
+	// RequestTierCid asks p for the TierCid of root. It returns
+	// ErrNoTierCid when p has none.
+	RequestTierCid(ctx context.Context, p peer.ID, root cid.Cid) (*bsmsg.TierCid, error)
+}
+
 // MessageSender is an interface for sending a series of messages over the bitswap
 // network
 type MessageSender interface {
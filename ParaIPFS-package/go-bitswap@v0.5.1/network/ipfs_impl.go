@@ -34,6 +34,13 @@ var minSendTimeout = 10 * time.Second
 var sendLatency = 2 * time.Second
 var minSendRate = (100 * 1000) / 8 // 100kbit/s
 
+// tierCidTimeout bounds a TierCid request, from opening the stream to
+// reading the answer.
+var tierCidTimeout = 30 * time.Second
+
+// maxTierCidRequestSize bounds a TierCid request, which is a single CID.
+const maxTierCidRequestSize = 256
+
 // NewFromIpfsHost returns a BitSwapNetwork supported by underlying IPFS host.
 func NewFromIpfsHost(host host.Host, r routing.ContentRouting, opts ...NetOpt) BitSwapNetwork {
 	s := processSettings(opts...)
@@ -46,6 +53,7 @@ func NewFromIpfsHost(host host.Host, r routing.ContentRouting, opts ...NetOpt) B
 		protocolBitswapOneZero: s.ProtocolPrefix + ProtocolBitswapOneZero,
 		protocolBitswapOneOne:  s.ProtocolPrefix + ProtocolBitswapOneOne,
 		protocolBitswap:        s.ProtocolPrefix + ProtocolBitswap,
+		protocolTierCid:        s.ProtocolPrefix + ProtocolTierCid,
 
 		supportedProtocols: s.SupportedProtocols,
 	}
@@ -86,6 +94,7 @@ type impl struct {
 	protocolBitswapOneZero protocol.ID
 	protocolBitswapOneOne  protocol.ID
 	protocolBitswap        protocol.ID
+	protocolTierCid        protocol.ID
 
 	supportedProtocols []protocol.ID
 
@@ -93,6 +102,8 @@ type impl struct {
 	receiver Receiver
 }
 
+var _ TierCidNetwork = (*impl)(nil)
+
 type streamMessageSender struct {
 	to        peer.ID
 	stream    network.Stream
@@ -424,6 +435,82 @@ func (bsnet *impl) handleNewStream(s network.Stream) {
 	}
 }
 
+// SetTierCidHandler answers the TierCid requests of peers with h.
+func (bsnet *impl) SetTierCidHandler(h TierCidHandler) {
+	bsnet.host.SetStreamHandler(bsnet.protocolTierCid, func(s network.Stream) {
+		bsnet.handleTierCidStream(s, h)
+	})
+}
+
+// handleTierCidStream reads the root a peer asks the TierCid of and writes
+// it back, or an empty message when there is none.
+func (bsnet *impl) handleTierCidStream(s network.Stream, h TierCidHandler) {
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tierCidTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if err := s.SetDeadline(deadline); err != nil {
+		log.Warnf("error setting deadline: %s", err)
+	}
+
+	r := msgio.NewVarintReaderSize(s, maxTierCidRequestSize)
+	req, err := r.ReadMsg()
+	if err != nil {
+		_ = s.Reset()
+		log.Debugf("bitswap net TierCid request from %s error: %s", s.Conn().RemotePeer(), err)
+		return
+	}
+	root, err := cid.Cast(req)
+	r.ReleaseMsg(req)
+	if err != nil {
+		_ = s.Reset()
+		log.Debugf("bitswap net TierCid request from %s error: %s", s.Conn().RemotePeer(), err)
+		return
+	}
+
+	var resp []byte
+	if tc, ok := h(ctx, root); ok {
+		resp = tc.Marshal()
+	}
+	if err := msgio.NewVarintWriter(s).WriteMsg(resp); err != nil {
+		_ = s.Reset()
+		log.Debugf("bitswap net TierCid answer to %s error: %s", s.Conn().RemotePeer(), err)
+	}
+}
+
+// RequestTierCid asks p for the TierCid of root.
+func (bsnet *impl) RequestTierCid(ctx context.Context, p peer.ID, root cid.Cid) (*bsmsg.TierCid, error) {
+	ctx, cancel := context.WithTimeout(ctx, tierCidTimeout)
+	defer cancel()
+
+	s, err := bsnet.host.NewStream(ctx, p, bsnet.protocolTierCid)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	deadline, _ := ctx.Deadline()
+	if err := s.SetDeadline(deadline); err != nil {
+		log.Warnf("error setting deadline: %s", err)
+	}
+
+	if err := msgio.NewVarintWriter(s).WriteMsg(root.Bytes()); err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	r := msgio.NewVarintReaderSize(s, bsmsg.MaxTierCidSize)
+	resp, err := r.ReadMsg()
+	if err != nil {
+		_ = s.Reset()
+		return nil, err
+	}
+	defer r.ReleaseMsg(resp)
+	if len(resp) == 0 {
+		return nil, ErrNoTierCid
+	}
+	return bsmsg.UnmarshalTierCid(resp)
+}
+
 func (bsnet *impl) ConnectionManager() connmgr.ConnManager {
 	return bsnet.host.ConnManager()
 }
@@ -0,0 +1,275 @@
+package bitswap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bssession "github.com/ipfs/go-bitswap/internal/session"
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var (
+	// tierCidMaxPeers bounds the number of peers asked for a TierCid.
+	tierCidMaxPeers = 32
+	// tierCidGrace is how long the other peers asked for a TierCid have to
+	// answer once one did, to be sent the blocks requests too.
+	tierCidGrace = time.Second
+)
+
+type tierCidAnswer struct {
+	from peer.ID
+	tc   *bsmsg.TierCid
+	err  error
+}
+
+// FetchTierCid fetches the DAG under root without walking it. It asks the
+// connected peers, then the providers of root, for its TierCid, and then
+// requests the blocks it lists in batches of want-blocks sent in turn to the
+// peers that gave the same TierCid. As peers of the session, the others are
+// sent want-haves for the blocks of each batch, and take over the ones its
+// peer does not send. The blocks already in the blockstore are skipped.
+//
+// The internal nodes are fetched first, a level at a time, and the leaves
+// are only requested once they are all found to be linked from them, so that
+// a peer cannot have arbitrary blocks fetched by listing them in the TierCid
+// of a DAG.
+//
+// It returns bsnet.ErrNoTierCid when no peer knows the TierCid of root, and
+// an error when some blocks could not be fetched or are not part of the DAG.
+func (bs *Bitswap) FetchTierCid(ctx context.Context, root cid.Cid) error {
+	tn, ok := bs.network.(bsnet.TierCidNetwork)
+	if !ok {
+		return bsnet.ErrNoTierCid
+	}
+
+	tc, providers := bs.askTierCid(ctx, tn, root, func(context.Context) <-chan peer.ID {
+		connected := bs.pm.ConnectedPeers()
+		if len(connected) > tierCidMaxPeers {
+			connected = connected[:tierCidMaxPeers]
+		}
+		peers := make(chan peer.ID, len(connected))
+		for _, p := range connected {
+			peers <- p
+		}
+		close(peers)
+		return peers
+	})
+	if tc == nil {
+		tc, providers = bs.askTierCid(ctx, tn, root, func(ctx context.Context) <-chan peer.ID {
+			return bs.network.FindProvidersAsync(ctx, root, tierCidMaxPeers)
+		})
+	}
+	if tc == nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return bsnet.ErrNoTierCid
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	session := bs.sm.NewSession(ctx, bs.provSearchDelay, bs.rebroadcastDelay).(*bssession.Session)
+
+	// Entries may list root, and a leaf several times.
+	seen := cid.NewSet()
+	seen.Add(root)
+	unique := func(list []cid.Cid) []cid.Cid {
+		keys := make([]cid.Cid, 0, len(list))
+		for _, c := range list {
+			if seen.Visit(c) {
+				keys = append(keys, c)
+			}
+		}
+		return keys
+	}
+
+	linked, err := bs.fetchTierCidNonLeaf(ctx, session, root, unique(tc.NonLeaf), providers)
+	if err != nil {
+		return err
+	}
+	leaves := unique(tc.Leaf)
+	for _, c := range leaves {
+		if !linked.Has(c) {
+			return fmt.Errorf("the TierCid of %s lists %s, which its DAG does not link to", root, c)
+		}
+	}
+	return bs.fetchTierCidBlocks(ctx, session, root, leaves, providers)
+}
+
+// fetchTierCidBlocks fetches the given blocks of the TierCid of root, in
+// batches sent in turn to each of the providers of the TierCid.
+func (bs *Bitswap) fetchTierCidBlocks(ctx context.Context, session *bssession.Session, root cid.Cid,
+	keys []cid.Cid, providers []peer.ID) error {
+	var (
+		wg      sync.WaitGroup
+		missing int64
+		errOnce sync.Once
+		getErr  error
+	)
+	inflight := make(chan struct{}, bs.tierCidParallel)
+batches:
+	for i, start := 0, 0; start < len(keys); i, start = i+1, start+bs.tierCidBatchSize {
+		end := start + bs.tierCidBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+			break batches
+		}
+		wg.Add(1)
+		go func(batch []cid.Cid, from peer.ID) {
+			defer wg.Done()
+			defer func() { <-inflight }()
+
+			want := make([]cid.Cid, 0, len(batch))
+			for _, c := range batch {
+				if has, err := bs.blockstore.Has(ctx, c); err != nil || !has {
+					want = append(want, c)
+				}
+			}
+			if len(want) == 0 {
+				return
+			}
+
+			blks, err := session.GetBlocksFrom(ctx, want, []peer.ID{from})
+			if err != nil {
+				errOnce.Do(func() { getErr = err })
+				return
+			}
+			got := 0
+			for range blks {
+				got++
+			}
+			atomic.AddInt64(&missing, int64(len(want)-got))
+		}(keys[start:end], providers[i%len(providers)])
+	}
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case getErr != nil:
+		return getErr
+	case missing > 0:
+		return fmt.Errorf("%d of the %d blocks of the TierCid of %s could not be fetched", missing, len(keys), root)
+	}
+	return nil
+}
+
+// fetchTierCidNonLeaf fetches the internal nodes of the DAG under root
+// listed in nonLeaf, a level at a time from root down, only requesting the
+// ones linked from the level above. It returns the CIDs they all link to,
+// and fails if some of them are not linked at all.
+func (bs *Bitswap) fetchTierCidNonLeaf(ctx context.Context, session *bssession.Session, root cid.Cid,
+	nonLeaf []cid.Cid, providers []peer.ID) (*cid.Set, error) {
+	listed := cid.NewSet()
+	for _, c := range nonLeaf {
+		listed.Add(c)
+	}
+
+	linked := cid.NewSet()
+	reached := cid.NewSet()
+	reached.Add(root)
+	for level := []cid.Cid{root}; len(level) > 0; {
+		if err := bs.fetchTierCidBlocks(ctx, session, root, level, providers); err != nil {
+			return nil, err
+		}
+
+		var next []cid.Cid
+		for _, c := range level {
+			blk, err := bs.blockstore.Get(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			nd, err := ipld.Decode(blk)
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range nd.Links() {
+				linked.Add(l.Cid)
+				if listed.Has(l.Cid) && reached.Visit(l.Cid) {
+					next = append(next, l.Cid)
+				}
+			}
+		}
+		level = next
+	}
+
+	for _, c := range nonLeaf {
+		if !reached.Has(c) {
+			return nil, fmt.Errorf("the TierCid of %s lists %s, which its DAG does not link to", root, c)
+		}
+	}
+	return linked, nil
+}
+
+// askTierCid asks the peers sent on the channel returned by peers for the
+// TierCid of root. It returns the first TierCid received, and the peers that
+// answered it within tierCidGrace of the first, or nil if none did.
+func (bs *Bitswap) askTierCid(ctx context.Context, tn bsnet.TierCidNetwork, root cid.Cid,
+	peers func(context.Context) <-chan peer.ID) (*bsmsg.TierCid, []peer.ID) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan tierCidAnswer)
+	go func() {
+		var wg sync.WaitGroup
+		for p := range peers(ctx) {
+			if p == bs.network.Self() {
+				continue
+			}
+			wg.Add(1)
+			go func(p peer.ID) {
+				defer wg.Done()
+				tc, err := tn.RequestTierCid(ctx, p, root)
+				select {
+				case answers <- tierCidAnswer{from: p, tc: tc, err: err}:
+				case <-ctx.Done():
+				}
+			}(p)
+		}
+		wg.Wait()
+		close(answers)
+	}()
+
+	var (
+		tc        *bsmsg.TierCid
+		encoded   []byte
+		providers []peer.ID
+		grace     <-chan time.Time
+	)
+	for {
+		select {
+		case a, ok := <-answers:
+			if !ok {
+				return tc, providers
+			}
+			if a.err != nil {
+				log.Debugf("TierCid of %s from %s: %s", root, a.from, a.err)
+				continue
+			}
+			if tc == nil {
+				tc, encoded = a.tc, a.tc.Marshal()
+				providers = append(providers, a.from)
+				grace = time.After(tierCidGrace)
+			} else if bytes.Equal(a.tc.Marshal(), encoded) {
+				providers = append(providers, a.from)
+			}
+		case <-grace:
+			return tc, providers
+		case <-ctx.Done():
+			return tc, providers
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package bitswap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	testinstance "github.com/ipfs/go-bitswap/testinstance"
+	tn "github.com/ipfs/go-bitswap/testnet"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	mockrouting "github.com/ipfs/go-ipfs-routing/mock"
+	merkledag "github.com/ipfs/go-merkledag"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestFetchTierCid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	net, err := tn.StreamNet(ctx, mn, mockrouting.NewServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blks, tc := tierCidDAG(t, 3, 12)
+	root := blks[0].Cid()
+	// List root, and a leaf twice, as the entries of a DAG walk can.
+	tc.NonLeaf = append([]cid.Cid{root}, tc.NonLeaf...)
+	tc.Leaf = append(tc.Leaf, tc.Leaf[0])
+	source := func(ctx context.Context, c cid.Cid) (*bsmsg.TierCid, bool) {
+		if !c.Equals(root) {
+			return nil, false
+		}
+		return tc, true
+	}
+
+	batches := bitswap.TierCidBatches(4, 2)
+	pgen := testinstance.NewTestInstanceGenerator(net, nil, []bitswap.Option{bitswap.WithTierCidSource(source), batches})
+	defer pgen.Close()
+	fgen := testinstance.NewTestInstanceGenerator(net, nil, []bitswap.Option{batches})
+	defer fgen.Close()
+
+	providers := []testinstance.Instance{pgen.Next(), pgen.Next()}
+	fetcher := fgen.Next()
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	testinstance.ConnectInstances(append([]testinstance.Instance{fetcher}, providers...))
+
+	for _, p := range providers {
+		if err := p.Blockstore().PutMany(ctx, blks); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fetcher.Exchange.FetchTierCid(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blks {
+		has, err := fetcher.Blockstore().Has(ctx, b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Fatalf("block %s was not fetched", b.Cid())
+		}
+	}
+	for i, p := range providers {
+		st, err := p.Exchange.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.BlocksSent == 0 {
+			t.Fatalf("provider %d sent no blocks", i)
+		}
+	}
+
+	// Nobody knows the TierCid of a block without one.
+	err = fetcher.Exchange.FetchTierCid(ctx, tc.Leaf[0])
+	if !errors.Is(err, bsnet.ErrNoTierCid) {
+		t.Fatalf("expected ErrNoTierCid, got %v", err)
+	}
+}
+
+// tierCidDAG builds a DAG of a root linking to `inner` internal nodes, each
+// linking to `leaves` raw leaves, and returns its blocks, root first, and its
+// TierCid.
+func tierCidDAG(t *testing.T, inner, leaves int) ([]blocks.Block, *bsmsg.TierCid) {
+	tc := &bsmsg.TierCid{}
+	var blks []blocks.Block
+	root := new(merkledag.ProtoNode)
+	for i := 0; i < inner; i++ {
+		nd := new(merkledag.ProtoNode)
+		for j := 0; j < leaves; j++ {
+			leaf := merkledag.NewRawNode([]byte(fmt.Sprintf("leaf %d of node %d", j, i)))
+			if err := nd.AddNodeLink("", leaf); err != nil {
+				t.Fatal(err)
+			}
+			tc.Leaf = append(tc.Leaf, leaf.Cid())
+			blks = append(blks, leaf)
+		}
+		if err := root.AddNodeLink("", nd); err != nil {
+			t.Fatal(err)
+		}
+		tc.NonLeaf = append(tc.NonLeaf, nd.Cid())
+		blks = append(blks, nd)
+	}
+	return append([]blocks.Block{root}, blks...), tc
+}
+
+// A TierCid listing blocks its DAG does not link to is rejected, and those
+// blocks are not fetched.
+func TestFetchTierCidUnlinked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	net, err := tn.StreamNet(ctx, mn, mockrouting.NewServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blks, tc := tierCidDAG(t, 2, 4)
+	root := blks[0].Cid()
+	bgen := blocksutil.NewBlockGenerator()
+	stray := bgen.Next()
+	source := func(ctx context.Context, c cid.Cid) (*bsmsg.TierCid, bool) {
+		if !c.Equals(root) {
+			return nil, false
+		}
+		return &bsmsg.TierCid{NonLeaf: tc.NonLeaf, Leaf: append(tc.Leaf, stray.Cid())}, true
+	}
+
+	pgen := testinstance.NewTestInstanceGenerator(net, nil, []bitswap.Option{bitswap.WithTierCidSource(source)})
+	defer pgen.Close()
+	fgen := testinstance.NewTestInstanceGenerator(net, nil, nil)
+	defer fgen.Close()
+
+	provider, fetcher := pgen.Next(), fgen.Next()
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	testinstance.ConnectInstances([]testinstance.Instance{fetcher, provider})
+	if err := provider.Blockstore().PutMany(ctx, append(blks, stray)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fetcher.Exchange.FetchTierCid(ctx, root)
+	if err == nil || errors.Is(err, bsnet.ErrNoTierCid) {
+		t.Fatalf("expected a TierCid listing an unlinked block to be rejected, got %v", err)
+	}
+	for _, c := range append(tc.Leaf, stray.Cid()) {
+		has, err := fetcher.Blockstore().Has(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			t.Fatalf("leaf %s was fetched", c)
+		}
+	}
+}
+
+func TestFetchTierCidWithoutSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	net, err := tn.StreamNet(ctx, mn, mockrouting.NewServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ig := testinstance.NewTestInstanceGenerator(net, nil, nil)
+	defer ig.Close()
+
+	a, b := ig.Next(), ig.Next()
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	testinstance.ConnectInstances([]testinstance.Instance{a, b})
+
+	bgen := blocksutil.NewBlockGenerator()
+	blk := bgen.Next()
+	if err := b.Blockstore().Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Exchange.FetchTierCid(ctx, blk.Cid())
+	if !errors.Is(err, bsnet.ErrNoTierCid) {
+		t.Fatalf("expected ErrNoTierCid, got %v", err)
+	}
+}
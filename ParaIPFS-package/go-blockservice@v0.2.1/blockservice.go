@@ -11,6 +11,7 @@ import (
 
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	logging "github.com/ipfs/go-log/v2"
@@ -61,6 +62,28 @@ type BlockService interface {
 	DeleteBlock(ctx context.Context, o cid.Cid) error
 }
 
+// ParallelBlockGetter is implemented by BlockGetters that can read many
+// blocks from their blockstore in parallel.
+type ParallelBlockGetter interface {
+	// GetBlocksParallel returns the requested blocks, in the same order,
+	// reading up to concurrency of them at the same time. Blocks that are
+	// not stored locally are requested from the exchange. It fails with
+	// ErrNotFound if one of the blocks cannot be found.
+	GetBlocksParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error)
+}
+
+// ParallelBlockService is implemented by BlockServices that can read and
+// write many blocks in parallel.
+type ParallelBlockService interface {
+	BlockService
+	ParallelBlockGetter
+
+	// AddBlocksParallel is like AddBlocks, but writes up to concurrency
+	// blocks at the same time. A concurrency below 1 lets the blockstore
+	// choose.
+	AddBlocksParallel(ctx context.Context, bs []blocks.Block, concurrency int) error
+}
+
 type blockService struct {
 	blockstore blockstore.Blockstore
 	exchange   exchange.Interface
@@ -159,6 +182,18 @@ func (s *blockService) AddBlock(ctx context.Context, o blocks.Block) error {
 }
 
 func (s *blockService) AddBlocks(ctx context.Context, bs []blocks.Block) error {
+	return s.addBlocks(ctx, bs, s.blockstore.PutMany)
+}
+
+func (s *blockService) AddBlocksParallel(ctx context.Context, bs []blocks.Block, concurrency int) error {
+	return s.addBlocks(ctx, bs, func(ctx context.Context, toput []blocks.Block) error {
+		return s.blockstore.PutManyParallel(ctx, toput, concurrency)
+	})
+}
+
+// addBlocks validates bs, stores the blocks that are not there yet with put
+// and announces them on the exchange.
+func (s *blockService) addBlocks(ctx context.Context, bs []blocks.Block, put func(context.Context, []blocks.Block) error) error {
 	// hash security
 	for _, b := range bs {
 		err := verifcid.ValidateCid(b.Cid())
@@ -186,7 +221,7 @@ func (s *blockService) AddBlocks(ctx context.Context, bs []blocks.Block) error {
 		return nil
 	}
 
-	err := s.blockstore.PutMany(ctx, toput)
+	err := put(ctx, toput)
 	if err != nil {
 		return err
 	}
@@ -215,6 +250,15 @@ func (s *blockService) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, e
 	return getBlock(ctx, c, s.blockstore, f) // hash security
 }
 
+func (s *blockService) GetBlocksParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	var f func() exchange.Fetcher
+	if s.exchange != nil {
+		f = s.getExchange
+	}
+
+	return getBlocksParallel(ctx, ks, concurrency, s.blockstore, f) // hash security
+}
+
 func (s *blockService) getExchange() exchange.Fetcher {
 	return s.exchange
 }
@@ -255,6 +299,40 @@ func getBlock(ctx context.Context, c cid.Cid, bs blockstore.Blockstore, fget fun
 	return nil, err
 }
 
+func getBlocksParallel(ctx context.Context, ks []cid.Cid, concurrency int, bs blockstore.Blockstore, fget func() exchange.Fetcher) ([]blocks.Block, error) {
+	for _, c := range ks {
+		err := verifcid.ValidateCid(c) // hash security
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	blks, err := bs.GetManyParallel(ctx, ks, concurrency)
+	if err == nil {
+		return blks, nil
+	}
+	if err != blockstore.ErrNotFound {
+		return nil, err
+	}
+
+	// Some of the blocks are not stored locally, get them one by one.
+	blks = make([]blocks.Block, len(ks))
+	err = ds.ParallelRange(ctx, len(ks), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			blk, err := getBlock(ctx, ks[i], bs, fget)
+			if err != nil {
+				return err
+			}
+			blks[i] = blk
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blks, nil
+}
+
 // GetBlocks gets a list of blocks asynchronously and returns through
 // the returned channel.
 // NB: No guarantees are made about order.
@@ -373,6 +451,16 @@ func (s *Session) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error)
 	return getBlock(ctx, c, s.bs, f) // hash security
 }
 
+// GetBlocksParallel gets many blocks at once, in the same order, reading up to
+// concurrency of them from the blockstore at the same time.
+func (s *Session) GetBlocksParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	var f func() exchange.Fetcher
+	if s.sessEx != nil {
+		f = s.getSession
+	}
+	return getBlocksParallel(ctx, ks, concurrency, s.bs, f) // hash security
+}
+
 // GetBlocks gets blocks in the context of a request session
 func (s *Session) GetBlocks(ctx context.Context, ks []cid.Cid) <-chan blocks.Block {
 	var f func() exchange.Fetcher
@@ -383,3 +471,5 @@ func (s *Session) GetBlocks(ctx context.Context, ks []cid.Cid) <-chan blocks.Blo
 }
 
 var _ BlockGetter = (*Session)(nil)
+var _ ParallelBlockService = (*blockService)(nil)
+var _ ParallelBlockGetter = (*Session)(nil)
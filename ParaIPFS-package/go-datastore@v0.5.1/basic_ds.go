@@ -16,6 +16,7 @@ type MapDatastore struct {
 
 var _ Datastore = (*MapDatastore)(nil)
 var _ Batching = (*MapDatastore)(nil)
+var _ ParallelDatastore = (*MapDatastore)(nil)
 
 // NewMapDatastore constructs a MapDatastore. It is _not_ thread-safe by
 // default, wrap using sync.MutexWrap if you need thread safety (the answer here
@@ -81,6 +82,39 @@ func (d *MapDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, err
 	return r, nil
 }
 
+// PutMany implements ParallelDatastore.PutMany. The entries are stored one
+// at a time as the map is not thread-safe.
+func (d *MapDatastore) PutMany(ctx context.Context, keys []Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return ErrValuesMismatch
+	}
+	for i, k := range keys {
+		d.values[k] = values[i]
+	}
+	return nil
+}
+
+// GetMany implements ParallelDatastore.GetMany
+func (d *MapDatastore) GetMany(ctx context.Context, keys []Key, concurrency int) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		v, found := d.values[k]
+		if !found {
+			return nil, ErrNotFound
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// DeleteMany implements ParallelDatastore.DeleteMany
+func (d *MapDatastore) DeleteMany(ctx context.Context, keys []Key, concurrency int) error {
+	for _, k := range keys {
+		delete(d.values, k)
+	}
+	return nil
+}
+
 func (d *MapDatastore) Batch(ctx context.Context) (Batch, error) {
 	return NewBasicBatch(d), nil
 }
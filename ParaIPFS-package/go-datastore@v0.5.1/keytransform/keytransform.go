@@ -36,6 +36,7 @@ var _ ds.PersistentDatastore = (*Datastore)(nil)
 var _ ds.CheckedDatastore = (*Datastore)(nil)
 var _ ds.ScrubbedDatastore = (*Datastore)(nil)
 var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.ParallelDatastore = (*Datastore)(nil)
 
 // Children implements ds.Shim
 func (d *Datastore) Children() []ds.Datastore {
@@ -74,6 +75,29 @@ func (d *Datastore) Delete(ctx context.Context, key ds.Key) (err error) {
 	return d.child.Delete(ctx, d.ConvertKey(key))
 }
 
+func (d *Datastore) convertKeys(keys []ds.Key) []ds.Key {
+	converted := make([]ds.Key, len(keys))
+	for i, k := range keys {
+		converted[i] = d.ConvertKey(k)
+	}
+	return converted
+}
+
+// PutMany stores the given values, transforming the keys first.
+func (d *Datastore) PutMany(ctx context.Context, keys []ds.Key, values [][]byte, concurrency int) error {
+	return ds.PutMany(ctx, d.child, d.convertKeys(keys), values, concurrency)
+}
+
+// GetMany returns the values for the given keys, transforming the keys first.
+func (d *Datastore) GetMany(ctx context.Context, keys []ds.Key, concurrency int) ([][]byte, error) {
+	return ds.GetMany(ctx, d.child, d.convertKeys(keys), concurrency)
+}
+
+// DeleteMany removes the values for the given keys.
+func (d *Datastore) DeleteMany(ctx context.Context, keys []ds.Key, concurrency int) error {
+	return ds.DeleteMany(ctx, d.child, d.convertKeys(keys), concurrency)
+}
+
 // Query implements Query, inverting keys on the way back out.
 func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
 	nq, cq := d.prepareQuery(q)
@@ -74,6 +74,7 @@ var _ ds.PersistentDatastore = (*Datastore)(nil)
 var _ ds.CheckedDatastore = (*Datastore)(nil)
 var _ ds.ScrubbedDatastore = (*Datastore)(nil)
 var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.ParallelDatastore = (*Datastore)(nil)
 
 // lookup looks up the datastore in which the given key lives.
 func (d *Datastore) lookup(key ds.Key) (ds.Datastore, ds.Key, ds.Key) {
@@ -307,6 +308,92 @@ func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
 	return cds.Delete(ctx, k)
 }
 
+// mountGroup holds the keys of a ParallelDatastore call that live in the same
+// mounted datastore, along with their position in the call.
+type mountGroup struct {
+	ds      ds.Datastore
+	keys    []ds.Key
+	indexes []int
+}
+
+// group splits the keys by the datastore they live in. The positions of the
+// keys that live outside all the mounts are returned in missing.
+func (d *Datastore) group(keys []ds.Key) (groups []*mountGroup, missing []int) {
+	byMount := make(map[ds.Key]*mountGroup)
+	for i, key := range keys {
+		cds, mount, k := d.lookup(key)
+		if cds == nil {
+			missing = append(missing, i)
+			continue
+		}
+		g, ok := byMount[mount]
+		if !ok {
+			g = &mountGroup{ds: cds}
+			byMount[mount] = g
+			groups = append(groups, g)
+		}
+		g.keys = append(g.keys, k)
+		g.indexes = append(g.indexes, i)
+	}
+	return groups, missing
+}
+
+// PutMany stores the values in the appropriate datastores, each one writing
+// its own entries with the given concurrency.
+//
+// Returns ErrNoMount if one of the keys lives outside all the mounts.
+func (d *Datastore) PutMany(ctx context.Context, keys []ds.Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return ds.ErrValuesMismatch
+	}
+	groups, missing := d.group(keys)
+	if len(missing) > 0 {
+		return ErrNoMount
+	}
+	for _, g := range groups {
+		vals := make([][]byte, len(g.indexes))
+		for i, idx := range g.indexes {
+			vals[i] = values[idx]
+		}
+		if err := ds.PutMany(ctx, g.ds, g.keys, vals, concurrency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMany returns the values associated with the keys from the appropriate
+// datastores.
+func (d *Datastore) GetMany(ctx context.Context, keys []ds.Key, concurrency int) ([][]byte, error) {
+	groups, missing := d.group(keys)
+	if len(missing) > 0 {
+		return nil, ds.ErrNotFound
+	}
+	values := make([][]byte, len(keys))
+	for _, g := range groups {
+		vals, err := ds.GetMany(ctx, g.ds, g.keys, concurrency)
+		if err != nil {
+			return nil, err
+		}
+		for i, idx := range g.indexes {
+			values[idx] = vals[i]
+		}
+	}
+	return values, nil
+}
+
+// DeleteMany deletes the values associated with the keys in the appropriate
+// datastores.
+func (d *Datastore) DeleteMany(ctx context.Context, keys []ds.Key, concurrency int) error {
+	groups, _ := d.group(keys)
+	for _, g := range groups {
+		if err := ds.DeleteMany(ctx, g.ds, g.keys, concurrency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Query queries the appropriate mounted datastores, merging the results
 // according to the given orders.
 //
@@ -888,6 +888,64 @@ func TestMaintenanceFunctions(t *testing.T) {
 	}
 }
 
+func TestParallelMounts(t *testing.T) {
+	ctx := context.Background()
+
+	blocks := datastore.NewMapDatastore()
+	root := datastore.NewMapDatastore()
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/blocks"), Datastore: blocks},
+		{Prefix: datastore.NewKey("/data"), Datastore: root},
+	})
+
+	keys := []datastore.Key{
+		datastore.NewKey("/blocks/a"),
+		datastore.NewKey("/data/b"),
+		datastore.NewKey("/blocks/c"),
+	}
+	values := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	if err := m.PutMany(ctx, keys, values, 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := blocks.Get(ctx, datastore.NewKey("/c")); err != nil || string(v) != "c" {
+		t.Fatalf("wrong value in the blocks mount: %q, %v", v, err)
+	}
+	if v, err := root.Get(ctx, datastore.NewKey("/b")); err != nil || string(v) != "b" {
+		t.Fatalf("wrong value in the data mount: %q, %v", v, err)
+	}
+
+	out, err := m.GetMany(ctx, keys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range out {
+		if string(out[i]) != string(values[i]) {
+			t.Fatalf("value %d: got %q, expected %q", i, out[i], values[i])
+		}
+	}
+
+	nowhere := datastore.NewKey("/nowhere/d")
+	if err := m.PutMany(ctx, []datastore.Key{nowhere}, [][]byte{nil}, 1); err != mount.ErrNoMount {
+		t.Fatalf("expected ErrNoMount, got %v", err)
+	}
+	if _, err := m.GetMany(ctx, append(keys, nowhere), 1); err != datastore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := m.DeleteMany(ctx, append(keys[:2:2], nowhere), 2); err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range keys {
+		has, err := m.Has(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (i == 2) {
+			t.Fatalf("key %s: expected present=%t", k, i == 2)
+		}
+	}
+}
+
 func TestSuite(t *testing.T) {
 	mapds0 := datastore.NewMapDatastore()
 	mapds1 := datastore.NewMapDatastore()
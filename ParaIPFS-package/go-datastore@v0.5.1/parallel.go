@@ -0,0 +1,151 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ErrValuesMismatch is returned by PutMany when the number of keys and values
+// differ.
+var ErrValuesMismatch = errors.New("datastore: number of keys and values differ")
+
+// ParallelDatastore is an interface that should be implemented by datastores
+// which can read, write or delete many entries faster than one at a time.
+//
+// The concurrency argument is a hint of how many entries may be handled at
+// the same time. Values below 1 let the datastore choose.
+type ParallelDatastore interface {
+	Datastore
+
+	// PutMany stores values[i] under keys[i] for every i.
+	PutMany(ctx context.Context, keys []Key, values [][]byte, concurrency int) error
+
+	// GetMany returns the values of the given keys, in the same order. It
+	// fails with ErrNotFound if one of the keys is missing.
+	GetMany(ctx context.Context, keys []Key, concurrency int) ([][]byte, error)
+
+	// DeleteMany removes the given keys. Missing keys are ignored, like
+	// in Delete.
+	DeleteMany(ctx context.Context, keys []Key, concurrency int) error
+}
+
+// Concurrency returns the concurrency to use for a hint given to a
+// ParallelDatastore method.
+func Concurrency(hint int) int {
+	if hint < 1 {
+		return runtime.NumCPU()
+	}
+	return hint
+}
+
+// ParallelRange splits [0, n) in up to concurrency contiguous ranges and calls
+// fn on each of them from its own goroutine. The context given to fn is
+// cancelled as soon as one of the calls fails, and the first error is
+// returned.
+func ParallelRange(ctx context.Context, n, concurrency int, fn func(ctx context.Context, begin, end int) error) error {
+	if n == 0 {
+		return ctx.Err()
+	}
+	concurrency = Concurrency(concurrency)
+	if concurrency > n {
+		concurrency = n
+	}
+	if concurrency == 1 {
+		return fn(ctx, 0, n)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	size := n / concurrency
+	rest := n % concurrency
+	begin := 0
+	for i := 0; i < concurrency; i++ {
+		end := begin + size
+		// Spread the remainder over the first ranges.
+		if i < rest {
+			end++
+		}
+		wg.Add(1)
+		go func(begin, end int) {
+			defer wg.Done()
+			if err := fn(ctx, begin, end); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(begin, end)
+		begin = end
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// PutMany stores values[i] under keys[i] in d. It uses the ParallelDatastore
+// implementation of d when there is one, and calls Put from up to concurrency
+// goroutines otherwise.
+func PutMany(ctx context.Context, d Datastore, keys []Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return ErrValuesMismatch
+	}
+	if pds, ok := d.(ParallelDatastore); ok {
+		return pds.PutMany(ctx, keys, values, concurrency)
+	}
+	return ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			if err := d.Put(ctx, keys[i], values[i]); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
+
+// GetMany returns the values of the given keys in d, in the same order. It
+// uses the ParallelDatastore implementation of d when there is one, and calls
+// Get from up to concurrency goroutines otherwise.
+func GetMany(ctx context.Context, d Datastore, keys []Key, concurrency int) ([][]byte, error) {
+	if pds, ok := d.(ParallelDatastore); ok {
+		return pds.GetMany(ctx, keys, concurrency)
+	}
+	values := make([][]byte, len(keys))
+	err := ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			v, err := d.Get(ctx, keys[i])
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DeleteMany removes the given keys from d. It uses the ParallelDatastore
+// implementation of d when there is one, and calls Delete from up to
+// concurrency goroutines otherwise.
+func DeleteMany(ctx context.Context, d Datastore, keys []Key, concurrency int) error {
+	if pds, ok := d.(ParallelDatastore); ok {
+		return pds.DeleteMany(ctx, keys, concurrency)
+	}
+	return ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			if err := d.Delete(ctx, keys[i]); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
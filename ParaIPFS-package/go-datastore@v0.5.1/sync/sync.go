@@ -23,6 +23,7 @@ var _ ds.PersistentDatastore = (*MutexDatastore)(nil)
 var _ ds.CheckedDatastore = (*MutexDatastore)(nil)
 var _ ds.ScrubbedDatastore = (*MutexDatastore)(nil)
 var _ ds.GCDatastore = (*MutexDatastore)(nil)
+var _ ds.ParallelDatastore = (*MutexDatastore)(nil)
 
 // MutexWrap constructs a datastore with a coarse lock around the entire
 // datastore, for every single operation.
@@ -77,6 +78,27 @@ func (d *MutexDatastore) Delete(ctx context.Context, key ds.Key) (err error) {
 	return d.child.Delete(ctx, key)
 }
 
+// PutMany implements ParallelDatastore.PutMany
+func (d *MutexDatastore) PutMany(ctx context.Context, keys []ds.Key, values [][]byte, concurrency int) error {
+	d.Lock()
+	defer d.Unlock()
+	return ds.PutMany(ctx, d.child, keys, values, concurrency)
+}
+
+// GetMany implements ParallelDatastore.GetMany
+func (d *MutexDatastore) GetMany(ctx context.Context, keys []ds.Key, concurrency int) ([][]byte, error) {
+	d.RLock()
+	defer d.RUnlock()
+	return ds.GetMany(ctx, d.child, keys, concurrency)
+}
+
+// DeleteMany implements ParallelDatastore.DeleteMany
+func (d *MutexDatastore) DeleteMany(ctx context.Context, keys []ds.Key, concurrency int) error {
+	d.Lock()
+	defer d.Unlock()
+	return ds.DeleteMany(ctx, d.child, keys, concurrency)
+}
+
 // Query implements Datastore.Query
 func (d *MutexDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
 	d.RLock()
@@ -3,6 +3,7 @@ package dstest
 import (
 	"bytes"
 	"context"
+	"encoding/base32"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -519,3 +520,60 @@ func subtestQuery(t *testing.T, ds dstore.Datastore, q dsq.Query, count int) {
 		}
 	}
 }
+
+func SubtestParallelPutGetDelete(t *testing.T, ds dstore.Datastore) {
+	ctx := context.Background()
+
+	var keys []dstore.Key
+	var values [][]byte
+	for i := 0; i < ElemCount; i++ {
+		value := make([]byte, 64)
+		rand.Read(value)
+		keys = append(keys, dstore.NewKey(base32.StdEncoding.EncodeToString(value[:8])))
+		values = append(values, value)
+	}
+
+	if err := dstore.PutMany(ctx, ds, keys, values[:1], 4); err != dstore.ErrValuesMismatch {
+		t.Fatalf("expected ErrValuesMismatch, got %v", err)
+	}
+	if err := dstore.PutMany(ctx, ds, keys, values, 4); err != nil {
+		t.Fatal("error putting many values: ", err)
+	}
+
+	for _, concurrency := range []int{0, 1, 7} {
+		out, err := dstore.GetMany(ctx, ds, keys, concurrency)
+		if err != nil {
+			t.Fatalf("error getting many values with concurrency %d: %s", concurrency, err)
+		}
+		if len(out) != len(values) {
+			t.Fatalf("expected %d values, got %d", len(values), len(out))
+		}
+		for i := range out {
+			if !bytes.Equal(out[i], values[i]) {
+				t.Fatalf("value %d mismatch with concurrency %d", i, concurrency)
+			}
+		}
+	}
+
+	missing := dstore.NewKey("MISSING")
+	if _, err := dstore.GetMany(ctx, ds, append(keys[:1:1], missing), 2); err != dstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound for a missing key, got %v", err)
+	}
+
+	half := len(keys) / 2
+	if err := dstore.DeleteMany(ctx, ds, append(keys[:half:half], missing), 3); err != nil {
+		t.Fatal("error deleting many keys: ", err)
+	}
+	for i, k := range keys {
+		has, err := ds.Has(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (i >= half) {
+			t.Fatalf("key %d: expected present=%t", i, i >= half)
+		}
+	}
+	if err := dstore.DeleteMany(ctx, ds, keys[half:], 0); err != nil {
+		t.Fatal("error deleting many keys: ", err)
+	}
+}
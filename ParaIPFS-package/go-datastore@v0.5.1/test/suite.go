@@ -23,6 +23,7 @@ var BasicSubtests = []func(t *testing.T, ds dstore.Datastore){
 	SubtestManyKeysAndQuery,
 	SubtestReturnSizes,
 	SubtestBasicSync,
+	SubtestParallelPutGetDelete,
 }
 
 // Only enable the expensive "combinations" test when not running the race detector.
@@ -122,6 +122,7 @@ var _ ds.TxnDatastore = (*Datastore)(nil)
 var _ ds.TTLDatastore = (*Datastore)(nil)
 var _ ds.GCDatastore = (*Datastore)(nil)
 var _ ds.Batching = (*Datastore)(nil)
+var _ ds.ParallelDatastore = (*Datastore)(nil)
 
 // NewDatastore creates a new badger datastore.
 //
@@ -418,6 +419,74 @@ func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
 	return b, nil
 }
 
+// PutMany writes all the entries through a badger WriteBatch, which commits
+// its transactions concurrently on its own.
+func (d *Datastore) PutMany(ctx context.Context, keys []ds.Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return ds.ErrValuesMismatch
+	}
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	wb := d.DB.NewWriteBatch()
+	for i, k := range keys {
+		if err := wb.Set(k.Bytes(), values[i]); err != nil {
+			wb.Cancel()
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// GetMany reads the entries from up to concurrency goroutines, each one using
+// its own read-only transaction.
+func (d *Datastore) GetMany(ctx context.Context, keys []ds.Key, concurrency int) ([][]byte, error) {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	values := make([][]byte, len(keys))
+	err := ds.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		txn := d.newImplicitTransaction(true)
+		defer txn.discard()
+		for i := begin; i < end; i++ {
+			v, err := txn.get(keys[i])
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DeleteMany removes all the entries through a badger WriteBatch.
+func (d *Datastore) DeleteMany(ctx context.Context, keys []ds.Key, concurrency int) error {
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	wb := d.DB.NewWriteBatch()
+	for _, k := range keys {
+		if err := wb.Delete(k.Bytes()); err != nil {
+			wb.Cancel()
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
 func (d *Datastore) CollectGarbage(ctx context.Context) (err error) {
 	// The idea is to keep calling DB.RunValueLogGC() till Badger no longer has any log files
 	// to GC(which would be indicated by an error, please refer to Badger GC docs).
@@ -0,0 +1,199 @@
+package flatfs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Durability selects how the flatfs datastores opened with syncing enabled
+// make their writes durable.
+type Durability string
+
+const (
+	// DurabilityStrict syncs every file before renaming it in place, and
+	// its directory right after: a write is durable once it returns.
+	DurabilityStrict Durability = "strict"
+	// DurabilityBatch renames the files in place without syncing them, and
+	// group-commits them for each directory shard: the files of a shard are
+	// synced together once enough of them are pending, and the directories
+	// are only synced, once each, by Sync or Close. The writes are durable
+	// once Sync returns. A power failure may lose, or leave corrupt, the
+	// files written since the last Sync; killing the process does not.
+	DurabilityBatch Durability = "batch"
+	// DurabilityNone never syncs.
+	DurabilityNone Durability = "none"
+)
+
+// ParseDurability parses a durability mode, defaulting to DurabilityStrict.
+func ParseDurability(s string) (Durability, error) {
+	switch d := Durability(s); d {
+	case "":
+		return DurabilityStrict, nil
+	case DurabilityStrict, DurabilityBatch, DurabilityNone:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown durability %q, expected %q, %q or %q", s, DurabilityStrict, DurabilityBatch, DurabilityNone)
+	}
+}
+
+var durability atomic.Value
+
+func init() {
+	durability.Store(DurabilityStrict)
+}
+
+// SetDurability sets the durability of the writes of all the flatfs
+// datastores of the process opened with syncing enabled. The files pending
+// in batch mode are still committed by the next Sync or Close.
+func SetDurability(d Durability) {
+	durability.Store(d)
+}
+
+// BatchCommitFiles is the number of files pending in a directory shard, in
+// batch mode, that makes the write adding the last one commit them.
+var BatchCommitFiles = 1024
+
+func (fs *Datastore) durability() Durability {
+	if !fs.sync {
+		return DurabilityNone
+	}
+	return durability.Load().(Durability)
+}
+
+// shardCommit tracks the writes of a directory shard not yet committed.
+type shardCommit struct {
+	// commitLk is held while the shard is committed, so that a commit
+	// only returns once the files taken by earlier ones are synced too.
+	commitLk sync.Mutex
+
+	// files and dirty are guarded by Datastore.pendingLk.
+	files []string
+	dirty bool
+}
+
+// addPending records that path was renamed into the shard dir without
+// being synced, and commits the files of the shard once BatchCommitFiles of
+// them are pending.
+func (fs *Datastore) addPending(dir string, paths ...string) error {
+	fs.pendingLk.Lock()
+	if fs.pending == nil {
+		fs.pending = make(map[string]*shardCommit)
+	}
+	sc, ok := fs.pending[dir]
+	if !ok {
+		sc = &shardCommit{}
+		fs.pending[dir] = sc
+	}
+	sc.files = append(sc.files, paths...)
+	sc.dirty = true
+	full := len(sc.files) >= BatchCommitFiles
+	fs.pendingLk.Unlock()
+
+	if full {
+		return fs.commitShard(dir, sc, false)
+	}
+	return nil
+}
+
+// addPendingDir records that a directory shard was created without syncing
+// the root directory.
+func (fs *Datastore) addPendingDir() {
+	fs.pendingLk.Lock()
+	fs.pendingRoot = true
+	fs.pendingLk.Unlock()
+}
+
+// commitShard syncs the files pending in the shard dir, then dir itself if
+// withDir is set.
+func (fs *Datastore) commitShard(dir string, sc *shardCommit, withDir bool) error {
+	sc.commitLk.Lock()
+	defer sc.commitLk.Unlock()
+
+	fs.pendingLk.Lock()
+	files := sc.files
+	sc.files = nil
+	dirty := sc.dirty
+	if withDir {
+		sc.dirty = false
+	}
+	fs.pendingLk.Unlock()
+
+	for i, path := range files {
+		if err := syncPath(path); err != nil {
+			fs.requeue(sc, files[i:], withDir && dirty)
+			return err
+		}
+	}
+	if withDir && dirty {
+		if err := syncDir(dir); err != nil {
+			fs.requeue(sc, nil, true)
+			return err
+		}
+	}
+	return nil
+}
+
+// requeue puts back the files a failed commit did not sync.
+func (fs *Datastore) requeue(sc *shardCommit, files []string, dirty bool) {
+	fs.pendingLk.Lock()
+	sc.files = append(sc.files, files...)
+	sc.dirty = sc.dirty || dirty
+	fs.pendingLk.Unlock()
+}
+
+// commitPending commits every directory shard with pending writes, then
+// the root directory if shards were created.
+func (fs *Datastore) commitPending() error {
+	fs.pendingLk.Lock()
+	dirs := make(map[string]*shardCommit, len(fs.pending))
+	for dir, sc := range fs.pending {
+		if sc.dirty || len(sc.files) > 0 {
+			dirs[dir] = sc
+		}
+	}
+	root := fs.pendingRoot
+	fs.pendingRoot = false
+	fs.pendingLk.Unlock()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+	)
+	for dir, sc := range dirs {
+		wg.Add(1)
+		go func(dir string, sc *shardCommit) {
+			defer wg.Done()
+			if cerr := fs.commitShard(dir, sc, true); cerr != nil {
+				errOnce.Do(func() { err = cerr })
+			}
+		}(dir, sc)
+	}
+	wg.Wait()
+
+	if root {
+		if err == nil {
+			err = syncDir(fs.path)
+		}
+		if err != nil {
+			fs.addPendingDir()
+		}
+	}
+	return err
+}
+
+// syncPath syncs the file at path. A file removed meanwhile has nothing to
+// sync.
+func syncPath(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return syncFile(f)
+}
@@ -0,0 +1,262 @@
+package flatfs_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+
+	flatfs "github.com/ipfs/go-ds-flatfs"
+)
+
+func TestParseDurability(t *testing.T) {
+	for in, expected := range map[string]flatfs.Durability{
+		"":       flatfs.DurabilityStrict,
+		"strict": flatfs.DurabilityStrict,
+		"batch":  flatfs.DurabilityBatch,
+		"none":   flatfs.DurabilityNone,
+	} {
+		d, err := flatfs.ParseDurability(in)
+		if err != nil || d != expected {
+			t.Fatalf("ParseDurability(%q) = %q, %v", in, d, err)
+		}
+	}
+	if _, err := flatfs.ParseDurability("lazy"); err == nil {
+		t.Fatal("expected an error for an unknown durability")
+	}
+}
+
+// durabilityValue is the value stored under the i-th key by the durability
+// tests, large enough to take several writes.
+func durabilityValue(key datastore.Key) []byte {
+	return bytes.Repeat([]byte(key.String()), 4096)
+}
+
+func durabilityKey(i int) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("DURABILITY%08d", i))
+}
+
+func testDurabilityBatch(dirFunc mkShardFunc, t *testing.T) {
+	defer flatfs.SetDurability(flatfs.DurabilityStrict)
+	flatfs.SetDurability(flatfs.DurabilityBatch)
+	defer func(n int) { flatfs.BatchCommitFiles = n }(flatfs.BatchCommitFiles)
+
+	temp, cleanup := tempdir(t)
+	defer cleanup()
+	defer checkTemp(t, temp)
+
+	fs, err := flatfs.CreateOrOpen(temp, dirFunc(1), true)
+	if err != nil {
+		t.Fatalf("New fail: %v\n", err)
+	}
+
+	var keys []datastore.Key
+	var values [][]byte
+	for i := 0; i < 100; i++ {
+		key := durabilityKey(i)
+		keys = append(keys, key)
+		values = append(values, durabilityValue(key))
+	}
+	flatfs.BatchCommitFiles = len(keys) + 1
+	for i, key := range keys[:30] {
+		if err := fs.Put(bg, key, values[i]); err != nil {
+			t.Fatalf("Put fail: %v\n", err)
+		}
+	}
+	if err := fs.PutMany(bg, keys[30:], values[30:], 4); err != nil {
+		t.Fatalf("PutMany fail: %v\n", err)
+	}
+
+	if pending := fs.PendingFiles(); pending != len(keys) {
+		t.Fatalf("expected the %d files to be pending, got %d", len(keys), pending)
+	}
+	for i, key := range keys {
+		v, err := fs.Get(bg, key)
+		if err != nil {
+			t.Fatalf("Get fail: %v\n", err)
+		}
+		if !bytes.Equal(v, values[i]) {
+			t.Fatalf("%s: got the wrong value", key)
+		}
+	}
+
+	if err := fs.Sync(bg, datastore.NewKey("")); err != nil {
+		t.Fatalf("Sync fail: %v\n", err)
+	}
+	if pending := fs.PendingFiles(); pending != 0 {
+		t.Fatalf("expected no pending file after Sync, got %d", pending)
+	}
+
+	// A full shard is committed by the write filling it.
+	flatfs.BatchCommitFiles = 1
+	if err := fs.Put(bg, datastore.NewKey("QUUX"), []byte("foobar")); err != nil {
+		t.Fatalf("Put fail: %v\n", err)
+	}
+	if pending := fs.PendingFiles(); pending != 0 {
+		t.Fatalf("expected the full shard to be committed, got %d pending files", pending)
+	}
+
+	// Close commits whatever is pending.
+	flatfs.BatchCommitFiles = 2
+	if err := fs.Put(bg, datastore.NewKey("QUUZ"), []byte("foobar")); err != nil {
+		t.Fatalf("Put fail: %v\n", err)
+	}
+	if pending := fs.PendingFiles(); pending != 1 {
+		t.Fatalf("expected the last file to be pending, got %d", pending)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close fail: %v\n", err)
+	}
+	if pending := fs.PendingFiles(); pending != 0 {
+		t.Fatalf("expected no pending file after Close, got %d", pending)
+	}
+}
+
+func TestDurabilityBatch(t *testing.T) { tryAllShardFuncs(t, testDurabilityBatch) }
+
+func TestDurabilityStrictHasNothingPending(t *testing.T) {
+	temp, cleanup := tempdir(t)
+	defer cleanup()
+
+	fs, err := flatfs.CreateOrOpen(temp, flatfs.NextToLast(2), true)
+	if err != nil {
+		t.Fatalf("New fail: %v\n", err)
+	}
+	defer fs.Close()
+
+	key := durabilityKey(0)
+	if err := fs.Put(bg, key, durabilityValue(key)); err != nil {
+		t.Fatalf("Put fail: %v\n", err)
+	}
+	if pending := fs.PendingFiles(); pending != 0 {
+		t.Fatalf("expected no pending file, got %d", pending)
+	}
+}
+
+// crashHelperEnv names the environment variable holding the path of the
+// datastore the crash helper process writes to until it is killed.
+const crashHelperEnv = "FLATFS_CRASH_HELPER_PATH"
+
+// TestCrashHelper writes to the datastore given by the parent test until it
+// is killed, like an add that is interrupted.
+func TestCrashHelper(t *testing.T) {
+	path := os.Getenv(crashHelperEnv)
+	if path == "" {
+		t.Skip("only run by TestCrashConsistency")
+	}
+	d, err := flatfs.ParseDurability(os.Getenv("FLATFS_CRASH_HELPER_DURABILITY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flatfs.SetDurability(d)
+
+	fs, err := flatfs.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tell the parent that the datastore is open.
+	fmt.Println("ready")
+
+	for i := 0; ; i += 16 {
+		var keys []datastore.Key
+		var values [][]byte
+		for j := i; j < i+16; j++ {
+			key := durabilityKey(j)
+			keys = append(keys, key)
+			values = append(values, durabilityValue(key))
+		}
+		if err := fs.PutMany(bg, keys[:8], values[:8], 4); err != nil {
+			t.Fatal(err)
+		}
+		for j, key := range keys[8:] {
+			if err := fs.Put(bg, key, values[8+j]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i%256 == 0 {
+			if err := fs.Sync(bg, datastore.NewKey("")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// TestCrashConsistency kills a process writing to a datastore and checks that
+// every entry it left behind is complete, and that the datastore can still be
+// written to.
+func TestCrashConsistency(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cannot kill the helper process reliably on windows")
+	}
+	if os.Getenv(crashHelperEnv) != "" {
+		t.Skip("already the helper")
+	}
+
+	for _, d := range []flatfs.Durability{flatfs.DurabilityStrict, flatfs.DurabilityBatch, flatfs.DurabilityNone} {
+		t.Run(string(d), func(t *testing.T) {
+			temp, cleanup := tempdir(t)
+			defer cleanup()
+			if err := flatfs.Create(temp, flatfs.NextToLast(2)); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(bg, time.Minute)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestCrashHelper$", "-test.v")
+			cmd.Env = append(os.Environ(), crashHelperEnv+"="+temp, "FLATFS_CRASH_HELPER_DURABILITY="+string(d))
+			out, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 512)
+			if _, err := out.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(200 * time.Millisecond)
+			if err := cmd.Process.Kill(); err != nil {
+				t.Fatal(err)
+			}
+			_ = cmd.Wait()
+
+			fs, err := flatfs.Open(temp, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fs.Close()
+
+			res, err := fs.Query(bg, query.Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := res.Rest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) == 0 {
+				t.Fatal("the helper wrote nothing before it was killed")
+			}
+			for _, e := range entries {
+				key := datastore.NewKey(e.Key)
+				if !bytes.Equal(e.Value, durabilityValue(key)) {
+					t.Fatalf("%s: got %d bytes of a partial value", key, len(e.Value))
+				}
+			}
+			checkTemp(t, temp)
+
+			key := durabilityKey(-1)
+			if err := fs.Put(bg, key, durabilityValue(key)); err != nil {
+				t.Fatalf("Put after the crash fail: %v\n", err)
+			}
+		})
+	}
+}
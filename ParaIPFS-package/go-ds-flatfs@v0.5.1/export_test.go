@@ -0,0 +1,12 @@
+package flatfs
+
+// PendingFiles returns the number of files not yet committed in batch mode.
+func (fs *Datastore) PendingFiles() int {
+	fs.pendingLk.Lock()
+	defer fs.pendingLk.Unlock()
+	n := 0
+	for _, sc := range fs.pending {
+		n += len(sc.files)
+	}
+	return n
+}
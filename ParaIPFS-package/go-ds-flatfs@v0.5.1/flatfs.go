@@ -132,6 +132,11 @@ type Datastore struct {
 	// sychronize all writes and directory changes for added safety
 	sync bool
 
+	// the writes not yet committed in batch mode, see DurabilityBatch
+	pendingLk   sync.Mutex
+	pending     map[string]*shardCommit
+	pendingRoot bool
+
 	// these values should only be used during internalization or
 	// inside the checkpoint loop
 	dirty       bool
@@ -334,10 +339,13 @@ func (fs *Datastore) makeDir(dir string) error {
 	// it, the creation of the prefix dir itself might not be
 	// durable yet. Sync the root dir after a successful mkdir of
 	// a prefix dir, just to be paranoid.
-	if fs.sync {
+	switch fs.durability() {
+	case DurabilityStrict:
 		if err := syncDir(fs.path); err != nil {
 			return err
 		}
+	case DurabilityBatch:
+		fs.addPendingDir()
 	}
 	return nil
 }
@@ -416,6 +424,7 @@ func (fs *Datastore) Put(ctx context.Context, key datastore.Key, value []byte) e
 	return err
 }
 
+// Sync commits the writes pending in batch mode, whatever the prefix.
 func (fs *Datastore) Sync(ctx context.Context, prefix datastore.Key) error {
 	fs.shutdownLock.RLock()
 	defer fs.shutdownLock.RUnlock()
@@ -423,7 +432,7 @@ func (fs *Datastore) Sync(ctx context.Context, prefix datastore.Key) error {
 		return ErrClosed
 	}
 
-	return nil
+	return fs.commitPending()
 }
 
 func (fs *Datastore) doOp(oper *op) error {
@@ -502,7 +511,8 @@ func (fs *Datastore) doPut(key datastore.Key, val []byte) error {
 	if _, err := tmp.Write(val); err != nil {
 		return err
 	}
-	if fs.sync {
+	mode := fs.durability()
+	if mode == DurabilityStrict {
 		if err := syncFile(tmp); err != nil {
 			return err
 		}
@@ -518,15 +528,22 @@ func (fs *Datastore) doPut(key datastore.Key, val []byte) error {
 	}
 	removed = true
 
-	if fs.sync {
+	switch mode {
+	case DurabilityStrict:
 		if err := syncDir(dir); err != nil {
 			return err
 		}
+	case DurabilityBatch:
+		return fs.addPending(dir, path)
 	}
 	return nil
 }
 
-func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
+// putMany writes data through temporary files that are only renamed in place
+// once all of them have been written. It stops between files when ctx is
+// cancelled; whatever it leaves behind in the temporary directory is removed
+// on any failure.
+func (fs *Datastore) putMany(ctx context.Context, data map[datastore.Key][]byte) error {
 	fs.shutdownLock.RLock()
 	defer fs.shutdownLock.RUnlock()
 	if fs.shutdown {
@@ -541,7 +558,8 @@ func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
 	}
 
 	var (
-		dirsToSync = make(map[string]struct{}, len(data))
+		mode       = fs.durability()
+		dirsToSync = make(map[string][]string, len(data))
 		files      = make([]putManyOp, 0, len(data))
 		closed     int
 		removed    int
@@ -561,7 +579,7 @@ func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
 	closer := func() error {
 		for closed < len(files) {
 			fi := files[closed].file
-			if fs.sync {
+			if mode == DurabilityStrict {
 				if err := syncFile(fi); err != nil {
 					return err
 				}
@@ -575,11 +593,15 @@ func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
 	}
 
 	for key, value := range data {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		dir, path := fs.encode(key)
 		if err := fs.makeDirNoSync(dir); err != nil {
 			return err
 		}
-		dirsToSync[dir] = struct{}{}
+		dirsToSync[dir] = append(dirsToSync[dir], path)
 
 		tmp, err := fs.tempFileOnce()
 
@@ -633,7 +655,8 @@ func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
 	}
 
 	// now sync the dirs for those files
-	if fs.sync {
+	switch mode {
+	case DurabilityStrict:
 		for dir := range dirsToSync {
 			if err := syncDir(dir); err != nil {
 				return err
@@ -644,6 +667,14 @@ func (fs *Datastore) putMany(data map[datastore.Key][]byte) error {
 		if err := syncDir(fs.path); err != nil {
 			return err
 		}
+	case DurabilityBatch:
+		// the top flatfs dir is synced along with the shards
+		fs.addPendingDir()
+		for dir, paths := range dirsToSync {
+			if err := fs.addPending(dir, paths...); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -1197,8 +1228,12 @@ func (fs *Datastore) deactivate() {
 }
 
 func (fs *Datastore) Close() error {
+	fs.shutdownLock.RLock()
+	err := fs.commitPending()
+	fs.shutdownLock.RUnlock()
+
 	fs.deactivate()
-	return nil
+	return err
 }
 
 type flatfsBatch struct {
@@ -1232,7 +1267,7 @@ func (bt *flatfsBatch) Delete(ctx context.Context, key datastore.Key) error {
 }
 
 func (bt *flatfsBatch) Commit(ctx context.Context) error {
-	if err := bt.ds.putMany(bt.puts); err != nil {
+	if err := bt.ds.putMany(ctx, bt.puts); err != nil {
 		return err
 	}
 
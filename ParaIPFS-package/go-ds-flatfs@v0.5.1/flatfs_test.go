@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -943,6 +944,56 @@ func testBatchDelete(dirFunc mkShardFunc, t *testing.T) {
 
 func TestBatchDelete(t *testing.T) { tryAllShardFuncs(t, testBatchDelete) }
 
+// cancelAfterCtx is a context that reports itself cancelled once its Err
+// method has been called n times.
+type cancelAfterCtx struct {
+	context.Context
+	n int32
+}
+
+func (c *cancelAfterCtx) Err() error {
+	if atomic.AddInt32(&c.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func testPutManyCancel(dirFunc mkShardFunc, t *testing.T) {
+	temp, cleanup := tempdir(t)
+	defer cleanup()
+	defer checkTemp(t, temp)
+
+	fs, err := flatfs.CreateOrOpen(temp, dirFunc(2), false)
+	if err != nil {
+		t.Fatalf("New fail: %v\n", err)
+	}
+	defer fs.Close()
+
+	var keys []datastore.Key
+	var values [][]byte
+	for i := 0; i < 40; i++ {
+		keys = append(keys, datastore.NewKey(fmt.Sprintf("CANCEL%03d", i)))
+		values = append(values, []byte(fmt.Sprintf("value %d", i)))
+	}
+
+	// Cancelled in the middle of writing the temporary files.
+	ctx := &cancelAfterCtx{Context: bg, n: 10}
+	if err := fs.PutMany(ctx, keys, values, 1); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	for _, k := range keys {
+		if has, err := fs.Has(bg, k); err != nil || has {
+			t.Fatalf("%s stored by a cancelled PutMany (err: %v)", k, err)
+		}
+	}
+
+	if err := fs.PutMany(bg, keys, values, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutManyCancel(t *testing.T) { tryAllShardFuncs(t, testPutManyCancel) }
+
 func testClose(dirFunc mkShardFunc, t *testing.T) {
 	temp, cleanup := tempdir(t)
 	defer cleanup()
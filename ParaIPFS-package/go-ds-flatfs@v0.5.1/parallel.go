@@ -0,0 +1,63 @@
+package flatfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-datastore"
+)
+
+var _ datastore.ParallelDatastore = (*Datastore)(nil)
+
+// PutMany writes the entries from up to concurrency goroutines. Each goroutine
+// stores its share like a batch: the files are synced together and their
+// directories once, after every file has been renamed in place.
+func (fs *Datastore) PutMany(ctx context.Context, keys []datastore.Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return datastore.ErrValuesMismatch
+	}
+	for _, key := range keys {
+		if !keyIsValid(key) {
+			return fmt.Errorf("when putting '%q': %v", key, ErrInvalidKey)
+		}
+	}
+
+	return datastore.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		data := make(map[datastore.Key][]byte, end-begin)
+		for i := begin; i < end; i++ {
+			data[keys[i]] = values[i]
+		}
+		return fs.putMany(ctx, data)
+	})
+}
+
+// GetMany reads the entries from up to concurrency goroutines.
+func (fs *Datastore) GetMany(ctx context.Context, keys []datastore.Key, concurrency int) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	err := datastore.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			v, err := fs.Get(ctx, keys[i])
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DeleteMany removes the entries from up to concurrency goroutines.
+func (fs *Datastore) DeleteMany(ctx context.Context, keys []datastore.Key, concurrency int) error {
+	return datastore.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			if err := fs.Delete(ctx, keys[i]); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
@@ -3,16 +3,39 @@ package flatfs
 import (
 	"os"
 	"runtime"
+	"sync/atomic"
 )
 
 // don't block more than 16 threads on sync opearation
 // 16 should be able to sataurate most RAIDs
 // in case of two used disks per write (RAID 1, 5) and queue depth of 2,
 // 16 concurrent Sync calls should be able to saturate 16 HDDs RAID
-//TODO: benchmark it out, maybe provide tweak parmeter
+// It can be changed with SetSyncConcurrency.
 const SyncThreadsMax = 16
 
-var syncSemaphore chan struct{} = make(chan struct{}, SyncThreadsMax)
+// syncSemaphore holds the chan struct{} limiting the concurrent syncs.
+var syncSemaphore atomic.Value
+
+func init() {
+	SetSyncConcurrency(SyncThreadsMax)
+}
+
+// SetSyncConcurrency sets the number of fsyncs that all the flatfs
+// datastores of the process may run at once. The syncs already waiting keep
+// the previous limit.
+func SetSyncConcurrency(n int) {
+	if n < 1 {
+		n = SyncThreadsMax
+	}
+	syncSemaphore.Store(make(chan struct{}, n))
+}
+
+// acquireSync waits for a sync slot and returns the function releasing it.
+func acquireSync() (release func()) {
+	sem := syncSemaphore.Load().(chan struct{})
+	sem <- struct{}{}
+	return func() { <-sem }
+}
 
 //mssong sync
 func syncDir(dir string) error {
@@ -27,8 +50,7 @@ func syncDir(dir string) error {
 	}
 	defer dirF.Close()
 
-	syncSemaphore <- struct{}{}
-	defer func() { <-syncSemaphore }()
+	defer acquireSync()()
 
 	////
 	if err := dirF.Sync(); err != nil {
@@ -40,8 +62,7 @@ func syncDir(dir string) error {
 
 //mssong sync
 func syncFile(file *os.File) error {
-	syncSemaphore <- struct{}{}
-	defer func() { <-syncSemaphore }()
+	defer acquireSync()()
 	return file.Sync()
 	// return nil
 }
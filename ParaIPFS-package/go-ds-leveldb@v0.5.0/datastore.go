@@ -24,6 +24,7 @@ type Datastore struct {
 
 var _ ds.Datastore = (*Datastore)(nil)
 var _ ds.TxnDatastore = (*Datastore)(nil)
+var _ ds.ParallelDatastore = (*Datastore)(nil)
 
 // Options is an alias of syndtr/goleveldb/opt.Options which might be extended
 // in the future.
@@ -239,6 +240,51 @@ func (b *leveldbBatch) Delete(ctx context.Context, key ds.Key) error {
 	return nil
 }
 
+// PutMany writes all the entries in a single leveldb batch. LevelDB
+// serializes writes, so the concurrency hint is ignored.
+func (d *Datastore) PutMany(ctx context.Context, keys []ds.Key, values [][]byte, concurrency int) error {
+	if len(keys) != len(values) {
+		return ds.ErrValuesMismatch
+	}
+	b := new(leveldb.Batch)
+	for i, k := range keys {
+		b.Put(k.Bytes(), values[i])
+	}
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	return d.DB.Write(b, &opt.WriteOptions{Sync: d.syncWrites})
+}
+
+// GetMany reads the entries from up to concurrency goroutines.
+func (d *Datastore) GetMany(ctx context.Context, keys []ds.Key, concurrency int) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	err := ds.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			v, err := d.Get(ctx, keys[i])
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// DeleteMany removes all the entries in a single leveldb batch.
+func (d *Datastore) DeleteMany(ctx context.Context, keys []ds.Key, concurrency int) error {
+	b := new(leveldb.Batch)
+	for _, k := range keys {
+		b.Delete(k.Bytes())
+	}
+	d.closeLk.RLock()
+	defer d.closeLk.RUnlock()
+	return d.DB.Write(b, &opt.WriteOptions{Sync: d.syncWrites})
+}
+
 // A leveldb transaction embedding the accessor backed by the transaction.
 type transaction struct {
 	*accessor
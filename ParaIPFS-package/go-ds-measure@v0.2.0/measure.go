@@ -96,6 +96,21 @@ func New(prefix string, ds datastore.Datastore) *measure {
 		batchDeleteLatency: metrics.New(prefix+".batchdelete.latency_seconds",
 			"Latency distribution of Batch.Delete calls").Histogram(datastoreLatencyBuckets),
 
+		putManyNum: metrics.New(prefix+".putmany_total", "Total number of Datastore.PutMany calls").Counter(),
+		putManyErr: metrics.New(prefix+".putmany.errors_total", "Number of errored Datastore.PutMany calls").Counter(),
+		putManyLatency: metrics.New(prefix+".putmany.latency_seconds",
+			"Latency distribution of Datastore.PutMany calls").Histogram(datastoreLatencyBuckets),
+
+		getManyNum: metrics.New(prefix+".getmany_total", "Total number of Datastore.GetMany calls").Counter(),
+		getManyErr: metrics.New(prefix+".getmany.errors_total", "Number of errored Datastore.GetMany calls").Counter(),
+		getManyLatency: metrics.New(prefix+".getmany.latency_seconds",
+			"Latency distribution of Datastore.GetMany calls").Histogram(datastoreLatencyBuckets),
+
+		deleteManyNum: metrics.New(prefix+".deletemany_total", "Total number of Datastore.DeleteMany calls").Counter(),
+		deleteManyErr: metrics.New(prefix+".deletemany.errors_total", "Number of errored Datastore.DeleteMany calls").Counter(),
+		deleteManyLatency: metrics.New(prefix+".deletemany.latency_seconds",
+			"Latency distribution of Datastore.DeleteMany calls").Histogram(datastoreLatencyBuckets),
+
 		batchCommitNum: metrics.New(prefix+".batchcommit_total", "Total number of Batch.Commit calls").Counter(),
 		batchCommitErr: metrics.New(prefix+".batchcommit.errors_total", "Number of errored Batch.Commit calls").Counter(),
 		batchCommitLatency: metrics.New(prefix+".batchcommit.latency_seconds",
@@ -165,6 +180,18 @@ type measure struct {
 	batchCommitNum     metrics.Counter
 	batchCommitErr     metrics.Counter
 	batchCommitLatency metrics.Histogram
+
+	putManyNum     metrics.Counter
+	putManyErr     metrics.Counter
+	putManyLatency metrics.Histogram
+
+	getManyNum     metrics.Counter
+	getManyErr     metrics.Counter
+	getManyLatency metrics.Histogram
+
+	deleteManyNum     metrics.Counter
+	deleteManyErr     metrics.Counter
+	deleteManyLatency metrics.Histogram
 }
 
 func recordLatency(h metrics.Histogram, start time.Time) {
@@ -300,6 +327,39 @@ func (m *measure) DiskUsage(ctx context.Context) (uint64, error) {
 	return size, err
 }
 
+func (m *measure) PutMany(ctx context.Context, keys []datastore.Key, values [][]byte, concurrency int) error {
+	defer recordLatency(m.putManyLatency, time.Now())
+	m.putManyNum.Inc()
+	err := datastore.PutMany(ctx, m.backend, keys, values, concurrency)
+	if err != nil {
+		m.putManyErr.Inc()
+	}
+	return err
+}
+
+func (m *measure) GetMany(ctx context.Context, keys []datastore.Key, concurrency int) ([][]byte, error) {
+	defer recordLatency(m.getManyLatency, time.Now())
+	m.getManyNum.Inc()
+	values, err := datastore.GetMany(ctx, m.backend, keys, concurrency)
+	switch err {
+	case nil, datastore.ErrNotFound:
+		// Not really an error.
+	default:
+		m.getManyErr.Inc()
+	}
+	return values, err
+}
+
+func (m *measure) DeleteMany(ctx context.Context, keys []datastore.Key, concurrency int) error {
+	defer recordLatency(m.deleteManyLatency, time.Now())
+	m.deleteManyNum.Inc()
+	err := datastore.DeleteMany(ctx, m.backend, keys, concurrency)
+	if err != nil {
+		m.deleteManyErr.Inc()
+	}
+	return err
+}
+
 type measuredBatch struct {
 	b datastore.Batch
 	m *measure
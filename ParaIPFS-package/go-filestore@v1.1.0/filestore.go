@@ -14,6 +14,7 @@ import (
 
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	posinfo "github.com/ipfs/go-ipfs-posinfo"
@@ -249,6 +250,96 @@ func (f *Filestore) PutMany(ctx context.Context, bs []blocks.Block) error {
 	return nil
 }
 
+// PutManyParallel is like PutMany(), but lets the regular blockstore write
+// up to concurrency blocks in parallel.
+func (f *Filestore) PutManyParallel(ctx context.Context, bs []blocks.Block, concurrency int) error {
+	exists := make([]bool, len(bs))
+	err := ds.ParallelRange(ctx, len(bs), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			has, err := f.Has(ctx, bs[i].Cid())
+			if err != nil {
+				return err
+			}
+			exists[i] = has
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	var normals []blocks.Block
+	var fstores []*posinfo.FilestoreNode
+	for i, b := range bs {
+		if exists[i] {
+			continue
+		}
+
+		switch b := b.(type) {
+		case *posinfo.FilestoreNode:
+			fstores = append(fstores, b)
+		default:
+			normals = append(normals, b)
+		}
+	}
+
+	if len(normals) > 0 {
+		err := f.bs.PutManyParallel(ctx, normals, concurrency)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(fstores) > 0 {
+		err := f.fm.PutMany(ctx, fstores)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetManyParallel retrieves the blocks with the given Cids, in the same
+// order. Blocks that are not all in the regular blockstore are looked up one
+// by one, like in Get(). It may return ErrNotFound when a block is not
+// stored.
+func (f *Filestore) GetManyParallel(ctx context.Context, cs []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	blks, err := f.bs.GetManyParallel(ctx, cs, concurrency)
+	if err != blockstore.ErrNotFound {
+		return blks, err
+	}
+
+	blks = make([]blocks.Block, len(cs))
+	err = ds.ParallelRange(ctx, len(cs), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			blk, err := f.Get(ctx, cs[i])
+			if err != nil {
+				return err
+			}
+			blks[i] = blk
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blks, nil
+}
+
+// DeleteManyParallel deletes the blocks with the given Cids, like
+// DeleteBlock(). Blocks that are not stored are ignored.
+func (f *Filestore) DeleteManyParallel(ctx context.Context, cs []cid.Cid, concurrency int) error {
+	return ds.ParallelRange(ctx, len(cs), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			err := f.DeleteBlock(ctx, cs[i])
+			if err != nil && err != blockstore.ErrNotFound {
+				return err
+			}
+		}
+		return ctx.Err()
+	})
+}
+
 // HashOnRead calls blockstore.HashOnRead.
 func (f *Filestore) HashOnRead(enabled bool) {
 	f.bs.HashOnRead(enabled)
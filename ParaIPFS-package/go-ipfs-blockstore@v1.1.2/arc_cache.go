@@ -344,6 +344,132 @@ func (b *arccache) PutMany(ctx context.Context, bs []blocks.Block) error {
 	return nil
 }
 
+func (b *arccache) PutManyParallel(ctx context.Context, bs []blocks.Block, concurrency int) error {
+	good := newKeyedBlocks(len(bs))
+	for _, blk := range bs {
+		key := cacheKey(blk.Cid())
+		if has, _, ok := b.queryCache(key); !ok || (ok && !has) {
+			good.append(key, blk)
+		}
+	}
+
+	if good.isEmpty() {
+		return nil
+	}
+
+	good.sortAndDedup()
+
+	b.lockAll(good.keys, true)
+	defer b.unlockAll(good.keys, true)
+
+	err := b.blockstore.PutManyParallel(ctx, good.blocks, concurrency)
+	if err != nil {
+		for _, key := range good.keys {
+			b.cacheInvalidate(key)
+		}
+		return err
+	}
+	for i, key := range good.keys {
+		b.cacheSize(key, len(good.blocks[i].RawData()))
+	}
+
+	return nil
+}
+
+func (b *arccache) GetManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	for _, k := range ks {
+		if !k.Defined() {
+			return nil, ErrNotFound
+		}
+		if has, _, ok := b.queryCache(cacheKey(k)); ok && !has {
+			return nil, ErrNotFound
+		}
+	}
+
+	keys := sortedCacheKeys(ks)
+	b.lockAll(keys, false)
+	defer b.unlockAll(keys, false)
+
+	// On ErrNotFound we do not know which of the blocks is missing, so
+	// the cache is left alone.
+	bls, err := b.blockstore.GetManyParallel(ctx, ks, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	for _, bl := range bls {
+		b.cacheSize(cacheKey(bl.Cid()), len(bl.RawData()))
+	}
+	return bls, nil
+}
+
+func (b *arccache) DeleteManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) error {
+	toDelete := make([]cid.Cid, 0, len(ks))
+	for _, k := range ks {
+		if !k.Defined() {
+			continue
+		}
+		if has, _, ok := b.queryCache(cacheKey(k)); ok && !has {
+			continue
+		}
+		toDelete = append(toDelete, k)
+	}
+
+	if len(toDelete) == 0 {
+		return nil
+	}
+
+	keys := sortedCacheKeys(toDelete)
+	b.lockAll(keys, true)
+	defer b.unlockAll(keys, true)
+
+	err := b.blockstore.DeleteManyParallel(ctx, toDelete, concurrency)
+	for _, key := range keys {
+		if err == nil {
+			b.cacheHave(key, false)
+		} else {
+			b.cacheInvalidate(key)
+		}
+	}
+	return err
+}
+
+// sortedCacheKeys returns the sorted and deduplicated cache keys of ks, as
+// expected by lockAll.
+func sortedCacheKeys(ks []cid.Cid) []string {
+	keys := make([]string, 0, len(ks))
+	for _, k := range ks {
+		keys = append(keys, cacheKey(k))
+	}
+	sort.Strings(keys)
+
+	j := 0
+	for i := 1; i < len(keys); i++ {
+		if keys[j] == keys[i] {
+			continue
+		}
+		j++
+		keys[j] = keys[i]
+	}
+	if len(keys) == 0 {
+		return keys
+	}
+	return keys[:j+1]
+}
+
+// lockAll locks every key. The keys must be sorted and deduplicated so that
+// concurrent calls always lock them in the same order.
+func (b *arccache) lockAll(keys []string, write bool) {
+	for _, key := range keys {
+		b.lock(key, write)
+	}
+}
+
+func (b *arccache) unlockAll(keys []string, write bool) {
+	for _, key := range keys {
+		b.unlock(key, write)
+	}
+}
+
 func (b *arccache) HashOnRead(enabled bool) {
 	b.blockstore.HashOnRead(enabled)
 }
@@ -281,6 +281,50 @@ func TestPutManyCaches(t *testing.T) {
 	})
 }
 
+func TestParallelOpsCache(t *testing.T) {
+	arc, _, cd := createStores(t)
+	block2 := blocks.NewBlock([]byte("bar"))
+	blks := []blocks.Block{exampleBlock, block2, exampleBlock}
+	keys := []cid.Cid{exampleBlock.Cid(), block2.Cid()}
+
+	if err := arc.PutManyParallel(bg, blks, 2); err != nil {
+		t.Fatal(err)
+	}
+	trap("has hit datastore", cd, t)
+	for _, k := range keys {
+		if has, _ := arc.Has(bg, k); !has {
+			t.Fatal("put block is reported missing")
+		}
+		arc.GetSize(bg, k)
+	}
+	if err := arc.PutManyParallel(bg, blks, 2); err != nil {
+		t.Fatal(err)
+	}
+	untrap(cd)
+
+	if _, err := arc.GetManyParallel(bg, keys, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := arc.DeleteManyParallel(bg, keys, 2); err != nil {
+		t.Fatal(err)
+	}
+	trap("has hit datastore", cd, t)
+	for _, k := range keys {
+		if has, _ := arc.Has(bg, k); has {
+			t.Fatal("deleted block is reported present")
+		}
+	}
+	// Known missing blocks short circuit.
+	if _, err := arc.GetManyParallel(bg, keys, 2); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := arc.DeleteManyParallel(bg, keys, 2); err != nil {
+		t.Fatal(err)
+	}
+	untrap(cd)
+}
+
 func BenchmarkARCCacheConcurrentOps(b *testing.B) {
 	// ~4k blocks seems high enough to be realistic,
 	// but low enough to cause collisions.
@@ -57,6 +57,20 @@ type Blockstore interface {
 	HashOnRead(enabled bool)
 
 	AllKeysMansub(ctx context.Context) ([]cid.Cid, error)
+
+	// PutManyParallel puts a slice of blocks using up to concurrency
+	// parallel writes in the underlying datastore. A concurrency below 1
+	// lets the datastore choose.
+	PutManyParallel(ctx context.Context, blks []blocks.Block, concurrency int) error
+
+	// GetManyParallel returns the blocks of the given CIDs, in the same
+	// order, reading up to concurrency of them in parallel. It fails with
+	// ErrNotFound if one of them is missing.
+	GetManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error)
+
+	// DeleteManyParallel deletes the blocks of the given CIDs, deleting
+	// up to concurrency of them in parallel.
+	DeleteManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) error
 }
 
 // Viewer can be implemented by blockstores that offer zero-copy access to
@@ -201,6 +215,83 @@ func (bs *blockstore) PutMany(ctx context.Context, blocks []blocks.Block) error
 	return t.Commit(ctx)
 }
 
+func (bs *blockstore) PutManyParallel(ctx context.Context, blks []blocks.Block, concurrency int) error {
+	// Has is cheaper than Put, so drop the blocks we already have first.
+	keys := make([]ds.Key, len(blks))
+	exists := make([]bool, len(blks))
+	err := ds.ParallelRange(ctx, len(blks), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			keys[i] = dshelp.MultihashToDsKey(blks[i].Cid().Hash())
+			has, err := bs.datastore.Has(ctx, keys[i])
+			exists[i] = err == nil && has
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	toPut := make([]ds.Key, 0, len(blks))
+	values := make([][]byte, 0, len(blks))
+	for i, b := range blks {
+		if exists[i] {
+			continue
+		}
+		toPut = append(toPut, keys[i])
+		values = append(values, b.RawData())
+	}
+	if len(toPut) == 0 {
+		return nil
+	}
+	return ds.PutMany(ctx, bs.datastore, toPut, values, concurrency)
+}
+
+func (bs *blockstore) GetManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	keys := make([]ds.Key, len(ks))
+	for i, k := range ks {
+		if !k.Defined() {
+			log.Error("undefined cid in blockstore")
+			return nil, ErrNotFound
+		}
+		keys[i] = dshelp.MultihashToDsKey(k.Hash())
+	}
+
+	values, err := ds.GetMany(ctx, bs.datastore, keys, concurrency)
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rehash := bs.rehash.Load()
+	blks := make([]blocks.Block, len(ks))
+	for i, k := range ks {
+		if rehash {
+			rbcid, err := k.Prefix().Sum(values[i])
+			if err != nil {
+				return nil, err
+			}
+			if !rbcid.Equals(k) {
+				return nil, ErrHashMismatch
+			}
+		}
+		blks[i], err = blocks.NewBlockWithCid(values[i], k)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blks, nil
+}
+
+func (bs *blockstore) DeleteManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) error {
+	keys := make([]ds.Key, len(ks))
+	for i, k := range ks {
+		keys[i] = dshelp.MultihashToDsKey(k.Hash())
+	}
+	return ds.DeleteMany(ctx, bs.datastore, keys, concurrency)
+}
+
 func (bs *blockstore) Has(ctx context.Context, k cid.Cid) (bool, error) {
 	return bs.datastore.Has(ctx, dshelp.MultihashToDsKey(k.Hash()))
 }
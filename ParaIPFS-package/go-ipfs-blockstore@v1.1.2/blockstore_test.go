@@ -163,6 +163,77 @@ func TestHashOnRead(t *testing.T) {
 	}
 }
 
+func TestParallelPutGetDelete(t *testing.T) {
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+
+	var blks []blocks.Block
+	var keys []cid.Cid
+	for i := 0; i < 50; i++ {
+		bl := blocks.NewBlock([]byte(fmt.Sprintf("parallel data %d", i)))
+		blks = append(blks, bl)
+		keys = append(keys, bl.Cid())
+	}
+	if err := bs.PutManyParallel(bg, blks, 4); err != nil {
+		t.Fatal(err)
+	}
+	// Blocks that are already stored are skipped.
+	if err := bs.PutManyParallel(bg, blks[:10], 4); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := bs.GetManyParallel(bg, keys, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range out {
+		if !out[i].Cid().Equals(keys[i]) || !bytes.Equal(out[i].RawData(), blks[i].RawData()) {
+			t.Fatalf("block %d does not match", i)
+		}
+	}
+
+	missing := blocks.NewBlock([]byte("missing")).Cid()
+	if _, err := bs.GetManyParallel(bg, append(keys[:1:1], missing), 2); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := bs.DeleteManyParallel(bg, append(keys[:25:25], missing), 0); err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range keys {
+		has, err := bs.Has(bg, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != (i >= 25) {
+			t.Fatalf("block %d: expected present=%t", i, i >= 25)
+		}
+	}
+}
+
+func TestGetManyParallelHashOnRead(t *testing.T) {
+	orginalDebug := u.Debug
+	defer (func() {
+		u.Debug = orginalDebug
+	})()
+	u.Debug = false
+
+	bs := NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+	bl := blocks.NewBlock([]byte("some data"))
+	blBad, err := blocks.NewBlockWithCid([]byte("some other data"), bl.Cid())
+	if err != nil {
+		t.Fatal("debug is off, still got an error")
+	}
+	bl2 := blocks.NewBlock([]byte("some other data"))
+	if err = bs.PutManyParallel(bg, []blocks.Block{blBad, bl2}, 2); err != nil {
+		t.Fatal(err)
+	}
+	bs.HashOnRead(true)
+
+	if _, err := bs.GetManyParallel(bg, []cid.Cid{bl2.Cid(), bl.Cid()}, 2); err != ErrHashMismatch {
+		t.Fatalf("expected '%v' got '%v'\n", ErrHashMismatch, err)
+	}
+}
+
 func newBlockStoreWithKeys(t *testing.T, d ds.Datastore, N int) (Blockstore, []cid.Cid) {
 	if d == nil {
 		d = ds.NewMapDatastore()
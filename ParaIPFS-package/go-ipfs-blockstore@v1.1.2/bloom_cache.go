@@ -209,6 +209,40 @@ func (b *bloomcache) PutMany(ctx context.Context, bs []blocks.Block) error {
 	return nil
 }
 
+func (b *bloomcache) PutManyParallel(ctx context.Context, bs []blocks.Block, concurrency int) error {
+	// Like PutMany, this is a passthrough, see the comment there.
+	err := b.blockstore.PutManyParallel(ctx, bs, concurrency)
+	if err != nil {
+		return err
+	}
+	for _, bl := range bs {
+		b.bloom.AddTS(bl.Cid().Hash())
+	}
+	return nil
+}
+
+func (b *bloomcache) GetManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	for _, k := range ks {
+		if has, ok := b.hasCached(k); ok && !has {
+			return nil, ErrNotFound
+		}
+	}
+
+	return b.blockstore.GetManyParallel(ctx, ks, concurrency)
+}
+
+func (b *bloomcache) DeleteManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) error {
+	toDelete := make([]cid.Cid, 0, len(ks))
+	for _, k := range ks {
+		if has, ok := b.hasCached(k); ok && !has {
+			continue
+		}
+		toDelete = append(toDelete, k)
+	}
+
+	return b.blockstore.DeleteManyParallel(ctx, toDelete, concurrency)
+}
+
 func (b *bloomcache) HashOnRead(enabled bool) {
 	b.blockstore.HashOnRead(enabled)
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 	syncds "github.com/ipfs/go-datastore/sync"
@@ -85,6 +86,45 @@ func TestPutManyAddsToBloom(t *testing.T) {
 	}
 }
 
+func TestPutManyParallelAddsToBloom(t *testing.T) {
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	cachedbs, err := testBloomCached(ctx, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cachedbs.Wait(ctx); err != nil {
+		t.Fatalf("Failed while waiting for the filter to build: %d", cachedbs.bloom.ElementsAdded())
+	}
+
+	block1 := blocks.NewBlock([]byte("foo"))
+	block2 := blocks.NewBlock([]byte("bar"))
+
+	if err := cachedbs.PutManyParallel(bg, []blocks.Block{block1}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := cachedbs.Has(bg, block1.Cid()); err != nil || !has {
+		t.Fatal("added block is reported missing")
+	}
+	if _, err := cachedbs.GetManyParallel(bg, []cid.Cid{block1.Cid(), block2.Cid()}, 2); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	blks, err := cachedbs.GetManyParallel(bg, []cid.Cid{block1.Cid()}, 2)
+	if err != nil || len(blks) != 1 || !blks[0].Cid().Equals(block1.Cid()) {
+		t.Fatalf("cannot get the added block: %v", err)
+	}
+	if err := cachedbs.DeleteManyParallel(bg, []cid.Cid{block1.Cid(), block2.Cid()}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := bs.Has(bg, block1.Cid()); err != nil || has {
+		t.Fatal("deleted block is still in the blockstore")
+	}
+}
+
 func TestReturnsErrorWhenSizeNegative(t *testing.T) {
 	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
 	_, err := bloomCached(context.Background(), bs, -1, 1)
@@ -107,6 +107,58 @@ func (b *idstore) PutMany(ctx context.Context, bs []blocks.Block) error {
 	return b.bs.PutMany(ctx, toPut)
 }
 
+func (b *idstore) PutManyParallel(ctx context.Context, bs []blocks.Block, concurrency int) error {
+	toPut := make([]blocks.Block, 0, len(bs))
+	for _, bl := range bs {
+		isId, _ := extractContents(bl.Cid())
+		if isId {
+			continue
+		}
+		toPut = append(toPut, bl)
+	}
+	return b.bs.PutManyParallel(ctx, toPut, concurrency)
+}
+
+func (b *idstore) GetManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	blks := make([]blocks.Block, len(ks))
+	toGet := make([]cid.Cid, 0, len(ks))
+	indexes := make([]int, 0, len(ks))
+	for i, k := range ks {
+		isId, bdata := extractContents(k)
+		if !isId {
+			toGet = append(toGet, k)
+			indexes = append(indexes, i)
+			continue
+		}
+		bl, err := blocks.NewBlockWithCid(bdata, k)
+		if err != nil {
+			return nil, err
+		}
+		blks[i] = bl
+	}
+
+	got, err := b.bs.GetManyParallel(ctx, toGet, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		blks[i] = got[j]
+	}
+	return blks, nil
+}
+
+func (b *idstore) DeleteManyParallel(ctx context.Context, ks []cid.Cid, concurrency int) error {
+	toDelete := make([]cid.Cid, 0, len(ks))
+	for _, k := range ks {
+		isId, _ := extractContents(k)
+		if isId {
+			continue
+		}
+		toDelete = append(toDelete, k)
+	}
+	return b.bs.DeleteManyParallel(ctx, toDelete, concurrency)
+}
+
 func (b *idstore) HashOnRead(enabled bool) {
 	b.bs.HashOnRead(enabled)
 }
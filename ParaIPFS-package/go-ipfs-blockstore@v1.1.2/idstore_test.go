@@ -160,3 +160,40 @@ func TestIdStore(t *testing.T) {
 		t.Fatalf("expected exactly two keys returned by AllKeysChan got %d", cnt)
 	}
 }
+
+func TestIdStoreParallel(t *testing.T) {
+	idhash1, _ := cid.NewPrefixV1(cid.Raw, mh.IDENTITY).Sum([]byte("idhash1"))
+	idblock1, _ := blk.NewBlockWithCid([]byte("idhash1"), idhash1)
+	hash1, _ := cid.NewPrefixV1(cid.Raw, mh.SHA2_256).Sum([]byte("hash1"))
+	block1, _ := blk.NewBlockWithCid([]byte("hash1"), hash1)
+
+	ids, cb := createTestStores()
+
+	cb.f = func() {
+		t.Fatal("operation on identity hash passed though to datastore")
+	}
+	if err := ids.PutManyParallel(bg, []blk.Block{idblock1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ids.DeleteManyParallel(bg, []cid.Cid{idhash1}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	cb.f = func() {}
+	if err := ids.PutManyParallel(bg, []blk.Block{idblock1, block1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	blks, err := ids.GetManyParallel(bg, []cid.Cid{hash1, idhash1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(blks[0].RawData()) != "hash1" || string(blks[1].RawData()) != "idhash1" {
+		t.Fatal("GetManyParallel() returned the wrong blocks")
+	}
+	if err := ids.DeleteManyParallel(bg, []cid.Cid{idhash1, hash1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := ids.Has(bg, hash1); have {
+		t.Fatal("normal block not deleted from datastore")
+	}
+}
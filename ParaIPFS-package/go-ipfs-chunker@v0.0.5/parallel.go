@@ -0,0 +1,281 @@
+package chunk
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/whyrusleeping/chunker"
+)
+
+// ErrNoBoundaries is returned by Boundaries for splitters whose chunk
+// boundaries cannot be computed ahead of time.
+var ErrNoBoundaries = errors.New("splitter does not support parallel boundary computation")
+
+// scanSegmentSize is the amount of input each pre-scan worker hashes at a
+// time.
+const scanSegmentSize = 8 << 20
+
+// rabinWindow is the size of the sliding window of the Rabin chunker.
+const rabinWindow = 16
+
+// Boundaries returns the end offsets of the chunks that spl would produce
+// when reading the first size bytes of r, so that the chunks can be built
+// out of order. Content-defined splitters (rabin, buzhash) hash the input
+// with up to concurrency workers and then pick the boundaries in a single
+// sequential pass over the candidates found, which yields exactly the
+// chunks NextBytes would. spl itself is not read from.
+func Boundaries(spl Splitter, r io.ReaderAt, size int64, concurrency int) ([]int64, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	switch s := spl.(type) {
+	case *sizeSplitterv2:
+		return sizeBoundaries(int64(s.size), size), nil
+	case *Buzhash:
+		cands, err := scanCandidates(r, size, 32, concurrency, func() windowHash {
+			return new(buzScanner)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return buzBoundaries(cands, size), nil
+	case *Rabin:
+		tab := newRabinTables(IpfsRabinPoly)
+		mask := uint64(1)<<uint(math.Log2(float64(s.avg))) - 1
+		cands, err := scanCandidates(r, size, rabinWindow, concurrency, func() windowHash {
+			return &rabinScanner{tab: tab, mask: mask}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return rabinBoundaries(cands, size, int64(s.min), int64(s.max)), nil
+	default:
+		return nil, ErrNoBoundaries
+	}
+}
+
+func sizeBoundaries(chunkSize, size int64) []int64 {
+	if chunkSize <= 0 {
+		chunkSize = DefaultBlockSize
+	}
+
+	bounds := make([]int64, 0, (size+chunkSize-1)/chunkSize)
+	for end := chunkSize; end < size; end += chunkSize {
+		bounds = append(bounds, end)
+	}
+	if size > 0 {
+		bounds = append(bounds, size)
+	}
+	return bounds
+}
+
+// buzBoundaries mirrors Buzhash.NextBytes: a chunk is cut at the first
+// candidate at least buzMin bytes in and strictly before the end of the
+// buffered data, and the tail under buzMin bytes is a chunk of its own.
+func buzBoundaries(cands []int64, size int64) []int64 {
+	var bounds []int64
+	j := 0
+	for start := int64(0); start < size; {
+		end := size
+		if rem := size - start; rem >= buzMin {
+			avail := rem
+			if avail > buzMax {
+				avail = buzMax
+			}
+			end = start + avail
+			for j < len(cands) && cands[j] < start+buzMin {
+				j++
+			}
+			if j < len(cands) && cands[j] < start+avail {
+				end = cands[j]
+			}
+		}
+		bounds = append(bounds, end)
+		start = end
+	}
+	return bounds
+}
+
+// rabinBoundaries mirrors chunker.Chunker.Next: a chunk is cut at the first
+// candidate at least min bytes in, or after max bytes.
+func rabinBoundaries(cands []int64, size, min, max int64) []int64 {
+	var bounds []int64
+	j := 0
+	for start := int64(0); start < size; {
+		end := start + max
+		if end > size {
+			end = size
+		}
+		for j < len(cands) && cands[j] < start+min {
+			j++
+		}
+		if j < len(cands) && cands[j] <= end {
+			end = cands[j]
+		}
+		bounds = append(bounds, end)
+		start = end
+	}
+	return bounds
+}
+
+// windowHash is a rolling hash whose value only depends on the last
+// window bytes slid into it.
+type windowHash interface {
+	reset(win []byte)
+	roll(out, in byte)
+	match() bool
+}
+
+// scanCandidates returns, in ascending order, every offset p in
+// [window, size] for which the hash of the bytes [p-window, p) matches.
+// The input is cut into segments hashed concurrently; each segment
+// re-reads the window preceding it so no match is lost at the seams.
+func scanCandidates(r io.ReaderAt, size int64, window int, concurrency int, newHash func() windowHash) ([]int64, error) {
+	w := int64(window)
+	if size < w {
+		return nil, nil
+	}
+
+	nseg := int((size - w + scanSegmentSize) / scanSegmentSize)
+	found := make([][]int64, nseg)
+	errs := make([]error, nseg)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	if concurrency > nseg {
+		concurrency = nseg
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := newHash()
+			var buf []byte
+			for seg := range next {
+				// Offsets [lo, hi) are checked by this segment.
+				lo := w + int64(seg)*scanSegmentSize
+				hi := lo + scanSegmentSize
+				if hi > size+1 {
+					hi = size + 1
+				}
+
+				n := int(hi - 1 - (lo - w))
+				if cap(buf) < n {
+					buf = make([]byte, n)
+				}
+				buf = buf[:n]
+				if _, err := r.ReadAt(buf, lo-w); err != nil && err != io.EOF {
+					errs[seg] = err
+					continue
+				}
+
+				var cands []int64
+				h.reset(buf[:window])
+				if h.match() {
+					cands = append(cands, lo)
+				}
+				for k := window; k < n; k++ {
+					h.roll(buf[k-window], buf[k])
+					if h.match() {
+						cands = append(cands, lo-w+int64(k)+1)
+					}
+				}
+				found[seg] = cands
+			}
+		}()
+	}
+	for seg := 0; seg < nseg; seg++ {
+		next <- seg
+	}
+	close(next)
+	wg.Wait()
+
+	var cands []int64
+	for seg := range found {
+		if errs[seg] != nil {
+			return nil, errs[seg]
+		}
+		cands = append(cands, found[seg]...)
+	}
+	return cands, nil
+}
+
+type buzScanner struct {
+	state uint32
+}
+
+func (s *buzScanner) reset(win []byte) {
+	s.state = 0
+	for _, b := range win {
+		s.state = bits.RotateLeft32(s.state, 1) ^ bytehash[b]
+	}
+}
+
+func (s *buzScanner) roll(out, in byte) {
+	s.state = bits.RotateLeft32(s.state, 1) ^ bytehash[out] ^ bytehash[in]
+}
+
+func (s *buzScanner) match() bool {
+	return s.state&buzMask == 0
+}
+
+// rabinTables holds the same lookup tables chunker.Chunker computes for
+// sliding bytes out of the window and reducing the digest.
+type rabinTables struct {
+	shift uint
+	out   [256]uint64
+	mod   [256]uint64
+}
+
+func newRabinTables(pol chunker.Pol) *rabinTables {
+	appendByte := func(h chunker.Pol, b byte) chunker.Pol {
+		h <<= 8
+		h |= chunker.Pol(b)
+		return h.Mod(pol)
+	}
+
+	t := &rabinTables{shift: uint(pol.Deg() - 8)}
+	k := uint(pol.Deg())
+	for b := 0; b < 256; b++ {
+		h := appendByte(0, byte(b))
+		for i := 0; i < rabinWindow-1; i++ {
+			h = appendByte(h, 0)
+		}
+		t.out[b] = uint64(h)
+		t.mod[b] = uint64(chunker.Pol(uint64(b)<<k).Mod(pol) | chunker.Pol(b)<<k)
+	}
+	return t
+}
+
+type rabinScanner struct {
+	tab    *rabinTables
+	mask   uint64
+	digest uint64
+}
+
+func (s *rabinScanner) append(b byte) {
+	index := s.digest >> s.tab.shift
+	s.digest <<= 8
+	s.digest |= uint64(b)
+	s.digest ^= s.tab.mod[index]
+}
+
+func (s *rabinScanner) reset(win []byte) {
+	s.digest = 0
+	for _, b := range win {
+		s.append(b)
+	}
+}
+
+func (s *rabinScanner) roll(out, in byte) {
+	s.digest ^= s.tab.out[out]
+	s.append(in)
+}
+
+func (s *rabinScanner) match() bool {
+	return s.digest&s.mask == 0
+}
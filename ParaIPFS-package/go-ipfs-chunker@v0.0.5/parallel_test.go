@@ -0,0 +1,70 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	util "github.com/ipfs/go-ipfs-util"
+)
+
+func sequentialBoundaries(t *testing.T, spl Splitter) []int64 {
+	var bounds []int64
+	var end int64
+	for {
+		chunk, err := spl.NextBytes()
+		if err == io.EOF {
+			return bounds
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		end += int64(len(chunk))
+		bounds = append(bounds, end)
+	}
+}
+
+func TestBoundariesMatchNextBytes(t *testing.T) {
+	splitters := map[string]func(r io.Reader) Splitter{
+		"size-1000": func(r io.Reader) Splitter { return NewSizeSplitter(r, 1000) },
+		"default":   DefaultSplitter,
+		"buzhash":   func(r io.Reader) Splitter { return NewBuzhash(r) },
+		"rabin":     func(r io.Reader) Splitter { return NewRabin(r, 1024*256) },
+		"rabin-min-avg-max": func(r io.Reader) Splitter {
+			return NewRabinMinMax(r, 1024, 1024*8, 1024*32)
+		},
+	}
+	// Sizes around the minimum chunk sizes and across a scan segment seam.
+	sizes := []int64{0, 1, 31, 999, 1000, 1001, buzMin - 1, buzMin, buzMin + 1, buzMax + 7, 3<<20 + 5, scanSegmentSize + 4321}
+
+	for name, newSpl := range splitters {
+		for _, size := range sizes {
+			data := make([]byte, size)
+			util.NewTimeSeededRand().Read(data)
+
+			want := sequentialBoundaries(t, newSpl(bytes.NewReader(data)))
+			for _, concurrency := range []int{1, 3} {
+				got, err := Boundaries(newSpl(bytes.NewReader(data)), bytes.NewReader(data), size, concurrency)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("%s/%d: got %d chunks, want %d", name, size, len(got), len(want))
+				}
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("%s/%d: chunk %d ends at %d, want %d", name, size, i, got[i], want[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBoundariesUnsupported(t *testing.T) {
+	spl := NewSizeSplitter(bytes.NewReader(nil), 10)
+	wrapped := struct{ Splitter }{spl}
+	if _, err := Boundaries(wrapped, bytes.NewReader(nil), 0, 1); err != ErrNoBoundaries {
+		t.Fatalf("expected ErrNoBoundaries, got %v", err)
+	}
+}
@@ -15,6 +15,8 @@ var IpfsRabinPoly = chunker.Pol(17437180132763653)
 type Rabin struct {
 	r      *chunker.Chunker
 	reader io.Reader
+
+	min, avg, max uint64
 }
 
 // NewRabin creates a new Rabin splitter with the given
@@ -35,6 +37,9 @@ func NewRabinMinMax(r io.Reader, min, avg, max uint64) *Rabin {
 	return &Rabin{
 		r:      ch,
 		reader: r,
+		min:    min,
+		avg:    avg,
+		max:    max,
 	}
 }
 
@@ -36,6 +36,7 @@ type Config struct {
 	Experimental Experiments
 	Plugins      Plugins
 	Pinning      Pinning
+	Parallel     Parallel
 
 	Internal Internal // experimental/unstable options
 }
@@ -13,6 +13,26 @@ type Datastore struct {
 	StorageGCWatermark int64  // in percentage to multiply on StorageMax
 	GCPeriod           string // in ns, us, ms, s, m, h
 
+	// GCMode selects how the garbage collector marks the blocks to keep:
+	// "fast", "safe" or "hybrid" (the default when empty).
+	GCMode string `json:",omitempty"`
+
+	// TierCidCacheSize is the memory budget of the TierCids cached for
+	// the roots that are not pinned, in B, kB, kiB, MB, ...
+	TierCidCacheSize string `json:",omitempty"`
+
+	// Durability selects how the writes of the flatfs datastores are made
+	// durable: "strict" (the default when empty), "batch" or "none".
+	Durability string `json:",omitempty"`
+
+	// GCSweepBatchSize, when set, makes the garbage collector sweep the
+	// blocks incrementally, deleting at most this many blocks per batch and
+	// blocking the adds and pins only while a batch is deleted.
+	GCSweepBatchSize int `json:",omitempty"`
+	// GCSweepInterval is the pause between two batches of an incremental
+	// sweep, in ns, us, ms, s, m, h, bounding the rate of deletion.
+	GCSweepInterval string `json:",omitempty"`
+
 	// deprecated fields, use Spec
 	Type   string           `json:",omitempty"`
 	Path   string           `json:",omitempty"`
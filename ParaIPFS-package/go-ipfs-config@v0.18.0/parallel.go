@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Parallel configures the number of workers used by the parallel import,
+// read, garbage collection, verification and block sync paths.
+type Parallel struct {
+	// Import is the number of workers of an add, shared between the
+	// files it imports at once and the leaves of each of them.
+	Import Concurrency
+
+	// Read is the number of leaves fetched ahead of a file being read
+	// when its TierCid is known.
+	Read Concurrency
+
+	// GC is the number of blocks deleted at once by garbage collection.
+	GC Concurrency
+
+	// Verify is the number of blocks re-hashed at once by repo verify and
+	// pin verify.
+	Verify Concurrency
+
+	// Fsync is the number of fsyncs the flatfs datastore runs at once.
+	Fsync Concurrency
+}
+
+// Concurrency is a number of workers. AutoConcurrency, encoded as "auto" in
+// json, lets the node size it from the CPU count and the latency of the
+// disk the repo is on.
+type Concurrency int64
+
+// AutoConcurrency is the default Concurrency.
+const AutoConcurrency Concurrency = 0
+
+// IsAuto returns whether the number of workers is left to the node.
+func (c Concurrency) IsAuto() bool {
+	return c == AutoConcurrency
+}
+
+// WithDefault returns the number of workers, or defaultValue when it is
+// left to the node.
+func (c Concurrency) WithDefault(defaultValue int) int {
+	if c.IsAuto() {
+		return defaultValue
+	}
+	return int(c)
+}
+
+func (c Concurrency) MarshalJSON() ([]byte, error) {
+	if c.IsAuto() {
+		return json.Marshal("auto")
+	}
+	if c < 0 {
+		return nil, fmt.Errorf("invalid concurrency value: %d", c)
+	}
+	return json.Marshal(int64(c))
+}
+
+func (c *Concurrency) UnmarshalJSON(input []byte) error {
+	switch string(input) {
+	case "null", "undefined", `"auto"`, `""`:
+		*c = AutoConcurrency
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(input, &n); err != nil {
+		// `ipfs config` without --json stores numbers as strings.
+		var s string
+		if json.Unmarshal(input, &s) != nil {
+			return err
+		}
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("concurrency must be \"auto\" or a positive number: %q", s)
+		}
+	}
+	if n <= 0 {
+		return fmt.Errorf("concurrency must be positive: %d <= 0", n)
+	}
+	*c = Concurrency(n)
+	return nil
+}
+
+func (c Concurrency) String() string {
+	if c.IsAuto() {
+		return "auto"
+	}
+	return strconv.FormatInt(int64(c), 10)
+}
+
+var _ json.Unmarshaler = (*Concurrency)(nil)
+var _ json.Marshaler = (*Concurrency)(nil)
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConcurrency(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Concurrency
+		out  string
+	}{
+		{`"auto"`, AutoConcurrency, `"auto"`},
+		{`null`, AutoConcurrency, `"auto"`},
+		{`8`, 8, `8`},
+		{`"16"`, 16, `16`},
+	} {
+		var c Concurrency
+		if err := json.Unmarshal([]byte(tc.in), &c); err != nil {
+			t.Fatalf("%s: %s", tc.in, err)
+		}
+		if c != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.in, c, tc.want)
+		}
+		out, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.out {
+			t.Errorf("%s: encoded as %s, want %s", tc.in, out, tc.out)
+		}
+	}
+
+	for _, in := range []string{`0`, `-2`, `"fast"`, `true`} {
+		var c Concurrency
+		if err := json.Unmarshal([]byte(in), &c); err == nil {
+			t.Errorf("%s: expected an error, got %s", in, c)
+		}
+	}
+
+	if n := Concurrency(3).WithDefault(10); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n := AutoConcurrency.WithDefault(10); n != 10 {
+		t.Errorf("expected 10, got %d", n)
+	}
+}
@@ -2,7 +2,10 @@ package files
 
 import (
 	"io"
+	"io/ioutil"
 	"mime/multipart"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -195,3 +198,47 @@ func TestCommonPrefix(t *testing.T) {
 		},
 	})
 }
+
+func TestMultiFileReaderNotLocal(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "files-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "file.txt")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewSerialFile(path, false, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sf.(*ReaderFile).LocalFile(); !ok {
+		t.Fatal("a serial file should be local")
+	}
+
+	// The parts carry the abspath of the files they were sent from, which
+	// must not make them local.
+	mfr := NewMultiFileReader(NewMapDirectory(map[string]Node{"file.txt": sf}), true)
+	mpReader := multipart.NewReader(mfr, mfr.Boundary())
+	mf, err := NewFileFromPartReader(mpReader, multipartFormdataType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := mf.Entries()
+	if !it.Next() {
+		t.Fatal("iterator didn't work as expected")
+	}
+	rf, ok := it.Node().(*ReaderFile)
+	if !ok || rf.AbsPath() != path {
+		t.Fatal("the part should carry the abspath of the file")
+	}
+	if _, ok := rf.LocalFile(); ok {
+		t.Fatal("a multipart file should not be local")
+	}
+}
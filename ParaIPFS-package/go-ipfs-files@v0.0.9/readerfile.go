@@ -48,6 +48,15 @@ func (f *ReaderFile) AbsPath() string {
 	return f.abspath
 }
 
+// LocalFile returns the file of the local filesystem f reads from, like the
+// ones NewSerialFile opens. It returns false for ReaderFiles that read from
+// anything else, such as the parts of a multipart request, whose AbsPath is
+// only what the client sent.
+func (f *ReaderFile) LocalFile() (*os.File, bool) {
+	osf, ok := f.reader.(*os.File)
+	return osf, ok
+}
+
 func (f *ReaderFile) Read(p []byte) (int, error) {
 	return f.reader.Read(p)
 }
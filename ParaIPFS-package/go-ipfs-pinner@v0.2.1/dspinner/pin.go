@@ -96,6 +96,16 @@ type pinner struct {
 
 	clean int64
 	dirty int64
+
+	// tierCids persists the TierCids of recursive pins. It is loaded into
+	// merkledag.PinBuffer the first time it is needed. loadLock serializes
+	// the loads, which walk DAGs without holding lock.
+	tierCids       *merkledag.TierCidStore
+	loadLock       sync.Mutex
+	tierCidsLoaded bool
+
+	// offline walks the local DAGs to build TierCids. See SetOfflineDAG.
+	offline ipld.NodeGetter
 }
 
 var _ ipfspinner.Pinner = (*pinner)(nil)
@@ -140,7 +150,10 @@ func New(ctx context.Context, dstore ds.Datastore, dserv ipld.DAGService) (*pinn
 		nameIndex: dsindex.New(dstore, ds.NewKey(pinNameIndexPath)),
 		dserv:     dserv,
 		dstore:    dstore,
+		tierCids:  merkledag.NewTierCidStore(dstore),
+		offline:   dserv,
 	}
+	merkledag.SetPinBufferLoader(p.LoadTierCids)
 
 	data, err := dstore.Get(ctx, dirtyKey)
 	if err != nil {
@@ -172,6 +185,18 @@ func (p *pinner) SetAutosync(auto bool) bool {
 	return auto
 }
 
+// SetOfflineDAG sets the NodeGetter the pinner reads the DAGs of its pins
+// from to build their TierCids, which must not fetch blocks from the network.
+// A DAG whose blocks are not local is then left without TierCid instead of
+// being fetched. It defaults to the DAGService of the pinner, and must be set
+// before the TierCids are loaded.
+func (p *pinner) SetOfflineDAG(ng ipld.NodeGetter) {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+
+	p.offline = ng
+}
+
 // Pin the given node, optionally recursive
 func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 	err := p.dserv.Add(ctx, node)
@@ -199,7 +224,11 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 		// temporary unlock to fetch the entire graph
 		p.lock.Unlock()
 		// Fetch graph starting at node identified by cid
-		err = merkledag.FetchGraph(ctx, c, p.dserv)
+		var tc *merkledag.TierCid
+		err = p.fetchGraph(ctx, c)
+		if err == nil {
+			tc, err = p.tierCidOf(ctx, c)
+		}
 		p.lock.Lock()
 		if err != nil {
 			return err
@@ -234,7 +263,7 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 			}
 		}
 
-		_, err = p.addPin(ctx, c, ipfspinner.Recursive, "")
+		_, err = p.addPin(ctx, c, ipfspinner.Recursive, "", tc)
 		if err != nil {
 			return err
 		}
@@ -247,7 +276,7 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 			return fmt.Errorf("%s already pinned recursively", c.String())
 		}
 
-		_, err = p.addPin(ctx, c, ipfspinner.Direct, "")
+		_, err = p.addPin(ctx, c, ipfspinner.Direct, "", nil)
 		if err != nil {
 			return err
 		}
@@ -255,7 +284,9 @@ func (p *pinner) Pin(ctx context.Context, node ipld.Node, recurse bool) error {
 	return p.flushPins(ctx, false)
 }
 
-func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, name string) (string, error) {
+// addPin stores a new pin of c, with its index entries and, when tc is not
+// nil, its TierCid, in a single batch.
+func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, name string, tc *merkledag.TierCid) (string, error) {
 	// Create new pin and store in datastore
 	pp := newPin(c, mode, name)
 
@@ -267,8 +298,19 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 
 	p.setDirty(ctx)
 
+	var batch ds.Batch
+	if bds, ok := p.dstore.(ds.Batching); ok {
+		batch, err = bds.Batch(ctx)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		batch = ds.NewBasicBatch(p.dstore)
+	}
+	w := batchStore{Datastore: p.dstore, batch: batch}
+
 	// Store the pin
-	err = p.dstore.Put(ctx, pp.dsKey(), pinData)
+	err = w.Put(ctx, pp.dsKey(), pinData)
 	if err != nil {
 		return "", err
 	}
@@ -276,9 +318,12 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 	// Store CID index
 	switch mode {
 	case ipfspinner.Recursive:
-		err = p.cidRIndex.Add(ctx, c.KeyString(), pp.Id)
+		err = dsindex.New(w, ds.NewKey(pinCidRIndexPath)).Add(ctx, c.KeyString(), pp.Id)
+		if err == nil && tc != nil {
+			err = p.tierCids.Write(ctx, w, c, tc)
+		}
 	case ipfspinner.Direct:
-		err = p.cidDIndex.Add(ctx, c.KeyString(), pp.Id)
+		err = dsindex.New(w, ds.NewKey(pinCidDIndexPath)).Add(ctx, c.KeyString(), pp.Id)
 	default:
 		panic("pin mode must be recursive or direct")
 	}
@@ -288,32 +333,49 @@ func (p *pinner) addPin(ctx context.Context, c cid.Cid, mode ipfspinner.Mode, na
 
 	if name != "" {
 		// Store name index
-		err = p.nameIndex.Add(ctx, name, pp.Id)
+		err = dsindex.New(w, ds.NewKey(pinNameIndexPath)).Add(ctx, name, pp.Id)
 		if err != nil {
-			if mode == ipfspinner.Recursive {
-				e := p.cidRIndex.Delete(ctx, c.KeyString(), pp.Id)
-				if e != nil {
-					log.Errorf("error deleting index: %s", e)
-				}
-			} else {
-				e := p.cidDIndex.Delete(ctx, c.KeyString(), pp.Id)
-				if e != nil {
-					log.Errorf("error deleting index: %s", e)
-				}
-			}
 			return "", fmt.Errorf("could not add pin name index: %v", err)
 		}
 	}
 
+	if err = batch.Commit(ctx); err != nil {
+		return "", fmt.Errorf("could not store pin: %v", err)
+	}
+
+	if tc != nil {
+		merkledag.PublishTierCid(c, tc)
+		merkledag.UnPinBuffer.Remove(c)
+	}
+
 	return pp.Id, nil
 }
 
+// batchStore is the pin datastore with its writes going to a batch, so that
+// the index entries written through it are committed along with the pin.
+type batchStore struct {
+	ds.Datastore
+	batch ds.Batch
+}
+
+func (s batchStore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	return s.batch.Put(ctx, key, value)
+}
+
+func (s batchStore) Delete(ctx context.Context, key ds.Key) error {
+	return s.batch.Delete(ctx, key)
+}
+
 func (p *pinner) removePin(ctx context.Context, pp *pin) error {
 	p.setDirty(ctx)
 	var err error
 
 	// Remove cid index from datastore
 	if pp.Mode == ipfspinner.Recursive {
+		err = p.tierCids.Release(ctx, pp.Cid)
+		if err != nil {
+			return err
+		}
 		err = p.cidRIndex.Delete(ctx, pp.Cid.KeyString(), pp.Id)
 	} else {
 		err = p.cidDIndex.Delete(ctx, pp.Cid.KeyString(), pp.Id)
@@ -372,9 +434,6 @@ func (p *pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
 			return ipfspinner.ErrNotPinned
 		}
 	}
-	delete(merkledag.PinBuffer, c)
-	// fmt.Println("merkledag.PinBuffer")
-
 	removed, err := p.removePinsForCid(ctx, c, ipfspinner.Any)
 	if err != nil {
 		return err
@@ -768,14 +827,18 @@ func (p *pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error
 
 	// Temporarily unlock while we fetch the differences.
 	p.lock.Unlock()
+	var tc *merkledag.TierCid
 	err = dagutils.DiffEnumerate(ctx, p.dserv, from, to)
+	if err == nil {
+		tc, err = p.tierCidOf(ctx, to)
+	}
 	p.lock.Lock()
 
 	if err != nil {
 		return err
 	}
 
-	_, err = p.addPin(ctx, to, ipfspinner.Recursive, "")
+	_, err = p.addPin(ctx, to, ipfspinner.Recursive, "", tc)
 	if err != nil {
 		return err
 	}
@@ -809,6 +872,9 @@ func (p *pinner) flushPins(ctx context.Context, force bool) error {
 	if err := p.dstore.Sync(ctx, ds.NewKey(basePath)); err != nil {
 		return fmt.Errorf("cannot sync pin state: %v", err)
 	}
+	if err := p.tierCids.Sync(ctx); err != nil {
+		return fmt.Errorf("cannot sync TierCids: %v", err)
+	}
 	p.setClean(ctx)
 	return nil
 }
@@ -826,11 +892,208 @@ func (p *pinner) Flush(ctx context.Context) error {
 	return p.flushPins(ctx, true)
 }
 
+// LoadTierCids loads the persisted TierCids of recursive pins into
+// merkledag.PinBuffer. Only the first successful call does any work, and it
+// is registered with merkledag.SetPinBufferLoader so that every consumer of
+// PinBuffer runs it. Entries that are missing or corrupt are rebuilt by
+// walking the local DAG of their pin, without holding the pinner lock, and
+// entries left behind for roots that are no longer pinned are dropped. The
+// pins whose DAG is not complete locally are left without TierCid; they are
+// tried again on the next start.
+func (p *pinner) LoadTierCids(ctx context.Context) error {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+
+	if p.tierCidsLoaded {
+		return nil
+	}
+
+	missing, err := p.loadStoredTierCids(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range missing {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Infof("rebuilding TierCid of %s", c)
+		tc, err := merkledag.BuildTierCid(ctx, p.offline, c, knownTierCid)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warnf("cannot rebuild TierCid of %s: %s", c, err)
+			continue
+		}
+		if err = p.storeRebuiltTierCid(ctx, c, tc); err != nil {
+			return err
+		}
+	}
+
+	if err = p.tierCids.Sync(ctx); err != nil {
+		return fmt.Errorf("cannot sync TierCids: %v", err)
+	}
+	p.tierCidsLoaded = true
+	return nil
+}
+
+// loadStoredTierCids reads the stored TierCids into merkledag.PinBuffer,
+// drops those of roots that are not pinned, and returns the recursive pins
+// that have none.
+func (p *pinner) loadStoredTierCids(ctx context.Context) ([]cid.Cid, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	corrupt, err := p.tierCids.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TierCids: %v", err)
+	}
+	for _, c := range corrupt {
+		log.Errorf("dropped corrupt TierCid of %s", c)
+	}
+
+	pinned := cid.NewSet()
+	var e error
+	err = p.cidRIndex.ForEach(ctx, "", func(key, value string) bool {
+		var c cid.Cid
+		c, e = cid.Cast([]byte(key))
+		if e != nil {
+			return false
+		}
+		pinned.Add(c)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	var stale, missing []cid.Cid
+	merkledag.PinBufferMutex.Lock()
+	for root := range merkledag.PinBuffer {
+		if !pinned.Has(root) {
+			stale = append(stale, root)
+		}
+	}
+	for _, c := range pinned.Keys() {
+		if _, ok := merkledag.PinBuffer[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	merkledag.PinBufferMutex.Unlock()
+
+	for _, c := range stale {
+		if err = p.tierCids.Delete(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// storeRebuiltTierCid stores the TierCid rebuilt for c, unless c was unpinned
+// or given one by a new pin while it was being rebuilt.
+func (p *pinner) storeRebuiltTierCid(ctx context.Context, c cid.Cid, tc *merkledag.TierCid) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pinned, err := p.cidRIndex.HasAny(ctx, c.KeyString())
+	if err != nil || !pinned {
+		return err
+	}
+	merkledag.PinBufferMutex.Lock()
+	_, ok := merkledag.PinBuffer[c]
+	merkledag.PinBufferMutex.Unlock()
+	if ok {
+		return nil
+	}
+	return p.tierCids.Put(ctx, c, tc)
+}
+
+// fetchGraph fetches the DAG of a new recursive pin. Unless it already has
+// one, its TierCid is recorded in merkledag.UnPinBuffer on the way, for
+// tierCidOf to find. A TierCid installed from another node does not count:
+// it is replaced by the recorded one, which checks it at no extra cost.
+func (p *pinner) fetchGraph(ctx context.Context, c cid.Cid) error {
+	if _, ok := knownTierCid(c); ok {
+		return merkledag.FetchGraph(ctx, c, p.dserv)
+	}
+
+	tc, err := merkledag.FetchGraphTierCid(ctx, c, p.dserv)
+	if err != nil {
+		return err
+	}
+	if installed, ok := merkledag.UnPinBuffer.Peek(c); ok && merkledag.UnPinBuffer.Unverified(c) {
+		if diff := merkledag.DiffTierCid(c, installed, tc); !diff.Empty() {
+			log.Warnf("the TierCid installed for %s does not match its DAG, replacing it", c)
+		}
+	}
+	merkledag.UnPinBuffer.Add(c, tc)
+	return nil
+}
+
+// tierCidOf returns the TierCid to store with a new recursive pin of c. An
+// entry left in merkledag.UnPinBuffer by the importer, a read, fetchGraph or
+// an earlier unpin is used as is. Otherwise (or if it was evicted meanwhile)
+// the local DAG is walked, reusing the entry of any sub-DAG that already has
+// one (such as the files of an added directory). An entry installed from
+// another node and left there, as fetchGraph replaces them, is checked
+// against the local DAG the same way. It must be called without holding the
+// pinner lock, once the DAG is fetched.
+func (p *pinner) tierCidOf(ctx context.Context, c cid.Cid) (*merkledag.TierCid, error) {
+	installed, ok := merkledag.UnPinBuffer.Get(c)
+	if ok && !merkledag.UnPinBuffer.Unverified(c) {
+		return installed, nil
+	}
+
+	tc, err := merkledag.BuildTierCid(ctx, p.offline, c, knownTierCid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build TierCid of %s: %v", c, err)
+	}
+	if ok {
+		if diff := merkledag.DiffTierCid(c, installed, tc); !diff.Empty() {
+			log.Warnf("the TierCid installed for %s does not match its DAG, replacing it", c)
+			return tc, nil
+		}
+		return installed, nil
+	}
+	return tc, nil
+}
+
+// knownTierCid looks up the TierCid of root in the merkledag buffers,
+// leaving out the unverified ones installed from other nodes.
+func knownTierCid(root cid.Cid) (*merkledag.TierCid, bool) {
+	merkledag.PinBufferMutex.Lock()
+	tc, ok := merkledag.PinBuffer[root]
+	merkledag.PinBufferMutex.Unlock()
+	if ok {
+		return tc, true
+	}
+
+	if merkledag.UnPinBuffer.Unverified(root) {
+		return nil, false
+	}
+	return merkledag.UnPinBuffer.Get(root)
+}
+
 // PinWithMode allows the user to have fine grained control over pin
 // counts
 func (p *pinner) PinWithMode(c cid.Cid, mode ipfspinner.Mode) {
 	ctx := context.TODO()
 
+	var tc *merkledag.TierCid
+	if mode == ipfspinner.Recursive {
+		var err error
+		// The DAG of a pin edited by hand may not be local. Pin it anyway;
+		// LoadTierCids builds its TierCid on the next start.
+		tc, err = p.tierCidOf(ctx, c)
+		if err != nil {
+			log.Warnf("pinning %s without TierCid: %s", c, err)
+		}
+	}
+
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
@@ -848,7 +1111,7 @@ func (p *pinner) PinWithMode(c cid.Cid, mode ipfspinner.Mode) {
 		panic("unrecognized pin mode")
 	}
 
-	_, err := p.addPin(ctx, c, mode, "")
+	_, err := p.addPin(ctx, c, mode, "", tc)
 	if err != nil {
 		return
 	}
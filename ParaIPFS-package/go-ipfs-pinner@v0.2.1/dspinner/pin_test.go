@@ -354,7 +354,11 @@ func TestAddLoadPin(t *testing.T) {
 
 	mode := ipfspin.Recursive
 	name := "my-pin"
-	pid, err := p.addPin(ctx, ak, mode, name)
+	tc, err := p.tierCidOf(ctx, ak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := p.addPin(ctx, ak, mode, name, tc)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -754,6 +758,271 @@ func TestLoadDirty(t *testing.T) {
 	}
 }
 
+func assertTierCid(t *testing.T, root cid.Cid, nonLeaf, leaf []cid.Cid) {
+	mdag.PinBufferMutex.Lock()
+	tc, ok := mdag.PinBuffer[root]
+	mdag.PinBufferMutex.Unlock()
+	if !ok {
+		t.Fatalf("no TierCid for %s", root)
+	}
+	if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(nonLeaf) {
+		t.Fatalf("wrong NonLeaf: got %v, expected %v", tc.NonLeaf, nonLeaf)
+	}
+	if fmt.Sprint(tc.Leaf) != fmt.Sprint(leaf) {
+		t.Fatalf("wrong Leaf: got %v, expected %v", tc.Leaf, leaf)
+	}
+}
+
+func resetPinBuffer() {
+	mdag.PinBufferMutex.Lock()
+	mdag.PinBuffer = make(map[cid.Cid]*mdag.TierCid)
+	mdag.PinBufferMutex.Unlock()
+}
+
+func TestTierCidPersistence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+	dserv := mdag.NewDAGService(bserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	c, ck := randNode()
+	for _, child := range []*mdag.ProtoNode{b, c} {
+		if err := a.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+		if err := dserv.Add(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ak = a.Cid()
+	if err := dserv.Add(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	assertTierCid(t, ak, []cid.Cid{ak}, []cid.Cid{bk, ck})
+
+	// Restart: the entry is loaded back from the datastore by the first
+	// consumer of PinBuffer.
+	resetPinBuffer()
+	_, err = New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mdag.LoadPinBuffer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertTierCid(t, ak, []cid.Cid{ak}, []cid.Cid{bk, ck})
+
+	// Corrupt and missing entries are rebuilt from the pinset.
+	for _, damage := range []func() error{
+		func() error { return dstore.Put(ctx, mdag.TierCidPrefix.ChildString(ak.String()), []byte{0xff}) },
+		func() error { return dstore.Delete(ctx, mdag.TierCidPrefix.ChildString(ak.String())) },
+	} {
+		if err = damage(); err != nil {
+			t.Fatal(err)
+		}
+		resetPinBuffer()
+		p, err = New(ctx, dstore, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.LoadTierCids(ctx); err != nil {
+			t.Fatal(err)
+		}
+		assertTierCid(t, ak, []cid.Cid{ak}, []cid.Cid{bk, ck})
+		data, err := dstore.Get(ctx, mdag.TierCidPrefix.ChildString(ak.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = mdag.UnmarshalTierCid(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unpinning moves the entry back to UnPinBuffer, and pinning again
+	// promotes it.
+	for i := 0; i < 2; i++ {
+		if err = p.Unpin(ctx, ak, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = dstore.Get(ctx, mdag.TierCidPrefix.ChildString(ak.String())); err != ds.ErrNotFound {
+			t.Fatal("TierCid should have been deleted, got:", err)
+		}
+		mdag.PinBufferMutex.Lock()
+		_, ok := mdag.PinBuffer[ak]
+		mdag.PinBufferMutex.Unlock()
+		if ok {
+			t.Fatal("TierCid should have been removed from PinBuffer")
+		}
+		tc, ok := mdag.UnPinBuffer.Peek(ak)
+		if !ok || fmt.Sprint(tc.Leaf) != fmt.Sprint([]cid.Cid{bk, ck}) {
+			t.Fatalf("TierCid should have been moved to UnPinBuffer, got %+v", tc)
+		}
+		if i == 1 {
+			break
+		}
+
+		if err = p.Pin(ctx, a, true); err != nil {
+			t.Fatal(err)
+		}
+		assertTierCid(t, ak, []cid.Cid{ak}, []cid.Cid{bk, ck})
+	}
+
+	// An entry recorded by the importer is promoted when pinning.
+	tc := mdag.NewTierCid()
+	tc.Leaf = []cid.Cid{bk, ck}
+	mdag.UnPinBuffer.Add(ak, tc)
+	if err = p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	assertTierCid(t, ak, []cid.Cid{}, []cid.Cid{bk, ck})
+	_, ok := mdag.UnPinBuffer.Peek(ak)
+	if ok {
+		t.Fatal("TierCid should have been moved out of UnPinBuffer")
+	}
+}
+
+// TestTierCidRebuildMissingBlocks checks that the TierCid of a pin whose
+// DAG is not complete locally is not rebuilt over the network, and that
+// loading goes on without it until the blocks are back.
+func TestTierCidRebuildMissingBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	dserv := mdag.NewDAGService(bs.New(bstore, offline.Exchange(bstore)))
+
+	a, _ := randNode()
+	b, bk := randNode()
+	if err := a.AddNodeLink("", b); err != nil {
+		t.Fatal(err)
+	}
+	ak := a.Cid()
+	if err := dserv.Add(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dstore.Delete(ctx, mdag.TierCidPrefix.ChildString(ak.String())); err != nil {
+		t.Fatal(err)
+	}
+	if err = bstore.DeleteBlock(ctx, bk); err != nil {
+		t.Fatal(err)
+	}
+	mdag.UnPinBuffer.Remove(ak)
+
+	// The pinner's DAGService, standing for the network, has b; the
+	// offline one does not.
+	full := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	online := mdag.NewDAGService(bs.New(full, offline.Exchange(full)))
+	if err = online.AddMany(ctx, []ipld.Node{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	resetPinBuffer()
+	p, err = New(ctx, dstore, online)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetOfflineDAG(dserv)
+	if err = p.LoadTierCids(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mdag.PinBufferMutex.Lock()
+	_, ok := mdag.PinBuffer[ak]
+	mdag.PinBufferMutex.Unlock()
+	if ok {
+		t.Fatal("the TierCid of an incomplete DAG should not be rebuilt")
+	}
+
+	// Once the blocks are back, the next start rebuilds it.
+	if err = dserv.Add(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	p, err = New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.LoadTierCids(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertTierCid(t, ak, []cid.Cid{ak}, []cid.Cid{bk})
+}
+
+// TestTierCidFetchedPin checks that pinning a DAG that has no TierCid yet
+// records its tiers while fetching it, even when one was installed from
+// another node.
+func TestTierCidFetchedPin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv := bs.New(bstore, offline.Exchange(bstore))
+	dserv := mdag.NewDAGService(bserv)
+
+	// a -> (b -> (d, e), c)
+	a, _ := randNode()
+	b, _ := randNode()
+	c, ck := randNode()
+	d, dk := randNode()
+	e, ek := randNode()
+	for _, child := range []*mdag.ProtoNode{d, e} {
+		if err := b.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, child := range []*mdag.ProtoNode{b, c} {
+		if err := a.AddNodeLink("", child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ak, bk := a.Cid(), b.Cid()
+	for _, nd := range []ipld.Node{b, c, d, e} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An installed TierCid missing d is not trusted.
+	installed := mdag.NewTierCid()
+	installed.NonLeaf = []cid.Cid{ak, bk}
+	installed.Leaf = []cid.Cid{ek, ck}
+	mdag.UnPinBuffer.AddUnverified(ak, installed)
+
+	p, err := New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	assertTierCid(t, ak, []cid.Cid{ak, bk}, []cid.Cid{dk, ek, ck})
+
+	_, ok := mdag.UnPinBuffer.Peek(ak)
+	if ok {
+		t.Fatal("TierCid should have been moved out of UnPinBuffer")
+	}
+}
+
 func TestEncodeDecodePin(t *testing.T) {
 	_, c := randNode()
 
@@ -1191,7 +1460,11 @@ func TestCidIndex(t *testing.T) {
 	cidKey := c.KeyString()
 
 	// Pin the cid
-	pid, err := pinner.addPin(ctx, c, ipfspin.Recursive, "")
+	tc, err := pinner.tierCidOf(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := pinner.addPin(ctx, c, ipfspin.Recursive, "", tc)
 	if err != nil {
 		t.Fatal(err)
 	}
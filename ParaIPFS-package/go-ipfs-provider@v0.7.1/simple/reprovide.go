@@ -187,29 +187,51 @@ type Pinner interface {
 // NewPinnedProvider returns provider supplying pinned keys
 func NewPinnedProvider(onlyRoots bool, pinning Pinner, fetchConfig fetcher.Factory) KeyChanFunc {
 	return func(ctx context.Context) (<-chan cid.Cid, error) {
-		set, err := pinSet(ctx, pinning, fetchConfig, onlyRoots)
+		set, err := pinSet(ctx, pinning, fetchConfig, onlyRoots, nil, false)
 		if err != nil {
 			return nil, err
 		}
+		return streamSet(ctx, set), nil
+	}
+}
 
-		outCh := make(chan cid.Cid)
-		go func() {
-			defer close(outCh)
-			for c := range set.New {
-				select {
-				case <-ctx.Done():
-					return
-				case outCh <- c:
-				}
+// TierCidIndex looks up the nodes recorded for the DAG under root: its
+// internal nodes and its leaves. It returns false when root has no entry.
+type TierCidIndex func(ctx context.Context, root cid.Cid) (nonLeaf, leaf []cid.Cid, ok bool)
+
+// NewTierCidProvider returns provider supplying pinned keys like
+// NewPinnedProvider, listing the nodes of the recursive pins from index
+// instead of walking their DAGs. With onlyNonLeaf, only the roots and
+// internal nodes of the indexed pins are supplied. The pins without an entry
+// in index are walked, and all their nodes supplied.
+func NewTierCidProvider(onlyNonLeaf bool, pinning Pinner, index TierCidIndex, fetchConfig fetcher.Factory) KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		set, err := pinSet(ctx, pinning, fetchConfig, false, index, onlyNonLeaf)
+		if err != nil {
+			return nil, err
+		}
+		return streamSet(ctx, set), nil
+	}
+}
+
+func streamSet(ctx context.Context, set *cidutil.StreamingSet) <-chan cid.Cid {
+	outCh := make(chan cid.Cid)
+	go func() {
+		defer close(outCh)
+		for c := range set.New {
+			select {
+			case <-ctx.Done():
+				return
+			case outCh <- c:
 			}
+		}
 
-		}()
+	}()
 
-		return outCh, nil
-	}
+	return outCh
 }
 
-func pinSet(ctx context.Context, pinning Pinner, fetchConfig fetcher.Factory, onlyRoots bool) (*cidutil.StreamingSet, error) {
+func pinSet(ctx context.Context, pinning Pinner, fetchConfig fetcher.Factory, onlyRoots bool, index TierCidIndex, onlyNonLeaf bool) (*cidutil.StreamingSet, error) {
 	set := cidutil.NewStreamingSet()
 
 	go func() {
@@ -235,19 +257,33 @@ func pinSet(ctx context.Context, pinning Pinner, fetchConfig fetcher.Factory, on
 		session := fetchConfig.NewSession(ctx)
 		for _, key := range rkeys {
 			set.Visitor(ctx)(key)
-			if !onlyRoots {
-				err := fetcherhelpers.BlockAll(ctx, session, cidlink.Link{Cid: key}, func(res fetcher.FetchResult) error {
-					clink, ok := res.LastBlockLink.(cidlink.Link)
-					if ok {
-						set.Visitor(ctx)(clink.Cid)
+			if onlyRoots {
+				continue
+			}
+			if index != nil {
+				if nonLeaf, leaf, ok := index(ctx, key); ok {
+					for _, c := range nonLeaf {
+						set.Visitor(ctx)(c)
+					}
+					if !onlyNonLeaf {
+						for _, c := range leaf {
+							set.Visitor(ctx)(c)
+						}
 					}
-					return nil
-				})
-				if err != nil {
-					logR.Errorf("reprovide indirect pins: %s", err)
-					return
+					continue
 				}
 			}
+			err := fetcherhelpers.BlockAll(ctx, session, cidlink.Link{Cid: key}, func(res fetcher.FetchResult) error {
+				clink, ok := res.LastBlockLink.(cidlink.Link)
+				if ok {
+					set.Visitor(ctx)(clink.Cid)
+				}
+				return nil
+			})
+			if err != nil {
+				logR.Errorf("reprovide indirect pins: %s", err)
+				return
+			}
 		}
 	}()
 
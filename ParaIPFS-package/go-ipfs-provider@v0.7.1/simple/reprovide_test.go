@@ -274,3 +274,64 @@ func TestReprovidePinned(t *testing.T) {
 		}
 	}
 }
+
+func TestReprovideTierCid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes, bstore := setupDag(t)
+
+	fetchConfig := bsfetcher.NewFetcherConfig(bsrv.New(bstore, offline.Exchange(bstore)))
+
+	// nodes[1] is indexed, nodes[3] is not and gets walked.
+	index := func(ctx context.Context, root cid.Cid) ([]cid.Cid, []cid.Cid, bool) {
+		if root.Equals(nodes[1]) {
+			return nil, []cid.Cid{nodes[0]}, true
+		}
+		return nil, nil, false
+	}
+
+	for i := 0; i < 2; i++ {
+		clA, clB, idA, _ := setupRouting(t)
+
+		onlyNonLeaf := i == 0
+		t.Logf("only non-leaf: %v", onlyNonLeaf)
+
+		var provide, dont []cid.Cid
+		if onlyNonLeaf {
+			provide = []cid.Cid{nodes[1], nodes[2], nodes[3]}
+			dont = []cid.Cid{nodes[0]}
+		} else {
+			provide = []cid.Cid{nodes[0], nodes[1], nodes[2], nodes[3]}
+		}
+
+		keyProvider := NewTierCidProvider(onlyNonLeaf, &mockPinner{
+			recursive: []cid.Cid{nodes[1], nodes[3]},
+		}, index, fetchConfig)
+
+		reprov := NewReprovider(ctx, time.Hour, clA, keyProvider)
+		err := reprov.Reprovide()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, c := range provide {
+			prov, ok := <-clB.FindProvidersAsync(ctx, c, 1)
+			if !ok {
+				t.Errorf("Should have gotten a provider for %d", i)
+				continue
+			}
+
+			if prov.ID != idA {
+				t.Errorf("Somehow got the wrong peer back as a provider.")
+				continue
+			}
+		}
+		for i, c := range dont {
+			prov, ok := <-clB.FindProvidersAsync(ctx, c, 1)
+			if ok {
+				t.Fatalf("found provider %s for %d, expected none", prov.ID, i)
+			}
+		}
+	}
+}
@@ -180,8 +180,13 @@ func FetchGraph(ctx context.Context, root cid.Cid, serv format.DAGService) error
 // maxDepth=1 means "fetch root and its direct children" and so on...
 // maxDepth=-1 means unlimited.
 func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, serv format.DAGService) error {
-	var ng format.NodeGetter = NewSession(ctx, serv)
+	return fetchGraph(ctx, root, depthLim, GetLinksDirect(NewSession(ctx, serv)))
+}
 
+// fetchGraph walks the graph under root down to depthLim, as
+// FetchGraphWithDepthLimit does, getting the links of every node with
+// getLinks.
+func fetchGraph(ctx context.Context, root cid.Cid, depthLim int, getLinks GetLinks) error {
 	set := make(map[cid.Cid]int)
 
 	// Visit function returns true when:
@@ -208,7 +213,7 @@ func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, s
 	// If we have a ProgressTracker, we wrap the visit function to handle it
 	v, _ := ctx.Value(progressContextKey).(*ProgressTracker)
 	if v == nil {
-		return WalkDepth(ctx, GetLinksDirect(ng), root, visit, Concurrent())
+		return WalkDepth(ctx, getLinks, root, visit, Concurrent())
 	}
 
 	visitProgress := func(c cid.Cid, depth int) bool {
@@ -218,7 +223,7 @@ func FetchGraphWithDepthLimit(ctx context.Context, root cid.Cid, depthLim int, s
 		}
 		return false
 	}
-	return WalkDepth(ctx, GetLinksDirect(ng), root, visitProgress, Concurrent())
+	return WalkDepth(ctx, getLinks, root, visitProgress, Concurrent())
 }
 
 // GetMany gets many nodes from the DAG at once.
@@ -343,6 +343,35 @@ func TestFetchGraph(t *testing.T) {
 	}
 }
 
+func TestFetchGraphTierCid(t *testing.T) {
+	var dservs []ipld.DAGService
+	bsis := bstest.Mocks(2)
+	for _, bsi := range bsis {
+		dservs = append(dservs, NewDAGService(bsi))
+	}
+
+	read := io.LimitReader(u.NewTimeSeededRand(), 1024*32)
+	root := makeTestDAG(t, read, dservs[0])
+
+	tc, err := FetchGraphTierCid(context.TODO(), root.Cid(), dservs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The blocks were fetched, and the tiers match a walk of the local copy.
+	bs := bserv.New(bsis[1].Blockstore(), offline.Exchange(bsis[1].Blockstore()))
+	want, err := BuildTierCid(context.Background(), NewDAGService(bs), root.Cid(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(want.NonLeaf) || fmt.Sprint(tc.Leaf) != fmt.Sprint(want.Leaf) {
+		t.Fatalf("fetched TierCid %+v, expected %+v", tc, want)
+	}
+	if len(tc.NonLeaf) == 0 || len(tc.Leaf) < 2 {
+		t.Fatalf("expected a DAG with several levels, got %+v", tc)
+	}
+}
+
 func TestFetchGraphWithDepthLimit(t *testing.T) {
 	type testcase struct {
 		depthLim int
@@ -695,6 +724,47 @@ func TestGetManyDuplicate(t *testing.T) {
 	}
 }
 
+func TestManyParallel(t *testing.T) {
+	ctx := context.Background()
+	bsis := bstest.Mocks(2)
+	local := NewDAGService(bsis[0])
+	remote := NewDAGService(bsis[1])
+
+	var nds []ipld.Node
+	var keys []cid.Cid
+	for i := 0; i < 20; i++ {
+		nd := NodeWithData([]byte(fmt.Sprint("node ", i)))
+		nds = append(nds, nd)
+		keys = append(keys, nd.Cid())
+	}
+	if err := AddManyParallel(ctx, local, nds, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, ng ipld.NodeGetter) {
+		out, err := GetManyParallel(ctx, ng, keys, 3)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		for i := range out {
+			if !out[i].Cid().Equals(keys[i]) {
+				t.Fatalf("%s: wrong node %d", name, i)
+			}
+		}
+	}
+	check("local", local)
+	check("session", NewSession(ctx, local))
+	check("read only", NewReadOnlyDagService(local))
+	// The remote dagService fetches the nodes it does not have.
+	check("remote", remote)
+
+	offlineDS := NewDAGService(bserv.New(bsis[1].Blockstore(), offline.Exchange(bsis[1].Blockstore())))
+	missing := NodeWithData([]byte("missing")).Cid()
+	if _, err := GetManyParallel(ctx, offlineDS, append(keys, missing), 3); err != ipld.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
 func TestEnumerateAsyncFailsNotFound(t *testing.T) {
 	ctx := context.Background()
 
@@ -0,0 +1,137 @@
+package merkledag
+
+import (
+	"context"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	format "github.com/ipfs/go-ipld-format"
+	legacy "github.com/ipfs/go-ipld-legacy"
+)
+
+// ParallelNodeAdder is implemented by NodeAdders that can store many nodes
+// in parallel.
+type ParallelNodeAdder interface {
+	// AddManyParallel is like AddMany, but stores up to concurrency nodes
+	// at the same time. A concurrency below 1 lets the storage choose.
+	AddManyParallel(ctx context.Context, nds []format.Node, concurrency int) error
+}
+
+// ParallelNodeGetter is implemented by NodeGetters that can read many nodes
+// in parallel.
+type ParallelNodeGetter interface {
+	// GetManyParallel returns the nodes of the given keys, in the same
+	// order, reading up to concurrency of them at the same time. It fails
+	// with format.ErrNotFound if one of them cannot be found.
+	GetManyParallel(ctx context.Context, keys []cid.Cid, concurrency int) ([]format.Node, error)
+}
+
+// LocalNodeChecker is implemented by DAGServices that can tell whether a node
+// is already stored locally, without fetching it from the network.
+type LocalNodeChecker interface {
+	HasLocal(ctx context.Context, c cid.Cid) (bool, error)
+}
+
+// AddManyParallel adds nds to na. It uses the ParallelNodeAdder
+// implementation of na when there is one, and AddMany otherwise.
+func AddManyParallel(ctx context.Context, na format.NodeAdder, nds []format.Node, concurrency int) error {
+	if pna, ok := na.(ParallelNodeAdder); ok {
+		return pna.AddManyParallel(ctx, nds, concurrency)
+	}
+	return na.AddMany(ctx, nds)
+}
+
+// GetManyParallel returns the nodes of the given keys from ng, in the same
+// order. It uses the ParallelNodeGetter implementation of ng when there is
+// one, and calls Get from up to concurrency goroutines otherwise.
+func GetManyParallel(ctx context.Context, ng format.NodeGetter, keys []cid.Cid, concurrency int) ([]format.Node, error) {
+	if png, ok := ng.(ParallelNodeGetter); ok {
+		return png.GetManyParallel(ctx, keys, concurrency)
+	}
+	return getManyParallel(ctx, ng, keys, concurrency)
+}
+
+func getManyParallel(ctx context.Context, ng format.NodeGetter, keys []cid.Cid, concurrency int) ([]format.Node, error) {
+	nds := make([]format.Node, len(keys))
+	err := ds.ParallelRange(ctx, len(keys), concurrency, func(ctx context.Context, begin, end int) error {
+		for i := begin; i < end; i++ {
+			nd, err := ng.Get(ctx, keys[i])
+			if err != nil {
+				return err
+			}
+			nds[i] = nd
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nds, nil
+}
+
+// AddManyParallel adds many nodes to the dagService, writing up to
+// concurrency blocks in parallel when the BlockService supports it.
+func (n *dagService) AddManyParallel(ctx context.Context, nds []format.Node, concurrency int) error {
+	pbs, ok := n.Blocks.(bserv.ParallelBlockService)
+	if !ok {
+		return n.AddMany(ctx, nds)
+	}
+
+	blks := make([]blocks.Block, len(nds))
+	for i, nd := range nds {
+		blks[i] = nd
+	}
+	return pbs.AddBlocksParallel(ctx, blks, concurrency)
+}
+
+// HasLocal returns whether the node is stored in the local blockstore.
+func (n *dagService) HasLocal(ctx context.Context, c cid.Cid) (bool, error) {
+	return n.Blocks.Blockstore().Has(ctx, c)
+}
+
+// GetManyParallel gets many nodes from the dagService, reading up to
+// concurrency blocks in parallel when the BlockService supports it.
+func (n *dagService) GetManyParallel(ctx context.Context, keys []cid.Cid, concurrency int) ([]format.Node, error) {
+	pbg, ok := n.Blocks.(bserv.ParallelBlockGetter)
+	if !ok {
+		return getManyParallel(ctx, n, keys, concurrency)
+	}
+	return decodeParallel(ctx, pbg, keys, concurrency)
+}
+
+// GetManyParallel gets many nodes in the context of the session, reading up
+// to concurrency blocks in parallel.
+func (sg *sesGetter) GetManyParallel(ctx context.Context, keys []cid.Cid, concurrency int) ([]format.Node, error) {
+	return decodeParallel(ctx, sg.bs, keys, concurrency)
+}
+
+func decodeParallel(ctx context.Context, pbg bserv.ParallelBlockGetter, keys []cid.Cid, concurrency int) ([]format.Node, error) {
+	blks, err := pbg.GetBlocksParallel(ctx, keys, concurrency)
+	switch err {
+	case bserv.ErrNotFound:
+		return nil, format.ErrNotFound
+	case nil:
+		// noop
+	default:
+		return nil, fmt.Errorf("failed to get blocks: %v", err)
+	}
+
+	nds := make([]format.Node, len(blks))
+	for i, b := range blks {
+		nds[i], err = legacy.DecodeNode(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nds, nil
+}
+
+var _ ParallelNodeAdder = &dagService{}
+var _ ParallelNodeGetter = &dagService{}
+var _ LocalNodeChecker = &dagService{}
+var _ ParallelNodeGetter = &sesGetter{}
+var _ ParallelNodeAdder = &ComboService{}
+var _ ParallelNodeGetter = &ComboService{}
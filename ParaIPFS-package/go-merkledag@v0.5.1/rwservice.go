@@ -36,6 +36,16 @@ func (cs *ComboService) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipl
 	return cs.Read.GetMany(ctx, cids)
 }
 
+// AddManyParallel adds nodes using the Write DAGService.
+func (cs *ComboService) AddManyParallel(ctx context.Context, nds []ipld.Node, concurrency int) error {
+	return AddManyParallel(ctx, cs.Write, nds, concurrency)
+}
+
+// GetManyParallel fetches nodes using the Read DAGService.
+func (cs *ComboService) GetManyParallel(ctx context.Context, cids []cid.Cid, concurrency int) ([]ipld.Node, error) {
+	return GetManyParallel(ctx, cs.Read, cids, concurrency)
+}
+
 // Remove deletes a node using the Write DAGService.
 func (cs *ComboService) Remove(ctx context.Context, c cid.Cid) error {
 	return cs.Write.Remove(ctx, c)
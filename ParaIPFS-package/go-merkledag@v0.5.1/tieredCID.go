@@ -2,28 +2,33 @@
 package merkledag
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
 
+	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
 )
 
 var PinBuffer map[cid.Cid]*TierCid
 var PinBufferMutex *sync.Mutex
-var UnPinBuffer map[cid.Cid]*TierCid
-var UnPinBufferMutex *sync.Mutex
 
-var NumThread = 64 * 8
-
-// var IPFS_Path = "/home/mssong/.ipfs"
-// var IPFS_Path = "/mnt/nvme0n1/.ipfs"
+// UnPinBuffer caches the TierCids of the roots that are not pinned.
+var UnPinBuffer *TierCidCache
 
-// var IPFS_Path = "/root/.ipfs"
-// var IPFS_DownloadPath = "/root/ipfs_client"
+// NumThread is the number of workers of the parallel import and GC paths
+// when their callers do not configure one.
+var NumThread = 64 * 8
 
-var IPFS_Path = "/root/ipfs_server/.ipfs"
-var IPFS_DownloadPath = "/root/ipfs_server" //md0
+func init() {
+	PinBuffer = make(map[cid.Cid]*TierCid)
+	PinBufferMutex = &sync.Mutex{}
+	UnPinBuffer = NewTierCidCache(DefaultTierCidCacheSize)
+}
 
 type TierCid struct {
 	NonLeaf []cid.Cid
@@ -46,9 +51,247 @@ func NewTierCid() *TierCid {
 	return tc
 }
 
+// tierCidVersion is the first byte of every encoded TierCid.
+const tierCidVersion = 1
+
+// ErrInvalidTierCid is returned when an encoded TierCid cannot be decoded.
+var ErrInvalidTierCid = errors.New("invalid encoded TierCid")
+
+// Marshal encodes the TierCid as a version byte followed by the NonLeaf and
+// Leaf lists, each one prefixed by its length.
+func (tc *TierCid) Marshal() []byte {
+	buf := make([]byte, 0, 1+(len(tc.NonLeaf)+len(tc.Leaf))*40)
+	buf = append(buf, tierCidVersion)
+	for _, list := range [][]cid.Cid{tc.NonLeaf, tc.Leaf} {
+		buf = appendUvarint(buf, uint64(len(list)))
+		for _, c := range list {
+			b := c.Bytes()
+			buf = appendUvarint(buf, uint64(len(b)))
+			buf = append(buf, b...)
+		}
+	}
+	return buf
+}
+
+// UnmarshalTierCid decodes a TierCid encoded with Marshal.
+func UnmarshalTierCid(data []byte) (*TierCid, error) {
+	if len(data) == 0 || data[0] != tierCidVersion {
+		return nil, ErrInvalidTierCid
+	}
+	data = data[1:]
+
+	tc := NewTierCid()
+	for _, list := range []*[]cid.Cid{&tc.NonLeaf, &tc.Leaf} {
+		count, n := binary.Uvarint(data)
+		if n <= 0 || count > uint64(len(data)) {
+			return nil, ErrInvalidTierCid
+		}
+		data = data[n:]
+		*list = make([]cid.Cid, 0, count)
+		for i := uint64(0); i < count; i++ {
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, ErrInvalidTierCid
+			}
+			c, err := cid.Cast(data[n : n+int(size)])
+			if err != nil {
+				return nil, ErrInvalidTierCid
+			}
+			*list = append(*list, c)
+			data = data[n+int(size):]
+		}
+	}
+	if len(data) != 0 {
+		return nil, ErrInvalidTierCid
+	}
+	return tc, nil
+}
+
+// hasRoot reports whether root itself is recorded in the TierCid. Entries
+// built by walking the DAG start with their root, while entries recorded by
+// the importer may omit it.
+func (tc *TierCid) hasRoot(root cid.Cid) bool {
+	if len(tc.NonLeaf) > 0 && tc.NonLeaf[0].Equals(root) {
+		return true
+	}
+	return len(tc.NonLeaf) == 0 && len(tc.Leaf) == 1 && tc.Leaf[0].Equals(root)
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+// BuildTierCid walks the DAG under root depth-first and collects the nodes
+// with links in NonLeaf and the nodes without links in Leaf, both in the
+// order a reader visits them. Raw blocks are never fetched as they cannot
+// have links.
+//
+// When known is not nil it is consulted before descending into a node; if it
+// returns a TierCid for that node the entry is spliced in instead of walking
+// the sub-DAG again.
+func BuildTierCid(ctx context.Context, ng format.NodeGetter, root cid.Cid, known func(cid.Cid) (*TierCid, bool)) (*TierCid, error) {
+	return buildTierCid(ctx, GetLinksWithDAG(ng), root, known)
+}
+
+// ErrNoTierCidFetcher is returned by PrefetchTierCid when the exchange of the
+// BlockService cannot fetch DAGs from their TierCid.
+var ErrNoTierCidFetcher = errors.New("exchange cannot fetch a DAG from its TierCid")
+
+// TierCidFetcher is implemented by the exchanges, like bitswap, that can
+// fetch a DAG from the TierCid its providers recorded for it.
+type TierCidFetcher interface {
+	FetchTierCid(ctx context.Context, root cid.Cid) error
+}
+
+// PrefetchTierCid fetches the DAG under root into the blockstore of bs from
+// the TierCid its providers recorded for it, without walking the DAG, when
+// the exchange of bs is a TierCidFetcher.
+func PrefetchTierCid(ctx context.Context, bs bserv.BlockService, root cid.Cid) error {
+	f, ok := bs.Exchange().(TierCidFetcher)
+	if !ok {
+		return ErrNoTierCidFetcher
+	}
+	return f.FetchTierCid(ctx, root)
+}
+
+// FetchGraphTierCid fetches the DAG under root like FetchGraph and returns
+// its TierCid, as BuildTierCid would. The links of every node are recorded
+// while the graph is fetched, concurrently, and the tiers are put in order
+// from them afterwards, so no node is read twice.
+//
+// When root is not local the DAG is first prefetched with PrefetchTierCid,
+// if its providers have a TierCid of it.
+func FetchGraphTierCid(ctx context.Context, root cid.Cid, serv format.DAGService) (*TierCid, error) {
+	if ds, ok := serv.(*dagService); ok {
+		if has, err := ds.Blocks.Blockstore().Has(ctx, root); err == nil && !has {
+			// Whatever this does not fetch is fetched by the walk below.
+			_ = PrefetchTierCid(ctx, ds.Blocks, root)
+		}
+	}
+
+	getLinks := GetLinksDirect(NewSession(ctx, serv))
+
+	var lk sync.Mutex
+	seen := make(map[cid.Cid][]*format.Link)
+	record := func(ctx context.Context, c cid.Cid) ([]*format.Link, error) {
+		links, err := getLinks(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		lk.Lock()
+		seen[c] = links
+		lk.Unlock()
+		return links, nil
+	}
+	if err := fetchGraph(ctx, root, -1, record); err != nil {
+		return nil, err
+	}
+
+	return buildTierCid(ctx, func(ctx context.Context, c cid.Cid) ([]*format.Link, error) {
+		if links, ok := seen[c]; ok {
+			return links, nil
+		}
+		return getLinks(ctx, c)
+	}, root, nil)
+}
+
+func buildTierCid(ctx context.Context, getLinks GetLinks, root cid.Cid, known func(cid.Cid) (*TierCid, bool)) (*TierCid, error) {
+	tc := NewTierCid()
+
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if known != nil {
+			if sub, ok := known(c); ok {
+				if !sub.hasRoot(c) {
+					tc.NonLeaf = append(tc.NonLeaf, c)
+				}
+				tc.NonLeaf = append(tc.NonLeaf, sub.NonLeaf...)
+				tc.Leaf = append(tc.Leaf, sub.Leaf...)
+				return nil
+			}
+		}
+		if c.Type() == cid.Raw {
+			tc.Leaf = append(tc.Leaf, c)
+			return nil
+		}
+
+		links, err := getLinks(ctx, c)
+		if err != nil {
+			return err
+		}
+		if len(links) == 0 {
+			tc.Leaf = append(tc.Leaf, c)
+			return nil
+		}
+
+		tc.NonLeaf = append(tc.NonLeaf, c)
+		for _, l := range links {
+			if err := walk(l.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// TierCidDiff lists the entries a TierCid gets wrong about its DAG.
+type TierCidDiff struct {
+	// MissingNonLeaf and MissingLeaf are the nodes of the DAG that are
+	// not recorded in their tier.
+	MissingNonLeaf []cid.Cid
+	MissingLeaf    []cid.Cid
+	// ExtraNonLeaf and ExtraLeaf are the recorded entries that are not
+	// nodes of the DAG in that tier.
+	ExtraNonLeaf []cid.Cid
+	ExtraLeaf    []cid.Cid
+}
+
+// Empty reports whether the TierCid matches its DAG.
+func (d *TierCidDiff) Empty() bool {
+	return len(d.MissingNonLeaf) == 0 && len(d.MissingLeaf) == 0 &&
+		len(d.ExtraNonLeaf) == 0 && len(d.ExtraLeaf) == 0
+}
+
+// DiffTierCid compares tc, the TierCid recorded for root, with want, the one
+// BuildTierCid returns for it. The order and repetitions of the entries are
+// not compared, and neither is root itself, which the importer leaves out.
+func DiffTierCid(root cid.Cid, tc, want *TierCid) *TierCidDiff {
+	d := new(TierCidDiff)
+	d.MissingNonLeaf, d.ExtraNonLeaf = diffCids(root, tc.NonLeaf, want.NonLeaf)
+	d.MissingLeaf, d.ExtraLeaf = diffCids(root, tc.Leaf, want.Leaf)
+	return d
+}
+
+// diffCids returns the CIDs of want that are not in have, and those of have
+// that are not in want, in the order they first appear, ignoring root.
+func diffCids(root cid.Cid, have, want []cid.Cid) (missing, extra []cid.Cid) {
+	notIn := func(list, set []cid.Cid) []cid.Cid {
+		in := cid.NewSet()
+		in.Add(root)
+		for _, c := range set {
+			in.Add(c)
+		}
+		var out []cid.Cid
+		for _, c := range list {
+			if in.Visit(c) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	return notIn(want, have), notIn(have, want)
+}
+
 func PrintPinBuffer(cid cid.Cid) {
 	tc := PinBuffer[cid]
-	fmt.Println("----------Print PinBuffer(CID: %s)\n----------", cid.String())
+	fmt.Printf("----------Print PinBuffer(CID: %s)\n----------\n", cid.String())
 	fmt.Printf("CID:%s\n", cid.String())
 	fmt.Printf("NonLeaf:\n")
 	for i := 0; i < len(tc.NonLeaf); i++ {
@@ -84,8 +327,8 @@ func PrintAllPinBuffer() {
 }
 
 func PrintUnPinBuffer(cid cid.Cid) {
-	tc := UnPinBuffer[cid]
-	fmt.Println("----------Print UnPinBuffer(CID: %s)\n----------", cid.String())
+	tc, _ := UnPinBuffer.Peek(cid)
+	fmt.Printf("----------Print UnPinBuffer(CID: %s)\n----------\n", cid.String())
 	fmt.Printf("NonLeaf:\n")
 	for i := 0; i < len(tc.NonLeaf); i++ {
 		fmt.Println(tc.NonLeaf[i])
@@ -104,7 +347,7 @@ func UnPrintAllPinBuffer() {
 	}
 	fmt.Fprintf(f, "----------Print UnPinBuffer----------\n")
 
-	for cid, tc := range UnPinBuffer {
+	UnPinBuffer.Range(func(cid cid.Cid, tc *TierCid) bool {
 		fmt.Fprintf(f, "==CID:%s, ==len(NonLeaf):%d, ==len(Leaf):%d\n", cid.String(), len(tc.NonLeaf), len(tc.Leaf))
 		fmt.Fprintf(f, "\tNonLeaf:\n")
 		for i := 0; i < len(tc.NonLeaf); i++ {
@@ -114,7 +357,8 @@ func UnPrintAllPinBuffer() {
 		for i := 0; i < len(tc.Leaf); i++ {
 			fmt.Fprintf(f, "\t%s\n", tc.Leaf[i].String())
 		}
-	}
+		return true
+	})
 	fmt.Fprintf(f, "------------------------------")
 
 }
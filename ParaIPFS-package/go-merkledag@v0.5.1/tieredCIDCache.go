@@ -0,0 +1,259 @@
+package merkledag
+
+import (
+	"container/list"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// DefaultTierCidCacheSize is the budget, in bytes of CIDs, of UnPinBuffer
+// when none is configured.
+const DefaultTierCidCacheSize = 256 << 20
+
+// tierCidEntryOverhead is the size charged for every entry of a
+// TierCidCache on top of its CIDs.
+const tierCidEntryOverhead = 64
+
+// TierCidCacheStats are the counters of a TierCidCache.
+type TierCidCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+
+	Entries int
+	Size    int64
+	Budget  int64
+}
+
+type tierCidEntry struct {
+	root cid.Cid
+	tc   *TierCid
+	size int64
+	// unverified is set for the entries received from other nodes, which
+	// were not checked against their DAG yet.
+	unverified bool
+}
+
+// TierCidCache holds the TierCids of roots that are not pinned: the ones
+// recorded by the importer until the root is pinned, by reads, and by
+// unpins. Its size is the number of bytes of the CIDs it lists; once it
+// goes over its budget the least recently used entries are evicted. An
+// entry that does not fit in the budget on its own is not kept at all.
+type TierCidCache struct {
+	lk      sync.Mutex
+	budget  int64
+	size    int64
+	lru     *list.List // of *tierCidEntry, most recently used first
+	entries map[cid.Cid]*list.Element
+
+	hits, misses, evictions, invalidations uint64
+}
+
+// NewTierCidCache returns an empty TierCidCache holding up to budget bytes.
+func NewTierCidCache(budget int64) *TierCidCache {
+	return &TierCidCache{
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[cid.Cid]*list.Element),
+	}
+}
+
+func tierCidSize(root cid.Cid, tc *TierCid) int64 {
+	size := int64(tierCidEntryOverhead + len(root.KeyString()))
+	for _, list := range [][]cid.Cid{tc.NonLeaf, tc.Leaf} {
+		for _, c := range list {
+			size += int64(len(c.KeyString()))
+		}
+	}
+	return size
+}
+
+// Get returns the TierCid of root, if it is cached, and marks it as
+// recently used. Lookups are counted as hits or misses.
+func (c *TierCidCache) Get(root cid.Cid) (*TierCid, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[root]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*tierCidEntry).tc, true
+}
+
+// Peek returns the TierCid of root, if it is cached, without counting the
+// lookup or marking the entry as used.
+func (c *TierCidCache) Peek(root cid.Cid) (*TierCid, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[root]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*tierCidEntry).tc, true
+}
+
+// Add caches the TierCid of root, replacing the one it had, and evicts the
+// least recently used entries until the cache fits its budget again.
+func (c *TierCidCache) Add(root cid.Cid, tc *TierCid) {
+	c.add(root, tc, false)
+}
+
+// AddUnverified caches the TierCid of root like Add, for a TierCid received
+// from another node that was not checked against the DAG of root. It is
+// returned like any other, and Unverified reports it until it is replaced.
+func (c *TierCidCache) AddUnverified(root cid.Cid, tc *TierCid) {
+	c.add(root, tc, true)
+}
+
+// Unverified reports whether the TierCid cached for root was added with
+// AddUnverified.
+func (c *TierCidCache) Unverified(root cid.Cid) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[root]
+	return ok && e.Value.(*tierCidEntry).unverified
+}
+
+func (c *TierCidCache) add(root cid.Cid, tc *TierCid, unverified bool) {
+	entry := &tierCidEntry{root: root, tc: tc, size: tierCidSize(root, tc), unverified: unverified}
+
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	if e, ok := c.entries[root]; ok {
+		c.remove(e)
+	}
+	if entry.size > c.budget {
+		c.evictions++
+		return
+	}
+	c.entries[root] = c.lru.PushFront(entry)
+	c.size += entry.size
+	c.shrink()
+}
+
+// Remove takes the TierCid of root out of the cache and returns it.
+func (c *TierCidCache) Remove(root cid.Cid) (*TierCid, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	e, ok := c.entries[root]
+	if !ok {
+		return nil, false
+	}
+	c.remove(e)
+	return e.Value.(*tierCidEntry).tc, true
+}
+
+// InvalidateFunc drops every entry listing a node, or having a root, for
+// which removed returns true, and returns how many were dropped.
+func (c *TierCidCache) InvalidateFunc(removed func(cid.Cid) bool) int {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	dropped := 0
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		entry := e.Value.(*tierCidEntry)
+		if tierCidUses(entry.root, entry.tc, removed) {
+			c.remove(e)
+			c.invalidations++
+			dropped++
+		}
+		e = next
+	}
+	return dropped
+}
+
+// Invalidate drops every entry listing one of the blocks of cids, whatever
+// the version and codec of the CIDs, and returns how many were dropped.
+func (c *TierCidCache) Invalidate(cids ...cid.Cid) int {
+	if len(cids) == 0 {
+		return 0
+	}
+	hashes := make(map[string]struct{}, len(cids))
+	for _, k := range cids {
+		hashes[string(k.Hash())] = struct{}{}
+	}
+	return c.InvalidateFunc(func(k cid.Cid) bool {
+		_, ok := hashes[string(k.Hash())]
+		return ok
+	})
+}
+
+func tierCidUses(root cid.Cid, tc *TierCid, removed func(cid.Cid) bool) bool {
+	if removed(root) {
+		return true
+	}
+	for _, list := range [][]cid.Cid{tc.NonLeaf, tc.Leaf} {
+		for _, k := range list {
+			if removed(k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetBudget changes the budget of the cache, evicting entries if it
+// shrinks.
+func (c *TierCidCache) SetBudget(budget int64) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	c.budget = budget
+	c.shrink()
+}
+
+// Range calls f on every entry, from the most recently used one, until it
+// returns false. The cache is locked meanwhile.
+func (c *TierCidCache) Range(f func(root cid.Cid, tc *TierCid) bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*tierCidEntry)
+		if !f(entry.root, entry.tc) {
+			return
+		}
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *TierCidCache) Stats() TierCidCacheStats {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	return TierCidCacheStats{
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+		Entries:       len(c.entries),
+		Size:          c.size,
+		Budget:        c.budget,
+	}
+}
+
+func (c *TierCidCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*tierCidEntry)
+	delete(c.entries, entry.root)
+	c.size -= entry.size
+}
+
+// shrink evicts the least recently used entries until the cache fits its
+// budget.
+func (c *TierCidCache) shrink() {
+	for c.size > c.budget {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
@@ -0,0 +1,172 @@
+package merkledag
+
+import (
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// TierCidPrefix is the datastore namespace holding the persisted TierCids.
+var TierCidPrefix = ds.NewKey("/tiercid")
+
+// TierCidStore persists the TierCids of pinned roots so that PinBuffer
+// survives daemon restarts. Every entry is stored under TierCidPrefix, keyed
+// by the string form of its root.
+type TierCidStore struct {
+	dstore ds.Datastore
+}
+
+// NewTierCidStore returns a TierCidStore that keeps its entries in dstore.
+func NewTierCidStore(dstore ds.Datastore) *TierCidStore {
+	return &TierCidStore{dstore: dstore}
+}
+
+func tierCidKey(root cid.Cid) ds.Key {
+	return TierCidPrefix.ChildString(root.String())
+}
+
+// Put stores the TierCid of root and makes it visible in PinBuffer.
+func (s *TierCidStore) Put(ctx context.Context, root cid.Cid, tc *TierCid) error {
+	err := s.Write(ctx, s.dstore, root, tc)
+	if err != nil {
+		return err
+	}
+
+	PublishTierCid(root, tc)
+	return nil
+}
+
+// Write writes the TierCid of root to w, which is usually a batch of the
+// datastore of the store, without making it visible in PinBuffer. Callers
+// call PublishTierCid once w is committed.
+func (s *TierCidStore) Write(ctx context.Context, w ds.Write, root cid.Cid, tc *TierCid) error {
+	return w.Put(ctx, tierCidKey(root), tc.Marshal())
+}
+
+// PublishTierCid makes the TierCid of a pinned root visible in PinBuffer.
+func PublishTierCid(root cid.Cid, tc *TierCid) {
+	PinBufferMutex.Lock()
+	PinBuffer[root] = tc
+	PinBufferMutex.Unlock()
+}
+
+// Get returns the stored TierCid of root, or ds.ErrNotFound if there is
+// none. It does not look into PinBuffer.
+func (s *TierCidStore) Get(ctx context.Context, root cid.Cid) (*TierCid, error) {
+	data, err := s.dstore.Get(ctx, tierCidKey(root))
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalTierCid(data)
+}
+
+// Delete removes the TierCid of root from the datastore and from PinBuffer.
+func (s *TierCidStore) Delete(ctx context.Context, root cid.Cid) error {
+	PinBufferMutex.Lock()
+	delete(PinBuffer, root)
+	PinBufferMutex.Unlock()
+
+	return s.dstore.Delete(ctx, tierCidKey(root))
+}
+
+// Release removes the TierCid of root from the datastore and moves it from
+// PinBuffer back to UnPinBuffer, where reads keep using it until the root is
+// garbage collected or pinned again.
+func (s *TierCidStore) Release(ctx context.Context, root cid.Cid) error {
+	PinBufferMutex.Lock()
+	tc, ok := PinBuffer[root]
+	delete(PinBuffer, root)
+	PinBufferMutex.Unlock()
+
+	if ok {
+		UnPinBuffer.Add(root, tc)
+	}
+
+	return s.dstore.Delete(ctx, tierCidKey(root))
+}
+
+// Sync flushes the stored TierCids to disk.
+func (s *TierCidStore) Sync(ctx context.Context) error {
+	return s.dstore.Sync(ctx, TierCidPrefix)
+}
+
+// Load reads every stored TierCid into PinBuffer. Entries that cannot be
+// decoded are removed from the datastore; the roots they belonged to, when
+// known, are returned so the caller can rebuild them.
+func (s *TierCidStore) Load(ctx context.Context) ([]cid.Cid, error) {
+	results, err := s.dstore.Query(ctx, dsq.Query{Prefix: TierCidPrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var corrupt []cid.Cid
+	var bad []ds.Key
+	loaded := make(map[cid.Cid]*TierCid)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		key := ds.RawKey(r.Key)
+		root, err := cid.Decode(key.BaseNamespace())
+		if err != nil {
+			bad = append(bad, key)
+			continue
+		}
+		tc, err := UnmarshalTierCid(r.Value)
+		if err != nil {
+			bad = append(bad, key)
+			corrupt = append(corrupt, root)
+			continue
+		}
+		loaded[root] = tc
+	}
+
+	for _, key := range bad {
+		if err := s.dstore.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	PinBufferMutex.Lock()
+	for root, tc := range loaded {
+		PinBuffer[root] = tc
+	}
+	PinBufferMutex.Unlock()
+
+	return corrupt, nil
+}
+
+var (
+	pinBufferLoaderMu sync.Mutex
+	pinBufferLoader   func(context.Context) error
+)
+
+// SetPinBufferLoader registers the function that loads the persisted
+// TierCids into PinBuffer, which LoadPinBuffer runs on first use.
+func SetPinBufferLoader(load func(context.Context) error) {
+	pinBufferLoaderMu.Lock()
+	pinBufferLoader = load
+	pinBufferLoaderMu.Unlock()
+}
+
+// LoadPinBuffer loads the persisted TierCids into PinBuffer, if that was not
+// done yet. Every consumer of PinBuffer calls it before looking entries up,
+// so that they are found right after a restart. The loader is run until it
+// succeeds once.
+func LoadPinBuffer(ctx context.Context) error {
+	pinBufferLoaderMu.Lock()
+	defer pinBufferLoaderMu.Unlock()
+
+	if pinBufferLoader == nil {
+		return nil
+	}
+	if err := pinBufferLoader(ctx); err != nil {
+		return err
+	}
+	pinBufferLoader = nil
+	return nil
+}
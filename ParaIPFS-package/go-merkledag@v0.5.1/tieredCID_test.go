@@ -0,0 +1,259 @@
+package merkledag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func TestTierCidMarshal(t *testing.T) {
+	tc := NewTierCid()
+	tc.NonLeaf = []cid.Cid{NodeWithData([]byte("root")).Cid()}
+	tc.Leaf = []cid.Cid{
+		NewRawNode([]byte("a")).Cid(),
+		NewRawNode([]byte("b")).Cid(),
+		NewRawNode([]byte("a")).Cid(),
+	}
+
+	data := tc.Marshal()
+	out, err := UnmarshalTierCid(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(out.NonLeaf) != fmt.Sprint(tc.NonLeaf) || fmt.Sprint(out.Leaf) != fmt.Sprint(tc.Leaf) {
+		t.Fatalf("round trip mismatch: got %v, expected %v", out, tc)
+	}
+
+	for _, bad := range [][]byte{nil, {0}, data[:len(data)-1], append(data, 0)} {
+		if _, err := UnmarshalTierCid(bad); err != ErrInvalidTierCid {
+			t.Fatalf("expected ErrInvalidTierCid for %x, got %v", bad, err)
+		}
+	}
+}
+
+func TestBuildTierCid(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock()
+	root := makeDepthTestingGraph(t, dserv)
+
+	tc, err := BuildTierCid(ctx, dserv, root.Cid(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The level 1 node with links is the only non-leaf besides the root.
+	var l11 cid.Cid
+	var l11Children []cid.Cid
+	var expectedLeaf []cid.Cid
+	for _, l := range root.Links() {
+		nd, err := dserv.Get(ctx, l.Cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nd.Links()) == 0 {
+			expectedLeaf = append(expectedLeaf, l.Cid)
+			continue
+		}
+		l11 = l.Cid
+		for _, cl := range nd.Links() {
+			l11Children = append(l11Children, cl.Cid)
+		}
+		expectedLeaf = append(expectedLeaf, l11Children...)
+	}
+
+	expectedNonLeaf := []cid.Cid{root.Cid(), l11}
+	if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(expectedNonLeaf) {
+		t.Fatalf("wrong NonLeaf: got %v, expected %v", tc.NonLeaf, expectedNonLeaf)
+	}
+	if fmt.Sprint(tc.Leaf) != fmt.Sprint(expectedLeaf) {
+		t.Fatalf("wrong Leaf: got %v, expected %v", tc.Leaf, expectedLeaf)
+	}
+
+	// Known sub-DAGs are spliced in without being walked.
+	sub := NewTierCid()
+	sub.Leaf = l11Children
+	err = dserv.Remove(ctx, l11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc, err = BuildTierCid(ctx, dserv, root.Cid(), func(c cid.Cid) (*TierCid, bool) {
+		if c.Equals(l11) {
+			return sub, true
+		}
+		return nil, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(expectedNonLeaf) {
+		t.Fatalf("wrong NonLeaf: got %v, expected %v", tc.NonLeaf, expectedNonLeaf)
+	}
+	if fmt.Sprint(tc.Leaf) != fmt.Sprint(expectedLeaf) {
+		t.Fatalf("wrong Leaf: got %v, expected %v", tc.Leaf, expectedLeaf)
+	}
+}
+
+func TestDiffTierCid(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock()
+	root := makeDepthTestingGraph(t, dserv)
+
+	want, err := BuildTierCid(ctx, dserv, root.Cid(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The importer leaves the root out and may list the nodes in any order.
+	tc := NewTierCid()
+	tc.NonLeaf = append(tc.NonLeaf, want.NonLeaf[1:]...)
+	for i := len(want.Leaf) - 1; i >= 0; i-- {
+		tc.Leaf = append(tc.Leaf, want.Leaf[i])
+	}
+	if d := DiffTierCid(root.Cid(), tc, want); !d.Empty() {
+		t.Fatalf("expected no difference, got %+v", d)
+	}
+
+	stray := NewRawNode([]byte("stray")).Cid()
+	tc.NonLeaf = nil
+	tc.Leaf = append(tc.Leaf, stray)
+	d := DiffTierCid(root.Cid(), tc, want)
+	if fmt.Sprint(d.MissingNonLeaf) != fmt.Sprint(want.NonLeaf[1:]) {
+		t.Fatalf("wrong MissingNonLeaf: got %v, expected %v", d.MissingNonLeaf, want.NonLeaf[1:])
+	}
+	if len(d.ExtraLeaf) != 1 || !d.ExtraLeaf[0].Equals(stray) {
+		t.Fatalf("wrong ExtraLeaf: got %v, expected [%s]", d.ExtraLeaf, stray)
+	}
+	if len(d.MissingLeaf) != 0 || len(d.ExtraNonLeaf) != 0 {
+		t.Fatalf("unexpected difference: %+v", d)
+	}
+}
+
+func TestTierCidStore(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	store := NewTierCidStore(dstore)
+
+	good := NodeWithData([]byte("good")).Cid()
+	bad := NodeWithData([]byte("bad")).Cid()
+	tc := NewTierCid()
+	tc.Leaf = []cid.Cid{NewRawNode([]byte("leaf")).Cid()}
+
+	if err := store.Put(ctx, good, tc); err != nil {
+		t.Fatal(err)
+	}
+	if err := dstore.Put(ctx, TierCidPrefix.ChildString(bad.String()), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got.Leaf) != fmt.Sprint(tc.Leaf) {
+		t.Fatalf("wrong stored Leaf: got %v, expected %v", got.Leaf, tc.Leaf)
+	}
+
+	PinBufferMutex.Lock()
+	PinBuffer = make(map[cid.Cid]*TierCid)
+	PinBufferMutex.Unlock()
+
+	corrupt, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(corrupt) != 1 || !corrupt[0].Equals(bad) {
+		t.Fatalf("expected %s to be reported as corrupt, got %v", bad, corrupt)
+	}
+	if _, ok := PinBuffer[good]; !ok {
+		t.Fatal("stored TierCid was not loaded")
+	}
+	if has, _ := dstore.Has(ctx, TierCidPrefix.ChildString(bad.String())); has {
+		t.Fatal("corrupt TierCid should have been removed")
+	}
+
+	if err = store.Delete(ctx, good); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := PinBuffer[good]; ok {
+		t.Fatal("deleted TierCid still in PinBuffer")
+	}
+}
+
+func TestTierCidCache(t *testing.T) {
+	leaves := func(prefix string, n int) *TierCid {
+		tc := NewTierCid()
+		for i := 0; i < n; i++ {
+			tc.Leaf = append(tc.Leaf, NewRawNode([]byte(fmt.Sprint(prefix, i))).Cid())
+		}
+		return tc
+	}
+	a, b, c := NodeWithData([]byte("a")).Cid(), NodeWithData([]byte("b")).Cid(), NodeWithData([]byte("c")).Cid()
+	tca, tcb, tcc := leaves("a", 10), leaves("b", 10), leaves("c", 10)
+
+	// Room for two entries of ten leaves.
+	probe := NewTierCidCache(1 << 20)
+	probe.Add(a, tca)
+	cache := NewTierCidCache(2*probe.Stats().Size + 10)
+
+	cache.Add(a, tca)
+	cache.Add(b, tcb)
+	if _, ok := cache.Get(a); !ok {
+		t.Fatal("a should be cached")
+	}
+	// b is now the least recently used entry.
+	cache.Add(c, tcc)
+	if _, ok := cache.Peek(b); ok {
+		t.Fatal("b should have been evicted")
+	}
+	for _, root := range []cid.Cid{a, c} {
+		if _, ok := cache.Peek(root); !ok {
+			t.Fatalf("%s should be cached", root)
+		}
+	}
+	if _, ok := cache.Get(b); ok {
+		t.Fatal("b should not be cached")
+	}
+
+	// An entry bigger than the budget is not kept.
+	cache.Add(b, leaves("b", 100))
+	if _, ok := cache.Peek(b); ok {
+		t.Fatal("an oversized entry should not be cached")
+	}
+
+	// Removing a leaf, whatever its CID, drops the entries listing it.
+	if n := cache.Invalidate(cid.NewCidV1(cid.DagProtobuf, tcc.Leaf[3].Hash())); n != 1 {
+		t.Fatalf("expected 1 entry to be invalidated, got %d", n)
+	}
+	if _, ok := cache.Peek(c); ok {
+		t.Fatal("c should have been invalidated")
+	}
+
+	st := cache.Stats()
+	if st.Hits != 1 || st.Misses != 1 || st.Evictions != 2 || st.Invalidations != 1 || st.Entries != 1 {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+
+	// An entry received from elsewhere stays unverified until replaced.
+	cache.AddUnverified(b, tcb)
+	if _, ok := cache.Get(b); !ok || !cache.Unverified(b) {
+		t.Fatal("b should be cached unverified")
+	}
+	if cache.Unverified(a) {
+		t.Fatal("a should be verified")
+	}
+	cache.Add(b, tcb)
+	if cache.Unverified(b) {
+		t.Fatal("b should be verified once replaced")
+	}
+
+	cache.SetBudget(0)
+	if st := cache.Stats(); st.Entries != 0 || st.Size != 0 {
+		t.Fatalf("shrinking the budget should empty the cache: %+v", st)
+	}
+}
@@ -3,15 +3,19 @@ package balanced
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	mrand "math/rand"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	h "github.com/ipfs/go-unixfs/importer/helpers"
 	uio "github.com/ipfs/go-unixfs/io"
 
+	cid "github.com/ipfs/go-cid"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	u "github.com/ipfs/go-ipfs-util"
 	ipld "github.com/ipfs/go-ipld-format"
@@ -32,7 +36,7 @@ func buildTestDag(ds ipld.DAGService, spl chunker.Splitter) (*dag.ProtoNode, err
 		return nil, err
 	}
 
-	nd, err := Layout(db)
+	nd, err := Layout(db, "")
 	if err != nil {
 		return nil, err
 	}
@@ -337,3 +341,215 @@ func TestSeekingConsistency(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestParallelLayoutMatchesSequential checks, over random files and builder
+// options, that building from the file path and building from the stream
+// with several workers give the same root CID as the sequential layout.
+func TestParallelLayoutMatchesSequential(t *testing.T) {
+	defer func(n, ring int) {
+		dag.NumThread, h.StreamBufferChunks = n, ring
+	}(dag.NumThread, h.StreamBufferChunks)
+	h.StreamBufferChunks = 8
+
+	chunkers := []string{"", "size-1000", "size-1048576", "rabin-1024-8192-32768", "buzhash"}
+	prefixes := []cid.Builder{nil, dag.V0CidPrefix(), dag.V1CidPrefix()}
+	rnd := mrand.New(mrand.NewSource(1))
+
+	for i := 0; i < 20; i++ {
+		size := rnd.Int63n(4 << 20)
+		if i == 0 {
+			size = 0
+		}
+		data := make([]byte, size)
+		rnd.Read(data)
+		path := filepath.Join(t.TempDir(), "file")
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		dbp := h.DagBuilderParams{
+			Dagserv:    mdtest.Mock(),
+			Maxlinks:   []int{2, 3, 174, h.DefaultLinksPerBlock}[rnd.Intn(4)],
+			RawLeaves:  rnd.Intn(2) == 0,
+			CidBuilder: prefixes[rnd.Intn(len(prefixes))],
+		}
+		chnk := chunkers[rnd.Intn(len(chunkers))]
+
+		build := func(path string) ipld.Node {
+			spl, err := chunker.FromString(bytes.NewReader(data), chnk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := dbp.New(spl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nd, err := Layout(db, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return nd
+		}
+
+		// The TierCid recorded by the parallel layouts must list the nodes
+		// in the order a reader visits them.
+		checkTierCid := func(nd ipld.Node, layout string) {
+			if len(nd.Links()) == 0 {
+				return
+			}
+			tc, ok := dag.UnPinBuffer.Remove(nd.Cid())
+			if !ok {
+				t.Fatalf("%s layout recorded no TierCid for %s", layout, nd.Cid())
+			}
+
+			want, err := dag.BuildTierCid(context.Background(), dbp.Dagserv, nd.Cid(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(want.NonLeaf[1:]) || fmt.Sprint(tc.Leaf) != fmt.Sprint(want.Leaf) {
+				t.Fatalf("size %d, chunker %q, %+v: %s layout recorded %+v, expected %+v without the root",
+					size, chnk, dbp, layout, tc, want)
+			}
+		}
+
+		dag.NumThread = 1
+		seq := build("")
+		dag.NumThread = 4
+		stream := build("")
+		checkTierCid(stream, "streamed")
+		par := build(path)
+		checkTierCid(par, "parallel")
+		if !seq.Cid().Equals(par.Cid()) {
+			t.Fatalf("size %d, chunker %q, %+v: sequential root %s, parallel root %s",
+				size, chnk, dbp, seq.Cid(), par.Cid())
+		}
+		if !seq.Cid().Equals(stream.Cid()) {
+			t.Fatalf("size %d, chunker %q, %+v: sequential root %s, streamed root %s",
+				size, chnk, dbp, seq.Cid(), stream.Cid())
+		}
+
+		r, err := uio.NewDagReader(context.Background(), par, dbp.Dagserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dagrArrComp(t, r, data)
+	}
+}
+
+var errInjected = errors.New("injected write error")
+
+// faultyDAG lets `after` nodes be written to it, and then either fails
+// every write or, when `cancel` is set, cancels the build and keeps going.
+type faultyDAG struct {
+	ipld.DAGService
+
+	mu     sync.Mutex
+	after  int
+	cancel context.CancelFunc
+}
+
+func (f *faultyDAG) fault() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.after > 0 {
+		f.after--
+		return nil
+	}
+	if f.cancel != nil {
+		f.cancel()
+		return nil
+	}
+	return errInjected
+}
+
+func (f *faultyDAG) Add(ctx context.Context, nd ipld.Node) error {
+	if err := f.fault(); err != nil {
+		return err
+	}
+	return f.DAGService.Add(ctx, nd)
+}
+
+func (f *faultyDAG) AddMany(ctx context.Context, nds []ipld.Node) error {
+	for _, nd := range nds {
+		if err := f.Add(ctx, nd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *faultyDAG) HasLocal(ctx context.Context, c cid.Cid) (bool, error) {
+	return f.DAGService.(dag.LocalNodeChecker).HasLocal(ctx, c)
+}
+
+// TestLayoutFaults checks that the parallel and the streamed layouts return
+// write errors and cancellations instead of a DAG, and remove the leaves
+// they wrote but not the ones that were already stored.
+func TestLayoutFaults(t *testing.T) {
+	defer func(n, ring int) {
+		dag.NumThread, h.StreamBufferChunks = n, ring
+	}(dag.NumThread, h.StreamBufferChunks)
+	dag.NumThread = 4
+	h.StreamBufferChunks = 8
+
+	data := make([]byte, 200*1000)
+	u.NewTimeSeededRand().Read(data)
+	path := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A leaf of the file stored by an earlier add.
+	shared := dag.NewRawNode(data[:1000])
+
+	for _, layout := range []string{"parallel", "stream"} {
+		for _, cancel := range []bool{false, true} {
+			bs := mdtest.Bserv()
+			store := dag.NewDAGService(bs)
+			if err := store.Add(context.Background(), shared); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancelFunc := context.WithCancel(context.Background())
+			leaves := &faultyDAG{DAGService: store, after: 50}
+			want := errInjected
+			if cancel {
+				leaves.cancel = cancelFunc
+				want = context.Canceled
+			}
+			dbp := h.DagBuilderParams{
+				Dagserv:     mdtest.Mock(),
+				LeafDagserv: leaves,
+				Maxlinks:    3,
+				RawLeaves:   true,
+				Ctx:         ctx,
+			}
+			db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var nd ipld.Node
+			if layout == "parallel" {
+				nd, err = Layout(db, path)
+			} else {
+				nd, err = Layout(db, "")
+			}
+			cancelFunc()
+			if !errors.Is(err, want) || nd != nil {
+				t.Fatalf("%s, cancel %t: expected %v, got %v (root %v)", layout, cancel, want, err, nd)
+			}
+
+			keys, err := bs.Blockstore().AllKeysChan(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []cid.Cid
+			for k := range keys {
+				left = append(left, k)
+			}
+			if len(left) != 1 || !left[0].Equals(shared.Cid()) {
+				t.Fatalf("%s, cancel %t: %d blocks left behind, want only the shared leaf", layout, cancel, len(left))
+			}
+		}
+	}
+}
@@ -52,101 +52,99 @@ package balanced
 import (
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"os"
-	"path/filepath"
-	"sync"
-	"time"
 
 	ft "github.com/ipfs/go-unixfs"
 	h "github.com/ipfs/go-unixfs/importer/helpers"
+	"golang.org/x/sync/errgroup"
 
-	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
-	"github.com/ipfs/go-datastore"
-	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	chunker "github.com/ipfs/go-ipfs-chunker"
 	ipld "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
 	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
 )
 
 var fillNodeRec_Count = 0
-var ChunkSize int64 = 1024 * 256
-var ChildLinkCount = 174
 
-// var NumThread = 32
-
-// var IPFS_Path = "/home/mssong/.ipfs"
-
-// var IPFS_Path = "/mnt/nvme0n1/.ipfs"
-
-func encode(key datastore.Key) (dirPath, fileName string) {
-	// dir: /home/mssong/.ipfs/blocks/7P path: /home/mssong/.ipfs/blocks/7P/CIQKGXY65BAIM2G5C64GRJOK2SGPDAXNG5VGHVHW7KFQ3PFFF5YH7PI.data
-	extension := ".data"
-	noslash := key.String()[1:]
-	// datastorePath := "/home/mssong/.ipfs/blocks"
-	datastorePath := merkledag.IPFS_Path + "/blocks"
-
-	dirPath = filepath.Join(datastorePath, noslash[len(noslash)-3:len(noslash)-1])
-	fileName = noslash + extension
-	return dirPath, fileName
-}
-
-func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, childNode []ipld.Node, childFileSize []uint64, lastChildIdx int, newFileNonLeaf *[]cid.Cid) (ipld.Node, uint64, error) {
+// makeDAG builds the nodes of `level` out of the nodes of the level below,
+// `childNode`, `db.Maxlinks()` children per node, and then the levels above
+// it up to the root, which it returns. The nodes of a level are built by up
+// to `db.Concurrency()` workers, which stop as soon as one of them fails
+// or the builder's context is cancelled. The CIDs of every level are
+// appended to `levels`, in order, once all of its nodes are built.
+func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, childNode []ipld.Node, childFileSize []uint64, lastChildIdx int, levels *[][]cid.Cid) (ipld.Node, uint64, error) {
 	// fmt.Println("@@@makeDAG")
-	wg := sync.WaitGroup{}
-
 	filledNode := make([]ipld.Node, depthNodeCount[level])
 	nodeFileSize := make([]uint64, depthNodeCount[level])
-	for i := 0; i < depthNodeCount[level]; i++ {
-		// fmt.Println("depthNodeCount[level]:", depthNodeCount[level])
-		// fmt.Println("len(childNode):",len(childNode))
-		// fmt.Println("len(childFileSize):",len(childFileSize))
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			node := db.NewFSNodeOverDag(ft.TFile)
-			for idx := i * ChildLinkCount; idx < (i+1)*ChildLinkCount; idx++ {
-				if i == depthNodeCount[level]-1 && idx > lastChildIdx {
-					break
+
+	workers := db.Concurrency()
+	if workers > depthNodeCount[level] {
+		workers = depthNodeCount[level]
+	}
+	eg, ctx := errgroup.WithContext(db.Context())
+	for w := 0; w < workers; w++ {
+		w := w
+		eg.Go(func() error {
+			for i := w; i < depthNodeCount[level]; i += workers {
+				if err := ctx.Err(); err != nil {
+					return err
 				}
-				st1 := time.Now()
-				// fmt.Println("i=", i, "idx =", idx)
-				err := node.AddChild_mansub(childNode[idx], childFileSize[idx], db, level)
-				elap1 := time.Since(st1)
-				elap1 = elap1
-				// fmt.Println("elap1:", elap1)
 
-				if err != nil {
-					panic("mssong - err := node.AddChild(childNode[idx], childFileSize[idx], db)")
+				node := db.NewFSNodeOverDag(ft.TFile)
+				for idx := i * db.Maxlinks(); idx < (i+1)*db.Maxlinks() && idx <= lastChildIdx; idx++ {
+					if err := node.AddChild_mansub(childNode[idx], childFileSize[idx], db, level); err != nil {
+						return err
+					}
 				}
 				nodeFileSize[i] = node.FileSize()
+				var err error
 				filledNode[i], err = node.Commit()
-				// fmt.Printf("newFileNonLeaf_0:%#v\n", newFileNonLeaf)
 				if err != nil {
-					panic("mssong - filledNode[i], err = node.Commit()")
+					return err
 				}
 			}
-			// mssong_Todo: 에러나니깐 일단 주석
-			// mutex := sync.Mutex{}
-			// mutex.Lock()
-			// filledNode[i] 만들어지는 순서가 i순서에 맞지 않음
-			// *newFileNonLeaf = append(*newFileNonLeaf, filledNode[i].Cid())
-			// fmt.Println("newFileNonLeaf:", filledNode[i])
-			// mutex.Unlock()
-			// 일단 주석
-
-		}(i)
+			return nil
+		})
 	}
-	wg.Wait()
+	if err := eg.Wait(); err != nil {
+		return nil, 0, err
+	}
+
+	levelCids := make([]cid.Cid, len(filledNode))
+	for i, nd := range filledNode {
+		levelCids[i] = nd.Cid()
+	}
+	*levels = append(*levels, levelCids)
 
 	if level+1 == len(depthNodeCount) {
 		return filledNode[0], nodeFileSize[0], nil
 	}
-	fn, nfs, err := makeDAG(db, level+1, depthNodeCount, filledNode, nodeFileSize, depthNodeCount[level]-1, newFileNonLeaf)
-	return fn, nfs, err
+	return makeDAG(db, level+1, depthNodeCount, filledNode, nodeFileSize, depthNodeCount[level]-1, levels)
+}
+
+// nonLeafOrder lists the internal nodes of a balanced DAG with `maxlinks`
+// children per node, given the CIDs of each of its levels from the parents
+// of the leaves up to the root. They are listed in the order a reader visits
+// them, like `merkledag.BuildTierCid` does, but without the root.
+func nonLeafOrder(levels [][]cid.Cid, maxlinks int) []cid.Cid {
+	if len(levels) == 0 {
+		return nil
+	}
 
+	var nonLeaf []cid.Cid
+	var visit func(level, idx int)
+	visit = func(level, idx int) {
+		nonLeaf = append(nonLeaf, levels[level][idx])
+		if level == 0 {
+			return
+		}
+		for child := idx * maxlinks; child < (idx+1)*maxlinks && child < len(levels[level-1]); child++ {
+			visit(level-1, child)
+		}
+	}
+	visit(len(levels)-1, 0)
+	return nonLeaf[1:]
 }
 
 // Layout builds a balanced DAG layout. In a balanced DAG of depth 1, leaf nodes
@@ -163,6 +161,14 @@ func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, chil
 // depth of the DAG. The process is repeated until there is no more data to add
 // (i.e. the DagBuilderHelper’s Done() function returns true).
 //
+// When `fileAbsPath` names the file being added the DAG is built from it
+// directly by `parallelLayout`; otherwise, unless `db.Concurrency()` is 1,
+// the Splitter is consumed by the pipelined `streamLayout`. Both produce
+// the same DAG as the sequential process described below. Callers only pass
+// the path of a local file they opened themselves (see
+// `files.ReaderFile.LocalFile`), never one a client claims to have read its
+// data from.
+//
 // The nodes are filled recursively, so the DAG is built from the bottom up. Leaf
 // nodes are created first using the chunked file data and its size. The size is
 // then bubbled up to the parent (internal) node, which aggregates all the sizes of
@@ -221,220 +227,176 @@ func makeDAG(db *ihelper.DagBuilderHelper, level int, depthNodeCount []int, chil
 //        +=========+   +=========+   + - - - - +
 //
 func Layout(db *h.DagBuilderHelper, fileAbsPath string) (ipld.Node, error) {
-	layout_st := time.Now()
-	var newFileLeaf []cid.Cid
-	optFlag := true
-
-	if fileAbsPath != "" && optFlag {
-		depthNodeCount := make([]int, 1)
-
-		fileInfo, err := os.Stat(fileAbsPath)
+	if fileAbsPath != "" {
+		root, ok, err := parallelLayout(db, fileAbsPath)
 		if err != nil {
-			panic(err)
+			return nil, removeWrittenLeaves(db, err)
 		}
-		fileSize := fileInfo.Size()
-		var levelNodeCount int
-		if fileSize%ChunkSize != 0 {
-			levelNodeCount = int(fileSize/ChunkSize) + 1
-		} else {
-			levelNodeCount = int(fileSize / ChunkSize)
+		if ok {
+			db.KeepWrittenLeaves()
+			return root, nil
 		}
-		depthNodeCount[0] = levelNodeCount //leaf node
+	}
 
-		var root ipld.Node
-		if levelNodeCount == 1 { // only one leaf node == root node
-			root, _, err := db.NewLeafDataNode(ft.TFile)
-			if err != nil {
-				return nil, err
-			}
-			return root, db.Add(root)
+	if !db.Done() && db.Concurrency() > 1 {
+		root, err := streamLayout(db)
+		if err != nil {
+			return nil, removeWrittenLeaves(db, err)
 		}
-		for {
-			childLinks := int64(ChildLinkCount)
-			if int(fileSize%childLinks) != 0 {
-				levelNodeCount = levelNodeCount/int(childLinks) + 1
-				// fmt.Println("levelNodeCount:", len(depthNodeCount), levelNodeCount)
-				if levelNodeCount == 1 {
-					depthNodeCount = append(depthNodeCount, 1) //root node
-					break
-				}
-			} else {
-				levelNodeCount = levelNodeCount / int(childLinks)
-				// fmt.Println("levelNodeCount:", len(depthNodeCount), levelNodeCount)
-			}
-			depthNodeCount = append(depthNodeCount, levelNodeCount)
+		db.KeepWrittenLeaves()
+		return root, nil
+	}
+
+	if db.Done() {
+		// No data, return just an empty node.
+		root, err := db.NewLeafNode(nil, ft.TFile)
+		if err != nil {
+			return nil, err
 		}
+		// This works without Filestore support (`ProcessFileStore`).
+		// TODO: Why? Is there a test case missing?
 
-		leafNode := make([]ipld.Node, depthNodeCount[0])
-		leafFileSize := make([]uint64, depthNodeCount[0])
+		return root, db.Add(root)
+	}
 
-		newFileLeaf = make([]cid.Cid, depthNodeCount[0])
+	// The first `root` will be a single leaf node with data
+	// (corner case), after that subsequent `root` nodes will
+	// always be internal nodes (with a depth > 0) that can
+	// be handled by the loop.
+	root, fileSize, err := db.NewLeafDataNode(ft.TFile)
+	if err != nil {
+		return nil, err
+	}
 
-		var numTh int
-		var size int
-		if merkledag.NumThread == 1 {
-			size = depthNodeCount[0]
-		} else {
+	// Each time a DAG of a certain `depth` is filled (because it
+	// has reached its maximum capacity of `db.Maxlinks()` per node)
+	// extend it by making it a sub-DAG of a bigger DAG with `depth+1`.
+	for depth := 1; !db.Done(); depth++ {
 
-			size = depthNodeCount[0] / (merkledag.NumThread - 1)
-		}
-		if size == 0 || size == 1 {
-			if size == 0 {
-				size = 1
-			}
-			numTh = depthNodeCount[0]
-		} else {
-			numTh = depthNodeCount[0] / size
-			if depthNodeCount[0]%size != 0 {
-				numTh = numTh + 1
-			}
+		// Add the old `root` as a child of the `newRoot`.
+		newRoot := db.NewFSNodeOverDag(ft.TFile)
+		newRoot.AddChild(root, fileSize, db)
+
+		// Fill the `newRoot` (that has the old `root` already as child)
+		// and make it the current `root` for the next iteration (when
+		// it will become "old").
+		root, fileSize, err = fillNodeRec(db, newRoot, depth)
+		if err != nil {
+			return nil, err
 		}
-		var wg sync.WaitGroup
-
-		tempPath := merkledag.IPFS_Path + "/blocks/temp"
-		os.Mkdir(tempPath, 0755)
-		for i := 0; i < numTh; i++ {
-			wg.Add(1)
-			go func(i int) {
-				defer wg.Done()
-				f, err := os.Open(fileAbsPath)
-				if err != nil {
-					panic(err)
-				}
-				offset := int64(i) * int64(size) * ChunkSize
-				f.Seek(offset, 0)
-				full := make([]byte, int64(size)*ChunkSize)
-				st := time.Now()
-				n, err := io.ReadFull(f, full)
-				elap := time.Since(st)
-				elap = elap
-				// chunkingMutex.Lock()
-				// chunkingTime = chunkingTime + int(elap)
-				// chunkingMutex.Unlock()
-				if err == io.ErrUnexpectedEOF {
-					small := make([]byte, n)
-					copy(small, full)
-					full = small
-				}
-				idx := i * size
-				fileDataSize := len(full)
-				count := fileDataSize / int(ChunkSize)
-				if count == 0 {
-					var err error
-					leafNode[idx], leafFileSize[idx], err = db.NewLeafDataNode_mansub(full, ft.TFile)
-					if err != nil {
-						log.Fatal("mssong: leafNode[i], leafFileSize[i], err = db.NewLeafDataNode_mansub(ft.TFile, fileCidIdx)")
-					}
-					hashing_st := time.Now()
-					newFileLeaf[idx] = leafNode[idx].Cid()
-					hashing_elap := time.Since(hashing_st)
-					hashing_elap = hashing_elap
-					err = db.Add(leafNode[idx])
-					if err != nil {
-						panic(err)
-					}
-				} else {
-					if fileDataSize%int(ChunkSize) != 0 {
-						count = count + 1
-					}
+	}
+	return root, db.Add(root)
+}
 
-					for j := 0; j < count; j++ {
-						start := j * int(ChunkSize)
-						end := (j + 1) * int(ChunkSize)
-						if end >= fileDataSize {
-							end = fileDataSize
-						}
-						var err error
-						leafNode[idx+j], leafFileSize[idx+j], err = db.NewLeafDataNode_mansub(full[start:end], ft.TFile)
-						if err != nil {
-							log.Fatal("mssong: leafNode[i], leafFileSize[i], err = db.NewLeafDataNode_mansub(ft.TFile, fileCidIdx)")
-						}
-						newFileLeaf[idx+j] = leafNode[idx+j].Cid()
-						dsKey := dshelp.MultihashToDsKey(newFileLeaf[idx+j].Hash())
-						dirPath, fileName := encode(dsKey)
-						os.Mkdir(dirPath, 0755)
-						filePath := dirPath + "/" + fileName
-						f, err := os.Create(filePath)
-						if err != nil {
-							panic(err)
-						}
-						var blk blocks.Block
-						blk = leafNode[idx+j]
-						writing_st := time.Now()
-						f.Write(blk.RawData())
-						f.Sync()
-						writing_elap := time.Since(writing_st)
-						writing_elap = writing_elap
-						if err != nil {
-							panic(err)
-						}
-					}
-				}
+// removeWrittenLeaves deletes the leaves a failed layout managed to store
+// and returns the error it failed with.
+func removeWrittenLeaves(db *h.DagBuilderHelper, err error) error {
+	if rerr := db.RemoveWrittenLeaves(); rerr != nil {
+		return fmt.Errorf("%w (removing the leaves written: %v)", err, rerr)
+	}
+	return err
+}
 
-			}(i)
-		}
-		wg.Wait()
-		newFileNonLeaf := make([]cid.Cid, 0)
-		st_1 := time.Now()
-		st_1 = st_1
-		root, _, err = makeDAG(db, 1, depthNodeCount, leafNode, leafFileSize, depthNodeCount[0]-1, &newFileNonLeaf)
-
-		dagCid := merkledag.NewTierCid()
-		dagCid.NonLeaf = append(dagCid.NonLeaf, newFileNonLeaf...)
-		dagCid.Leaf = append(dagCid.Leaf, newFileLeaf...)
-		merkledag.PinBufferMutex.Lock()
-		merkledag.PinBuffer[root.Cid()] = dagCid
-		merkledag.PinBufferMutex.Unlock()
-
-		elap := time.Since(layout_st)
-		elap = elap
-		fmt.Println("layout ~ makeDAG time:", elap)
-		// fmt.Println("layout elap:", elap)
-		return root, db.Add(root)
-		// panic("good game")
-	} else {
-		if db.Done() {
-			// No data, return just an empty node.
-			root, err := db.NewLeafNode(nil, ft.TFile)
-			if err != nil {
-				return nil, err
-			}
-			// This works without Filestore support (`ProcessFileStore`).
-			// TODO: Why? Is there a test case missing?
+// parallelLayout builds the same DAG as the sequential layout straight from
+// the file at `fileAbsPath`. The chunk boundaries the Splitter would produce
+// are computed up front, so that the leaves can be built and stored by
+// several workers at once; the internal levels are then built bottom-up by
+// `makeDAG`, grouping `db.Maxlinks()` children per node like `fillNodeRec`
+// does. `ok` is false, and nothing has been read from the Splitter, when
+// the file has to be built sequentially instead: either its Splitter
+// cannot be run ahead of time or it fits in a single leaf.
+func parallelLayout(db *h.DagBuilderHelper, fileAbsPath string) (root ipld.Node, ok bool, err error) {
+	f, err := os.Open(fileAbsPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
 
-			return root, db.Add(root)
-		}
+	bounds, err := db.ChunkBoundaries(f, fileInfo.Size(), db.Concurrency())
+	if err == chunker.ErrNoBoundaries {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(bounds) < 2 {
+		return nil, false, nil
+	}
 
-		// The first `root` will be a single leaf node with data
-		// (corner case), after that subsequent `root` nodes will
-		// always be internal nodes (with a depth > 0) that can
-		// be handled by the loop.
-		root, fileSize, err := db.NewLeafDataNode(ft.TFile)
-		if err != nil {
-			return nil, err
-		}
+	// Number of nodes on each level of the DAG, from the leaves up to
+	// the root.
+	depthNodeCount := []int{len(bounds)}
+	for n := len(bounds); n > 1; {
+		n = (n + db.Maxlinks() - 1) / db.Maxlinks()
+		depthNodeCount = append(depthNodeCount, n)
+	}
 
-		// Each time a DAG of a certain `depth` is filled (because it
-		// has reached its maximum capacity of `db.Maxlinks()` per node)
-		// extend it by making it a sub-DAG of a bigger DAG with `depth+1`.
-		for depth := 1; !db.Done(); depth++ {
+	leafNode := make([]ipld.Node, len(bounds))
+	leafFileSize := make([]uint64, len(bounds))
+	newFileLeaf := make([]cid.Cid, len(bounds))
+
+	// Every worker builds a run of `size` consecutive leaves out of a
+	// single read of the file.
+	size := (len(bounds) + db.Concurrency() - 1) / db.Concurrency()
+	eg, ctx := errgroup.WithContext(db.Context())
+	for first := 0; first < len(bounds); first += size {
+		first := first
+		last := first + size
+		if last > len(bounds) {
+			last = len(bounds)
+		}
+		eg.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-			// Add the old `root` as a child of the `newRoot`.
-			newRoot := db.NewFSNodeOverDag(ft.TFile)
-			newRoot.AddChild(root, fileSize, db)
+			var start int64
+			if first > 0 {
+				start = bounds[first-1]
+			}
+			full := make([]byte, bounds[last-1]-start)
+			if n, err := f.ReadAt(full, start); n < len(full) {
+				return err
+			}
 
-			// Fill the `newRoot` (that has the old `root` already as child)
-			// and make it the current `root` for the next iteration (when
-			// it will become "old").
-			root, fileSize, err = fillNodeRec(db, newRoot, depth)
-			if err != nil {
-				return nil, err
+			chunkStart := start
+			for j := first; j < last; j++ {
+				var err error
+				leafNode[j], leafFileSize[j], err = db.NewLeafDataNode_mansub(full[chunkStart-start:bounds[j]-start], uint64(chunkStart), ft.TFile)
+				if err != nil {
+					return err
+				}
+				newFileLeaf[j] = leafNode[j].Cid()
+				chunkStart = bounds[j]
 			}
-		}
-		fmt.Println("root CID:", root.Cid())
-		return root, db.Add(root)
+
+			// Every worker already runs in parallel with the
+			// others, so its own leaves are written in one go.
+			return db.AddLeaves(leafNode[first:last], 1)
+		})
 	}
+	if err := eg.Wait(); err != nil {
+		return nil, false, err
+	}
+
+	var levels [][]cid.Cid
+	root, _, err = makeDAG(db, 1, depthNodeCount, leafNode, leafFileSize, depthNodeCount[0]-1, &levels)
+	if err != nil {
+		return nil, false, err
+	}
+
+	dagCid := merkledag.NewTierCid()
+	dagCid.NonLeaf = append(dagCid.NonLeaf, nonLeafOrder(levels, db.Maxlinks())...)
+	dagCid.Leaf = append(dagCid.Leaf, newFileLeaf...)
+	// The entry stays in UnPinBuffer until the root is pinned, at
+	// which point the pinner persists it.
+	merkledag.UnPinBuffer.Add(root.Cid(), dagCid)
 
+	return root, true, db.Add(root)
 }
 
 // fillNodeRec will "fill" the given internal (non-leaf) `node` with data by
@@ -0,0 +1,125 @@
+package balanced
+
+import (
+	"errors"
+	"io"
+
+	ft "github.com/ipfs/go-unixfs"
+	h "github.com/ipfs/go-unixfs/importer/helpers"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+)
+
+// streamLayout builds the same DAG as the sequential layout out of data
+// that can only be read once, in order, from the Splitter. The leaves are
+// built and stored ahead by a `h.LeafStream`, while the calling goroutine
+// links them in order into their parents, committing each internal node as
+// soon as it has `db.Maxlinks()` children.
+//
+// Reading, building and linking all stop when the builder's context is
+// cancelled, and the layout returns the context's error.
+//
+// There must be at least one chunk to read (see `db.Done()`).
+func streamLayout(db *h.DagBuilderHelper) (ipld.Node, error) {
+	leaves := db.NewLeafStream(ft.TFile)
+	// Let the workers drain whatever is left if linking fails.
+	defer leaves.Close()
+
+	t := &levelBuilder{db: db}
+	dagCid := merkledag.NewTierCid()
+	for {
+		node, size, err := leaves.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		dagCid.Leaf = append(dagCid.Leaf, node.Cid())
+		if err := t.push(0, node, size); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := t.finish()
+	if err != nil {
+		return nil, err
+	}
+	dagCid.NonLeaf = append(dagCid.NonLeaf, nonLeafOrder(t.nodes, t.db.Maxlinks())...)
+
+	merkledag.UnPinBuffer.Add(root.Cid(), dagCid)
+
+	return root, db.Add(root)
+}
+
+// levelBuilder assembles a balanced DAG bottom-up from its leaves, given
+// in order. It only holds the node being filled on every level.
+type levelBuilder struct {
+	db *h.DagBuilderHelper
+
+	open  []*h.FSNodeOverDag // node being filled with children of each level
+	count []int              // nodes produced on each level
+	last  []ipld.Node        // last node produced on each level
+
+	// nodes holds the CIDs of the internal nodes produced on each level,
+	// starting with the parents of the leaves.
+	nodes [][]cid.Cid
+}
+
+// push adds `node`, the next node on `level` (0 for leaves), to its parent,
+// committing the parent once it is full.
+func (t *levelBuilder) push(level int, node ipld.Node, fileSize uint64) error {
+	if level == len(t.open) {
+		t.open = append(t.open, nil)
+		t.count = append(t.count, 0)
+		t.last = append(t.last, nil)
+	}
+	t.count[level]++
+	t.last[level] = node
+	if level > 0 {
+		if level > len(t.nodes) {
+			t.nodes = append(t.nodes, nil)
+		}
+		t.nodes[level-1] = append(t.nodes[level-1], node.Cid())
+	}
+
+	if t.open[level] == nil {
+		t.open[level] = t.db.NewFSNodeOverDag(ft.TFile)
+	}
+	parent := t.open[level]
+	if err := parent.AddChild_mansub(node, fileSize, t.db, level+1); err != nil {
+		return err
+	}
+	if parent.NumChildren() < t.db.Maxlinks() {
+		return nil
+	}
+	return t.commit(level)
+}
+
+func (t *levelBuilder) commit(level int) error {
+	parent := t.open[level]
+	t.open[level] = nil
+	filled, err := parent.Commit()
+	if err != nil {
+		return err
+	}
+	return t.push(level+1, filled, parent.FileSize())
+}
+
+// finish commits the partially filled nodes left on every level and
+// returns the root: the only node of the top level.
+func (t *levelBuilder) finish() (ipld.Node, error) {
+	for level := 0; level < len(t.count); level++ {
+		if t.count[level] == 1 && level == len(t.count)-1 {
+			return t.last[level], nil
+		}
+		if t.open[level] != nil {
+			if err := t.commit(level); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("no leaves to build a DAG from")
+}
@@ -28,12 +28,24 @@ var EncodingTime = 0
 // efficiently create unixfs dag trees
 type DagBuilderHelper struct {
 	dserv      ipld.DAGService
+	leafDserv  ipld.DAGService
 	spl        chunker.Splitter
 	recvdErr   error
 	rawLeaves  bool
 	nextData   []byte // the next item to return.
 	maxlinks   int
 	cidBuilder cid.Builder
+	ctx        context.Context
+	workers    int
+
+	// addLk serializes the writes to dserv, which may be a batch, from the
+	// parallel layouts.
+	addLk sync.Mutex
+
+	// Leaves written by AddLeaf and AddLeaves that were not stored before,
+	// claimed in leafClaims until the layout is done with them.
+	writtenLk sync.Mutex
+	written   []cid.Cid
 
 	// Filestore support variables.
 	// ----------------------------
@@ -66,9 +78,23 @@ type DagBuilderParams struct {
 	// DAGService to write blocks to (required)
 	Dagserv ipld.DAGService
 
+	// DAGService the parallel balanced layout writes its leaves to, in
+	// parallel when it implements merkledag.ParallelNodeAdder. Defaults
+	// to Dagserv.
+	LeafDagserv ipld.DAGService
+
 	// NoCopy signals to the chunker that it should track fileinfo for
 	// filestore adds
 	NoCopy bool
+
+	// Concurrency is the number of workers the parallel layouts build and
+	// store leaves with. Defaults to merkledag.NumThread.
+	Concurrency int
+
+	// Ctx is the context the blocks are written under. Cancelling it makes
+	// the layout stop and return its error. Defaults to
+	// context.Background().
+	Ctx context.Context
 }
 
 // New generates a new DagBuilderHelper from the given params and a given
@@ -76,16 +102,29 @@ type DagBuilderParams struct {
 func (dbp *DagBuilderParams) New(spl chunker.Splitter) (*DagBuilderHelper, error) {
 	db := &DagBuilderHelper{
 		dserv:      dbp.Dagserv,
+		leafDserv:  dbp.LeafDagserv,
 		spl:        spl,
 		rawLeaves:  dbp.RawLeaves,
 		cidBuilder: dbp.CidBuilder,
 		maxlinks:   dbp.Maxlinks,
+		ctx:        dbp.Ctx,
+		workers:    dbp.Concurrency,
+	}
+	if db.ctx == nil {
+		db.ctx = context.Background()
+	}
+	if db.workers < 1 {
+		db.workers = dag.NumThread
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
 		db.stat = fi.Stat()
 	}
 
+	if db.leafDserv == nil {
+		db.leafDserv = db.dserv
+	}
+
 	if dbp.NoCopy && db.fullPath == "" { // Enforce NoCopy
 		return nil, ErrMissingFsRef
 	}
@@ -137,6 +176,16 @@ func (db *DagBuilderHelper) GetDagServ() ipld.DAGService {
 	return db.dserv
 }
 
+// Context returns the context the blocks are written under.
+func (db *DagBuilderHelper) Context() context.Context {
+	return db.ctx
+}
+
+// Concurrency returns the number of workers the parallel layouts use.
+func (db *DagBuilderHelper) Concurrency() int {
+	return db.workers
+}
+
 // GetCidBuilder returns the internal `cid.CidBuilder` set in the builder.
 func (db *DagBuilderHelper) GetCidBuilder() cid.Builder {
 	return db.cidBuilder
@@ -226,24 +275,31 @@ func (db *DagBuilderHelper) NewLeafDataNode(fsNodeType pb.Data_DataType) (node i
 	return node, dataSize, nil
 }
 
-func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
-	// debug.PrintStack()
-
+// NewLeafDataNode_mansub builds a leaf node out of fileData, a chunk read
+// directly from the file at offset instead of from the Splitter, so that
+// leaves can be built out of order by the parallel layout.
+func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, offset uint64, fsNodeType pb.Data_DataType) (node ipld.Node, dataSize uint64, err error) {
 	dataSize = uint64(len(fileData))
 
 	// Create a new leaf node containing the file chunk data.
 	node, err = db.NewLeafNode(fileData, fsNodeType)
-
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Convert this leaf to a `FilestoreNode` if needed.
-	node = db.ProcessFileStore(node, dataSize)
+	node = db.processFileStoreAt(node, offset)
 
 	return node, dataSize, nil
 }
 
+// ChunkBoundaries returns the end offsets of the chunks the Splitter would
+// produce out of the first size bytes of r, computed with up to
+// concurrency workers (see chunker.Boundaries).
+func (db *DagBuilderHelper) ChunkBoundaries(r io.ReaderAt, size int64, concurrency int) ([]int64, error) {
+	return chunker.Boundaries(db.spl, r, size, concurrency)
+}
+
 // ProcessFileStore generates, if Filestore is being used, the
 // `FilestoreNode` representation of the `ipld.Node` that
 // contains the file data. If Filestore is not being used just
@@ -253,24 +309,30 @@ func (db *DagBuilderHelper) NewLeafDataNode_mansub(fileData []byte, fsNodeType p
 // `NewLeafDataNode` is called, both work in tandem but the
 // offset is more related to this function).
 func (db *DagBuilderHelper) ProcessFileStore(node ipld.Node, dataSize uint64) ipld.Node {
+	fn := db.processFileStoreAt(node, db.offset)
+	if fn != node {
+		// Update `offset` with the size of the data generated by `db.Next`.
+		db.offset += dataSize
+	}
+	return fn
+}
+
+// processFileStoreAt is ProcessFileStore for a chunk found at `offset` in
+// the file. It does not touch `db.offset`.
+func (db *DagBuilderHelper) processFileStoreAt(node ipld.Node, offset uint64) ipld.Node {
 	// Check if Filestore is being used.
 	if db.fullPath != "" {
 		// Check if the node is actually a raw node (needed for
 		// Filestore support).
 		if _, ok := node.(*dag.RawNode); ok {
-			fn := &pi.FilestoreNode{
+			return &pi.FilestoreNode{
 				Node: node,
 				PosInfo: &pi.PosInfo{
-					Offset:   db.offset,
+					Offset:   offset,
 					FullPath: db.fullPath,
 					Stat:     db.stat,
 				},
 			}
-
-			// Update `offset` with the size of the data generated by `db.Next`.
-			db.offset += dataSize
-
-			return fn
 		}
 	}
 
@@ -280,7 +342,177 @@ func (db *DagBuilderHelper) ProcessFileStore(node ipld.Node, dataSize uint64) ip
 
 // Add inserts the given node in the DAGService.
 func (db *DagBuilderHelper) Add(node ipld.Node) error {
-	return db.dserv.Add(context.TODO(), node)
+	db.addLk.Lock()
+	defer db.addLk.Unlock()
+	return db.dserv.Add(db.ctx, node)
+}
+
+// AddLeaf writes the given leaf node to the leaf DAGService.
+func (db *DagBuilderHelper) AddLeaf(node ipld.Node) error {
+	return db.AddLeaves([]ipld.Node{node}, 1)
+}
+
+// AddLeaves writes the given leaf nodes to the leaf DAGService, using up to
+// concurrency parallel writes when it supports them.
+func (db *DagBuilderHelper) AddLeaves(nodes []ipld.Node, concurrency int) error {
+	// The leaves are claimed before they are written, so that they are
+	// removed if the layout fails even when the write fails halfway.
+	if err := db.claimLeaves(nodes); err != nil {
+		return err
+	}
+	if len(nodes) == 1 {
+		return db.leafDserv.Add(db.ctx, nodes[0])
+	}
+	return dag.AddManyParallel(db.ctx, db.leafDserv, nodes, concurrency)
+}
+
+// leafClaims holds the leaves written by the builders whose layout is still
+// running that were not stored before, with the builder that wrote each of
+// them first. Those leaves belong to that builder alone, and are removed if
+// its layout fails, unless another builder wrote them too in the meantime.
+// releases counts the claims dropped while their leaves stay stored.
+var leafClaims = struct {
+	sync.Mutex
+	m        map[cid.Cid]*leafClaim
+	releases uint64
+}{m: make(map[cid.Cid]*leafClaim)}
+
+type leafClaim struct {
+	owner  *DagBuilderHelper
+	shared bool
+}
+
+// claimLeaves records the nodes that the leaf DAGService does not store yet
+// as written by this builder, and marks the ones claimed by other builders
+// as shared with them. Nothing is claimed when the DAGService cannot tell
+// which nodes it stores, so that blocks other DAGs may share are never taken
+// for ones written by this builder.
+//
+// The DAGService is asked without holding leafClaims, which the leaf writes
+// of every layout go through. A leaf may be stored and released by another
+// builder in the meantime, so the leaves not found are asked for again when
+// any claim was released.
+func (db *DagBuilderHelper) claimLeaves(nodes []ipld.Node) error {
+	lc, ok := db.leafDserv.(dag.LocalNodeChecker)
+	if !ok {
+		return nil
+	}
+
+	absent := make([]cid.Cid, len(nodes))
+	for i, nd := range nodes {
+		absent[i] = nd.Cid()
+	}
+	for {
+		leafClaims.Lock()
+		releases := leafClaims.releases
+		leafClaims.Unlock()
+
+		var err error
+		if absent, err = absentNodes(db.ctx, lc, absent); err != nil {
+			return err
+		}
+
+		leafClaims.Lock()
+		if leafClaims.releases == releases {
+			break
+		}
+		leafClaims.Unlock()
+	}
+	defer leafClaims.Unlock()
+
+	var fresh []cid.Cid
+	for _, c := range absent {
+		if claim, ok := leafClaims.m[c]; ok {
+			if claim.owner != db {
+				claim.shared = true
+			}
+			continue
+		}
+		leafClaims.m[c] = &leafClaim{owner: db}
+		fresh = append(fresh, c)
+	}
+
+	db.writtenLk.Lock()
+	db.written = append(db.written, fresh...)
+	db.writtenLk.Unlock()
+	return nil
+}
+
+// absentNodes returns the nodes of cids that lc does not store.
+func absentNodes(ctx context.Context, lc dag.LocalNodeChecker, cids []cid.Cid) ([]cid.Cid, error) {
+	var absent []cid.Cid
+	for _, c := range cids {
+		has, err := lc.HasLocal(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			absent = append(absent, c)
+		}
+	}
+	return absent, nil
+}
+
+// takeWritten returns the leaves claimed by this builder and forgets them.
+func (db *DagBuilderHelper) takeWritten() []cid.Cid {
+	db.writtenLk.Lock()
+	defer db.writtenLk.Unlock()
+	written := db.written
+	db.written = nil
+	return written
+}
+
+// KeepWrittenLeaves releases the leaves written by AddLeaf and AddLeaves
+// once the layout has succeeded: they are part of a complete DAG from then
+// on, which other builders may share.
+func (db *DagBuilderHelper) KeepWrittenLeaves() {
+	written := db.takeWritten()
+
+	leafClaims.Lock()
+	defer leafClaims.Unlock()
+	for _, c := range written {
+		delete(leafClaims.m, c)
+	}
+	if len(written) > 0 {
+		leafClaims.releases++
+	}
+}
+
+// RemoveWrittenLeaves deletes the leaves stored by AddLeaf and AddLeaves
+// that were not in the leaf DAGService before and no other builder has
+// written since, so that a layout that fails halfway does not leave them
+// behind. The leaves shared with other builders are left to the garbage
+// collector. It runs even when the builder's context has been cancelled.
+//
+// The internal nodes are not tracked. They are written with Add to the
+// DAGService of the add, which 'ipfs add' buffers and does not commit when
+// the add fails, and there is one of them for every Maxlinks() leaves; the
+// few flushed before the failure are left to the garbage collector too.
+func (db *DagBuilderHelper) RemoveWrittenLeaves() error {
+	written := db.takeWritten()
+	if len(written) == 0 {
+		return nil
+	}
+
+	// The claims are held until the leaves are gone, so that no builder
+	// finds one of them stored in the meantime, takes it for a leaf of an
+	// earlier DAG, and then loses it.
+	leafClaims.Lock()
+	defer leafClaims.Unlock()
+	owned := written[:0]
+	for _, c := range written {
+		if !leafClaims.m[c].shared {
+			owned = append(owned, c)
+		}
+		delete(leafClaims.m, c)
+	}
+	if len(owned) < len(written) {
+		leafClaims.releases++
+	}
+	if len(owned) == 0 {
+		return nil
+	}
+	return db.leafDserv.RemoveMany(context.Background(), owned)
 }
 
 // Maxlinks returns the configured maximum number for links
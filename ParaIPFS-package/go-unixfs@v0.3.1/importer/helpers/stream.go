@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"io"
+	"sync"
+
+	pb "github.com/ipfs/go-unixfs/pb"
+
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// StreamBufferChunks is the number of chunks a `LeafStream` keeps in
+// flight between the Splitter and the layout, which bounds its memory use
+// to about StreamBufferChunks times the chunk size.
+var StreamBufferChunks = 128
+
+// leafJob is a chunk of the stream on its way to become a leaf node.
+type leafJob struct {
+	data   []byte
+	offset uint64
+
+	node ipld.Node
+	size uint64
+	err  error
+	done chan struct{}
+}
+
+// LeafStream turns the data of the Splitter into leaves ahead of the layout
+// consuming them. Chunks are read into a ring of `StreamBufferChunks` jobs;
+// a pool of up to `db.Concurrency()` workers builds and stores the leaves,
+// which `Next` hands out in order.
+//
+// Reading and building stop when the builder's context is cancelled, and
+// `Next` then returns the context's error.
+type LeafStream struct {
+	order  chan *leafJob
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	peeked *leafJob
+
+	// readErr is set by the reader before it closes order.
+	readErr error
+}
+
+// NewLeafStream starts reading the Splitter of db into leaves of the given
+// type. The stream must be closed once the layout is done with it.
+func (db *DagBuilderHelper) NewLeafStream(fsNodeType pb.Data_DataType) *LeafStream {
+	ring := StreamBufferChunks
+	if ring < 1 {
+		ring = 1
+	}
+	workers := db.Concurrency()
+	if workers > ring {
+		workers = ring
+	}
+
+	ctx := db.Context()
+	jobs := make(chan *leafJob, ring)
+	s := &LeafStream{
+		order: make(chan *leafJob, ring),
+		stop:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(s.order)
+
+		var offset uint64
+		for !db.Done() {
+			select {
+			case <-s.stop:
+				return
+			case <-ctx.Done():
+				s.readErr = ctx.Err()
+				return
+			default:
+			}
+			data, err := db.Next()
+			if err != nil {
+				s.readErr = err
+				return
+			}
+			j := &leafJob{data: data, offset: offset, done: make(chan struct{})}
+			offset += uint64(len(data))
+
+			select {
+			case s.order <- j:
+			case <-s.stop:
+				return
+			}
+			jobs <- j
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for j := range jobs {
+				if j.err = ctx.Err(); j.err != nil {
+					close(j.done)
+					continue
+				}
+				j.node, j.size, j.err = db.NewLeafDataNode_mansub(j.data, j.offset, fsNodeType)
+				if j.err == nil {
+					j.err = db.AddLeaf(j.node)
+				}
+				j.data = nil
+				close(j.done)
+			}
+		}()
+	}
+	return s
+}
+
+// Done returns whether all the leaves have been handed out. Like
+// `DagBuilderHelper.Done`, it returns false when reading failed, so that
+// the error is returned by the next call to `Next`.
+func (s *LeafStream) Done() bool {
+	if s.peeked != nil {
+		return false
+	}
+	j, ok := <-s.order
+	if !ok {
+		return s.readErr == nil
+	}
+	s.peeked = j
+	return false
+}
+
+// Next returns the next leaf, already stored, and the size of its data. It
+// returns io.EOF after the last one.
+func (s *LeafStream) Next() (ipld.Node, uint64, error) {
+	j := s.peeked
+	s.peeked = nil
+	if j == nil {
+		var ok bool
+		if j, ok = <-s.order; !ok {
+			if s.readErr != nil {
+				return nil, 0, s.readErr
+			}
+			return nil, 0, io.EOF
+		}
+	}
+
+	<-j.done
+	if j.err != nil {
+		return nil, 0, j.err
+	}
+	return j.node, j.size, nil
+}
+
+// Close stops reading and waits for the workers to drain the leaves still
+// in flight.
+func (s *LeafStream) Close() {
+	close(s.stop)
+	s.wg.Wait()
+}
@@ -0,0 +1,90 @@
+package trickle
+
+import (
+	ft "github.com/ipfs/go-unixfs"
+	h "github.com/ipfs/go-unixfs/importer/helpers"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// streamLayout builds the same DAG as the sequential layout, with the
+// leaves built and stored ahead by a `h.LeafStream` while the calling
+// goroutine links them in order into the trickle sub-trees. The TierCid of
+// the DAG is recorded in `dag.UnPinBuffer`.
+//
+// There must be at least one chunk to read (see `db.Done()`).
+func streamLayout(db *h.DagBuilderHelper) (ipld.Node, error) {
+	leaves := db.NewLeafStream(ft.TRaw)
+	// Let the workers drain whatever is left if linking fails.
+	defer leaves.Close()
+
+	b := &streamBuilder{db: db, leaves: leaves, tc: dag.NewTierCid()}
+	root, _, err := b.fill(db.NewFSNodeOverDag(ft.TFile), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	dag.UnPinBuffer.Add(root.Cid(), b.tc)
+
+	return root, db.Add(root)
+}
+
+// streamBuilder fills trickle sub-trees like `fillTrickleRec`, taking the
+// leaves from a `h.LeafStream`.
+type streamBuilder struct {
+	db     *h.DagBuilderHelper
+	leaves *h.LeafStream
+	// tc lists the nodes in the order a reader visits them, without the
+	// root.
+	tc *dag.TierCid
+}
+
+func (b *streamBuilder) fill(node *h.FSNodeOverDag, maxDepth int) (ipld.Node, uint64, error) {
+	// The sub-trees are listed before their children, but only known once
+	// the children are linked.
+	self := -1
+	if maxDepth != -1 {
+		self = len(b.tc.NonLeaf)
+		b.tc.NonLeaf = append(b.tc.NonLeaf, cid.Undef)
+	}
+
+	// Fill the node layer, like `db.FillNodeLayer`.
+	for node.NumChildren() < b.db.Maxlinks() && !b.leaves.Done() {
+		child, childFileSize, err := b.leaves.Next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := node.AddChild_mansub(child, childFileSize, b.db, 0); err != nil {
+			return nil, 0, err
+		}
+		b.tc.Leaf = append(b.tc.Leaf, child.Cid())
+	}
+
+	for depth := 1; maxDepth == -1 || depth < maxDepth; depth++ {
+		if b.leaves.Done() {
+			break
+		}
+
+		for repeatIndex := 0; repeatIndex < depthRepeat && !b.leaves.Done(); repeatIndex++ {
+			childNode, childFileSize, err := b.fill(b.db.NewFSNodeOverDag(ft.TFile), depth)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if err := node.AddChild(childNode, childFileSize, b.db); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	filledNode, err := node.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+	if self >= 0 {
+		b.tc.NonLeaf[self] = filledNode.Cid()
+	}
+	return filledNode, node.FileSize(), nil
+}
@@ -13,6 +13,7 @@ import (
 	h "github.com/ipfs/go-unixfs/importer/helpers"
 	uio "github.com/ipfs/go-unixfs/io"
 
+	cid "github.com/ipfs/go-cid"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	u "github.com/ipfs/go-ipfs-util"
 	ipld "github.com/ipfs/go-ipld-format"
@@ -665,3 +666,73 @@ func TestAppendSingleBytesToEmpty(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestStreamLayoutMatchesSequential checks, over random files and builder
+// options, that building with several workers gives the same DAG as the
+// sequential layout, and records its TierCid in the order a reader visits
+// the nodes.
+func TestStreamLayoutMatchesSequential(t *testing.T) {
+	defer func(ring int) { h.StreamBufferChunks = ring }(h.StreamBufferChunks)
+	h.StreamBufferChunks = 8
+
+	chunkers := []string{"", "size-1000", "rabin-1024-8192-32768", "buzhash"}
+	prefixes := []cid.Builder{nil, merkledag.V0CidPrefix(), merkledag.V1CidPrefix()}
+	rnd := mrand.New(mrand.NewSource(1))
+
+	for i := 0; i < 20; i++ {
+		size := rnd.Int63n(2 << 20)
+		if i == 0 {
+			size = 0
+		}
+		data := make([]byte, size)
+		rnd.Read(data)
+
+		dbp := h.DagBuilderParams{
+			Dagserv:    mdtest.Mock(),
+			Maxlinks:   []int{2, 3, 174, h.DefaultLinksPerBlock}[rnd.Intn(4)],
+			RawLeaves:  rnd.Intn(2) == 0,
+			CidBuilder: prefixes[rnd.Intn(len(prefixes))],
+		}
+		chnk := chunkers[rnd.Intn(len(chunkers))]
+
+		build := func(concurrency int) ipld.Node {
+			spl, err := chunker.FromString(bytes.NewReader(data), chnk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dbp.Concurrency = concurrency
+			db, err := dbp.New(spl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nd, err := Layout(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return nd
+		}
+
+		seq := build(1)
+		par := build(4)
+		if !seq.Cid().Equals(par.Cid()) {
+			t.Fatalf("size %d, chunker %q, %+v: sequential root %s, parallel root %s",
+				size, chnk, dbp, seq.Cid(), par.Cid())
+		}
+		if size == 0 {
+			continue
+		}
+
+		tc, ok := merkledag.UnPinBuffer.Remove(par.Cid())
+		if !ok {
+			t.Fatalf("no TierCid recorded for %s", par.Cid())
+		}
+		want, err := merkledag.BuildTierCid(context.Background(), dbp.Dagserv, par.Cid(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(tc.NonLeaf) != fmt.Sprint(want.NonLeaf[1:]) || fmt.Sprint(tc.Leaf) != fmt.Sprint(want.Leaf) {
+			t.Fatalf("size %d, chunker %q, %+v: recorded %+v, expected %+v without the root",
+				size, chnk, dbp, tc, want)
+		}
+	}
+}
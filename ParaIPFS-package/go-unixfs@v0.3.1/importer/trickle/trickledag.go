@@ -36,7 +36,19 @@ const depthRepeat = 4
 // Layout builds a new DAG with the trickle format using the provided
 // DagBuilderHelper. See the module's description for a more detailed
 // explanation.
+//
+// Unless `db.Concurrency()` is 1, the leaves are built by the pipelined
+// `streamLayout`, which produces the same DAG.
 func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
+	if !db.Done() && db.Concurrency() > 1 {
+		root, err := streamLayout(db)
+		if err != nil {
+			return nil, removeWrittenLeaves(db, err)
+		}
+		db.KeepWrittenLeaves()
+		return root, nil
+	}
+
 	newRoot := db.NewFSNodeOverDag(ft.TFile)
 	root, _, err := fillTrickleRec(db, newRoot, -1)
 	if err != nil {
@@ -46,6 +58,15 @@ func Layout(db *h.DagBuilderHelper) (ipld.Node, error) {
 	return root, db.Add(root)
 }
 
+// removeWrittenLeaves deletes the leaves a failed layout managed to store
+// and returns the error it failed with.
+func removeWrittenLeaves(db *h.DagBuilderHelper, err error) error {
+	if rerr := db.RemoveWrittenLeaves(); rerr != nil {
+		return fmt.Errorf("%w (removing the leaves written: %v)", err, rerr)
+	}
+	return err
+}
+
 // fillTrickleRec creates a trickle (sub-)tree with an optional maximum specified depth
 // in the case maxDepth is greater than zero, or with unlimited depth otherwise
 // (where the DAG builder will signal the end of data to end the function).
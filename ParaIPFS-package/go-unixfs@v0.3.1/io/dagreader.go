@@ -4,19 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"math/rand"
-	"os"
-	"path/filepath"
-	"strconv"
-	"sync"
-	"time"
+	"sort"
 
 	proto "github.com/gogo/protobuf/proto"
-	"github.com/ipfs/go-datastore"
-	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	cid "github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	merkledag "github.com/ipfs/go-merkledag"
 	unixfs "github.com/ipfs/go-unixfs"
@@ -106,14 +98,34 @@ func NewDagReader(ctx context.Context, n ipld.Node, serv ipld.NodeGetter) (DagRe
 
 	ctxWithCancel, cancel := context.WithCancel(ctx)
 
-	return &dagReader{
+	dr := &dagReader{
 		ctx:       ctxWithCancel,
 		cancel:    cancel,
 		serv:      serv,
 		size:      size,
 		rootNode:  n,
 		dagWalker: ipld.NewWalker(ctxWithCancel, ipld.NewNavigableIPLDNode(n, serv)),
-	}, nil
+	}
+	if tc := lookupTierCid(ctx, n.Cid()); tc != nil && len(tc.Leaf) > 0 {
+		dr.leaves = tc.Leaf
+	}
+	return dr, nil
+}
+
+// lookupTierCid returns the TierCid recorded for root, if any.
+func lookupTierCid(ctx context.Context, root cid.Cid) *merkledag.TierCid {
+	if err := merkledag.LoadPinBuffer(ctx); err != nil {
+		log.Warnf("cannot load TierCids: %s", err)
+	}
+	merkledag.PinBufferMutex.Lock()
+	tc, ok := merkledag.PinBuffer[root]
+	merkledag.PinBufferMutex.Unlock()
+	if ok {
+		return tc
+	}
+
+	tc, _ = merkledag.UnPinBuffer.Get(root)
+	return tc
 }
 
 // dagReader provides a way to easily read the data contained in a dag.
@@ -149,6 +161,16 @@ type dagReader struct {
 	// Passed to the `dagWalker` that will use it to request nodes.
 	// TODO: Revisit name.
 	serv ipld.NodeGetter
+
+	// Leaves of the file, in order, when its TierCid is known. The reader
+	// then fetches them through `prefetch` instead of the `dagWalker`.
+	leaves []cid.Cid
+	// File offset at which each of the `leaves` ends, computed on the
+	// first `Seek`.
+	leafEnds []int64
+	// Fetches the leaves ahead of the read head; nil until the first read
+	// from the beginning of the file.
+	prefetch *leafPrefetcher
 }
 
 // Size returns the total size of the data from the DAG structured file.
@@ -184,6 +206,16 @@ func (dr *dagReader) CtxReadFull(ctx context.Context, out []byte) (n int, err er
 		}
 	}
 
+	if dr.leaves != nil {
+		for n < len(out) {
+			if err := dr.nextLeaf(ctx); err != nil {
+				return n, err
+			}
+			n += dr.readNodeDataBuffer(out[n:])
+		}
+		return n, nil
+	}
+
 	// Iterate the DAG calling the passed `Visitor` function on every node
 	// to read its data into the `out` buffer, stop if there is an error or
 	// if the entire DAG is traversed (`EndOfDag`).
@@ -289,15 +321,6 @@ func (dr *dagReader) writeNodeDataBuffer(w io.Writer) (int64, error) {
 }
 
 ///////////////////////////////////// wrriten by mssong
-func encode(key datastore.Key) (file string) {
-	extension := ".data"
-	noslash := key.String()[1:]
-	datastorePath := merkledag.IPFS_Path + "/blocks"
-
-	dir := filepath.Join(datastorePath, noslash[len(noslash)-3:len(noslash)-1])
-	file = filepath.Join(dir, noslash+extension)
-	return file
-}
 
 // UnwrapData unmarshals a protobuf messages and returns the contents.
 func UnwrapData(data []byte) ([]byte, error) {
@@ -309,134 +332,55 @@ func UnwrapData(data []byte) ([]byte, error) {
 	return pbdata.GetData(), nil
 }
 
-func createFile(f *os.File, tc *merkledag.TierCid) (size int64, err error) {
-	wg := sync.WaitGroup{}
-	rawData := make([][]byte, len(tc.Leaf))
-	// ff, err := os.Create("/home/mssong/zzzzzzz")
-	for i := 0; i < len(tc.Leaf); i++ {
-		wg.Add(1)
-		go func(i int) {
-
-			defer wg.Done()
-			leafCid := tc.Leaf[i]
-			dsKey := dshelp.MultihashToDsKey(leafCid.Hash())
-			// fmt.Println("dsKey:", dsKey.String())
-			filePath := encode(dsKey)
-			// fmt.Println("filePath:", filePath)
-			dat, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				panic(err)
-			}
-
-			// fmt.Println("filePath:", filePath, "data len:", len(dat))
-
-			node, err := merkledag.DecodeProtobuf(dat)
-			if err != nil {
-				panic(err)
-			}
-
-			rawData[i], err = UnwrapData(node.Data())
-
-			if err != nil {
-				panic(err)
-			}
-
-		}(i)
-
+// leafData returns the file data held by a leaf node.
+func leafData(nd ipld.Node) ([]byte, error) {
+	switch nd := nd.(type) {
+	case *merkledag.RawNode:
+		return nd.RawData(), nil
+	case *merkledag.ProtoNode:
+		return UnwrapData(nd.Data())
+	default:
+		return nil, ErrUnkownNodeType
 	}
-	wg.Wait()
-
-	st_1 := time.Now()
-	for i := 0; i < len(rawData); i++ {
+}
 
-		f.Write(rawData[i])
+// nextLeaf loads the data of the next leaf in `leaves` into the
+// `currentNodeData` buffer, starting the prefetcher from the beginning of
+// the file if no `Seek` did it yet. It returns `io.EOF` after the last leaf.
+func (dr *dagReader) nextLeaf(ctx context.Context) error {
+	if dr.prefetch == nil {
+		dr.prefetch = newLeafPrefetcher(dr.ctx, dr.serv, dr.leaves, readAhead(dr.ctx), 0)
 	}
-	elap_1 := time.Since(st_1)
-	elap_1 = elap_1
-	// fmt.Println("elap_1:", elap_1)
 
-	fileInfo, err := f.Stat()
+	data, err := dr.prefetch.next(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return fileInfo.Size(), nil
+	dr.currentNodeData = bytes.NewReader(data)
+	return nil
 }
 
-func createFile_2(f *os.File, tc *merkledag.TierCid) (size int64, err error) {
-	wg := sync.WaitGroup{}
-	len_leaf := len(tc.Leaf)
-	rawData := make([][]byte, len_leaf)
-	// fmt.Println("len_leaf:", len_leaf)
-	count := len_leaf / merkledag.NumThread
-	if len_leaf%merkledag.NumThread != 0 {
-		count = count + 1
-	}
-	// fmt.Println("count: ", count)
-	var cc = 0
-	// var mutex sync.RWMutex
-	for i := 0; i < merkledag.NumThread; i++ {
-		if len_leaf <= i {
-			// fmt.Println("i: ", i)
-			break
+// seekLeaves restarts the prefetcher at the leaf holding `offset`.
+func (dr *dagReader) seekLeaves(offset int64) error {
+	if dr.leafEnds == nil {
+		known := make(map[cid.Cid]struct{}, len(dr.leaves))
+		for _, c := range dr.leaves {
+			known[c] = struct{}{}
 		}
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-			for j := 0; j < count; j++ {
-				interval := (i * count) + j
-				if interval >= len_leaf {
-					break
-				}
-				cc++
-				// fmt.Println("interval, i, j", interval, i, j, cc, count)
-				leafCid := tc.Leaf[interval]
-				dsKey := dshelp.MultihashToDsKey(leafCid.Hash())
-				// fmt.Println("dsKey:", dsKey.String())
-				filePath := encode(dsKey)
-				// fmt.Println("filePath:", filePath)
-				dat, err := ioutil.ReadFile(filePath)
-				// fmt.Println("filePath:", filePath, "data len:", len(dat))
-				if err != nil {
-					panic(err)
-				}
-				if dat == nil {
-					fmt.Println("data is nil")
-					continue
-				}
-				node, err := merkledag.DecodeProtobuf(dat)
-				if err != nil {
-					panic(err)
-				}
-
-				rawData[interval], err = UnwrapData(node.Data())
-				if err != nil {
-					panic(err)
-				}
-				// mutex.Lock()
-				// f.WriteAt(rawData[interval], int64(interval*256*1024))
-				// mutex.Unlock()
-			}
-
-		}(i)
-
-	}
-	wg.Wait()
-
-	// fmt.Println("len_leaf:", len_leaf)
-	st_1 := time.Now()
-	for i := 0; i < len(rawData); i++ {
-
-		f.Write(rawData[i])
+		leaves, ends, err := leafLayout(dr.ctx, dr.serv, dr.rootNode, known)
+		if err != nil {
+			return err
+		}
+		dr.leaves, dr.leafEnds = leaves, ends
 	}
-	elap_1 := time.Since(st_1)
-	elap_1 = elap_1
-	fmt.Println("write time:", elap_1)
 
-	fileInfo, err := f.Stat()
-	if err != nil {
-		panic(err)
+	i := sort.Search(len(dr.leafEnds), func(i int) bool { return dr.leafEnds[i] > offset })
+	var start int64
+	if i > 0 {
+		start = dr.leafEnds[i-1]
 	}
-	return fileInfo.Size(), nil
+	dr.prefetch = newLeafPrefetcher(dr.ctx, dr.serv, dr.leaves[i:], readAhead(dr.ctx), offset-start)
+	return nil
 }
 
 ///////////////////////////////////// wrriten by mssong
@@ -446,12 +390,21 @@ func createFile_2(f *os.File, tc *merkledag.TierCid) (size int64, err error) {
 // where it starts from the internal index that may have
 // been modified by other `Read` calls.
 //
+// When the TierCid of the file is known its leaves are fetched in
+// parallel, `ReadAheadLeaves` (or as many as set with `WithReadAhead`) at a
+// time, and written to `w` in order.
+// Otherwise the DAG is walked and, if the whole file is written, its
+// TierCid is recorded in `merkledag.UnPinBuffer` for the next reads.
+//
 // TODO: This implementation is very similar to `CtxReadFull`,
 // the common parts should be abstracted away.
 func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 
 	dr.dagWalker.SetContext(dr.ctx)
 
+	// Only a traversal of the whole DAG gives its TierCid.
+	fromStart := dr.offset == 0 && dr.currentNodeData == nil
+
 	// If there was a partially read buffer from the last visited
 	// node read it before visiting a new one.
 	if dr.currentNodeData != nil {
@@ -461,82 +414,63 @@ func (dr *dagReader) WriteTo(w io.Writer) (n int64, err error) {
 		}
 	}
 
-	tc_Pin, exist_Pin := merkledag.PinBuffer[dr.rootNode.Cid()]
-	tc_UnPin, exist_Unpin := merkledag.UnPinBuffer[dr.rootNode.Cid()]
-
-	tc_Pin = tc_Pin
-	tc_UnPin = tc_UnPin
-
-	fileName := merkledag.IPFS_DownloadPath + "/" + dr.rootNode.Cid().String() + strconv.Itoa(rand.Intn(10000000))
-	_, err = os.Stat(fileName)
-	if err == nil {
-		fmt.Println("exist file!", fileName)
-		return 0, nil
-	}
-
-	f, err := os.Create(fileName)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	if exist_Pin {
-
-		n, err = createFile_2(f, tc_Pin)
-	} else if exist_Unpin {
-
-		n, err = createFile_2(f, tc_UnPin)
-	} else {
-		dagCid := merkledag.NewTierCid()
-		//////////////////////////////////////////////////////////////////////////////////////////////////
-
-		// Iterate the DAG calling the passed `Visitor` function on every node
-		// to read its data into the `out` buffer, stop if there is an error or
-		// if the entire DAG is traversed (`EndOfDag`).
-		err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
-			// debug.PrintStack()
-			node := ipld.ExtractIPLDNode(visitedNode)
-			// Skip internal nodes, they shouldn't have any file data
-			// (see the `balanced` package for more details).
-			if len(node.Links()) > 0 {
-				// fmt.Println("rootNode.Cid():", dr.rootNode.Cid())
-				dagCid.NonLeaf = append(dagCid.NonLeaf, node.Cid())
-				return nil
+	if dr.leaves != nil {
+		for {
+			err = dr.nextLeaf(dr.ctx)
+			if err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return n, err
 			}
 
-			dagCid.Leaf = append(dagCid.Leaf, node.Cid())
-
-			err = dr.saveNodeData(node)
-			if err != nil {
-				return err
-			}
-
-			////////////////////////////////////////////////////////////////////////////////////////////////////////////
-			// Save the leaf node file data in a buffer in case it is only
-			// partially read now and future `CtxReadFull` calls reclaim the
-			// rest (as each node is visited only once during `Iterate`).
 			written, err := dr.writeNodeDataBuffer(w)
 			n += written
 			if err != nil {
-				return err
+				return n, err
 			}
-			////////////////////////////////////////////////////////////////////////////////////////////////////////////
+		}
+	}
 
+	dagCid := merkledag.NewTierCid()
+
+	// Iterate the DAG calling the passed `Visitor` function on every node
+	// to read its data into the `out` buffer, stop if there is an error or
+	// if the entire DAG is traversed (`EndOfDag`).
+	err = dr.dagWalker.Iterate(func(visitedNode ipld.NavigableNode) error {
+		node := ipld.ExtractIPLDNode(visitedNode)
+		// Skip internal nodes, they shouldn't have any file data
+		// (see the `balanced` package for more details).
+		if len(node.Links()) > 0 {
+			dagCid.NonLeaf = append(dagCid.NonLeaf, node.Cid())
 			return nil
-		})
-		merkledag.UnPinBuffer[dr.rootNode.Cid()] = dagCid
-		// merkledag.PrintUnPinBuffer(dr.rootNode.Cid())
-		//////////////////////////////////////////////////////////////////////////////////////////////////
+		}
 
-		// fmt.Printf("merkledag.UnpinnedCidMap:%+v\n", merkledag.UnpinnedCidMap)
+		dagCid.Leaf = append(dagCid.Leaf, node.Cid())
 
-		if err == ipld.EndOfDag {
-			return n, nil
+		err = dr.saveNodeData(node)
+		if err != nil {
+			return err
 		}
+		// Save the leaf node file data in a buffer in case it is only
+		// partially read now and future `CtxReadFull` calls reclaim the
+		// rest (as each node is visited only once during `Iterate`).
+		written, err := dr.writeNodeDataBuffer(w)
+		n += written
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
 
+	if err == ipld.EndOfDag {
+		if fromStart {
+			merkledag.UnPinBuffer.Add(dr.rootNode.Cid(), dagCid)
+		}
+		return n, nil
 	}
-	return n, err
 
+	return n, err
 }
 
 // Close the reader (cancelling fetch node operations requested with
@@ -577,6 +511,19 @@ func (dr *dagReader) Seek(offset int64, whence int) (int64, error) {
 			return 0, nil
 		}
 
+		if dr.leaves != nil {
+			err := dr.seekLeaves(offset)
+			if err == nil {
+				dr.offset = offset
+				return dr.offset, nil
+			} else if err != ErrSeekNotSupported {
+				return 0, err
+			}
+			// Without size hints the leaves can't be located, keep
+			// reading through the `dagWalker` from now on.
+			dr.leaves = nil
+		}
+
 		// Use the internal reader's context to fetch the child node promises
 		// (see `ipld.NavigableIPLDNode.FetchChild` for details).
 		dr.dagWalker.SetContext(dr.ctx)
@@ -694,6 +641,11 @@ func (dr *dagReader) resetPosition() {
 	dr.currentNodeData = nil
 	dr.offset = 0
 
+	if dr.prefetch != nil {
+		dr.prefetch.close()
+		dr.prefetch = nil
+	}
+
 	dr.dagWalker = ipld.NewWalker(dr.ctx, ipld.NewNavigableIPLDNode(dr.rootNode, dr.serv))
 	// TODO: This could be avoided (along with storing the `dr.rootNode` and
 	// `dr.serv` just for this call) if `Reset` is supported in the `Walker`.
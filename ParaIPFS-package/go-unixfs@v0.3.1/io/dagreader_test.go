@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	ipld "github.com/ipfs/go-ipld-format"
 	mdag "github.com/ipfs/go-merkledag"
 	"github.com/ipfs/go-unixfs"
 
@@ -325,3 +326,82 @@ func getOffset(reader DagReader) int64 {
 	}
 	return offset
 }
+
+// getTierCidReader returns a reader of node that reads through its TierCid,
+// recorded by a first WriteTo through the DAG walker.
+func getTierCidReader(t *testing.T, ctx context.Context, node ipld.Node, dserv ipld.DAGService) DagReader {
+	first, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.WriteTo(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.(*dagReader).leaves == nil {
+		t.Fatal("expected the reader to use the recorded TierCid")
+	}
+	return reader
+}
+
+func TestTierCidWriteTo(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GetRandomNode(t, dserv, 100*1024, testu.UseRawLeaves)
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	ctx = WithReadAhead(ctx, 4)
+	if n, ok := ReadAheadFromContext(ctx); !ok || n != 4 {
+		t.Fatalf("expected a read-ahead of 4 leaves, got %d", n)
+	}
+	reader := getTierCidReader(t, ctx, node, dserv)
+
+	// Start in the middle of a leaf.
+	if _, err := reader.Seek(1234, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	outbuf := new(bytes.Buffer)
+	n, err := reader.WriteTo(outbuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(inbuf)-1234) {
+		t.Fatalf("wrote %d bytes, expected %d", n, len(inbuf)-1234)
+	}
+	if err := testu.ArrComp(inbuf[1234:], outbuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTierCidSeekAndRead(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GetRandomNode(t, dserv, 100*1024, testu.UseProtoBufLeaves)
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader := getTierCidReader(t, ctx, node, dserv)
+
+	// Ranges like the ones of HTTP Range requests.
+	ranges := [][2]int64{{0, 10}, {499, 2}, {500, 1500}, {77777, 22223}, {100*1024 - 1, 1}, {3, 100 * 1024}}
+	for _, r := range ranges {
+		if _, err := reader.Seek(r[0], io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, r[1])
+		n, err := io.ReadFull(reader, out)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		end := r[0] + int64(n)
+		if err := testu.ArrComp(inbuf[r[0]:end], out[:n]); err != nil {
+			t.Fatalf("range %v: %s", r, err)
+		}
+		if getOffset(reader) != end {
+			t.Fatalf("range %v: offset %d, expected %d", r, getOffset(reader), end)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package io
+
+import (
+	"context"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	unixfs "github.com/ipfs/go-unixfs"
+)
+
+// ReadAheadLeaves is the number of leaves a dagReader with a known TierCid
+// fetches ahead of the one being read.
+var ReadAheadLeaves = 64
+
+type readAheadKey struct{}
+
+// WithReadAhead returns a context that makes the dagReaders created with it
+// fetch n leaves ahead instead of ReadAheadLeaves.
+func WithReadAhead(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, readAheadKey{}, n)
+}
+
+// ReadAheadFromContext returns the number of leaves set with WithReadAhead,
+// if any.
+func ReadAheadFromContext(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(readAheadKey{}).(int)
+	return n, ok && n > 0
+}
+
+type partialReadKey struct{}
+
+// WithPartialRead returns a context marking the reads done with it as
+// reading part of their files only, like ranged reads, which do not need the
+// whole DAG of the files fetched ahead of them.
+func WithPartialRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, partialReadKey{}, true)
+}
+
+// PartialReadFromContext reports whether ctx was returned by
+// WithPartialRead.
+func PartialReadFromContext(ctx context.Context) bool {
+	partial, _ := ctx.Value(partialReadKey{}).(bool)
+	return partial
+}
+
+// readAhead returns the number of leaves to fetch ahead for a dagReader
+// created with ctx.
+func readAhead(ctx context.Context) int {
+	if n, ok := ReadAheadFromContext(ctx); ok {
+		return n
+	}
+	return ReadAheadLeaves
+}
+
+// leafFuture is the data of a leaf being fetched by a leafPrefetcher.
+type leafFuture struct {
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+// leafPrefetcher fetches a list of leaves concurrently, keeping at most a
+// window of them ahead of the consumer, and hands their data out in order.
+type leafPrefetcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	futures chan *leafFuture
+	// pending is a leaf taken from futures whose wait was interrupted.
+	pending *leafFuture
+	// skip is the amount of data to drop from the first leaf, when reading
+	// starts in the middle of it.
+	skip int64
+}
+
+func newLeafPrefetcher(ctx context.Context, serv ipld.NodeGetter, leaves []cid.Cid, window int, skip int64) *leafPrefetcher {
+	if window < 1 {
+		window = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &leafPrefetcher{
+		ctx:     ctx,
+		cancel:  cancel,
+		futures: make(chan *leafFuture, window),
+		skip:    skip,
+	}
+
+	go func() {
+		defer close(p.futures)
+		for _, c := range leaves {
+			f := &leafFuture{done: make(chan struct{})}
+			select {
+			case p.futures <- f:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(c cid.Cid) {
+				defer close(f.done)
+				nd, err := serv.Get(ctx, c)
+				if err != nil {
+					f.err = err
+					return
+				}
+				f.data, f.err = leafData(nd)
+			}(c)
+		}
+	}()
+	return p
+}
+
+// next returns the data of the next leaf, or io.EOF after the last one.
+func (p *leafPrefetcher) next(ctx context.Context) ([]byte, error) {
+	f := p.pending
+	if f == nil {
+		var ok bool
+		select {
+		case f, ok = <-p.futures:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !ok {
+			if err := p.ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+	}
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		p.pending = f
+		return nil, ctx.Err()
+	}
+	p.pending = nil
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	data := f.data
+	if p.skip > 0 {
+		if p.skip > int64(len(data)) {
+			p.skip = int64(len(data))
+		}
+		data = data[p.skip:]
+		p.skip = 0
+	}
+	return data, nil
+}
+
+// close stops the fetches still in flight.
+func (p *leafPrefetcher) close() {
+	p.cancel()
+}
+
+// leafLayout walks the internal nodes of the file DAG under root and
+// returns its leaves in reading order, along with the file offset at which
+// each of them ends. Children in known (or raw ones) are taken to be leaves
+// without fetching them; the sizes come from the size hints of the
+// parents, so ErrSeekNotSupported is returned when those are missing.
+func leafLayout(ctx context.Context, serv ipld.NodeGetter, root ipld.Node, known map[cid.Cid]struct{}) (leaves []cid.Cid, ends []int64, err error) {
+	if len(root.Links()) == 0 {
+		data, err := leafData(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []cid.Cid{root.Cid()}, []int64{int64(len(data))}, nil
+	}
+
+	var offset int64
+	var walk func(nd ipld.Node) error
+	walk = func(nd ipld.Node) error {
+		fsNode, err := unixfs.ExtractFSNode(nd)
+		if err != nil {
+			return err
+		}
+		if fsNode.NumChildren() != len(nd.Links()) {
+			return ErrSeekNotSupported
+		}
+
+		for i, l := range nd.Links() {
+			leaf := l.Cid.Type() == cid.Raw
+			if !leaf {
+				_, leaf = known[l.Cid]
+			}
+			if !leaf {
+				child, err := l.GetNode(ctx, serv)
+				if err != nil {
+					return err
+				}
+				if len(child.Links()) > 0 {
+					if err := walk(child); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			offset += int64(fsNode.BlockSize(i))
+			leaves = append(leaves, l.Cid)
+			ends = append(ends, offset)
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, nil, err
+	}
+	return leaves, ends, nil
+}
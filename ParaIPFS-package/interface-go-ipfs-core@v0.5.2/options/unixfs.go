@@ -36,6 +36,8 @@ type UnixfsAddSettings struct {
 	Events   chan<- interface{}
 	Silent   bool
 	Progress bool
+
+	Threads int
 }
 
 type UnixfsLsSettings struct {
@@ -66,6 +68,8 @@ func UnixfsAddOptions(opts ...UnixfsAddOption) (*UnixfsAddSettings, cid.Prefix,
 		Events:   nil,
 		Silent:   false,
 		Progress: false,
+
+		Threads: 0,
 	}
 
 	for _, opt := range opts {
@@ -277,6 +281,18 @@ func (unixfsOpts) Nocopy(enable bool) UnixfsAddOption {
 	}
 }
 
+// Threads sets the number of workers that build and store the leaves of
+// the files added. Default: the node's Parallel.Import setting
+func (unixfsOpts) Threads(n int) UnixfsAddOption {
+	return func(settings *UnixfsAddSettings) error {
+		if n < 0 {
+			return fmt.Errorf("invalid number of threads: %d", n)
+		}
+		settings.Threads = n
+		return nil
+	}
+}
+
 func (unixfsOpts) ResolveChildren(resolve bool) UnixfsLsOption {
 	return func(settings *UnixfsLsSettings) error {
 		settings.ResolveChildren = resolve
@@ -9,6 +9,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	bs "github.com/ipfs/go-ipfs-blockstore"
 	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
 )
 
 // RemovedBlock is used to represent the result of removing a block.
@@ -45,6 +46,10 @@ func RmBlocks(ctx context.Context, blocks bs.GCBlockstore, pins pin.Pinner, cids
 
 		stillOkay := FilterPinned(ctx, pins, out, cids)
 
+		var removed []cid.Cid
+		// The cached TierCids listing a removed block are stale.
+		defer func() { dag.UnPinBuffer.Invalidate(removed...) }()
+
 		for _, c := range stillOkay {
 			// Kept for backwards compatibility. We may want to
 			// remove this sometime in the future.
@@ -61,7 +66,10 @@ func RmBlocks(ctx context.Context, blocks bs.GCBlockstore, pins pin.Pinner, cids
 			err = blocks.DeleteBlock(ctx, c)
 			if err != nil {
 				out <- &RemovedBlock{Hash: c.String(), Error: err.Error()}
-			} else if !opts.Quiet {
+				continue
+			}
+			removed = append(removed, c)
+			if !opts.Quiet {
 				out <- &RemovedBlock{Hash: c.String()}
 			}
 		}
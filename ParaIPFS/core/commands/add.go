@@ -45,6 +45,7 @@ const (
 	hashOptionName        = "hash"
 	inlineOptionName      = "inline"
 	inlineLimitOptionName = "inline-limit"
+	threadsOptionName     = "threads"
 )
 
 const adderOutChanSize = 8
@@ -140,6 +141,7 @@ only-hash, and progress/status related flags) will change the final hash.
 		cmds.StringOption(hashOptionName, "Hash function to use. Implies CIDv1 if not sha2-256. (experimental)").WithDefault("sha2-256"),
 		cmds.BoolOption(inlineOptionName, "Inline small blocks into CIDs. (experimental)"),
 		cmds.IntOption(inlineLimitOptionName, "Maximum block size to inline. (experimental)").WithDefault(32),
+		cmds.IntOption(threadsOptionName, "Number of workers importing the files and building their DAGs. Defaults to Parallel.Import in the config."),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		quiet, _ := req.Options[quietOptionName].(bool)
@@ -180,6 +182,7 @@ only-hash, and progress/status related flags) will change the final hash.
 		hashFunStr, _ := req.Options[hashOptionName].(string)
 		inline, _ := req.Options[inlineOptionName].(bool)
 		inlineLimit, _ := req.Options[inlineLimitOptionName].(int)
+		threads, _ := req.Options[threadsOptionName].(int)
 
 		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
 		if !ok {
@@ -213,6 +216,8 @@ only-hash, and progress/status related flags) will change the final hash.
 
 			options.Unixfs.Progress(progress),
 			options.Unixfs.Silent(silent),
+
+			options.Unixfs.Threads(threads),
 		}
 
 		if cidVerSet {
@@ -324,9 +329,10 @@ only-hash, and progress/status related flags) will change the final hash.
 					bar.Start()
 				}
 
-				lastFile := ""
 				lastHash := ""
-				var totalProgress, prevFiles, lastBytes int64
+				// Several files are imported at once, so their progress
+				// events are interleaved.
+				fileBytes := make(map[string]int64)
 
 			LOOP:
 				for {
@@ -350,6 +356,7 @@ only-hash, and progress/status related flags) will change the final hash.
 								// clear progress bar line before we print "added x" output
 								fmt.Fprintf(os.Stderr, "\033[2K\r")
 							}
+							delete(fileBytes, output.Name)
 							if quiet {
 								fmt.Fprintf(os.Stdout, "%s\n", output.Hash)
 							} else {
@@ -361,16 +368,13 @@ only-hash, and progress/status related flags) will change the final hash.
 								continue
 							}
 
-							if len(lastFile) == 0 {
-								lastFile = output.Name
-							}
-							if output.Name != lastFile || output.Bytes < lastBytes {
-								prevFiles += lastBytes
-								lastFile = output.Name
+							delta := output.Bytes - fileBytes[output.Name]
+							if delta < 0 {
+								// Another file of the same name.
+								delta = output.Bytes
 							}
-							lastBytes = output.Bytes
-							delta := prevFiles + lastBytes - totalProgress
-							totalProgress = bar.Add64(delta)
+							fileBytes[output.Name] = output.Bytes
+							bar.Add64(delta)
 						}
 
 						if progress {
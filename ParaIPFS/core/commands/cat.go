@@ -10,6 +10,7 @@ import (
 
 	"github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs-files"
+	uio "github.com/ipfs/go-unixfs/io"
 	"github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/path"
 )
@@ -117,6 +118,9 @@ func cat(ctx context.Context, api iface.CoreAPI, paths []string, offset int64, m
 	if max == 0 {
 		return nil, 0, nil
 	}
+	if offset > 0 || max > 0 {
+		ctx = uio.WithPartialRead(ctx)
+	}
 	for _, p := range paths {
 		f, err := api.Unixfs().Get(ctx, path.New(p))
 		if err != nil {
@@ -112,6 +112,9 @@ func TestCommands(t *testing.T) {
 		"/dag/put",
 		"/dag/resolve",
 		"/dag/stat",
+		"/dag/tiercid",
+		"/dag/tiercid/install",
+		"/dag/tiercid/verify",
 		"/dht",
 		"/dht/findpeer",
 		"/dht/findprovs",
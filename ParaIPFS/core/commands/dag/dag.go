@@ -40,6 +40,7 @@ to deprecate and replace the existing 'ipfs object' command moving forward.
 		"import":  DagImportCmd,
 		"export":  DagExportCmd,
 		"stat":    DagStatCmd,
+		"tiercid": DagTierCidCmd,
 	},
 }
 
@@ -319,3 +320,142 @@ Note: This command skips duplicate blocks in reporting both size and the number
 		}),
 	},
 }
+
+// DagTierCidCmd groups the commands inspecting the TierCids recorded for
+// DAG roots.
+var DagTierCidCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the TierCids recorded for DAG roots.",
+		ShortDescription: `
+A TierCid lists the internal (non-leaf) and the leaf nodes of a DAG. It is
+recorded when a file is added and persisted when its root is pinned, so that
+garbage collection and reads do not have to walk the DAG.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"verify":  DagTierCidVerifyCmd,
+		"install": DagTierCidInstallCmd,
+	},
+}
+
+// TierCidVerifyOutput is the output type of 'dag tiercid verify'
+type TierCidVerifyOutput struct {
+	Root cid.Cid
+	// Source is where the TierCid was found: "unpinned" (UnPinBuffer),
+	// "pinned" (PinBuffer) or "stored" (the datastore).
+	Source string
+
+	NonLeaf int
+	Leaf    int
+
+	MissingNonLeaf []cid.Cid `json:",omitempty"`
+	MissingLeaf    []cid.Cid `json:",omitempty"`
+	ExtraNonLeaf   []cid.Cid `json:",omitempty"`
+	ExtraLeaf      []cid.Cid `json:",omitempty"`
+}
+
+// DagTierCidVerifyCmd checks the TierCid of a root against its DAG
+var DagTierCidVerifyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check the TierCid of a root against its DAG.",
+		ShortDescription: `
+'ipfs dag tiercid verify' walks the DAG under a root and compares its nodes
+with the TierCid recorded for it, listing the nodes missing from each tier and
+the recorded entries that are not part of the DAG. The order of the entries
+is not compared, and neither is the root itself.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "CID of the DAG root to verify").EnableStdin(),
+	},
+	Run:  dagTierCidVerify,
+	Type: TierCidVerifyOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *TierCidVerifyOutput) error {
+			enc, err := cmdenv.GetLowLevelCidEncoder(req)
+			if err != nil {
+				return err
+			}
+
+			for _, list := range []struct {
+				name string
+				cids []cid.Cid
+			}{
+				{"missing non-leaf", out.MissingNonLeaf},
+				{"missing leaf", out.MissingLeaf},
+				{"extra non-leaf", out.ExtraNonLeaf},
+				{"extra leaf", out.ExtraLeaf},
+			} {
+				for _, c := range list.cids {
+					fmt.Fprintf(w, "%s\t%s\n", list.name, enc.Encode(c))
+				}
+			}
+
+			problems := len(out.MissingNonLeaf) + len(out.MissingLeaf) + len(out.ExtraNonLeaf) + len(out.ExtraLeaf)
+			if problems == 0 {
+				fmt.Fprintf(w, "%s TierCid of %s matches its DAG (%d non-leaf, %d leaf nodes)\n",
+					out.Source, enc.Encode(out.Root), out.NonLeaf, out.Leaf)
+			} else {
+				fmt.Fprintf(w, "%s TierCid of %s has %d wrong entries\n",
+					out.Source, enc.Encode(out.Root), problems)
+			}
+			return nil
+		}),
+	},
+}
+
+// TierCidInstallOutput is the output type of 'dag tiercid install'
+type TierCidInstallOutput struct {
+	Root cid.Cid
+	// Source is where the TierCid was installed: "unpinned" (UnPinBuffer)
+	// or "stored" (the datastore and PinBuffer). When Kept is set, it is
+	// where the TierCid already recorded for Root is, as in
+	// TierCidVerifyOutput.
+	Source string
+	// Kept is set when a TierCid was already recorded for Root, which was
+	// kept instead of the given one.
+	Kept bool
+
+	NonLeaf int
+	Leaf    int
+}
+
+// DagTierCidInstallCmd installs a serialized TierCid for a root
+var DagTierCidInstallCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Install the TierCid of a root from a block.",
+		ShortDescription: `
+'ipfs dag tiercid install' reads a TierCid serialized in a block, fetching the
+block if needed, and records it as the TierCid of the given root. When the
+root is pinned recursively, the TierCid is stored with the pin. Otherwise it
+is used when the root gets pinned, instead of walking its DAG again.
+
+The DAG of the root is never fetched to check the TierCid. When the root is
+pinned, its DAG is local and the TierCid is refused if it does not match it.
+Otherwise it is checked when the root gets pinned, and replaced if it is
+wrong. A TierCid already recorded for the root, such as the one of a file
+added to this node, is kept instead.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "CID of the DAG root"),
+		cmds.StringArg("tiercid", true, false, "CID of the block holding the serialized TierCid"),
+	},
+	Run:  dagTierCidInstall,
+	Type: TierCidInstallOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *TierCidInstallOutput) error {
+			enc, err := cmdenv.GetLowLevelCidEncoder(req)
+			if err != nil {
+				return err
+			}
+			verb := "installed"
+			if out.Kept {
+				verb = "kept"
+			}
+			fmt.Fprintf(w, "%s %s TierCid of %s (%d non-leaf, %d leaf nodes)\n",
+				verb, out.Source, enc.Encode(out.Root), out.NonLeaf, out.Leaf)
+			return nil
+		}),
+	},
+}
@@ -0,0 +1,187 @@
+package dagcmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	mdag "github.com/ipfs/go-merkledag"
+)
+
+func dagTierCidVerify(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+
+	rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+	if err != nil {
+		return err
+	}
+	if len(rp.Remainder()) > 0 {
+		return fmt.Errorf("can only verify the TierCid of a DAG root CID")
+	}
+	root := rp.Cid()
+
+	tc, source, err := recordedTierCid(req.Context, n, root)
+	if err != nil {
+		return err
+	}
+
+	want, err := mdag.BuildTierCid(req.Context, mdag.NewSession(req.Context, n.DAG), root, nil)
+	if err != nil {
+		return fmt.Errorf("error walking DAG: %w", err)
+	}
+	diff := mdag.DiffTierCid(root, tc, want)
+
+	return res.Emit(&TierCidVerifyOutput{
+		Root:           root,
+		Source:         source,
+		NonLeaf:        len(want.NonLeaf),
+		Leaf:           len(want.Leaf),
+		MissingNonLeaf: diff.MissingNonLeaf,
+		MissingLeaf:    diff.MissingLeaf,
+		ExtraNonLeaf:   diff.ExtraNonLeaf,
+		ExtraLeaf:      diff.ExtraLeaf,
+	})
+}
+
+func dagTierCidInstall(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+
+	rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+	if err != nil {
+		return err
+	}
+	if len(rp.Remainder()) > 0 {
+		return fmt.Errorf("can only install the TierCid of a DAG root CID")
+	}
+	root := rp.Cid()
+
+	r, err := api.Block().Get(req.Context, path.New(req.Arguments[1]))
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	tc, err := mdag.UnmarshalTierCid(data)
+	if err != nil {
+		return err
+	}
+
+	tc, source, kept, err := installTierCid(req.Context, n, root, tc)
+	if err != nil {
+		return err
+	}
+
+	return res.Emit(&TierCidInstallOutput{
+		Root:    root,
+		Source:  source,
+		Kept:    kept,
+		NonLeaf: len(tc.NonLeaf),
+		Leaf:    len(tc.Leaf),
+	})
+}
+
+// installTierCid records tc as the TierCid of root. When root is pinned
+// recursively its DAG is local, and tc is checked against it and stored
+// next to the pin. Otherwise tc is trusted for now and kept unverified in
+// UnPinBuffer; the pinner checks it when it fetches the DAG of root. The DAG
+// is never fetched here. A TierCid already recorded for root, like the one
+// of a DAG built by this node, is never replaced: it is returned instead,
+// with kept set. The source returned is where the TierCid is, as
+// recordedTierCid names it.
+func installTierCid(ctx context.Context, n *core.IpfsNode, root cid.Cid, tc *mdag.TierCid) (_ *mdag.TierCid, source string, kept bool, err error) {
+	recorded, source, ok, err := lookupTierCid(ctx, n, root)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if ok {
+		return recorded, source, true, nil
+	}
+
+	_, pinned, err := n.Pinning.IsPinnedWithType(ctx, root, pin.Recursive)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !pinned {
+		mdag.UnPinBuffer.AddUnverified(root, tc)
+		return tc, "unpinned", false, nil
+	}
+
+	local := mdag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+	want, err := mdag.BuildTierCid(ctx, local, root, nil)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("error walking DAG: %w", err)
+	}
+	if diff := mdag.DiffTierCid(root, tc, want); !diff.Empty() {
+		return nil, "", false, fmt.Errorf("the TierCid does not match the DAG of %s: %d non-leaf and %d leaf nodes missing, %d non-leaf and %d leaf nodes not in the DAG",
+			root, len(diff.MissingNonLeaf), len(diff.MissingLeaf), len(diff.ExtraNonLeaf), len(diff.ExtraLeaf))
+	}
+	return tc, "stored", false, mdag.NewTierCidStore(n.Repo.Datastore()).Put(ctx, root, tc)
+}
+
+// recordedTierCid looks the TierCid of root up where the node keeps it: in
+// UnPinBuffer until the root is pinned, then in PinBuffer and the datastore.
+func recordedTierCid(ctx context.Context, n *core.IpfsNode, root cid.Cid) (*mdag.TierCid, string, error) {
+	tc, source, ok, err := lookupTierCid(ctx, n, root)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("no TierCid recorded for %s", root)
+	}
+	return tc, source, nil
+}
+
+// lookupTierCid is recordedTierCid, with ok false when no TierCid is
+// recorded for root.
+func lookupTierCid(ctx context.Context, n *core.IpfsNode, root cid.Cid) (_ *mdag.TierCid, source string, ok bool, err error) {
+	tc, ok := mdag.UnPinBuffer.Peek(root)
+	if ok {
+		return tc, "unpinned", true, nil
+	}
+
+	if err := mdag.LoadPinBuffer(ctx); err != nil {
+		return nil, "", false, err
+	}
+	mdag.PinBufferMutex.Lock()
+	tc, ok = mdag.PinBuffer[root]
+	mdag.PinBufferMutex.Unlock()
+	if ok {
+		return tc, "pinned", true, nil
+	}
+
+	tc, err = mdag.NewTierCidStore(n.Repo.Datastore()).Get(ctx, root)
+	switch err {
+	case nil:
+		return tc, "stored", true, nil
+	case ds.ErrNotFound:
+		return nil, "", false, nil
+	default:
+		return nil, "", false, err
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/cheggaaa/pb"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
+	uio "github.com/ipfs/go-unixfs/io"
 	"github.com/ipfs/interface-go-ipfs-core/path"
 	"github.com/ipfs/tar-utils"
 )
@@ -54,6 +55,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption(archiveOptionName, "a", "Output a TAR archive."),
 		cmds.BoolOption(compressOptionName, "C", "Compress the output with GZIP compression."),
 		cmds.IntOption(compressionLevelOptionName, "l", "The level of compression (1-9)."),
+		cmds.IntOption(threadsOptionName, "Number of blocks of a file fetched ahead of the one being read. Defaults to Parallel.Read in the config."),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		_, err := getCompressOptions(req)
@@ -72,7 +74,15 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 
 		p := path.New(req.Arguments[0])
 
-		file, err := api.Unixfs().Get(req.Context, p)
+		ctx := req.Context
+		if threads, ok := req.Options[threadsOptionName].(int); ok {
+			if threads < 1 {
+				return fmt.Errorf("invalid number of threads: %d", threads)
+			}
+			ctx = uio.WithReadAhead(ctx, threads)
+		}
+
+		file, err := api.Unixfs().Get(ctx, p)
 		if err != nil {
 			return err
 		}
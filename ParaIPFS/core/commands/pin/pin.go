@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
 	verifcid "github.com/ipfs/go-verifcid"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
@@ -22,6 +25,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/core/corerepo"
 )
 
 var PinCmd = &cmds.Command{
@@ -592,15 +596,29 @@ pin.
 
 const (
 	pinVerboseOptionName = "verbose"
+	pinRehashOptionName  = "rehash"
+	pinThreadsOptionName = "threads"
 )
 
 var verifyPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify that recursive pins are complete.",
+		ShortDescription: `
+'ipfs pin verify' walks the DAG of every recursive pin and reports the
+blocks that are missing or cannot be decoded, under the pin they belong to.
+
+With --rehash, the blocks are re-hashed as well, with as many blocks at once
+as Parallel.Verify in the config or --threads sets. The blocks of the pins
+that have a TierCid are then read straight from its lists, without walking
+their DAG.
+`,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(pinVerboseOptionName, "Also write the hashes of non-broken pins."),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of broken pins."),
+		cmds.BoolOption(pinRehashOptionName, "Re-hash the blocks of the pins, in parallel."),
+		cmds.IntOption(pinThreadsOptionName, "Number of blocks re-hashed at once with --rehash. Defaults to Parallel.Verify in the config."),
+		cmds.BoolOption(pinProgressOptionName, "Show progress"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -610,11 +628,21 @@ var verifyPinCmd = &cmds.Command{
 
 		verbose, _ := req.Options[pinVerboseOptionName].(bool)
 		quiet, _ := req.Options[pinQuietOptionName].(bool)
+		rehash, _ := req.Options[pinRehashOptionName].(bool)
+		showProgress, _ := req.Options[pinProgressOptionName].(bool)
 
 		if verbose && quiet {
 			return fmt.Errorf("the --verbose and --quiet options can not be used at the same time")
 		}
 
+		threads := n.Parallel.Verify
+		if t, ok := req.Options[pinThreadsOptionName].(int); ok {
+			threads = t
+		}
+		if threads < 1 {
+			return fmt.Errorf("invalid number of threads: %d", threads)
+		}
+
 		enc, err := cmdenv.GetCidEncoder(req)
 		if err != nil {
 			return err
@@ -623,19 +651,45 @@ var verifyPinCmd = &cmds.Command{
 		opts := pinVerifyOpts{
 			explain:   !quiet,
 			includeOk: verbose,
+			rehash:    rehash,
+			threads:   threads,
+			progress:  new(dag.ProgressTracker),
 		}
 		out, err := pinVerify(req.Context, n, opts, enc)
 		if err != nil {
 			return err
 		}
-		return res.Emit(out)
+		if !showProgress {
+			return res.Emit(out)
+		}
+
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case r, ok := <-out:
+				if !ok {
+					return res.Emit(&PinVerifyRes{Progress: opts.progress.Value()})
+				}
+				if err := res.Emit(r); err != nil {
+					return err
+				}
+			case <-ticker.C:
+				if err := res.Emit(&PinVerifyRes{Progress: opts.progress.Value()}); err != nil {
+					return err
+				}
+			}
+		}
 	},
 	Type: PinVerifyRes{},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinVerifyRes) error {
 			quiet, _ := req.Options[pinQuietOptionName].(bool)
 
-			if quiet && !out.Ok {
+			if out.Cid == "" {
+				fmt.Fprintf(os.Stderr, "Verified %d blocks\r", out.Progress)
+			} else if quiet && !out.Ok {
 				fmt.Fprintf(w, "%s\n", out.Cid)
 			} else if !quiet {
 				out.Format(w)
@@ -650,6 +704,10 @@ var verifyPinCmd = &cmds.Command{
 type PinVerifyRes struct {
 	Cid string
 	PinStatus
+
+	// Progress is the number of blocks verified so far, set with
+	// --progress on results without a Cid.
+	Progress int `json:",omitempty"`
 }
 
 // PinStatus is part of PinVerifyRes, do not use directly
@@ -667,6 +725,9 @@ type BadNode struct {
 type pinVerifyOpts struct {
 	explain   bool
 	includeOk bool
+	rehash    bool
+	threads   int
+	progress  *dag.ProgressTracker
 }
 
 func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc cidenc.Encoder) (<-chan interface{}, error) {
@@ -697,6 +758,7 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 		}
 
 		links, err := getLinks(ctx, root)
+		opts.progress.Increment()
 		if err != nil {
 			status := PinStatus{Ok: false}
 			if opts.explain {
@@ -719,14 +781,30 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 		return status
 	}
 
+	if opts.rehash {
+		v := &rehashVerifier{
+			n:    n,
+			bs:   corerepo.HashingBlockstore(n),
+			opts: opts,
+			enc:  enc,
+		}
+		v.dserv = dag.NewDAGService(bserv.New(v.bs, offline.Exchange(v.bs)))
+		checkPin = func(root cid.Cid) PinStatus {
+			return v.checkPin(ctx, root)
+		}
+	}
+
 	out := make(chan interface{})
 	go func() {
 		defer close(out)
 		for _, cid := range recPins {
 			pinStatus := checkPin(cid)
+			if ctx.Err() != nil {
+				return
+			}
 			if !pinStatus.Ok || opts.includeOk {
 				select {
-				case out <- &PinVerifyRes{enc.Encode(cid), pinStatus}:
+				case out <- &PinVerifyRes{Cid: enc.Encode(cid), PinStatus: pinStatus}:
 				case <-ctx.Done():
 					return
 				}
@@ -737,6 +815,87 @@ func pinVerify(ctx context.Context, n *core.IpfsNode, opts pinVerifyOpts, enc ci
 	return out, nil
 }
 
+// rehashVerifier verifies the pins for "pin verify --rehash": it re-hashes
+// every block of a pin, each block once per pin, with opts.threads workers.
+type rehashVerifier struct {
+	n     *core.IpfsNode
+	bs    bstore.Blockstore
+	dserv ipld.DAGService
+	opts  pinVerifyOpts
+	enc   cidenc.Encoder
+}
+
+func (v *rehashVerifier) checkPin(ctx context.Context, root cid.Cid) PinStatus {
+	var lk sync.Mutex
+	status := PinStatus{Ok: true}
+	bad := func(c cid.Cid, err error) {
+		lk.Lock()
+		defer lk.Unlock()
+		status.Ok = false
+		if v.opts.explain {
+			status.BadNodes = append(status.BadNodes, BadNode{Cid: v.enc.Encode(c), Err: err.Error()})
+		}
+	}
+
+	tc, ok, err := corerepo.PinnedTierCid(ctx, v.n, root)
+	if err != nil {
+		bad(root, err)
+		return status
+	}
+	if ok {
+		// Read the blocks straight from the lists of the TierCid, which
+		// may hold the root, and a leaf several times.
+		keys := make(chan cid.Cid)
+		go func() {
+			defer close(keys)
+			seen := cid.NewSet()
+			for _, list := range [][]cid.Cid{{root}, tc.NonLeaf, tc.Leaf} {
+				for _, c := range list {
+					if !seen.Visit(c) {
+						continue
+					}
+					select {
+					case keys <- c:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		for r := range corerepo.Verify(ctx, v.bs, keys, v.opts.threads) {
+			v.opts.progress.Increment()
+			if r.Err != nil {
+				bad(r.Cid, r.Err)
+			}
+		}
+		return status
+	}
+
+	// Without a TierCid, the DAG is walked. The blocks that cannot be read
+	// are reported here rather than failing the walk, which goes on with
+	// the others.
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		if err := verifcid.ValidateCid(c); err != nil {
+			bad(c, err)
+			return nil, nil
+		}
+		nd, err := v.dserv.Get(ctx, c)
+		v.opts.progress.Increment()
+		if err != nil {
+			if ctx.Err() == nil {
+				bad(c, err)
+			}
+			return nil, nil
+		}
+		return nd.Links(), nil
+	}
+	err = dag.Walk(ctx, getLinks, root, cid.NewSet().Visit, dag.Concurrency(v.opts.threads))
+	if err != nil && ctx.Err() == nil {
+		bad(root, err)
+	}
+	return status
+}
+
 // Format formats PinVerifyRes
 func (r PinVerifyRes) Format(out io.Writer) {
 	if r.Ok {
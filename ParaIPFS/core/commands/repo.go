@@ -1,19 +1,19 @@
 package commands
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"runtime"
 	"strings"
-	"sync"
 	"text/tabwriter"
+	"time"
 
 	humanize "github.com/dustin/go-humanize"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cid "github.com/ipfs/go-cid"
@@ -46,11 +46,29 @@ var RepoCmd = &cmds.Command{
 type GcResult struct {
 	Key   cid.Cid
 	Error string `json:",omitempty"`
+
+	// Size and Reason are set with --dry-run.
+	Size   int    `json:",omitempty"`
+	Reason string `json:",omitempty"`
+
+	// Report is set on the last result, with --dry-run or --report.
+	Report *GcReport `json:",omitempty"`
+}
+
+// GcReport sums up a "repo gc" run.
+type GcReport struct {
+	gc.Report
+	// Removed is the number of blocks removed, or that would be with
+	// --dry-run, and Size their total size, only known with --dry-run.
+	Removed int
+	Size    uint64 `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoDryRunOptionName       = "dry-run"
+	repoReportOptionName       = "report"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -60,11 +78,29 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+`,
+		LongDescription: `
+'ipfs repo gc' is a plumbing command that will sweep the local
+set of stored objects and remove ones that are not pinned in
+order to reclaim hard disk space.
+
+With --dry-run, nothing is removed: the objects that would be are
+listed along with their size and the reason why, "unreachable" when
+they are not reachable from the pins or MFS, or "not-in-tiercid" when
+they are but the fast mode of Datastore.GCMode would remove them as
+no TierCid lists them. Their total size is given last.
+
+With --report=json, the run ends with a JSON report of the time spent
+marking the objects to keep, listing the objects of the repo, and
+removing them, in nanoseconds.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmds.IntOption(threadsOptionName, "Number of blocks deleted at once. Defaults to Parallel.GC in the config."),
+		cmds.BoolOption(repoDryRunOptionName, "List the objects that would be removed, without removing them."),
+		cmds.StringOption(repoReportOptionName, "Report the time spent in each phase, in the given format: json."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -73,8 +109,30 @@ order to reclaim hard disk space.
 		}
 
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
+		dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+		reportFormat, _ := req.Options[repoReportOptionName].(string)
+		if reportFormat != "" && reportFormat != "json" {
+			return fmt.Errorf("unknown report format %q, expected \"json\"", reportFormat)
+		}
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+		report := &GcReport{}
+		opts := []gc.Option{gc.WithReport(&report.Report)}
+		if threads, ok := req.Options[threadsOptionName].(int); ok {
+			if threads < 1 {
+				return fmt.Errorf("invalid number of threads: %d", threads)
+			}
+			opts = append(opts, gc.WithConcurrency(threads))
+		}
+		if dryRun {
+			opts = append(opts, gc.WithDryRun())
+		}
+
+		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context, opts...)
+		emitRemoved := func(res gc.Result) error {
+			report.Removed++
+			report.Size += uint64(res.Size)
+			return re.Emit(&GcResult{Key: res.KeyRemoved, Size: res.Size, Reason: string(res.Reason)})
+		}
 
 		if streamErrors {
 			errs := false
@@ -85,7 +143,7 @@ order to reclaim hard disk space.
 					}
 					errs = true
 				} else {
-					if err := re.Emit(&GcResult{Key: res.KeyRemoved}); err != nil {
+					if err := emitRemoved(res); err != nil {
 						return err
 					}
 				}
@@ -94,17 +152,20 @@ order to reclaim hard disk space.
 				return errors.New("encountered errors during gc run")
 			}
 		} else {
-			err := corerepo.CollectResult(req.Context, gcOutChan, func(k cid.Cid) {
+			err := corerepo.CollectResult(req.Context, gcOutChan, func(res gc.Result) {
 				// Nothing to do with this error, really. This
 				// most likely means that the client is gone but
 				// we still need to let the GC finish.
-				_ = re.Emit(&GcResult{Key: k})
+				_ = emitRemoved(res)
 			})
 			if err != nil {
 				return err
 			}
 		}
 
+		if dryRun || reportFormat != "" {
+			return re.Emit(&GcResult{Report: report})
+		}
 		return nil
 	},
 	Type: GcResult{},
@@ -112,11 +173,34 @@ order to reclaim hard disk space.
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, gcr *GcResult) error {
 			quiet, _ := req.Options[repoQuietOptionName].(bool)
 
+			dryRun, _ := req.Options[repoDryRunOptionName].(bool)
+			reportFormat, _ := req.Options[repoReportOptionName].(string)
+
 			if gcr.Error != "" {
 				_, err := fmt.Fprintf(w, "Error: %s\n", gcr.Error)
 				return err
 			}
 
+			if gcr.Report != nil {
+				if reportFormat == "json" {
+					return json.NewEncoder(w).Encode(gcr.Report)
+				}
+				if quiet {
+					return nil
+				}
+				_, err := fmt.Fprintf(w, "would remove %d objects, %s\n", gcr.Report.Removed, humanize.Bytes(gcr.Report.Size))
+				return err
+			}
+
+			if dryRun {
+				if quiet {
+					_, err := fmt.Fprintf(w, "%s\n", gcr.Key)
+					return err
+				}
+				_, err := fmt.Fprintf(w, "would remove %s %d %s\n", gcr.Key, gcr.Size, gcr.Reason)
+				return err
+			}
+
 			prefix := "removed "
 			if quiet {
 				prefix = ""
@@ -233,53 +317,22 @@ var repoFsckCmd = &cmds.Command{
 type VerifyProgress struct {
 	Msg      string
 	Progress int
-}
-
-func verifyWorkerRun(ctx context.Context, wg *sync.WaitGroup, keys <-chan cid.Cid, results chan<- string, bs bstore.Blockstore) {
-	defer wg.Done()
-
-	for k := range keys {
-		_, err := bs.Get(ctx, k)
-		if err != nil {
-			select {
-			case results <- fmt.Sprintf("block %s was corrupt (%s)", k, err):
-			case <-ctx.Done():
-				return
-			}
-
-			continue
-		}
-
-		select {
-		case results <- "":
-		case <-ctx.Done():
-			return
-		}
-	}
-}
-
-func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blockstore) <-chan string {
-	results := make(chan string)
-
-	go func() {
-		defer close(results)
-
-		var wg sync.WaitGroup
-
-		for i := 0; i < runtime.NumCPU()*2; i++ {
-			wg.Add(1)
-			go verifyWorkerRun(ctx, &wg, keys, results, bs)
-		}
 
-		wg.Wait()
-	}()
-
-	return results
+	// Roots lists the pins a corrupt block belongs to.
+	Roots []cid.Cid `json:",omitempty"`
 }
 
 var repoVerifyCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify all blocks in repo are not corrupted.",
+		ShortDescription: `
+'ipfs repo verify' re-hashes every block of the repo, with as many blocks
+at once as Parallel.Verify in the config or --threads sets. Each corrupt
+block is reported with the pins it belongs to.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(threadsOptionName, "Number of blocks re-hashed at once. Defaults to Parallel.Verify in the config."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
@@ -287,6 +340,14 @@ var repoVerifyCmd = &cmds.Command{
 			return err
 		}
 
+		threads := nd.Parallel.Verify
+		if t, ok := req.Options[threadsOptionName].(int); ok {
+			threads = t
+		}
+		if threads < 1 {
+			return fmt.Errorf("invalid number of threads: %d", threads)
+		}
+
 		bs := bstore.NewBlockstore(nd.Repo.Datastore())
 		bs.HashOnRead(true)
 
@@ -296,26 +357,58 @@ var repoVerifyCmd = &cmds.Command{
 			return err
 		}
 
-		results := verifyResultChan(req.Context, keys, bs)
+		results := corerepo.Verify(req.Context, bs, keys, threads)
+
+		// The pins are only indexed once a block turns out to be corrupt.
+		var pins *corerepo.PinIndex
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
 
 		var fails int
 		var i int
-		for msg := range results {
-			if msg != "" {
-				if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
-					return err
+	loop:
+		for {
+			select {
+			case r, ok := <-results:
+				if !ok {
+					break loop
+				}
+				i++
+				if r.Err == nil {
+					continue
 				}
 				fails++
-			}
-			i++
-			if err := res.Emit(&VerifyProgress{Progress: i}); err != nil {
-				return err
+
+				if pins == nil {
+					if pins, err = corerepo.NewPinIndex(req.Context, nd); err != nil {
+						return err
+					}
+				}
+				msg := fmt.Sprintf("block %s was corrupt (%s)", r.Cid, r.Err)
+				roots := pins.Roots(r.Cid)
+				if len(roots) > 0 {
+					pinned := make([]string, len(roots))
+					for j, root := range roots {
+						pinned[j] = root.String()
+					}
+					msg += ", pinned by " + strings.Join(pinned, ", ")
+				}
+				if err := res.Emit(&VerifyProgress{Msg: msg, Roots: roots}); err != nil {
+					return err
+				}
+			case <-ticker.C:
+				if err := res.Emit(&VerifyProgress{Progress: i}); err != nil {
+					return err
+				}
 			}
 		}
 
 		if err := req.Context.Err(); err != nil {
 			return err
 		}
+		if err := res.Emit(&VerifyProgress{Progress: i}); err != nil {
+			return err
+		}
 
 		if fails != 0 {
 			return errors.New("verify complete, some blocks were corrupt")
@@ -83,6 +83,7 @@ type IpfsNode struct {
 	Discovery            mdns.Service              `optional:"true"`
 	FilesRoot            *mfs.Root
 	RecordValidator      record.Validator
+	Parallel             node.Parallel // the number of workers of the parallel paths
 
 	// Online
 	PeerHost      p2phost.Host            `optional:"true"` // the network host (server+client)
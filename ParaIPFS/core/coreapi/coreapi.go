@@ -73,6 +73,8 @@ type CoreAPI struct {
 
 	pubSub *pubsub.PubSub
 
+	parallel node.Parallel
+
 	checkPublishAllowed func() error
 	checkOnline         func(allowOffline bool) error
 
@@ -186,6 +188,8 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 		pubSub: n.PubSub,
 
+		parallel: n.Parallel,
+
 		nd:         n,
 		parentOpts: settings,
 	}
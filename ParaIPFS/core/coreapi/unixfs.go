@@ -16,6 +16,7 @@ import (
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
 	dag "github.com/ipfs/go-merkledag"
 	merkledag "github.com/ipfs/go-merkledag"
 	dagtest "github.com/ipfs/go-merkledag/test"
@@ -30,6 +31,8 @@ import (
 
 type UnixfsAPI CoreAPI
 
+var log = logging.Logger("coreapi")
+
 var nilNode *core.IpfsNode
 var once sync.Once
 
@@ -134,6 +137,10 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 	fileAdder.RawLeaves = settings.RawLeaves
 	fileAdder.NoCopy = settings.NoCopy
 	fileAdder.CidBuilder = prefix
+	fileAdder.Threads = settings.Threads
+	if fileAdder.Threads == 0 {
+		fileAdder.Threads = api.parallel.Import
+	}
 
 	switch settings.Layout {
 	case options.BalancedLayout:
@@ -181,14 +188,64 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 func (api *UnixfsAPI) Get(ctx context.Context, p path.Path) (files.Node, error) {
 	ses := api.core().getSession(ctx)
 
-	nd, err := ses.ResolveNode(ctx, p)
+	rp, err := ses.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	// Before ResolveNode fetches it.
+	local, err := api.blocks.Blockstore().Has(ctx, rp.Cid())
 	if err != nil {
 		return nil, err
 	}
+	nd, err := ses.ResolveNode(ctx, rp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Have the blocks of a remote file fetched in large batches ahead of
+	// the reader when the DAG is not one this node recorded the TierCid
+	// of, unless only part of it is read. The reader fetches whatever this
+	// does not.
+	if !local && !uio.PartialReadFromContext(ctx) && isFileDAG(nd) && !hasTierCid(ctx, nd.Cid()) {
+		go func() {
+			if err := dag.PrefetchTierCid(ctx, api.blocks, nd.Cid()); err != nil && ctx.Err() == nil {
+				log.Debugf("cannot prefetch %s from its TierCid: %s", nd.Cid(), err)
+			}
+		}()
+	}
 
+	if _, ok := uio.ReadAheadFromContext(ctx); !ok && api.parallel.Read > 0 {
+		ctx = uio.WithReadAhead(ctx, api.parallel.Read)
+	}
 	return unixfile.NewUnixfsFile(ctx, ses.dag, nd)
 }
 
+// isFileDAG reports whether nd is the root of a UnixFS file spread over
+// several blocks.
+func isFileDAG(nd ipld.Node) bool {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok || len(pn.Links()) == 0 {
+		return false
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	return err == nil && fsn.Type() == ft.TFile
+}
+
+// hasTierCid reports whether the node recorded the TierCid of root.
+func hasTierCid(ctx context.Context, root cid.Cid) bool {
+	if _, ok := dag.UnPinBuffer.Peek(root); ok {
+		return true
+	}
+	// If the TierCids cannot be loaded, the prefetch fetches a copy.
+	if dag.LoadPinBuffer(ctx) != nil {
+		return false
+	}
+	dag.PinBufferMutex.Lock()
+	defer dag.PinBufferMutex.Unlock()
+	_, ok := dag.PinBuffer[root]
+	return ok
+}
+
 // Ls returns the contents of an IPFS or IPNS object(s) at path p, with the format:
 // `<link base58 hash> <link size in bytes> <link name>`
 func (api *UnixfsAPI) Ls(ctx context.Context, p path.Path, opts ...options.UnixfsLsOption) (<-chan coreiface.DirEntry, error) {
@@ -305,3 +362,7 @@ type syncDagService struct {
 func (s *syncDagService) Sync() error {
 	return s.syncFn()
 }
+
+func (s *syncDagService) AddManyParallel(ctx context.Context, nds []ipld.Node, concurrency int) error {
+	return dag.AddManyParallel(ctx, s.DAGService, nds, concurrency)
+}
@@ -23,6 +23,7 @@ import (
 	assets "github.com/ipfs/go-ipfs/assets"
 	dag "github.com/ipfs/go-merkledag"
 	mfs "github.com/ipfs/go-mfs"
+	uio "github.com/ipfs/go-unixfs/io"
 	path "github.com/ipfs/go-path"
 	"github.com/ipfs/go-path/resolver"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
@@ -286,7 +287,11 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	dr, err := i.api.Unixfs().Get(r.Context(), resolvedPath)
+	getCtx := r.Context()
+	if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+		getCtx = uio.WithPartialRead(getCtx)
+	}
+	dr, err := i.api.Unixfs().Get(getCtx, resolvedPath)
 	if err != nil {
 		webError(w, "ipfs cat "+escapedURLPath, err, http.StatusNotFound)
 		return
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-merkledag"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/zpages"
 
@@ -178,3 +179,66 @@ func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
 	}
 	return vals
 }
+
+var (
+	tierCidCacheHitsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "hits_total"),
+		"Number of lookups finding the TierCid of an unpinned root",
+		nil, nil,
+	)
+	tierCidCacheMissesMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "misses_total"),
+		"Number of lookups not finding the TierCid of an unpinned root",
+		nil, nil,
+	)
+	tierCidCacheEvictionsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "evictions_total"),
+		"Number of TierCids evicted, or not kept, to fit the budget",
+		nil, nil,
+	)
+	tierCidCacheInvalidationsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "invalidations_total"),
+		"Number of TierCids dropped because one of their blocks was removed",
+		nil, nil,
+	)
+	tierCidCacheEntriesMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "entries"),
+		"Number of TierCids cached",
+		nil, nil,
+	)
+	tierCidCacheSizeMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "size_bytes"),
+		"Size of the TierCids cached",
+		nil, nil,
+	)
+	tierCidCacheBudgetMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tiercid_cache", "budget_bytes"),
+		"Size the TierCids cached may take",
+		nil, nil,
+	)
+)
+
+// TierCidCacheCollector exports the counters of the cache of the TierCids
+// of unpinned roots.
+type TierCidCacheCollector struct{}
+
+func (TierCidCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tierCidCacheHitsMetric
+	ch <- tierCidCacheMissesMetric
+	ch <- tierCidCacheEvictionsMetric
+	ch <- tierCidCacheInvalidationsMetric
+	ch <- tierCidCacheEntriesMetric
+	ch <- tierCidCacheSizeMetric
+	ch <- tierCidCacheBudgetMetric
+}
+
+func (TierCidCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	st := dag.UnPinBuffer.Stats()
+	ch <- prometheus.MustNewConstMetric(tierCidCacheHitsMetric, prometheus.CounterValue, float64(st.Hits))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheMissesMetric, prometheus.CounterValue, float64(st.Misses))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheEvictionsMetric, prometheus.CounterValue, float64(st.Evictions))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheInvalidationsMetric, prometheus.CounterValue, float64(st.Invalidations))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheEntriesMetric, prometheus.GaugeValue, float64(st.Entries))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheSizeMetric, prometheus.GaugeValue, float64(st.Size))
+	ch <- prometheus.MustNewConstMetric(tierCidCacheBudgetMetric, prometheus.GaugeValue, float64(st.Budget))
+}
@@ -83,20 +83,52 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 	return []cid.Cid{rootDag.Cid()}, nil
 }
 
+// gcOptions returns the GC options set in the config of the node: the mode
+// from Datastore.GCMode, the concurrency from Parallel.GC, and the batches of
+// an incremental sweep from Datastore.GCSweepBatchSize and GCSweepInterval.
+func gcOptions(n *core.IpfsNode) ([]gc.Option, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	mode, err := gc.ParseMode(cfg.Datastore.GCMode)
+	if err != nil {
+		return nil, err
+	}
+	opts := []gc.Option{gc.WithMode(mode), gc.WithConcurrency(n.Parallel.GC)}
+
+	if cfg.Datastore.GCSweepBatchSize > 0 {
+		var interval time.Duration
+		if cfg.Datastore.GCSweepInterval != "" {
+			interval, err = time.ParseDuration(cfg.Datastore.GCSweepInterval)
+			if err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, gc.WithIncremental(cfg.Datastore.GCSweepBatchSize, interval))
+	}
+	return opts, nil
+}
+
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
 		return err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	opts, err := gcOptions(n)
+	if err != nil {
+		return err
+	}
+	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, opts...)
 
 	return CollectResult(ctx, rmed, nil)
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
-// given callback for each object removed.  It also collects all errors into a
-// MultiError which is returned after the gc is completed.
-func CollectResult(ctx context.Context, gcOut <-chan gc.Result, cb func(cid.Cid)) error {
+// given callback for each object removed, or that would be in a dry run.  It
+// also collects all errors into a MultiError which is returned after the gc is
+// completed.
+func CollectResult(ctx context.Context, gcOut <-chan gc.Result, cb func(gc.Result)) error {
 	var errors []error
 loop:
 	for {
@@ -108,7 +140,7 @@ loop:
 			if res.Error != nil {
 				errors = append(errors, res.Error)
 			} else if res.KeyRemoved.Defined() && cb != nil {
-				cb(res.KeyRemoved)
+				cb(res)
 			}
 		case <-ctx.Done():
 			errors = append(errors, ctx.Err())
@@ -147,16 +179,22 @@ func (e *MultiError) Error() string {
 	return buf.String()
 }
 
-func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
+// GarbageCollectAsync runs a GC configured from the config of the node,
+// with opts applied on top of it.
+func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context, opts ...gc.Option) <-chan gc.Result {
 	roots, err := BestEffortRoots(n.FilesRoot)
-	if err != nil {
-		out := make(chan gc.Result)
-		out <- gc.Result{Error: err}
-		close(out)
-		return out
+	if err == nil {
+		var cfgOpts []gc.Option
+		cfgOpts, err = gcOptions(n)
+		if err == nil {
+			return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots, append(cfgOpts, opts...)...)
+		}
 	}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	out := make(chan gc.Result, 1)
+	out <- gc.Result{Error: err}
+	close(out)
+	return out
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -0,0 +1,158 @@
+package corerepo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfs/go-ipfs/core"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-filestore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// VerifyResult is the outcome of reading a block back.
+type VerifyResult struct {
+	Cid cid.Cid
+	// Err is nil when the block was read, and had the expected hash if
+	// the blockstore hashes on read.
+	Err error
+}
+
+// HashingBlockstore returns a blockstore of the blocks of n that re-hashes
+// them on read. The blocks of the filestore are checked against their
+// files.
+func HashingBlockstore(n *core.IpfsNode) bstore.Blockstore {
+	bs := bstore.NewBlockstore(n.Repo.Datastore())
+	bs.HashOnRead(true)
+	if n.Filestore != nil {
+		return filestore.NewFilestore(bs, n.Filestore.FileManager())
+	}
+	return bs
+}
+
+// Verify reads the blocks of keys from bs with the given number of workers,
+// and sends the outcome for each of them. The channel is closed once keys
+// is, or when ctx is done.
+func Verify(ctx context.Context, bs bstore.Blockstore, keys <-chan cid.Cid, workers int) <-chan VerifyResult {
+	results := make(chan VerifyResult)
+
+	go func() {
+		defer close(results)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := range keys {
+					_, err := bs.Get(ctx, k)
+					select {
+					case results <- VerifyResult{Cid: k, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+
+	return results
+}
+
+// PinnedTierCid returns the TierCid recorded for the recursive pin root, from
+// dag.PinBuffer or the datastore.
+func PinnedTierCid(ctx context.Context, n *core.IpfsNode, root cid.Cid) (*dag.TierCid, bool, error) {
+	if err := dag.LoadPinBuffer(ctx); err != nil {
+		return nil, false, err
+	}
+	dag.PinBufferMutex.Lock()
+	tc, ok := dag.PinBuffer[root]
+	dag.PinBufferMutex.Unlock()
+	if ok {
+		return tc, true, nil
+	}
+
+	tc, err := dag.NewTierCidStore(n.Repo.Datastore()).Get(ctx, root)
+	switch err {
+	case nil:
+		return tc, true, nil
+	case ds.ErrNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// PinIndex maps blocks to the roots of the pins they belong to.
+type PinIndex struct {
+	roots map[string][]cid.Cid
+}
+
+// NewPinIndex indexes the blocks of the pins of n. The blocks of a recursive
+// pin are taken from its TierCid when it has one, and found by walking its
+// DAG otherwise, past the blocks that cannot be read.
+func NewPinIndex(ctx context.Context, n *core.IpfsNode) (*PinIndex, error) {
+	pi := &PinIndex{roots: make(map[string][]cid.Cid)}
+
+	direct, err := n.Pinning.DirectKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range direct {
+		pi.add(root, root)
+	}
+
+	recursive, err := n.Pinning.RecursiveKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bs := n.Blocks.Blockstore()
+	getLinks := dag.GetLinksWithDAG(dag.NewDAGService(bserv.New(bs, offline.Exchange(bs))))
+	for _, root := range recursive {
+		tc, ok, err := PinnedTierCid(ctx, n, root)
+		if err != nil {
+			return nil, err
+		}
+		seen := cid.NewSet()
+		if ok {
+			for _, list := range [][]cid.Cid{{root}, tc.NonLeaf, tc.Leaf} {
+				for _, c := range list {
+					if seen.Visit(c) {
+						pi.add(c, root)
+					}
+				}
+			}
+			continue
+		}
+
+		// The walk serializes the calls to visit.
+		err = dag.Walk(ctx, getLinks, root, func(c cid.Cid) bool {
+			if !seen.Visit(c) {
+				return false
+			}
+			pi.add(c, root)
+			return true
+		}, dag.Concurrent(), dag.IgnoreErrors())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pi, nil
+}
+
+func (pi *PinIndex) add(c, root cid.Cid) {
+	k := string(c.Hash())
+	pi.roots[k] = append(pi.roots[k], root)
+}
+
+// Roots returns the roots of the pins c belongs to, whatever its CID version
+// and codec.
+func (pi *PinIndex) Roots(c cid.Cid) []cid.Cid {
+	return pi.roots[string(c.Hash())]
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	gopath "path"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -45,14 +46,11 @@ type syncer interface {
 
 // NewAdder Returns a new Adder used for a file add operation.
 func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCLocker, ds ipld.DAGService) (*Adder, error) {
-	bufferedDS := ipld.NewBufferedDAG(ctx, ds)
-
 	return &Adder{
 		ctx:        ctx,
 		pinning:    p,
 		gcLocker:   bs,
 		dagService: ds,
-		bufferedDS: bufferedDS,
 		Progress:   false,
 		Pin:        true,
 		Trickle:    false,
@@ -66,11 +64,13 @@ type Adder struct {
 	pinning    pin.Pinner
 	gcLocker   bstore.GCLocker
 	dagService ipld.DAGService
-	bufferedDS *ipld.BufferedDAG
 	Out        chan<- interface{}
 	Progress   bool
 	Pin        bool
 	Trickle    bool
+	// Threads is the number of workers shared by the files imported at
+	// once and the layouts building them.
+	Threads    int
 	RawLeaves  bool
 	Silent     bool
 	NoCopy     bool
@@ -80,6 +80,14 @@ type Adder struct {
 	tempRoot   cid.Cid
 	CidBuilder cid.Builder
 	liveNodes  uint64
+
+	// The files read from a local path are imported in the background;
+	// the changes to the MFS root are queued in the order of the walk.
+	budget        workerBudget
+	pending       []*pendingAdd
+	imports       sync.WaitGroup
+	importCtx     context.Context
+	cancelImports context.CancelFunc
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -101,29 +109,31 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 	adder.mroot = r
 }
 
-// Constructs a node from reader's data, and adds it. Doesn't pin.
-func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
-
-	// if fi, ok := reader.(files.FileInfo); ok {
-	// 	// fmt.Printf("fi: %#v\n", fi.AbsPath())
-	// 	balanced.FileAbsPath = fi.AbsPath()
-	// 	fmt.Println("FileAbsPath_0:", balanced.FileAbsPath)
-
-	// }
-	fi, _ := reader.(files.FileInfo)
-	fileAbsPath := fi.AbsPath()
+// Constructs a node from reader's data with the given number of workers,
+// and adds it. Doesn't pin.
+func (adder *Adder) add(ctx context.Context, reader io.Reader, workers int) (ipld.Node, error) {
+	// Only files read from a local path can be built by the parallel
+	// layout; streamed input has no path.
+	fileAbsPath := localPath(reader)
 
 	chnk, err := chunker.FromString(reader, adder.Chunker)
 	if err != nil {
 		return nil, err
 	}
 
+	// Every file has its own batch, as several are imported at once.
+	bufferedDS := ipld.NewBufferedDAG(ctx, adder.dagService)
 	params := ihelper.DagBuilderParams{
-		Dagserv:    adder.bufferedDS,
-		RawLeaves:  adder.RawLeaves,
-		Maxlinks:   ihelper.DefaultLinksPerBlock,
-		NoCopy:     adder.NoCopy,
-		CidBuilder: adder.CidBuilder,
+		Dagserv: bufferedDS,
+		// The parallel and streamed layouts write their leaves
+		// concurrently, which the batching DAGService does not support.
+		LeafDagserv: adder.dagService,
+		RawLeaves:   adder.RawLeaves,
+		Maxlinks:    ihelper.DefaultLinksPerBlock,
+		NoCopy:      adder.NoCopy,
+		CidBuilder:  adder.CidBuilder,
+		Ctx:         ctx,
+		Concurrency: workers,
 	}
 
 	db, err := params.New(chnk)
@@ -139,7 +149,25 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	return nd, adder.bufferedDS.Commit()
+	return nd, bufferedDS.Commit()
+}
+
+// localPath returns the path of the local file the daemon opened and reads r
+// from, or "" if r reads from anything else. The files of a multipart request
+// carry the path the client read them from, which is not to be trusted.
+func localPath(r io.Reader) string {
+	var f interface{} = r
+	if pr, ok := r.(*progressReader2); ok {
+		f = pr.FileInfo
+	}
+	rf, ok := f.(*files.ReaderFile)
+	if !ok {
+		return ""
+	}
+	if _, ok := rf.LocalFile(); !ok {
+		return ""
+	}
+	return rf.AbsPath()
 }
 
 // RootNode returns the mfs root node
@@ -276,13 +304,19 @@ func (adder *Adder) AddAllAndPin(ctx context.Context, file files.Node) (ipld.Nod
 		}
 	}()
 
-	st_1 := time.Now()
-	if err := adder.addFileNode(ctx, "", file, true); err != nil {
+	adder.budget = newWorkerBudget(adder.threads())
+	adder.importCtx, adder.cancelImports = context.WithCancel(adder.ctx)
+	defer adder.cancelImports()
+
+	err := adder.addFileNode(ctx, "", file, true)
+	if err == nil {
+		// Wait for the files still being imported.
+		err = adder.applyPending(0)
+	}
+	if err != nil {
+		adder.abortImports()
 		return nil, err
 	}
-	elap_1 := time.Since(st_1)
-	fmt.Println("addFileNode time:", elap_1)
-
 	// get root
 	mr, err := adder.mfsRoot()
 	if err != nil {
@@ -342,12 +376,11 @@ func (adder *Adder) AddAllAndPin(ctx context.Context, file files.Node) (ipld.Nod
 		}
 	}
 
+	log.Debugf("added %s in %s", nd.Cid(), time.Since(st))
 	if !adder.Pin {
 		return nd, nil
 	}
 
-	elap := time.Since(st)
-	fmt.Println("AddAllAndPin time:", elap)
 	return nd, adder.PinRoot(nd)
 }
 
@@ -379,11 +412,7 @@ func (adder *Adder) addFileNode(ctx context.Context, path string, file files.Nod
 	case *files.Symlink:
 		return adder.addSymlink(path, f)
 	case files.File:
-		st := time.Now()
-		err = adder.addFile(path, f)
-		elap := time.Since(st)
-		fmt.Println("addFile time:", elap)
-		return err
+		return adder.addFile(path, f, toplevel)
 	default:
 		return errors.New("unknown file type")
 	}
@@ -402,30 +431,84 @@ func (adder *Adder) addSymlink(path string, l *files.Symlink) error {
 		return err
 	}
 
-	return adder.addNode(dagnode, path)
+	return adder.queue(&pendingAdd{
+		ready: applyNow,
+		apply: func() error {
+			return adder.addNode(dagnode, path)
+		},
+	})
 }
 
-func (adder *Adder) addFile(path string, file files.File) error {
-	st := time.Now()
-	// if the progress flag was specified, wrap the file so that we can send
-	// progress updates to the client (over the output channel)
-	var reader io.Reader = file
+// addFile imports file with its share of the workers of the Adder. Files
+// that can be read again from their local path are imported in the
+// background, the others before the walk moves past them; either way the
+// file is patched into the MFS root in the order of the walk.
+func (adder *Adder) addFile(path string, file files.File, toplevel bool) error {
+	local, ok, err := openLocal(file)
+	if err != nil {
+		return err
+	}
+	if ok {
+		file = local
+	}
 
-	// if fi, ok := file.(files.FileInfo); ok {
-	// 	// fmt.Printf("fi: %#v\n", fi.AbsPath())
-	// 	balanced.FileAbsPath = fi.AbsPath()
-	// 	fmt.Println("FileAbsPath:", balanced.FileAbsPath)
+	// A file imported on its own may take the whole budget, one in a
+	// directory leaves a worker to the file after it.
+	spare := 1
+	if toplevel {
+		spare = 0
+	}
+	workers, err := adder.budget.acquire(adder.importCtx, adder.fileWorkers(file.Size()), spare)
+	if err != nil {
+		if ok {
+			local.Close()
+		}
+		return err
+	}
+
+	var dagnode ipld.Node
+	var addErr error
+	p := &pendingAdd{
+		ready: make(chan struct{}),
+		apply: func() error {
+			if addErr != nil {
+				return addErr
+			}
+			return adder.addNode(dagnode, path)
+		},
+	}
+	build := func() {
+		dagnode, addErr = adder.addFileData(path, file, workers)
+		adder.budget.release(workers)
+		close(p.ready)
+	}
 
-	// }
-	// if fi, ok := reader.(files.FileInfo); ok {
-	// 	// fmt.Printf("fi: %#v\n", fi.AbsPath())
-	// 	balanced.FileAbsPath = fi.AbsPath()
-	// 	fmt.Println("FileAbsPath_0:", balanced.FileAbsPath)
+	if !ok {
+		build()
+		if addErr != nil {
+			return addErr
+		}
+		return adder.queue(p)
+	}
 
-	// }
+	adder.imports.Add(1)
+	go func() {
+		defer adder.imports.Done()
+		defer local.Close()
+		build()
+	}()
+	return adder.queue(p)
+}
 
+// addFileData builds the DAG of file with the given number of workers.
+func (adder *Adder) addFileData(path string, file files.File, workers int) (ipld.Node, error) {
+	st := time.Now()
+	// if the progress flag was specified, wrap the file so that we can send
+	// progress updates to the client (over the output channel)
+	var reader io.Reader = file
+	var rdr *progressReader
 	if adder.Progress {
-		rdr := &progressReader{file: reader, path: path, out: adder.Out}
+		rdr = &progressReader{file: reader, path: path, out: adder.Out}
 		if fi, ok := file.(files.FileInfo); ok {
 			reader = &progressReader2{rdr, fi}
 		} else {
@@ -433,32 +516,38 @@ func (adder *Adder) addFile(path string, file files.File) error {
 		}
 	}
 
-	dagnode, err := adder.add(reader)
+	dagnode, err := adder.add(adder.importCtx, reader, workers)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	elap := time.Since(st)
-	fmt.Println("~add time:", elap)
-
-	// patch it into the root
-	err = adder.addNode(dagnode, path)
-	elap = time.Since(st)
-	fmt.Println("~addNode time:", elap)
-	return err
+	if rdr != nil {
+		// The parallel layout reads the file from its path, not from
+		// the progress reader.
+		if size, err := file.Size(); err == nil && rdr.bytes < size {
+			rdr.report(size)
+		}
+	}
+	log.Debugf("built the DAG of %q in %s", path, time.Since(st))
+	return dagnode, nil
 }
 
 func (adder *Adder) addDir(ctx context.Context, path string, dir files.Directory, toplevel bool) error {
 	log.Infof("adding directory: %s", path)
 
 	if !(toplevel && path == "") {
-		mr, err := adder.mfsRoot()
-		if err != nil {
-			return err
-		}
-		err = mfs.Mkdir(mr, path, mfs.MkdirOpts{
-			Mkparents:  true,
-			Flush:      false,
-			CidBuilder: adder.CidBuilder,
+		err := adder.queue(&pendingAdd{
+			ready: applyNow,
+			apply: func() error {
+				mr, err := adder.mfsRoot()
+				if err != nil {
+					return err
+				}
+				return mfs.Mkdir(mr, path, mfs.MkdirOpts{
+					Mkparents:  true,
+					Flush:      false,
+					CidBuilder: adder.CidBuilder,
+				})
+			},
 		})
 		if err != nil {
 			return err
@@ -479,6 +568,12 @@ func (adder *Adder) addDir(ctx context.Context, path string, dir files.Directory
 
 func (adder *Adder) maybePauseForGC(ctx context.Context) error {
 	if adder.unlocker != nil && adder.gcLocker.GCRequested(ctx) {
+		// The files being imported are only protected by the lock
+		// until they are in the root pinned below.
+		if err := adder.applyPending(0); err != nil {
+			return err
+		}
+
 		rn, err := adder.curRootNode()
 		if err != nil {
 			return err
@@ -495,6 +590,14 @@ func (adder *Adder) maybePauseForGC(ctx context.Context) error {
 	return nil
 }
 
+// threads returns the size of the worker budget of the Adder.
+func (adder *Adder) threads() int {
+	if adder.Threads < 1 {
+		return dag.NumThread
+	}
+	return adder.Threads
+}
+
 // outputDagnode sends dagnode info over the output channel
 func outputDagnode(out chan<- interface{}, name string, dn ipld.Node) error {
 	if out == nil {
@@ -544,16 +647,22 @@ func (i *progressReader) Read(p []byte) (int, error) {
 
 	i.bytes += int64(n)
 	if i.bytes-i.lastProgress >= progressReaderIncrement || err == io.EOF {
-		i.lastProgress = i.bytes
-		i.out <- &coreiface.AddEvent{
-			Name:  i.path,
-			Bytes: i.bytes,
-		}
+		i.report(i.bytes)
 	}
 
 	return n, err
 }
 
+// report sends a progress update of the given number of bytes read.
+func (i *progressReader) report(bytes int64) {
+	i.bytes = bytes
+	i.lastProgress = bytes
+	i.out <- &coreiface.AddEvent{
+		Name:  i.path,
+		Bytes: bytes,
+	}
+}
+
 type progressReader2 struct {
 	*progressReader
 	files.FileInfo
@@ -3,6 +3,7 @@ package coreunix
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -24,6 +25,7 @@ import (
 	config "github.com/ipfs/go-ipfs-config"
 	files "github.com/ipfs/go-ipfs-files"
 	pi "github.com/ipfs/go-ipfs-posinfo"
+	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 )
@@ -253,6 +255,159 @@ func TestAddGCLive(t *testing.T) {
 	}
 }
 
+func TestAddConcurrentFiles(t *testing.T) {
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(3))
+	sizes := map[string]int{
+		"a":       10,
+		"b":       3 << 20,
+		"c":       1 << 20,
+		"d/e":     600 << 10,
+		"d/f":     0,
+		"d/g/h":   2<<20 + 1,
+		"d/g/i":   1,
+		"empty/j": 5 << 10,
+	}
+	for name, size := range sizes {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, size)
+		rnd.Read(data)
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add := func(threads int) (cid.Cid, []string, map[string]int64) {
+		r := &repo.Mock{
+			C: config.Config{
+				Identity: config.Identity{
+					PeerID: testPeerID, // required by offline node
+				},
+			},
+			D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		}
+		node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(chan interface{})
+		adder.Out = out
+		adder.Progress = true
+		adder.Threads = threads
+
+		stat, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := files.NewSerialFile(dir, false, stat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var root ipld.Node
+		go func() {
+			defer close(out)
+			root, err = adder.AddAllAndPin(context.Background(), file)
+		}()
+
+		var added []string
+		progress := make(map[string]int64)
+		for o := range out {
+			evt := o.(*coreiface.AddEvent)
+			if evt.Path == nil {
+				if evt.Bytes < progress[evt.Name] {
+					t.Fatalf("progress of %s went back from %d to %d", evt.Name, progress[evt.Name], evt.Bytes)
+				}
+				progress[evt.Name] = evt.Bytes
+				continue
+			}
+			added = append(added, evt.Name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Cid(), added, progress
+	}
+
+	seqRoot, seqAdded, _ := add(1)
+	for _, threads := range []int{4, 16} {
+		root, added, progress := add(threads)
+		if !root.Equals(seqRoot) {
+			t.Fatalf("%d threads: got root %s, expected %s", threads, root, seqRoot)
+		}
+		if fmt.Sprint(added) != fmt.Sprint(seqAdded) {
+			t.Fatalf("%d threads: added %v, expected %v", threads, added, seqAdded)
+		}
+		for name, size := range sizes {
+			if size > 0 && progress[name] != int64(size) {
+				t.Fatalf("%d threads: progress of %s is %d, expected %d", threads, name, progress[name], size)
+			}
+		}
+	}
+}
+
+// A file that only claims a local path, as the files of a multipart request
+// do, is added from its own data, never from the file at that path.
+func TestAddClaimedPath(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	onDisk := make([]byte, 1<<20)
+	rnd.Read(onDisk)
+	sent := make([]byte, len(onDisk))
+	rnd.Read(sent)
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(path, onDisk, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(file files.Node) cid.Cid {
+		r := &repo.Mock{
+			C: config.Config{
+				Identity: config.Identity{
+					PeerID: testPeerID, // required by offline node
+				},
+			},
+			D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		}
+		node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(chan interface{}, 10)
+		adder.Out = out
+		adder.Threads = 4
+		root, err := adder.AddAllAndPin(context.Background(), file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Cid()
+	}
+
+	claimed, err := files.NewReaderPathFile(path, ioutil.NopCloser(bytes.NewReader(sent)), stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := add(claimed)
+	if exp := add(files.NewBytesFile(sent)); !got.Equals(exp) {
+		t.Fatalf("got root %s, expected %s (the data sent)", got, exp)
+	}
+}
+
 func testAddWPosInfo(t *testing.T, rawLeaves bool) {
 	r := &repo.Mock{
 		C: config.Config{
@@ -0,0 +1,161 @@
+package coreunix
+
+import (
+	"context"
+	"os"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// maxPendingPerWorker bounds the queue of an Adder: once it holds that many
+// entries per worker of the budget, the walk waits for the entry at its
+// head before reading the next one.
+const maxPendingPerWorker = 16
+
+// workerBudget is the pool of workers an Adder shares out between the files
+// it imports at once and the layouts building each of them.
+type workerBudget chan struct{}
+
+func newWorkerBudget(n int) workerBudget {
+	if n < 1 {
+		n = 1
+	}
+	b := make(workerBudget, n)
+	for i := 0; i < n; i++ {
+		b <- struct{}{}
+	}
+	return b
+}
+
+// acquire waits for a worker, then takes up to want-1 more among the free
+// ones, leaving spare of them to the files imported next. It returns the
+// number of workers taken.
+func (b workerBudget) acquire(ctx context.Context, want, spare int) (int, error) {
+	select {
+	case <-b:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	n := 1
+	for n < want && len(b) > spare {
+		select {
+		case <-b:
+			n++
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+func (b workerBudget) release(n int) {
+	for ; n > 0; n-- {
+		b <- struct{}{}
+	}
+}
+
+// pendingAdd is an entry of the walk whose change to the MFS root waits for
+// the entries before it, so that the root is built in the order of the walk
+// whatever the order the files finish importing in.
+type pendingAdd struct {
+	// ready is closed once apply can be called.
+	ready chan struct{}
+	apply func() error
+}
+
+// applyNow is the ready channel of the entries that need not wait.
+var applyNow = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// queue appends p to the entries waiting to be applied and applies the ones
+// that can be.
+func (adder *Adder) queue(p *pendingAdd) error {
+	adder.pending = append(adder.pending, p)
+	return adder.applyPending(maxPendingPerWorker * cap(adder.budget))
+}
+
+// applyPending applies the queued entries in order until it reaches one
+// still being imported, which it waits for as long as more than keep
+// entries are queued.
+func (adder *Adder) applyPending(keep int) error {
+	for len(adder.pending) > 0 {
+		p := adder.pending[0]
+		if len(adder.pending) > keep {
+			<-p.ready
+		} else {
+			select {
+			case <-p.ready:
+			default:
+				return nil
+			}
+		}
+
+		adder.pending[0] = nil
+		adder.pending = adder.pending[1:]
+		if err := p.apply(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abortImports stops the files still being imported once the add failed,
+// and waits for them so that nothing is sent to Out afterwards.
+func (adder *Adder) abortImports() {
+	adder.cancelImports()
+	adder.imports.Wait()
+	adder.pending = nil
+}
+
+// fileWorkers is the number of workers worth building a file of the given
+// size with: one per chunk of the default size, up to the whole budget.
+func (adder *Adder) fileWorkers(size int64, err error) int {
+	n := cap(adder.budget)
+	if err != nil || size < 0 {
+		return n
+	}
+	if chunks := (size + chunker.DefaultBlockSize - 1) / chunker.DefaultBlockSize; chunks < int64(n) {
+		n = int(chunks)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// openLocal opens again the regular file f reads from, if the daemon opened
+// it from the local filesystem itself, so that it can be read apart from the
+// directory walk f comes from. The files of a multipart request are never
+// reopened: their AbsPath is only what the client sent, and they are read
+// before the walk moves to the next.
+func openLocal(f files.File) (files.File, bool, error) {
+	rf, ok := f.(*files.ReaderFile)
+	if !ok {
+		return nil, false, nil
+	}
+	if _, ok := rf.LocalFile(); !ok || rf.AbsPath() == "" {
+		return nil, false, nil
+	}
+
+	osf, err := os.Open(rf.AbsPath())
+	if err != nil {
+		return nil, false, err
+	}
+	stat, err := osf.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		osf.Close()
+		return nil, false, err
+	}
+
+	local, err := files.NewReaderPathFile(rf.AbsPath(), osf, stat)
+	if err != nil {
+		osf.Close()
+		return nil, false, err
+	}
+	return local, true, nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 
 	"github.com/ipfs/go-bitswap"
+	bsmsg "github.com/ipfs/go-bitswap/message"
 	"github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipfs/go-ipfs-config"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	dag "github.com/ipfs/go-merkledag"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
@@ -25,7 +29,7 @@ const (
 
 // OnlineExchange creates new LibP2P backed block exchange (BitSwap)
 func OnlineExchange(cfg *config.Config, provide bool) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore, dstore datastore.Datastore) exchange.Interface {
 		bitswapNetwork := network.NewFromIpfsHost(host, rt)
 
 		var internalBsCfg config.InternalBitswap
@@ -39,6 +43,7 @@ func OnlineExchange(cfg *config.Config, provide bool) interface{} {
 			bitswap.TaskWorkerCount(int(internalBsCfg.TaskWorkerCount.WithDefault(DefaultTaskWorkerCount))),
 			bitswap.EngineTaskWorkerCount(int(internalBsCfg.EngineTaskWorkerCount.WithDefault(DefaultEngineTaskWorkerCount))),
 			bitswap.MaxOutstandingBytesPerPeer(int(internalBsCfg.MaxOutstandingBytesPerPeer.WithDefault(DefaultMaxOutstandingBytesPerPeer))),
+			bitswap.WithTierCidSource(tierCidSource(dstore)),
 		}
 		exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs, opts...)
 		lc.Append(fx.Hook{
@@ -50,3 +55,26 @@ func OnlineExchange(cfg *config.Config, provide bool) interface{} {
 
 	}
 }
+
+// tierCidSource answers the TierCid requests of peers with the TierCids the
+// node recorded, for the roots it imported or pinned.
+func tierCidSource(dstore datastore.Datastore) network.TierCidHandler {
+	store := dag.NewTierCidStore(dstore)
+	return func(ctx context.Context, root cid.Cid) (*bsmsg.TierCid, bool) {
+		tc, ok := dag.UnPinBuffer.Peek(root)
+		if !ok {
+			// The TierCids of the pins are loaded at start-up, with the
+			// pinner.
+			dag.PinBufferMutex.Lock()
+			tc, ok = dag.PinBuffer[root]
+			dag.PinBufferMutex.Unlock()
+		}
+		if !ok {
+			var err error
+			if tc, err = store.Get(ctx, root); err != nil {
+				return nil, false
+			}
+		}
+		return &bsmsg.TierCid{NonLeaf: tc.NonLeaf, Leaf: tc.Leaf}, true
+	}
+}
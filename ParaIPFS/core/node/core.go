@@ -12,6 +12,7 @@ import (
 	"github.com/ipfs/go-filestore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	pin "github.com/ipfs/go-ipfs-pinner"
 	"github.com/ipfs/go-ipfs-pinner/dspinner"
 	format "github.com/ipfs/go-ipld-format"
@@ -61,6 +62,14 @@ func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo)
 		return nil, err
 	}
 
+	// The TierCids of the pins are loaded once, now, so that the readers,
+	// the provider and the TierCid requests of peers never wait for them.
+	// Those missing are rebuilt from the local blocks only.
+	pinning.SetOfflineDAG(merkledag.NewDAGService(blockservice.New(bstore, offline.Exchange(bstore))))
+	if err := merkledag.LoadPinBuffer(ctx); err != nil {
+		return nil, fmt.Errorf("cannot load TierCids: %w", err)
+	}
+
 	return pinning, nil
 }
 
@@ -192,6 +192,10 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		fx.Provide(Datastore),
 		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead)),
 		finalBstore,
+		fx.Provide(ParallelConfig(cfg.Parallel)),
+		fx.Invoke(SetSyncConcurrency),
+		fx.Invoke(SetTierCidCacheSize(cfg.Datastore.TierCidCacheSize)),
+		fx.Invoke(SetDurability(cfg.Datastore.Durability)),
 	)
 }
 
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	config "github.com/ipfs/go-ipfs-config"
+
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// Parallel holds the number of workers of the parallel paths of the node,
+// resolved from the Parallel section of the config.
+type Parallel struct {
+	Import int
+	Read   int
+	GC     int
+	Verify int
+	Fsync  int
+}
+
+const (
+	// maxAutoWorkers bounds the pools sized by "auto".
+	maxAutoWorkers = 512
+	// autoLatencyUnit is the sync latency worth one more in-flight I/O
+	// per CPU in the pools sized by "auto".
+	autoLatencyUnit = 250 * time.Microsecond
+	// solidStateLatency is the sync latency below which the repo is
+	// taken to be on a disk that serves many syncs at once.
+	solidStateLatency = time.Millisecond
+	// latencyProbes is the number of synced writes measuring the latency.
+	latencyProbes = 4
+)
+
+// ParallelConfig resolves the Parallel section of the config. The "auto"
+// entries are sized from the CPU count and the sync latency of the disk
+// the repo is on, which is only measured when one of them needs it.
+func ParallelConfig(cfg config.Parallel) func(repo repo.Repo) Parallel {
+	return func(repo repo.Repo) Parallel {
+		var latency time.Duration
+		if cfg.Import.IsAuto() || cfg.Read.IsAuto() || cfg.GC.IsAuto() || cfg.Verify.IsAuto() || cfg.Fsync.IsAuto() {
+			if r, ok := repo.(interface{ Path() string }); ok {
+				latency = syncLatency(r.Path())
+			}
+		}
+		auto := autoParallel(runtime.NumCPU(), latency)
+
+		return Parallel{
+			Import: cfg.Import.WithDefault(auto.Import),
+			Read:   cfg.Read.WithDefault(auto.Read),
+			GC:     cfg.GC.WithDefault(auto.GC),
+			Verify: cfg.Verify.WithDefault(auto.Verify),
+			Fsync:  cfg.Fsync.WithDefault(auto.Fsync),
+		}
+	}
+}
+
+// autoParallel sizes the pools for cpus CPUs and a disk syncing a small
+// write in latency. The slower the disk, the more I/O every CPU keeps in
+// flight to hide it; syncs are only issued concurrently on solid-state
+// disks, which serve them in parallel.
+func autoParallel(cpus int, latency time.Duration) Parallel {
+	depth := 1 + int(latency/autoLatencyUnit)
+	if depth > 64 {
+		depth = 64
+	}
+	workers := cpus * depth
+	if workers > maxAutoWorkers {
+		workers = maxAutoWorkers
+	}
+
+	fsync := flatfs.SyncThreadsMax
+	if latency < solidStateLatency && 4*cpus > fsync {
+		fsync = 4 * cpus
+		if fsync > 64 {
+			fsync = 64
+		}
+	}
+
+	return Parallel{
+		Import: workers,
+		Read:   workers,
+		GC:     workers,
+		Verify: workers,
+		Fsync:  fsync,
+	}
+}
+
+// syncLatency returns the average time taken to write and sync a block
+// sized file under dir, or 0 if it cannot be measured.
+func syncLatency(dir string) time.Duration {
+	f, err := ioutil.TempFile(dir, ".latency-")
+	if err != nil {
+		return 0
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	buf := make([]byte, 4096)
+	start := time.Now()
+	for i := 0; i < latencyProbes; i++ {
+		if _, err := f.WriteAt(buf, int64(i*len(buf))); err != nil {
+			return 0
+		}
+		if err := f.Sync(); err != nil {
+			return 0
+		}
+	}
+	return time.Since(start) / latencyProbes
+}
+
+// SetSyncConcurrency applies the Fsync setting to the flatfs datastores.
+func SetSyncConcurrency(p Parallel) {
+	flatfs.SetSyncConcurrency(p.Fsync)
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-fetcher"
 	"github.com/ipfs/go-ipfs-pinner"
 	"github.com/ipfs/go-ipfs-provider"
 	"github.com/ipfs/go-ipfs-provider/batched"
 	q "github.com/ipfs/go-ipfs-provider/queue"
 	"github.com/ipfs/go-ipfs-provider/simple"
+	dag "github.com/ipfs/go-merkledag"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"github.com/multiformats/go-multihash"
 	"go.uber.org/fx"
@@ -159,6 +161,10 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 		keyProvider = fx.Provide(pinnedProviderStrategy(true))
 	case "pinned":
 		keyProvider = fx.Provide(pinnedProviderStrategy(false))
+	case "tiercid":
+		keyProvider = fx.Provide(tierCidProviderStrategy(false))
+	case "tiercid-nonleaf":
+		keyProvider = fx.Provide(tierCidProviderStrategy(true))
 	default:
 		return fx.Error(fmt.Errorf("unknown reprovider strategy '%s'", reprovideStrategy))
 	}
@@ -181,3 +187,33 @@ func pinnedProviderStrategy(onlyRoots bool) interface{} {
 		return simple.NewPinnedProvider(onlyRoots, in.Pinner, in.IPLDFetcher)
 	}
 }
+
+func tierCidProviderStrategy(onlyNonLeaf bool) interface{} {
+	type input struct {
+		fx.In
+		Pinner      pin.Pinner
+		IPLDFetcher fetcher.Factory `name:"ipldFetcher"`
+		Repo        repo.Repo
+	}
+	return func(in input) simple.KeyChanFunc {
+		return simple.NewTierCidProvider(onlyNonLeaf, in.Pinner, pinnedTierCids(in.Repo), in.IPLDFetcher)
+	}
+}
+
+// pinnedTierCids looks the TierCids of the recursive pins up in PinBuffer,
+// loaded at start-up with the pinner, then in the datastore.
+func pinnedTierCids(repo repo.Repo) simple.TierCidIndex {
+	store := dag.NewTierCidStore(repo.Datastore())
+	return func(ctx context.Context, root cid.Cid) ([]cid.Cid, []cid.Cid, bool) {
+		dag.PinBufferMutex.Lock()
+		tc, ok := dag.PinBuffer[root]
+		dag.PinBufferMutex.Unlock()
+		if !ok {
+			var err error
+			if tc, err = store.Get(ctx, root); err != nil {
+				return nil, nil, false
+			}
+		}
+		return tc.NonLeaf, tc.Leaf, true
+	}
+}
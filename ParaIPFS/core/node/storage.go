@@ -1,13 +1,19 @@
 package node
 
 import (
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
 	"github.com/ipfs/go-datastore"
+	flatfs "github.com/ipfs/go-ds-flatfs"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipfs/go-ipfs-config"
+	dag "github.com/ipfs/go-merkledag"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-filestore"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
 )
@@ -53,7 +59,11 @@ func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead
 func GcBlockstoreCtor(bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore) {
 	gclocker = blockstore.NewGCLocker()
 	gcbs = blockstore.NewGCBlockstore(bb, gclocker)
+	// the write barrier lets the GC sweep incrementally, and must see every
+	// PinLock
+	gcbs = gc.NewWriteBarrier(gcbs)
 
+	gclocker = gcbs
 	bs = gcbs
 	return
 }
@@ -66,7 +76,39 @@ func FilestoreBlockstoreCtor(repo repo.Repo, bb BaseBlocks) (gclocker blockstore
 	fstore = filestore.NewFilestore(bb, repo.FileManager())
 	gcbs = blockstore.NewGCBlockstore(fstore, gclocker)
 	gcbs = &verifbs.VerifBSGC{GCBlockstore: gcbs}
+	gcbs = gc.NewWriteBarrier(gcbs)
 
+	gclocker = gcbs
 	bs = gcbs
 	return
 }
+
+// SetTierCidCacheSize sets the budget of the cache of the TierCids of
+// unpinned roots, given in Datastore.TierCidCacheSize.
+func SetTierCidCacheSize(size string) func() error {
+	return func() error {
+		if size == "" {
+			dag.UnPinBuffer.SetBudget(dag.DefaultTierCidCacheSize)
+			return nil
+		}
+		budget, err := humanize.ParseBytes(size)
+		if err != nil {
+			return fmt.Errorf("invalid Datastore.TierCidCacheSize: %w", err)
+		}
+		dag.UnPinBuffer.SetBudget(int64(budget))
+		return nil
+	}
+}
+
+// SetDurability sets how the flatfs datastores make their writes durable,
+// given in Datastore.Durability.
+func SetDurability(mode string) func() error {
+	return func() error {
+		d, err := flatfs.ParseDurability(mode)
+		if err != nil {
+			return fmt.Errorf("invalid Datastore.Durability: %w", err)
+		}
+		flatfs.SetDurability(d)
+		return nil
+	}
+}
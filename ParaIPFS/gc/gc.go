@@ -5,17 +5,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	dstore "github.com/ipfs/go-datastore"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
-	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	pin "github.com/ipfs/go-ipfs-pinner"
 	ipld "github.com/ipfs/go-ipld-format"
@@ -25,16 +21,17 @@ import (
 )
 
 var log = logging.Logger("gc")
-var HasTime = 0
-
-// var numThread = 32
-// var IPFS_Path = "/home/mssong/.ipfs"
 
 // Result represents an incremental output from a garbage collection
 // run.  It contains either an error, or the cid of a removed object.
+// In a dry run, KeyRemoved is a block that would be removed, along with its
+// Size and the Reason why.
 type Result struct {
 	KeyRemoved cid.Cid
 	Error      error
+
+	Size   int
+	Reason Reason
 }
 
 // converts a set of CIDs with different codecs to a set of CIDs with the raw codec.
@@ -47,106 +44,99 @@ func toRawCids(set *cid.Set) (*cid.Set, error) {
 	return newSet, err
 }
 
+// tierCidLoader is implemented by pinners that persist the TierCids of their
+// recursive pins and load them into dag.PinBuffer on demand.
+type tierCidLoader interface {
+	LoadTierCids(ctx context.Context) error
+}
+
 func OptColoredSet() *cid.Set {
 	gcs := cid.NewSet()
 
-	// fmt.Printf("OptColoredSet Map:%+v\n", dag.FileCidMap)
-	// fmt.Printf("dag.FileCidMap:%+v\n", dag.FileCidMap)
-	for _, tieredCID := range dag.PinBuffer {
+	dag.PinBufferMutex.Lock()
+	defer dag.PinBufferMutex.Unlock()
+	for root, tieredCID := range dag.PinBuffer {
+		gcs.Visit(toCidV1(root))
 		for _, cid := range tieredCID.NonLeaf {
-			// fmt.Printf("OptColoredSet_cid:%v\n", cid)
-			// fmt.Printf("OptColoredSet_cidV1:%v\n", toCidV1(cid))
 			gcs.Visit(toCidV1(cid))
 		}
 		for _, cid := range tieredCID.Leaf {
-			// fmt.Printf("OptColoredSet_cid:%v\n", cid)
-			// fmt.Printf("OptColoredSet_cidV1:%v\n", toCidV1(cid))
 			gcs.Visit(toCidV1(cid))
 		}
 	}
-
-	// for _, val := range dag.UnpinnedCidMap {
-	// 	for _, cid := range val {
-	// 		gcs.Visit(toCidV1(cid))
-	// 	}
-	// }
-	fmt.Println("gcs.Len():", gcs.Len())
 	return gcs
 }
 
-func encode(key dstore.Key) (dirPath, filePath string) {
-	// dir: /home/mssong/.ipfs/blocks/7P path: /home/mssong/.ipfs/blocks/7P/CIQKGXY65BAIM2G5C64GRJOK2SGPDAXNG5VGHVHW7KFQ3PFFF5YH7PI.data
-	extension := ".data"
-	noslash := key.String()[1:]
-	// datastorePath := "/home/mssong/.ipfs/blocks"
-	datastorePath := dag.IPFS_Path + "/blocks"
-
-	dirPath = filepath.Join(datastorePath, noslash[len(noslash)-3:len(noslash)-1])
-	filePath = filepath.Join(dirPath, noslash+extension)
-	return dirPath, filePath
+// removeSet calls remove on every key that is not in gcs. It returns false
+// if some of the keys could not be removed.
+func removeSet(gcs *cid.Set, keys []cid.Cid, ctx context.Context, remove func(context.Context, cid.Cid) error, output chan Result) bool {
+	ok := true
+	for _, key := range keys {
+		if gcs.Has(key) {
+			continue
+		}
+		err := remove(ctx, key)
+		if err != nil {
+			ok = false
+			select {
+			case output <- Result{Error: &CannotDeleteBlockError{key, err}}:
+			case <-ctx.Done():
+				return ok
+			}
+			// continue as error is non-fatal
+			continue
+		}
+		select {
+		case output <- Result{KeyRemoved: key}:
+		case <-ctx.Done():
+			return ok
+		}
+	}
+	return ok
 }
 
-func removeSet(gcs *cid.Set, keys []cid.Cid, ctx context.Context, bs bstore.GCBlockstore, output chan Result) {
-	// removeKeys := make([]cid.Cid, 0)
-	fmt.Println("keys length:", len(keys))
-	if len(keys) > 0 {
-		for _, key := range keys {
-			st := time.Now()
-			has := gcs.Has(key)
-			elap := time.Since(st)
-			HasTime = HasTime + int(elap)
-			if !has {
-				/////
-				// err := bs.DeleteBlock(ctx, key)
-				////
-				dsKey := dshelp.MultihashToDsKey(key.Hash())
-				_, filePath := encode(dsKey)
-				// fmt.Println("filePath:", filePath)
-				err := os.Remove(filePath)
-				if err != nil {
-					select {
-					case output <- Result{Error: &CannotDeleteBlockError{key, err}}:
-					case <-ctx.Done():
-						println("break loop_1")
-						return
-					}
-					// continue as error is non-fatal
-					println("continue loop@@@")
-					continue
-				}
-				select {
-				case output <- Result{KeyRemoved: key}:
-				case <-ctx.Done():
-					println("break loop_2")
-					break
-				}
-			}
+// removeBatchSize is the number of blocks parallelRemoveSet hands to a single
+// DeleteManyParallel call.
+var removeBatchSize = 4096
+
+// parallelRemoveSet deletes every key that is not in gcs from bs, using up to
+// numTh parallel deletes. When a batch fails, its keys are deleted one by one
+// to report the ones that cannot be removed. It returns false if some of the
+// keys could not be removed.
+func parallelRemoveSet(gcs *cid.Set, allkeys []cid.Cid, numTh int, ctx context.Context, bs bstore.Blockstore, output chan Result) bool {
+	toRemove := make([]cid.Cid, 0, len(allkeys))
+	for _, key := range allkeys {
+		if !gcs.Has(key) {
+			toRemove = append(toRemove, key)
 		}
 	}
-	// return removeKeys
 
-}
-func parallelRemoveSet(gcs *cid.Set, allkeys []cid.Cid, numTh int, ctx context.Context, bs bstore.GCBlockstore, output chan Result) {
-	// removeKeys := make([]cid.Cid, numTh)
-	if len(allkeys) < numTh {
-		removeSet(gcs, allkeys, ctx, bs, output)
-	} else {
-		size := len(allkeys) / numTh
-		var wg sync.WaitGroup
-
-		for i := 0; i < numTh; i++ {
-			wg.Add(1)
-			go func(i int) {
-				defer wg.Done()
-				begin, end := i*size, (i+1)*size
-				if end > len(allkeys) {
-					end = len(allkeys)
-				}
-				removeSet(gcs, allkeys[begin:end], ctx, bs, output)
-			}(i)
+	ok := true
+	for begin := 0; begin < len(toRemove); begin += removeBatchSize {
+		end := begin + removeBatchSize
+		if end > len(toRemove) {
+			end = len(toRemove)
+		}
+		batch := toRemove[begin:end]
+
+		if err := bs.DeleteManyParallel(ctx, batch, numTh); err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			if !removeSet(cid.NewSet(), batch, ctx, bs.DeleteBlock, output) {
+				ok = false
+			}
+			continue
+		}
+		for _, key := range batch {
+			select {
+			case output <- Result{KeyRemoved: key}:
+			case <-ctx.Done():
+				return ok
+			}
 		}
-		wg.Wait()
 	}
+	return ok
 }
 
 // GC performs a mark and sweep garbage collection of the blocks in the blockstore
@@ -158,9 +148,37 @@ func parallelRemoveSet(gcs *cid.Set, allkeys []cid.Cid, numTh int, ctx context.C
 //
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
-func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
-	fmt.Println("@@GC start")
-	HasTime = 0
+//
+// How the marked set is built depends on the Mode given with WithMode. In
+// ModeFast only the TierCids in dag.PinBuffer are marked, see OptColoredSet.
+//
+// With WithIncremental, and a blockstore wrapped in a WriteBarrier, the GC
+// lock is only held for each batch of the sweep, see incrementalGC. With
+// WithDryRun nothing is deleted, see dryRun.
+func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, opts ...Option) <-chan Result {
+	o := gcOptions{mode: ModeHybrid}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = dag.NumThread
+	}
+
+	if o.report == nil {
+		o.report = &Report{}
+	}
+	*o.report = Report{Mode: o.mode, DryRun: o.dryRun}
+
+	if o.dryRun {
+		return dryRun(ctx, bs, pn, bestEffortRoots, o)
+	}
+	if o.batchSize > 0 {
+		if b, ok := bs.(*WriteBarrier); ok {
+			return incrementalGC(ctx, b, dstor, pn, bestEffortRoots, o)
+		}
+		log.Warn("the blockstore has no write barrier, sweeping it under the GC lock")
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 
 	unlocker := bs.GCLock(ctx)
@@ -175,91 +193,57 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 		defer cancel()
 		defer close(output)
 		defer unlocker.Unlock(ctx)
+		defer o.report.log()
 
-		gcOptFlag := true
-		if gcOptFlag {
-			startTime := time.Now()
-			gcsOpt := OptColoredSet() //optimization
-			// gcsOpt, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output) // traditional
-			if err != nil {
-				select {
-				case output <- Result{Error: err}:
-				case <-ctx.Done():
-				}
-				return
-			}
-			gcsOpt, err = toRawCids(gcsOpt)
-
-			if err != nil {
-				select {
-				case output <- Result{Error: err}:
-				case <-ctx.Done():
-				}
-				return
-			}
-			elapsedTime := time.Since(startTime)
-			fmt.Printf("######OptColoredSet time: %vms\n\n", elapsedTime.Milliseconds())
-			// fmt.Fprintf(f, "OptColoredSet time: %v\n", elapsedTime.Milliseconds())
-			fmt.Printf("gcsOpt:%+v\n\n", gcsOpt.Len())
-
-			// bigInt := new(big.Int)
-			// bigInt.SetInt64(elapsedTime.Milliseconds())
-			// bigInt.Bytes()
-
-			// f.WriteString("text to append\n")
-			// if _, err := f.Write([]byte("\nOptColoredSet time: ")); err != nil {
-			// 	log.Fatal(err)
-			// }
-			// if _, err := f.Write(bigInt.Bytes()); err != nil {
-			// 	log.Fatal(err)
-			// }
-
-			// Here !!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!
-			startTime = time.Now()
-			startTimAllKeys := time.Now()
-			allKeys, err := bs.AllKeysMansub(ctx)
-			elapsedAllKeys := time.Since(startTimAllKeys)
-			fmt.Printf("ONLY AllKeysMansub time: %vms\n", elapsedAllKeys.Milliseconds())
-			if err != nil {
-				select {
-				case output <- Result{Error: err}:
-				case <-ctx.Done():
-
+		if o.mode != ModeSafe {
+			// Make sure the persisted TierCids are in dag.PinBuffer
+			// before marking.
+			if l, ok := pn.(tierCidLoader); ok {
+				if err := l.LoadTierCids(ctx); err != nil {
+					select {
+					case output <- Result{Error: err}:
+					case <-ctx.Done():
+					}
+					return
 				}
-				return
 			}
-			// st := time.Now()
-			// removeSet(gcsOpt, allKeys, ctx, bs, output)
-			// elap := time.Since(st)
-			// fmt.Println("HasTime:", time.Duration(HasTime))
-			// fmt.Println("removeSet time:", elap)
-
-			parallelRemoveSet(gcsOpt, allKeys, dag.NumThread, ctx, bs, output)
-			elapsedTime = time.Since(startTime)
-			fmt.Printf("######Delete Block time(dag.NumThread = %d): %vms\n", dag.NumThread, elapsedTime.Milliseconds())
-			// fmt.Fprintf(f, "Delete Block time(numThread = %d): %v\n", numThread, elapsedTime.Milliseconds())
+		}
 
-		} else {
-			gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
-			if err != nil {
-				select {
-				case output <- Result{Error: err}:
-				case <-ctx.Done():
-				}
-				return
+		startTime := time.Now()
+		var gcs *cid.Set
+		switch o.mode {
+		case ModeFast:
+			gcs = OptColoredSet()
+		case ModeHybrid:
+			gcs, err = HybridColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		default:
+			gcs, err = ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		}
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
 			}
+			return
+		}
 
-			// The blockstore reports raw blocks. We need to remove the codecs from the CIDs.
-			gcs, err = toRawCids(gcs)
-			if err != nil {
-				select {
-				case output <- Result{Error: err}:
-				case <-ctx.Done():
-				}
-				return
+		// The blockstore reports raw blocks. We need to remove the codecs from the CIDs.
+		gcs, err = toRawCids(gcs)
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
 			}
+			return
+		}
+		o.report.Mark = time.Since(startTime)
+		o.report.Marked = gcs.Len()
 
+		errors := false
+		if o.mode == ModeSafe {
+			startTime = time.Now()
 			keychan, err := bs.AllKeysChan(ctx)
+			o.report.ListKeys = time.Since(startTime)
 			if err != nil {
 				select {
 				case output <- Result{Error: err}:
@@ -268,21 +252,21 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 				return
 			}
 
-			errors := false
-			var removed uint64
-
 		loop:
 			for ctx.Err() == nil { // select may not notice that we're "done".
+				startTime = time.Now()
 				select {
 				case k, ok := <-keychan:
+					o.report.ListKeys += time.Since(startTime)
 					if !ok {
 						break loop
 					}
 					// NOTE: assumes that all CIDs returned by the keychan are _raw_ CIDv1 CIDs.
 					// This means we keep the block as long as we want it somewhere (CIDv1, CIDv0, Raw, other...).
 					if !gcs.Has(k) {
+						startTime = time.Now()
 						err := bs.DeleteBlock(ctx, k)
-						removed++
+						o.report.Sweep += time.Since(startTime)
 						if err != nil {
 							errors = true
 							select {
@@ -303,15 +287,37 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 					break loop
 				}
 			}
-			if errors {
+		} else {
+			startTime = time.Now()
+			allKeys, err := bs.AllKeysMansub(ctx)
+			o.report.ListKeys = time.Since(startTime)
+			if err != nil {
 				select {
-				case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+				case output <- Result{Error: err}:
 				case <-ctx.Done():
-					return
 				}
+				return
 			}
 
+			startTime = time.Now()
+			errors = !parallelRemoveSet(gcs, allKeys, o.concurrency, ctx, bs, output)
+			o.report.Sweep = time.Since(startTime)
 		}
+
+		// The cached TierCids of unpinned DAGs that were not marked
+		// list blocks that are gone now.
+		dag.UnPinBuffer.InvalidateFunc(func(c cid.Cid) bool {
+			return !gcs.Has(cid.NewCidV1(cid.Raw, c.Hash()))
+		})
+
+		if errors {
+			select {
+			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
 		gds, ok := dstor.(dstore.GCDatastore)
 		if !ok {
 			return
@@ -381,8 +387,76 @@ func toCidV1(c cid.Cid) cid.Cid {
 func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
 	// KeySet currently implemented in memory, in the future, may be bloom filter or
 	// disk backed to conserve memory.
-	errors := false
+	pins, err := listPins(ctx, pn)
+	if err != nil {
+		return nil, err
+	}
+	return coloredSet(ctx, pins, ng, bestEffortRoots, output, cid.NewSet())
+}
+
+// HybridColoredSet computes the same set as ColoredSet, but marks the
+// recursive pins that have a TierCid in dag.PinBuffer from it, as
+// OptColoredSet does, instead of walking their DAGs. The other recursive pins,
+// the direct and internal pins and the best-effort roots are walked as in
+// ColoredSet, and stop at the blocks already marked.
+func HybridColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
+	pins, err := listPins(ctx, pn)
+	if err != nil {
+		return nil, err
+	}
+	return hybridColoredSet(ctx, pins, ng, bestEffortRoots, output)
+}
+
+func hybridColoredSet(ctx context.Context, pins *pinSnapshot, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
 	gcs := cid.NewSet()
+	walk := *pins
+	walk.recursive = nil
+	dag.PinBufferMutex.Lock()
+	for _, root := range pins.recursive {
+		tieredCID, ok := dag.PinBuffer[root]
+		if !ok {
+			walk.recursive = append(walk.recursive, root)
+			continue
+		}
+		gcs.Add(toCidV1(root))
+		for _, c := range tieredCID.NonLeaf {
+			gcs.Add(toCidV1(c))
+		}
+		for _, c := range tieredCID.Leaf {
+			gcs.Add(toCidV1(c))
+		}
+	}
+	dag.PinBufferMutex.Unlock()
+
+	return coloredSet(ctx, &walk, ng, bestEffortRoots, output, gcs)
+}
+
+// pinSnapshot lists the pins of a pinner at some point in time.
+type pinSnapshot struct {
+	recursive []cid.Cid
+	direct    []cid.Cid
+	internal  []cid.Cid
+}
+
+func listPins(ctx context.Context, pn pin.Pinner) (*pinSnapshot, error) {
+	var pins pinSnapshot
+	var err error
+	if pins.recursive, err = pn.RecursiveKeys(ctx); err != nil {
+		return nil, err
+	}
+	if pins.direct, err = pn.DirectKeys(ctx); err != nil {
+		return nil, err
+	}
+	if pins.internal, err = pn.InternalPins(ctx); err != nil {
+		return nil, err
+	}
+	return &pins, nil
+}
+
+// coloredSet adds the nodes pinned by the given pins to gcs. Nodes already
+// in gcs are not walked.
+func coloredSet(ctx context.Context, pins *pinSnapshot, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result, gcs *cid.Set) (*cid.Set, error) {
+	errors := false
 	getLinks := func(ctx context.Context, cid cid.Cid) ([]*ipld.Link, error) {
 		links, err := ipld.GetLinks(ctx, ng, cid)
 		if err != nil {
@@ -395,11 +469,7 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 		return links, nil
 	}
-	rkeys, err := pn.RecursiveKeys(ctx)
-	if err != nil {
-		return nil, err
-	}
-	err = Descendants(ctx, getLinks, gcs, rkeys)
+	err := Descendants(ctx, getLinks, gcs, pins.recursive)
 	if err != nil {
 		errors = true
 		select {
@@ -431,19 +501,11 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		}
 	}
 
-	dkeys, err := pn.DirectKeys(ctx)
-	if err != nil {
-		return nil, err
-	}
-	for _, k := range dkeys {
+	for _, k := range pins.direct {
 		gcs.Add(toCidV1(k))
 	}
 
-	ikeys, err := pn.InternalPins(ctx)
-	if err != nil {
-		return nil, err
-	}
-	err = Descendants(ctx, getLinks, gcs, ikeys)
+	err = Descendants(ctx, getLinks, gcs, pins.internal)
 	if err != nil {
 		errors = true
 		select {
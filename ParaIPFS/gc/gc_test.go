@@ -0,0 +1,378 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// plainPinner hides LoadTierCids so that the tests control dag.PinBuffer.
+type plainPinner struct {
+	pin.Pinner
+}
+
+type gcFixture struct {
+	bs    *WriteBarrier
+	hooks *hookBlockstore
+	dstor ds.Datastore
+	dserv ipld.DAGService
+	pn    pin.Pinner
+
+	// keep lists every block that must survive a safe collection.
+	keep []cid.Cid
+	// garbage lists every block that is not reachable from anything.
+	garbage []cid.Cid
+	// bestEffort is the root that is passed to GC as bestEffortRoots.
+	bestEffort cid.Cid
+	// complete is a recursive pin whose TierCid lists all its blocks.
+	complete cid.Cid
+}
+
+// makeTree adds a tree of the given depth and fanout to dserv and returns its
+// root along with every block in it.
+func makeTree(t *testing.T, dserv ipld.DAGService, name string, depth, fanout int) (ipld.Node, []cid.Cid) {
+	ctx := context.Background()
+	if depth == 0 {
+		nd := dag.NewRawNode([]byte(name))
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd, []cid.Cid{nd.Cid()}
+	}
+
+	nd := dag.NodeWithData([]byte(name))
+	var all []cid.Cid
+	for i := 0; i < fanout; i++ {
+		child, blocks := makeTree(t, dserv, fmt.Sprintf("%s/%d", name, i), depth-1, fanout)
+		if err := nd.AddNodeLink(fmt.Sprint(i), child); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, blocks...)
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd, append(all, nd.Cid())
+}
+
+func resetPinBuffers() {
+	dag.PinBufferMutex.Lock()
+	dag.PinBuffer = make(map[cid.Cid]*dag.TierCid)
+	dag.PinBufferMutex.Unlock()
+	dag.UnPinBuffer = dag.NewTierCidCache(dag.DefaultTierCidCacheSize)
+}
+
+func newGCFixture(t *testing.T) *gcFixture {
+	ctx := context.Background()
+	resetPinBuffers()
+
+	dstor := dssync.MutexWrap(ds.NewMapDatastore())
+	hooks := &hookBlockstore{GCBlockstore: bstore.NewGCBlockstore(bstore.NewBlockstore(dstor), bstore.NewGCLocker())}
+	bs := NewWriteBarrier(hooks)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	p, err := dspinner.New(ctx, dstor, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &gcFixture{bs: bs, hooks: hooks, dstor: dstor, dserv: dserv, pn: plainPinner{p}}
+
+	// A recursive pin with a complete TierCid.
+	complete, blocks := makeTree(t, dserv, "complete", 3, 3)
+	if err = p.Pin(ctx, complete, true); err != nil {
+		t.Fatal(err)
+	}
+	f.complete = complete.Cid()
+	f.keep = append(f.keep, blocks...)
+
+	// A recursive pin without any TierCid.
+	missing, blocks := makeTree(t, dserv, "missing", 2, 4)
+	if err = p.Pin(ctx, missing, true); err != nil {
+		t.Fatal(err)
+	}
+	dag.PinBufferMutex.Lock()
+	delete(dag.PinBuffer, missing.Cid())
+	dag.PinBufferMutex.Unlock()
+	f.keep = append(f.keep, blocks...)
+
+	// A direct pin: only the root is kept, its children are garbage.
+	direct, blocks := makeTree(t, dserv, "direct", 1, 2)
+	if err = p.Pin(ctx, direct, false); err != nil {
+		t.Fatal(err)
+	}
+	f.keep = append(f.keep, direct.Cid())
+	f.garbage = append(f.garbage, blocks[:len(blocks)-1]...)
+
+	// An unpinned DAG reachable from the best effort roots, like MFS.
+	mfs, blocks := makeTree(t, dserv, "mfs", 2, 2)
+	f.bestEffort = mfs.Cid()
+	f.keep = append(f.keep, blocks...)
+
+	// Unreachable blocks.
+	_, blocks = makeTree(t, dserv, "garbage", 2, 3)
+	f.garbage = append(f.garbage, blocks...)
+
+	// The blocks used internally by the pinner.
+	if err = p.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	internal, err := p.InternalPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.keep = append(f.keep, internal...)
+
+	return f
+}
+
+func (f *gcFixture) run(t *testing.T, mode Mode, opts ...Option) []cid.Cid {
+	ctx := context.Background()
+	var removed []cid.Cid
+	opts = append([]Option{WithMode(mode)}, opts...)
+	for res := range GC(ctx, f.bs, f.dstor, f.pn, []cid.Cid{f.bestEffort}, opts...) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		removed = append(removed, res.KeyRemoved)
+	}
+	return removed
+}
+
+func (f *gcFixture) assertHas(t *testing.T, keys []cid.Cid, expected bool) {
+	for _, c := range keys {
+		has, err := f.bs.Has(context.Background(), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != expected {
+			t.Fatalf("block %s: expected present=%t", c, expected)
+		}
+	}
+}
+
+func TestGCKeepsReachableBlocks(t *testing.T) {
+	for _, mode := range []Mode{ModeSafe, ModeHybrid} {
+		t.Run(string(mode), func(t *testing.T) {
+			f := newGCFixture(t)
+			removed := f.run(t, mode)
+
+			f.assertHas(t, f.keep, true)
+			f.assertHas(t, f.garbage, false)
+			if len(removed) != len(f.garbage) {
+				t.Fatalf("expected %d removed blocks, got %d", len(f.garbage), len(removed))
+			}
+
+			// A second run has nothing left to remove.
+			if removed = f.run(t, mode); len(removed) != 0 {
+				t.Fatalf("expected nothing to be removed, got %v", removed)
+			}
+			f.assertHas(t, f.keep, true)
+		})
+	}
+}
+
+func TestGCInvalidatesTierCidCache(t *testing.T) {
+	ctx := context.Background()
+	f := newGCFixture(t)
+
+	kept, err := dag.BuildTierCid(ctx, f.dserv, f.bestEffort, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dag.UnPinBuffer.Add(f.bestEffort, kept)
+	stale := dag.NewTierCid()
+	stale.Leaf = f.garbage[len(f.garbage)-2:]
+	dag.UnPinBuffer.Add(f.garbage[len(f.garbage)-1], stale)
+
+	f.run(t, ModeHybrid)
+
+	if _, ok := dag.UnPinBuffer.Peek(f.bestEffort); !ok {
+		t.Fatal("the TierCid of a kept DAG should stay cached")
+	}
+	if _, ok := dag.UnPinBuffer.Peek(f.garbage[len(f.garbage)-1]); ok {
+		t.Fatal("the TierCid of a removed DAG should have been invalidated")
+	}
+}
+
+func TestHybridColoredSetMatchesColoredSet(t *testing.T) {
+	ctx := context.Background()
+	f := newGCFixture(t)
+	roots := []cid.Cid{f.bestEffort}
+
+	safe, err := ColoredSet(ctx, f.pn, f.dserv, roots, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hybrid, err := HybridColoredSet(ctx, f.pn, f.dserv, roots, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if safe.Len() != hybrid.Len() {
+		t.Fatalf("hybrid set has %d cids, safe set has %d", hybrid.Len(), safe.Len())
+	}
+	err = safe.ForEach(func(c cid.Cid) error {
+		if !hybrid.Has(c) {
+			return fmt.Errorf("%s missing from the hybrid set", c)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHybridColoredSetSkipsKnownDAGs(t *testing.T) {
+	ctx := context.Background()
+	f := newGCFixture(t)
+
+	dag.PinBufferMutex.Lock()
+	tc := dag.PinBuffer[f.complete]
+	dag.PinBufferMutex.Unlock()
+
+	// Without its blocks, the DAG can only be marked through the TierCid.
+	known := append(append([]cid.Cid{f.complete}, tc.NonLeaf...), tc.Leaf...)
+	for _, c := range known {
+		if err := f.bs.DeleteBlock(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := make(chan Result, len(known))
+	gcs, err := HybridColoredSet(ctx, f.pn, f.dserv, nil, output)
+	if err != nil {
+		t.Fatalf("hybrid marking fetched a known block: %s", (<-output).Error)
+	}
+	for _, c := range known {
+		if !gcs.Has(toCidV1(c)) {
+			t.Fatalf("%s missing from the hybrid set", c)
+		}
+	}
+}
+
+func TestOptColoredSet(t *testing.T) {
+	f := newGCFixture(t)
+	gcs := OptColoredSet()
+
+	dag.PinBufferMutex.Lock()
+	tc := dag.PinBuffer[f.complete]
+	dag.PinBufferMutex.Unlock()
+	for _, c := range append(append([]cid.Cid{f.complete}, tc.NonLeaf...), tc.Leaf...) {
+		if !gcs.Has(toCidV1(c)) {
+			t.Fatalf("%s missing from the fast set", c)
+		}
+	}
+	if gcs.Has(toCidV1(f.bestEffort)) {
+		t.Fatal("the fast set should only contain TierCids")
+	}
+}
+
+// hookBlockstore calls onAllKeys, when set, before listing its keys.
+type hookBlockstore struct {
+	bstore.GCBlockstore
+	onAllKeys func()
+}
+
+func (bs *hookBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	if bs.onAllKeys != nil {
+		bs.onAllKeys()
+	}
+	return bs.GCBlockstore.AllKeysChan(ctx)
+}
+
+// failingBlockstore cannot delete one of its blocks.
+type failingBlockstore struct {
+	bstore.Blockstore
+	fail cid.Cid
+}
+
+func (bs *failingBlockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	if c.Equals(bs.fail) {
+		return fmt.Errorf("cannot remove")
+	}
+	return bs.Blockstore.DeleteBlock(ctx, c)
+}
+
+func (bs *failingBlockstore) DeleteManyParallel(ctx context.Context, cs []cid.Cid, concurrency int) error {
+	for _, c := range cs {
+		if c.Equals(bs.fail) {
+			return fmt.Errorf("cannot remove")
+		}
+	}
+	return bs.Blockstore.DeleteManyParallel(ctx, cs, concurrency)
+}
+
+func TestParallelRemoveSet(t *testing.T) {
+	ctx := context.Background()
+	defer func(size int) { removeBatchSize = size }(removeBatchSize)
+	removeBatchSize = 3
+
+	bs := &failingBlockstore{Blockstore: bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))}
+	gcs := cid.NewSet()
+	var keys []cid.Cid
+	for i := 0; i < 11; i++ {
+		nd := dag.NewRawNode([]byte(fmt.Sprint(i)))
+		if err := bs.Put(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, nd.Cid())
+		if i%5 == 0 {
+			gcs.Add(nd.Cid())
+		}
+	}
+	bs.fail = keys[9]
+
+	removed := cid.NewSet()
+	output := make(chan Result, len(keys))
+	ok := parallelRemoveSet(gcs, keys, 3, ctx, bs, output)
+	close(output)
+	if ok {
+		t.Fatal("expected a removal failure to be reported")
+	}
+
+	var errs int
+	for res := range output {
+		if res.Error != nil {
+			errs++
+			continue
+		}
+		removed.Add(res.KeyRemoved)
+	}
+	// Keys 0, 5 and 10 are kept and key 9 cannot be removed. The other
+	// keys of its batch are still removed one by one.
+	if errs != 1 || removed.Len() != len(keys)-4 {
+		t.Fatalf("got %d errors and %d removed keys", errs, removed.Len())
+	}
+	for i, c := range keys {
+		has, err := bs.Has(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != 9 && removed.Has(c) == gcs.Has(c) {
+			t.Fatalf("key %d: removed=%t", i, removed.Has(c))
+		}
+		if has == removed.Has(c) {
+			t.Fatalf("key %d: removed=%t but present=%t", i, removed.Has(c), has)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for in, expected := range map[string]Mode{"": ModeHybrid, "fast": ModeFast, "safe": ModeSafe, "hybrid": ModeHybrid} {
+		mode, err := ParseMode(in)
+		if err != nil || mode != expected {
+			t.Fatalf("ParseMode(%q) = %q, %v", in, mode, err)
+		}
+	}
+	if _, err := ParseMode("quick"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,384 @@
+package gc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-verifcid"
+)
+
+// WriteBarrier is a GCBlockstore that an incremental GC can sweep while
+// blocks are put and pinned. While a sweep runs, the blocks put are
+// recorded, to be kept along with everything they link to, and the PinLock
+// sections are counted, so that the pins made meanwhile are marked too.
+type WriteBarrier struct {
+	bstore.GCBlockstore
+
+	// lk is held for reading by the puts, and for writing by each batch
+	// of the sweep, so that no block is put while the batch is deleted.
+	lk sync.RWMutex
+
+	shadeLk sync.Mutex
+	// shaded lists the blocks put since the last batch, or is nil when no
+	// sweep is running.
+	shaded *cid.Set
+
+	// pinLocks counts the PinLock sections that ended.
+	pinLocks uint64
+}
+
+// NewWriteBarrier wraps bs in a WriteBarrier.
+func NewWriteBarrier(bs bstore.GCBlockstore) *WriteBarrier {
+	return &WriteBarrier{GCBlockstore: bs}
+}
+
+func (b *WriteBarrier) Put(ctx context.Context, blk blocks.Block) error {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	b.shade(blk)
+	return b.GCBlockstore.Put(ctx, blk)
+}
+
+func (b *WriteBarrier) PutMany(ctx context.Context, blks []blocks.Block) error {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	b.shade(blks...)
+	return b.GCBlockstore.PutMany(ctx, blks)
+}
+
+func (b *WriteBarrier) PutManyParallel(ctx context.Context, blks []blocks.Block, concurrency int) error {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	b.shade(blks...)
+	return b.GCBlockstore.PutManyParallel(ctx, blks, concurrency)
+}
+
+// PinLock counts the section once it ends: when the sweep holds the GC
+// lock, the count covers every pin made so far.
+func (b *WriteBarrier) PinLock(ctx context.Context) bstore.Unlocker {
+	return &countingUnlocker{b.GCBlockstore.PinLock(ctx), &b.pinLocks}
+}
+
+type countingUnlocker struct {
+	bstore.Unlocker
+	count *uint64
+}
+
+func (u *countingUnlocker) Unlock(ctx context.Context) {
+	atomic.AddUint64(u.count, 1)
+	u.Unlocker.Unlock(ctx)
+}
+
+// shade records the blocks put during a sweep. Blocks already stored are
+// recorded as well: putting them again means they are wanted.
+func (b *WriteBarrier) shade(blks ...blocks.Block) {
+	b.shadeLk.Lock()
+	defer b.shadeLk.Unlock()
+	if b.shaded == nil {
+		return
+	}
+	for _, blk := range blks {
+		b.shaded.Add(blk.Cid())
+	}
+}
+
+func (b *WriteBarrier) startSweep() {
+	b.shadeLk.Lock()
+	b.shaded = cid.NewSet()
+	b.shadeLk.Unlock()
+}
+
+func (b *WriteBarrier) stopSweep() {
+	b.shadeLk.Lock()
+	b.shaded = nil
+	b.shadeLk.Unlock()
+}
+
+// takeShaded returns the blocks put since the last call.
+func (b *WriteBarrier) takeShaded() []cid.Cid {
+	b.shadeLk.Lock()
+	defer b.shadeLk.Unlock()
+	if b.shaded == nil || b.shaded.Len() == 0 {
+		return nil
+	}
+	keys := b.shaded.Keys()
+	b.shaded = cid.NewSet()
+	return keys
+}
+
+// incrementalGC collects the garbage of the blockstore behind b without
+// holding the GC lock for the whole run:
+//   - the pins are listed under the GC lock, then marked without it, as GC
+//     would for the mode,
+//   - the blockstore is then swept in batches of unmarked blocks. For each
+//     batch, the GC lock is taken, the pins made since the last batch are
+//     marked, and so are the blocks put meanwhile and everything they link
+//     to, before the batch is deleted.
+func incrementalGC(ctx context.Context, b *WriteBarrier, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, o gcOptions) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		s := &sweeper{
+			b:      b,
+			pn:     pn,
+			ng:     dag.NewDAGService(bserv.New(b, offline.Exchange(b))),
+			o:      o,
+			output: output,
+		}
+		if err := s.run(ctx, dstor, bestEffortRoots); err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return output
+}
+
+type sweeper struct {
+	b      *WriteBarrier
+	pn     pin.Pinner
+	ng     ipld.NodeGetter
+	o      gcOptions
+	output chan Result
+
+	// marked lists the raw CIDs of the blocks to keep.
+	marked *cid.Set
+	// walked lists the recursive and internal pins already marked.
+	walked *cid.Set
+	// pinLocks is the count of the WriteBarrier when the pins were last
+	// listed.
+	pinLocks uint64
+}
+
+func (s *sweeper) run(ctx context.Context, dstor dstore.Datastore, bestEffortRoots []cid.Cid) error {
+	s.b.startSweep()
+	defer s.b.stopSweep()
+
+	if s.o.mode != ModeSafe {
+		if l, ok := s.pn.(tierCidLoader); ok {
+			if err := l.LoadTierCids(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	defer s.o.report.log()
+
+	startTime := time.Now()
+	unlocker := s.b.GCLock(ctx)
+	s.pinLocks = atomic.LoadUint64(&s.b.pinLocks)
+	pins, err := listPins(ctx, s.pn)
+	unlocker.Unlock(ctx)
+	if err != nil {
+		return err
+	}
+
+	var gcs *cid.Set
+	switch s.o.mode {
+	case ModeFast:
+		gcs = OptColoredSet()
+	case ModeHybrid:
+		gcs, err = hybridColoredSet(ctx, pins, s.ng, bestEffortRoots, s.output)
+	default:
+		gcs, err = coloredSet(ctx, pins, s.ng, bestEffortRoots, s.output, cid.NewSet())
+	}
+	if err != nil {
+		return err
+	}
+	if s.marked, err = toRawCids(gcs); err != nil {
+		return err
+	}
+	s.walked = cid.NewSet()
+	for _, c := range append(pins.recursive, pins.internal...) {
+		s.walked.Add(c)
+	}
+	s.o.report.Mark = time.Since(startTime)
+	// The blocks marked during the sweep are counted at the end.
+	defer func() { s.o.report.Marked = s.marked.Len() }()
+
+	startTime = time.Now()
+	keys, err := s.b.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	failed := false
+	batch := make([]cid.Cid, 0, s.o.batchSize)
+	for k := range keys {
+		s.o.report.ListKeys += time.Since(startTime)
+		// NOTE: assumes that all CIDs returned by the keychan are _raw_ CIDv1 CIDs.
+		if !s.marked.Has(k) {
+			batch = append(batch, k)
+		}
+		if len(batch) == s.o.batchSize {
+			ok, err := s.sweep(ctx, batch)
+			if err != nil {
+				return err
+			}
+			failed = failed || !ok
+			batch = batch[:0]
+
+			if s.o.batchInterval > 0 {
+				select {
+				case <-time.After(s.o.batchInterval):
+				case <-ctx.Done():
+				}
+			}
+		}
+		startTime = time.Now()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(batch) > 0 {
+		ok, err := s.sweep(ctx, batch)
+		if err != nil {
+			return err
+		}
+		failed = failed || !ok
+	}
+
+	// The cached TierCids of unpinned DAGs that were not marked list
+	// blocks that are gone now.
+	dag.UnPinBuffer.InvalidateFunc(func(c cid.Cid) bool {
+		return !s.marked.Has(cid.NewCidV1(cid.Raw, c.Hash()))
+	})
+
+	if failed {
+		return ErrCannotDeleteSomeBlocks
+	}
+
+	if gds, ok := dstor.(dstore.GCDatastore); ok {
+		return gds.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// sweep deletes the blocks of batch that are still unmarked once the pins
+// made and the blocks put since the last batch are marked. It returns false
+// if some of them could not be deleted.
+func (s *sweeper) sweep(ctx context.Context, batch []cid.Cid) (bool, error) {
+	startTime := time.Now()
+	defer func() { s.o.report.Sweep += time.Since(startTime) }()
+
+	// Mark most of the blocks put since the last batch before blocking the
+	// puts.
+	if err := s.markShaded(ctx); err != nil {
+		return false, err
+	}
+
+	unlocker := s.b.GCLock(ctx)
+	defer unlocker.Unlock(ctx)
+	if err := s.markNewPins(ctx); err != nil {
+		return false, err
+	}
+
+	s.b.lk.Lock()
+	defer s.b.lk.Unlock()
+	if err := s.markShaded(ctx); err != nil {
+		return false, err
+	}
+
+	return parallelRemoveSet(s.marked, batch, s.o.concurrency, ctx, s.b, s.output), nil
+}
+
+// markShaded marks the blocks put since the last call and the DAGs under
+// them.
+func (s *sweeper) markShaded(ctx context.Context) error {
+	for _, c := range s.b.takeShaded() {
+		if err := s.markDAG(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markNewPins marks the pins made since they were last listed. It must be
+// called with the GC lock held.
+func (s *sweeper) markNewPins(ctx context.Context) error {
+	count := atomic.LoadUint64(&s.b.pinLocks)
+	if count == s.pinLocks {
+		return nil
+	}
+	s.pinLocks = count
+
+	pins, err := listPins(ctx, s.pn)
+	if err != nil {
+		return err
+	}
+	for _, c := range pins.direct {
+		s.marked.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+	}
+	for _, c := range append(pins.recursive, pins.internal...) {
+		if !s.walked.Visit(c) {
+			continue
+		}
+		if s.o.mode != ModeSafe {
+			dag.PinBufferMutex.Lock()
+			tc, ok := dag.PinBuffer[c]
+			dag.PinBufferMutex.Unlock()
+			if ok {
+				s.marked.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+				for _, l := range tc.NonLeaf {
+					s.marked.Add(cid.NewCidV1(cid.Raw, l.Hash()))
+				}
+				for _, l := range tc.Leaf {
+					s.marked.Add(cid.NewCidV1(cid.Raw, l.Hash()))
+				}
+				continue
+			}
+		}
+		if err := s.markDAG(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markDAG marks root and walks the DAG under it, down to the blocks already
+// marked. Root itself is walked even if it is marked: it may have been kept
+// alone, as a direct pin.
+func (s *sweeper) markDAG(ctx context.Context, root cid.Cid) error {
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		if c.Type() == cid.Raw {
+			return nil, nil
+		}
+		if err := verifcid.ValidateCid(c); err != nil {
+			return nil, err
+		}
+		links, err := ipld.GetLinks(ctx, s.ng, c)
+		if err == ipld.ErrNotFound {
+			// Not stored: there is nothing below it to keep.
+			return nil, nil
+		}
+		if err != nil {
+			select {
+			case s.output <- Result{Error: &CannotFetchLinksError{c, err}}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return nil, ErrCannotFetchAllLinks
+		}
+		return links, nil
+	}
+
+	return dag.Walk(ctx, getLinks, root, func(c cid.Cid) bool {
+		return s.marked.Visit(cid.NewCidV1(cid.Raw, c.Hash())) || c.Equals(root)
+	}, dag.Concurrent())
+}
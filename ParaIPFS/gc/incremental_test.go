@@ -0,0 +1,85 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestIncrementalGCKeepsReachableBlocks(t *testing.T) {
+	for _, mode := range []Mode{ModeSafe, ModeHybrid} {
+		t.Run(string(mode), func(t *testing.T) {
+			f := newGCFixture(t)
+			removed := f.run(t, mode, WithIncremental(4, time.Millisecond))
+
+			f.assertHas(t, f.keep, true)
+			f.assertHas(t, f.garbage, false)
+			if len(removed) != len(f.garbage) {
+				t.Fatalf("expected %d removed blocks, got %d", len(f.garbage), len(removed))
+			}
+
+			if removed = f.run(t, mode, WithIncremental(4, 0)); len(removed) != 0 {
+				t.Fatalf("expected nothing to be removed, got %v", removed)
+			}
+			f.assertHas(t, f.keep, true)
+		})
+	}
+}
+
+func TestIncrementalGCKeepsWrites(t *testing.T) {
+	for _, mode := range []Mode{ModeSafe, ModeHybrid} {
+		t.Run(string(mode), func(t *testing.T) {
+			ctx := context.Background()
+			f := newGCFixture(t)
+
+			// The children of the direct pin come first in the garbage,
+			// followed by the unreachable tree, its root last.
+			reput, err := f.bs.Get(ctx, f.garbage[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := f.garbage[2:]
+			root, err := f.dserv.Get(ctx, tree[len(tree)-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			added := dag.NewRawNode([]byte("added during the sweep"))
+
+			// Once the pins are marked, pin the unreachable tree, put
+			// back a garbage block and add a new one.
+			f.hooks.onAllKeys = func() {
+				f.hooks.onAllKeys = nil
+				unlocker := f.bs.PinLock(ctx)
+				defer unlocker.Unlock(ctx)
+				if err := f.pn.Pin(ctx, root, true); err != nil {
+					t.Error(err)
+				}
+				if err := f.pn.Flush(ctx); err != nil {
+					t.Error(err)
+				}
+				if err := f.bs.Put(ctx, reput); err != nil {
+					t.Error(err)
+				}
+				if err := f.dserv.Add(ctx, added); err != nil {
+					t.Error(err)
+				}
+			}
+			f.run(t, mode, WithIncremental(2, 0))
+
+			f.assertHas(t, f.keep, true)
+			f.assertHas(t, tree, true)
+			f.assertHas(t, []cid.Cid{reput.Cid(), added.Cid()}, true)
+			f.assertHas(t, f.garbage[1:2], false)
+
+			// The new pin is kept by a full run too, along with its
+			// internal pins, which are not garbage.
+			f.run(t, mode)
+			f.assertHas(t, f.keep, true)
+			f.assertHas(t, tree, true)
+			f.assertHas(t, []cid.Cid{reput.Cid(), added.Cid()}, false)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gc
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mode selects how GC builds the set of blocks to keep.
+type Mode string
+
+const (
+	// ModeFast only keeps the blocks recorded in the TierCids of
+	// dag.PinBuffer. Direct pins, bestEffortRoots, internal pinner blocks
+	// and recursive pins without a TierCid are not protected.
+	ModeFast Mode = "fast"
+	// ModeSafe walks the DAG of every pin like upstream go-ipfs.
+	ModeSafe Mode = "safe"
+	// ModeHybrid marks the recursive pins that have a known TierCid from
+	// it, as ModeFast does, and walks the DAGs for everything else.
+	ModeHybrid Mode = "hybrid"
+)
+
+// ParseMode parses a GC mode as found in the configuration. An empty string
+// selects ModeHybrid.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "":
+		return ModeHybrid, nil
+	case ModeFast, ModeSafe, ModeHybrid:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("unknown GC mode %q, expected %q, %q or %q", s, ModeFast, ModeSafe, ModeHybrid)
+	}
+}
+
+type gcOptions struct {
+	mode        Mode
+	concurrency int
+
+	// batchSize and batchInterval are set by WithIncremental.
+	batchSize     int
+	batchInterval time.Duration
+
+	dryRun bool
+	report *Report
+}
+
+// Option configures a GC run.
+type Option func(*gcOptions)
+
+// WithMode sets the Mode used by GC. The default is ModeHybrid.
+func WithMode(mode Mode) Option {
+	return func(o *gcOptions) {
+		o.mode = mode
+	}
+}
+
+// WithConcurrency sets the number of blocks GC deletes at once. The default
+// is dag.NumThread.
+func WithConcurrency(n int) Option {
+	return func(o *gcOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithIncremental makes GC sweep the blockstore in batches of batchSize
+// blocks, waiting for batchInterval after each, and only take the GC lock
+// for each batch. The blockstore must be wrapped in a WriteBarrier, else GC
+// holds the GC lock for the whole run. A batchSize below 1 disables it.
+func WithIncremental(batchSize int, batchInterval time.Duration) Option {
+	return func(o *gcOptions) {
+		o.batchSize = batchSize
+		o.batchInterval = batchInterval
+	}
+}
+
+// WithDryRun makes GC only output the blocks it would remove, along with
+// their size and the reason why, without deleting anything.
+func WithDryRun() Option {
+	return func(o *gcOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithReport makes GC fill r in before closing its output channel.
+func WithReport(r *Report) Option {
+	return func(o *gcOptions) {
+		o.report = r
+	}
+}
@@ -0,0 +1,144 @@
+package gc
+
+import (
+	"context"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// Reason tells why a dry run would remove a block.
+type Reason string
+
+const (
+	// ReasonUnreachable is given for the blocks that are not reachable
+	// from the pins, the best effort roots or the internal pins.
+	ReasonUnreachable Reason = "unreachable"
+	// ReasonNotInTierCid is given in ModeFast for the blocks that are
+	// reachable, but listed in no TierCid of a pinned root.
+	ReasonNotInTierCid Reason = "not-in-tiercid"
+)
+
+// Report sums up a GC run, see WithReport.
+type Report struct {
+	Mode   Mode
+	DryRun bool `json:",omitempty"`
+
+	// Marked is the number of blocks to keep, once marked.
+	Marked int
+
+	// Mark, ListKeys and Sweep are the time spent in each phase: marking
+	// the blocks to keep, listing the blocks of the blockstore, and
+	// deleting the unmarked ones. When the blocks are deleted as they are
+	// listed, the time spent waiting for the next key is counted as
+	// listing.
+	Mark     time.Duration
+	ListKeys time.Duration
+	Sweep    time.Duration
+}
+
+func (r *Report) log() {
+	log.Infof("%s GC: %d blocks marked in %s, keys listed in %s, swept in %s",
+		r.Mode, r.Marked, r.Mark, r.ListKeys, r.Sweep)
+}
+
+// dryRun outputs the blocks GC would remove, without taking the GC lock: the
+// blocks being added meanwhile may be listed too. In ModeFast, the blocks
+// that are reachable but would be removed as no TierCid lists them are told
+// apart, which requires walking the pins as ModeHybrid does.
+func dryRun(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, o gcOptions) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+	output := make(chan Result, 128)
+
+	go func() {
+		defer cancel()
+		defer close(output)
+
+		if err := listGarbage(ctx, bs, pn, bestEffortRoots, o, output); err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return output
+}
+
+func listGarbage(ctx context.Context, bs bstore.GCBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid, o gcOptions, output chan Result) error {
+	if o.mode != ModeSafe {
+		if l, ok := pn.(tierCidLoader); ok {
+			if err := l.LoadTierCids(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	startTime := time.Now()
+	ng := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pins, err := listPins(ctx, pn)
+	if err != nil {
+		return err
+	}
+
+	var gcs, reachable *cid.Set
+	switch o.mode {
+	case ModeFast:
+		gcs = OptColoredSet()
+		reachable, err = hybridColoredSet(ctx, pins, ng, bestEffortRoots, output)
+	case ModeHybrid:
+		gcs, err = hybridColoredSet(ctx, pins, ng, bestEffortRoots, output)
+	default:
+		gcs, err = coloredSet(ctx, pins, ng, bestEffortRoots, output, cid.NewSet())
+	}
+	if err != nil {
+		return err
+	}
+	if gcs, err = toRawCids(gcs); err != nil {
+		return err
+	}
+	if reachable != nil {
+		if reachable, err = toRawCids(reachable); err != nil {
+			return err
+		}
+	}
+	o.report.Mark = time.Since(startTime)
+	o.report.Marked = gcs.Len()
+	defer o.report.log()
+
+	startTime = time.Now()
+	defer func() { o.report.ListKeys = time.Since(startTime) }()
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	for k := range keys {
+		// NOTE: assumes that all CIDs returned by the keychan are _raw_ CIDv1 CIDs.
+		if gcs.Has(k) {
+			continue
+		}
+		size, err := bs.GetSize(ctx, k)
+		if err == bstore.ErrNotFound {
+			// Removed meanwhile.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		reason := ReasonUnreachable
+		if reachable != nil && reachable.Has(k) {
+			reason = ReasonNotInTierCid
+		}
+		select {
+		case output <- Result{KeyRemoved: k, Size: size, Reason: reason}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
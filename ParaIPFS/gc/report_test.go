@@ -0,0 +1,85 @@
+package gc
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestGCDryRun(t *testing.T) {
+	for _, mode := range []Mode{ModeSafe, ModeHybrid, ModeFast} {
+		t.Run(string(mode), func(t *testing.T) {
+			ctx := context.Background()
+			f := newGCFixture(t)
+			// The blockstore lists raw CIDs.
+			garbage := cid.NewSet()
+			for _, c := range f.garbage {
+				garbage.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+			}
+			keep := cid.NewSet()
+			for _, c := range f.keep {
+				keep.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+			}
+
+			var report Report
+			listed := cid.NewSet()
+			for res := range GC(ctx, f.bs, f.dstor, f.pn, []cid.Cid{f.bestEffort}, WithMode(mode), WithDryRun(), WithReport(&report)) {
+				if res.Error != nil {
+					t.Fatal(res.Error)
+				}
+				k := res.KeyRemoved
+				listed.Add(k)
+
+				size, err := f.bs.GetSize(ctx, k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Size != size {
+					t.Fatalf("%s: got size %d, expected %d", k, res.Size, size)
+				}
+				switch {
+				case garbage.Has(k):
+					if res.Reason != ReasonUnreachable {
+						t.Fatalf("garbage %s: got reason %q", k, res.Reason)
+					}
+				case mode == ModeFast && keep.Has(k):
+					if res.Reason != ReasonNotInTierCid {
+						t.Fatalf("reachable %s: got reason %q", k, res.Reason)
+					}
+				default:
+					t.Fatalf("%s should not be removed", k)
+				}
+			}
+
+			if listed.Len() < garbage.Len() {
+				t.Fatalf("listed %d blocks, expected at least the %d garbage ones", listed.Len(), garbage.Len())
+			}
+			if mode == ModeFast && listed.Len() == garbage.Len() {
+				t.Fatal("the fast mode should remove the pins without a TierCid")
+			}
+			if !report.DryRun || report.Mode != mode || report.Marked == 0 {
+				t.Fatalf("unexpected report %+v", report)
+			}
+
+			// Nothing was deleted.
+			f.assertHas(t, f.keep, true)
+			f.assertHas(t, f.garbage, true)
+		})
+	}
+}
+
+func TestGCReport(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithIncremental(4, 0)}} {
+		f := newGCFixture(t)
+		var report Report
+		f.run(t, ModeHybrid, append(opts, WithReport(&report))...)
+
+		if report.DryRun || report.Mode != ModeHybrid || report.Marked != len(f.keep) {
+			t.Fatalf("unexpected report %+v, expected %d marked blocks", report, len(f.keep))
+		}
+		if report.Mark <= 0 || report.ListKeys <= 0 || report.Sweep <= 0 {
+			t.Fatalf("missing timings in report %+v", report)
+		}
+	}
+}
@@ -447,7 +447,6 @@ func (r *FSRepo) openDatastore() error {
 	// Wrap it with metrics gathering
 	prefix := "ipfs.fsrepo.datastore"
 	r.ds = measure.New(prefix, r.ds)
-
 	return nil
 }
 
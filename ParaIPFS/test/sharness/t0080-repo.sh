@@ -108,12 +108,40 @@ test_expect_success "remove direct pin" '
   test_cmp expected6 actual6
 '
 
+test_expect_success "'ipfs repo gc --dry-run' lists file without removing it" '
+  HASH_MH=`cid-fmt -b base32 "%M" "$HASH"` &&
+  ipfs repo gc --dry-run -q | cid-fmt -b base32 --filter "%M" >dry_run_actual &&
+  grep "$HASH_MH" dry_run_actual &&
+  ipfs repo gc --dry-run >dry_run_out &&
+  grep "unreachable" dry_run_out &&
+  tail -n1 dry_run_out | grep "^would remove" &&
+  ipfs block stat $HASH
+'
+
+test_expect_success "'ipfs repo gc --dry-run --report=json' ends with a report" '
+  ipfs repo gc --dry-run --report=json | tail -n1 >report_out &&
+  grep "\"DryRun\":true" report_out &&
+  grep "\"Removed\":" report_out &&
+  ipfs block stat $HASH
+'
+
+test_expect_success "'ipfs repo gc --report' rejects unknown formats" '
+  test_must_fail ipfs repo gc --report=xml
+'
+
 test_expect_success "'ipfs repo gc' removes file" '
   ipfs block stat $HASH &&
   ipfs repo gc &&
   test_must_fail ipfs block stat $HASH
 '
 
+test_expect_success "'ipfs repo gc --report=json' reports each phase" '
+  ipfs repo gc --report=json >report_out &&
+  grep "\"Mark\":" report_out &&
+  grep "\"ListKeys\":" report_out &&
+  grep "\"Sweep\":" report_out
+'
+
 # Convert all to a base32-multihash as refs local outputs cidv1 raw
 # Technically converting refs local output would suffice, but this is more
 # future proof if we ever switch to adding the files with cid-version 1.
@@ -58,6 +58,12 @@ test_pins() {
     ipfs pin verify
   '
 
+  test_expect_success "see if verify --rehash $BASE_ARGS works" '
+    ipfs pin verify --rehash --verbose $BASE_ARGS > verify_out &&
+    test_should_contain "$HASH_A ok" verify_out &&
+    test_should_contain "$HASH_G ok" verify_out
+  '
+
   test_expect_success "see if verify --verbose $BASE_ARGS works" '
     ipfs pin verify --verbose $BASE_ARGS > verify_out &&
     test $(cat verify_out | wc -l) -ge 7 &&
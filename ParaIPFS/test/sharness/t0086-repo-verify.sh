@@ -57,4 +57,49 @@ do
   check_random_corruption
 done
 
+test_expect_success "add a pinned file" '
+  random 3000000 7 >pinned &&
+  PINNED=$(ipfs add -q pinned) &&
+  LEAF=$(ipfs refs $PINNED | tail -n 1) &&
+  LEAF_KEY=$(ipfs cid format -b base32upper -f "%M" $LEAF) &&
+  LEAF_FILE=$(find "$IPFS_PATH/blocks" -type f -name "$LEAF_KEY.data") &&
+  cp "$LEAF_FILE" leaf_backup
+'
+
+test_expect_success "corrupt one of its leaves" '
+  echo "this is super broken" >"$LEAF_FILE"
+'
+
+test_expect_success "repo verify reports the pin of the corrupt block" '
+  test_expect_code 1 ipfs repo verify --threads=2 >verify_out &&
+  grep "was corrupt" verify_out >corrupt_out &&
+  test $(wc -l <corrupt_out) -eq 1 &&
+  grep "pinned by $PINNED" corrupt_out
+'
+
+test_expect_success "pin verify --rehash reports the corrupt block under its pin" '
+  ipfs pin verify --rehash >pin_verify_out &&
+  test_should_contain "$PINNED broken" pin_verify_out &&
+  test_should_contain "$LEAF: block in storage has different hash than requested" pin_verify_out
+'
+
+test_expect_success "pin verify --rehash reports a missing block under its pin" '
+  rm "$LEAF_FILE" &&
+  ipfs pin verify --rehash --threads=2 >pin_verify_out &&
+  test_should_contain "$PINNED broken" pin_verify_out &&
+  test_should_contain "$LEAF: " pin_verify_out
+'
+
+test_expect_success "pin verify --rehash passes once the block is back" '
+  cp leaf_backup "$LEAF_FILE" &&
+  ipfs pin verify --rehash --verbose >pin_verify_out &&
+  test_should_contain "$PINNED ok" pin_verify_out &&
+  ipfs repo verify
+'
+
+test_expect_success "the number of threads must be positive" '
+  test_must_fail ipfs repo verify --threads=0 &&
+  test_must_fail ipfs pin verify --rehash --threads=0
+'
+
 test_done
@@ -0,0 +1,57 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the blocks of an add killed midway for each Datastore.Durability"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a large file" '
+  random 100000000 42 >bigfile
+'
+
+test_crash_add() {
+  mode=$1
+
+  test_expect_success "set Datastore.Durability to $mode" '
+    ipfs config Datastore.Durability $mode
+  '
+
+  test_launch_ipfs_daemon_without_network
+
+  test_expect_success "kill the daemon in the middle of an add ($mode)" '
+    { ipfs add -q bigfile >add_out 2>&1 & } &&
+    go-sleep 500ms &&
+    kill -9 $IPFS_PID &&
+    { wait $IPFS_PID || true; } &&
+    rm -f "$IPFS_PATH/api"
+  '
+
+  test_expect_success "'ipfs repo verify' passes after the crash ($mode)" '
+    ipfs repo verify
+  '
+
+  test_expect_success "the file can be added again ($mode)" '
+    HASH=$(ipfs add -q bigfile) &&
+    ipfs cat $HASH >bigfile_out &&
+    test_cmp bigfile bigfile_out &&
+    ipfs pin rm $HASH &&
+    ipfs repo gc >/dev/null
+  '
+}
+
+test_crash_add strict
+test_crash_add batch
+test_crash_add none
+
+test_expect_success "an unknown durability is rejected" '
+  ipfs config Datastore.Durability lazy &&
+  test_must_fail ipfs add -q bigfile 2>add_err &&
+  grep "invalid Datastore.Durability" add_err &&
+  ipfs config Datastore.Durability strict
+'
+
+test_done
@@ -104,6 +104,34 @@ test_expect_success 'Stop iptb' '
   iptb stop
 '
 
+# Test 'tiercid-nonleaf' strategy
+init_strategy 'tiercid-nonleaf'
+
+test_expect_success 'prepare test files' '
+  echo foo > f1 &&
+  random 1000000 42 > f2
+'
+
+test_expect_success 'add test objects' '
+  HASH_FOO=$(ipfsi 0 add -q --offline --pin=false f1) &&
+  HASH_BIG=$(ipfsi 0 add -q --offline f2) &&
+  HASH_LEAF=$(ipfsi 0 refs $HASH_BIG | head -1)
+'
+
+findprovs_empty '$HASH_FOO'
+findprovs_empty '$HASH_BIG'
+findprovs_empty '$HASH_LEAF'
+
+reprovide
+
+findprovs_empty '$HASH_FOO'
+findprovs_expect '$HASH_BIG' '$PEERID_0'
+findprovs_empty '$HASH_LEAF'
+
+test_expect_success 'Stop iptb' '
+  iptb stop
+'
+
 # Test reprovider working with ticking disabled
 test_expect_success 'init iptb' '
   iptb testbed create -type localipfs -force -count $NUM_NODES -init
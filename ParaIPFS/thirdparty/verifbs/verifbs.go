@@ -29,6 +29,15 @@ func (bs *VerifBSGC) PutMany(ctx context.Context, blks []blocks.Block) error {
 	return bs.GCBlockstore.PutMany(ctx, blks)
 }
 
+func (bs *VerifBSGC) PutManyParallel(ctx context.Context, blks []blocks.Block, concurrency int) error {
+	for _, b := range blks {
+		if err := verifcid.ValidateCid(b.Cid()); err != nil {
+			return err
+		}
+	}
+	return bs.GCBlockstore.PutManyParallel(ctx, blks, concurrency)
+}
+
 func (bs *VerifBSGC) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
 	if err := verifcid.ValidateCid(c); err != nil {
 		return nil, err
@@ -36,6 +45,15 @@ func (bs *VerifBSGC) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
 	return bs.GCBlockstore.Get(ctx, c)
 }
 
+func (bs *VerifBSGC) GetManyParallel(ctx context.Context, cs []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	for _, c := range cs {
+		if err := verifcid.ValidateCid(c); err != nil {
+			return nil, err
+		}
+	}
+	return bs.GCBlockstore.GetManyParallel(ctx, cs, concurrency)
+}
+
 type VerifBS struct {
 	bstore.Blockstore
 }
@@ -56,9 +74,27 @@ func (bs *VerifBS) PutMany(ctx context.Context, blks []blocks.Block) error {
 	return bs.Blockstore.PutMany(ctx, blks)
 }
 
+func (bs *VerifBS) PutManyParallel(ctx context.Context, blks []blocks.Block, concurrency int) error {
+	for _, b := range blks {
+		if err := verifcid.ValidateCid(b.Cid()); err != nil {
+			return err
+		}
+	}
+	return bs.Blockstore.PutManyParallel(ctx, blks, concurrency)
+}
+
 func (bs *VerifBS) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
 	if err := verifcid.ValidateCid(c); err != nil {
 		return nil, err
 	}
 	return bs.Blockstore.Get(ctx, c)
 }
+
+func (bs *VerifBS) GetManyParallel(ctx context.Context, cs []cid.Cid, concurrency int) ([]blocks.Block, error) {
+	for _, c := range cs {
+		if err := verifcid.ValidateCid(c); err != nil {
+			return nil, err
+		}
+	}
+	return bs.Blockstore.GetManyParallel(ctx, cs, concurrency)
+}